@@ -7,6 +7,7 @@ import (
 
 	"github.com/ejoffe/spr/config"
 	"github.com/ejoffe/spr/config/config_parser"
+	"github.com/ejoffe/spr/errs"
 	"github.com/ejoffe/spr/git/realgit"
 	"github.com/ejoffe/spr/github/githubclient"
 	"github.com/ejoffe/spr/spr"
@@ -47,26 +48,40 @@ func main() {
 		zerolog.SetGlobalLevel(zerolog.DebugLevel)
 	}
 
-	gitcmd := realgit.NewGitCmd(config.DefaultConfig())
+	gitcmd, err := realgit.NewGitCmd(config.DefaultConfig())
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
 	//  check that we are inside a git dir
-	var output string
-	err = gitcmd.Git("status --porcelain", &output)
+	ctx := context.Background()
+	output, err := gitcmd.Git(ctx, "status", "--porcelain")
 	if err != nil {
 		fmt.Println(output)
 		fmt.Println(err)
 		os.Exit(2)
 	}
 
-	ctx := context.Background()
-	cfg := config_parser.ParseConfig(gitcmd)
-	client := githubclient.NewGitHubClient(ctx, cfg)
-	gitcmd = realgit.NewGitCmd(cfg)
+	cfg, err := config_parser.ParseConfig(gitcmd)
+	exit(err)
+	client, err := githubclient.NewGitHubClient(ctx, cfg)
+	exit(err)
+	gitcmd, err = realgit.NewGitCmd(cfg)
+	exit(err)
 
 	sd := spr.NewStackedPR(cfg, client, gitcmd)
-	sd.AmendCommit(ctx)
+	exit(sd.AmendCommit(ctx))
 
 	if opts.Update {
-		sd.UpdatePullRequests(ctx, nil, nil)
+		exit(sd.UpdatePullRequests(ctx, nil, nil))
+	}
+}
+
+// exit exits with the code of the kind of err, when there is one
+func exit(err error) {
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		os.Exit(errs.ExitCode(err))
 	}
 }
 
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"os"
 	"strings"
@@ -13,7 +14,8 @@ import (
 
 func main() {
 	filename := os.Args[1]
-	gitcmd := realgit.NewGitCmd(config.DefaultConfig())
+	gitcmd, err := realgit.NewGitCmd(config.DefaultConfig())
+	check(err)
 	if !strings.HasSuffix(filename, "COMMIT_EDITMSG") {
 		readfile, err := os.Open(filename)
 		check(err)
@@ -33,8 +35,7 @@ func main() {
 		for _, line := range lines {
 			if strings.HasPrefix(line, "pick") {
 				res := strings.Split(line, " ")
-				var out string
-				gitcmd.Git("log --format=%B -n 1 "+res[1], &out)
+				out, _ := gitcmd.Git(context.Background(), "log", "--format=%B", "-n", "1", res[1])
 				if !strings.Contains(out, "commit-id") {
 					line = strings.Replace(line, "pick ", "reword ", 1)
 				}
@@ -1,17 +1,23 @@
 package main
 
 import (
-	"bufio"
 	"context"
 	"fmt"
 	"os"
+	"os/exec"
 	"strings"
 
 	"github.com/ejoffe/rake"
 	"github.com/ejoffe/spr/config"
 	"github.com/ejoffe/spr/config/config_parser"
+	"github.com/ejoffe/spr/errs"
 	"github.com/ejoffe/spr/git/realgit"
+	"github.com/ejoffe/spr/github"
+	"github.com/ejoffe/spr/github/bitbucketclient"
+	"github.com/ejoffe/spr/github/fakegithub"
+	"github.com/ejoffe/spr/github/giteaclient"
 	"github.com/ejoffe/spr/github/githubclient"
+	"github.com/ejoffe/spr/github/gitlabclient"
 	"github.com/ejoffe/spr/spr"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -38,65 +44,117 @@ func init() {
 }
 
 // handleEditSequence is an internal command used as a git sequence editor.
-// It rewrites 'pick <hash>' to 'edit <hash>' for a target commit in the rebase todo file.
-// Usage: spr _edit-sequence <commit-hash-prefix> <todo-file>
+// It replaces the rebase todo file with the todo list prepared by spr.
+// Usage: spr _edit-sequence <todo> <todo-file>
 func handleEditSequence() {
-	if len(os.Args) < 4 || os.Args[1] != "_edit-sequence" {
+	if len(os.Args) < 2 || os.Args[1] != spr.EditSequenceCommand {
 		return
 	}
-	hashPrefix := os.Args[2]
-	todoFile := os.Args[3]
-
-	data, err := os.ReadFile(todoFile)
+	err := spr.EditSequence(os.Args[2:])
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "error reading todo file: %s\n", err)
+		fmt.Fprintf(os.Stderr, "error writing todo file: %s\n", err)
 		os.Exit(1)
 	}
+	os.Exit(0)
+}
 
-	scanner := bufio.NewScanner(strings.NewReader(string(data)))
-	var lines []string
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.HasPrefix(line, "pick "+hashPrefix) {
-			line = strings.Replace(line, "pick ", "edit ", 1)
-		}
-		lines = append(lines, line)
+// handleSandbox runs 'spr sandbox', which needs neither a git repository nor
+// a GitHub token. It starts a fake GitHub server serving a throwaway
+// repository and opens a shell in a clone of it.
+func handleSandbox() {
+	if len(os.Args) < 2 || os.Args[1] != "sandbox" {
+		return
 	}
-
-	err = os.WriteFile(todoFile, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+	err := runSandbox()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "error writing todo file: %s\n", err)
+		fmt.Fprintf(os.Stderr, "error running sandbox: %s\n", err)
 		os.Exit(1)
 	}
 	os.Exit(0)
 }
 
+// runSandbox returns when the sandbox shell exits, everything is removed.
+func runSandbox() error {
+	dir, err := os.MkdirTemp("", "spr-sandbox-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	sb, err := fakegithub.NewSandbox(dir)
+	if err != nil {
+		return err
+	}
+	defer sb.Close()
+
+	fmt.Printf("spr sandbox : fake GitHub server listening on %s\n", sb.URL)
+	fmt.Printf("  a stack of 3 commits is ready in %s\n", sb.WorkDir)
+	fmt.Println("  try 'spr update', 'spr status' and 'spr merge', exit the shell to clean up")
+
+	shell := os.Getenv("SHELL")
+	if shell == "" {
+		shell = "/bin/sh"
+	}
+	cmd := exec.Command(shell)
+	cmd.Dir = sb.WorkDir
+	cmd.Env = append(os.Environ(), "GITHUB_TOKEN=sandbox")
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	// the exit status of the last command run in the shell doesn't matter
+	cmd.Run()
+	return nil
+}
+
 func main() {
 	// Handle internal _edit-sequence command before any git/config initialization.
 	// This is invoked by git as a sequence editor during 'spr edit'.
 	handleEditSequence()
+	handleSandbox()
 
-	gitcmd := realgit.NewGitCmd(config.DefaultConfig())
+	initcmd, err := realgit.NewGitCmd(config.DefaultConfig())
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
 	//  check that we are inside a git dir
-	var output string
-	err := gitcmd.Git("status --porcelain", &output)
+	output, err := initcmd.Git(context.Background(), "status", "--porcelain")
 	if err != nil {
 		fmt.Println(output)
 		fmt.Println(err)
 		os.Exit(2)
 	}
 
-	cfg := config_parser.ParseConfig(gitcmd)
+	cfg, err := config_parser.ParseConfig(initcmd)
+	if err != nil {
+		exit(err)
+	}
 
 	err = config_parser.CheckConfig(cfg)
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(2)
 	}
-	gitcmd = realgit.NewGitCmd(cfg)
+	gitcmd, err := realgit.NewGitInterface(cfg)
+	if err != nil {
+		exit(err)
+	}
 
 	ctx := context.Background()
-	client := githubclient.NewGitHubClient(ctx, cfg)
+	var client github.GitHubInterface
+	switch cfg.Repo.Forge {
+	case config.ForgeGitLab:
+		client, err = gitlabclient.NewGitLabClient(ctx, cfg)
+	case config.ForgeGitea:
+		client, err = giteaclient.NewGiteaClient(ctx, cfg)
+	case config.ForgeBitbucket:
+		client, err = bitbucketclient.NewBitbucketClient(ctx, cfg)
+	default:
+		client, err = githubclient.NewGitHubClient(ctx, cfg)
+	}
+	if err != nil {
+		exit(err)
+	}
 	stackedpr := spr.NewStackedPR(cfg, client, gitcmd)
 
 	detailFlag := &cli.BoolFlag{
@@ -112,6 +170,52 @@ func main() {
 		Usage:   "Show plain text output (URL : title)",
 	}
 
+	stackFlag := &cli.StringFlag{
+		Name:  "stack",
+		Usage: "Operate on the stack of the given local branch instead of the checked out branch",
+	}
+
+	targetFlag := &cli.StringFlag{
+		Name:  "target",
+		Usage: "Branch the pull requests are merged into (defaults to the stack's upstream branch)",
+	}
+
+	selectStack := func(c *cli.Context) error {
+		if c.IsSet("stack") {
+			err := stackedpr.SelectStack(c.String("stack"))
+			if err != nil {
+				return err
+			}
+			err = stackedpr.SelectTarget("")
+			if err != nil {
+				return err
+			}
+		}
+		if c.IsSet("target") {
+			return stackedpr.SelectTarget(c.String("target"))
+		}
+		return nil
+	}
+
+	// selectWritableStack selects the stack like selectStack and rejects
+	//  read-only checkouts of pull requests
+	selectWritableStack := func(c *cli.Context) error {
+		err := selectStack(c)
+		if err != nil {
+			return err
+		}
+		return stackedpr.CheckWritable(ctx)
+	}
+
+	// checkWritableOnUpdate rejects read-only checkouts of pull requests
+	//  before commands run with --update change the stack
+	checkWritableOnUpdate := func(c *cli.Context) error {
+		if !c.Bool("update") {
+			return nil
+		}
+		return stackedpr.CheckWritable(ctx)
+	}
+
 	cli.AppHelpTemplate = `NAME:
    {{.Name}} - {{.Usage}}
 
@@ -176,32 +280,157 @@ VERSION: fork of {{.Version}}
 				cfg.User.LogGitCommands = true
 				cfg.User.LogGitHubCalls = true
 			}
-			client.MaybeStar(ctx, cfg)
-			return nil
+			if starrer, ok := client.(interface {
+				MaybeStar(context.Context, *config.Config)
+			}); ok {
+				starrer.MaybeStar(ctx, cfg)
+			}
+			return stackedpr.SelectTarget("")
 		},
 		Commands: []*cli.Command{
 			{
 				Name:    "status",
 				Aliases: []string{"s", "st"},
 				Usage:   "Show status of open pull requests",
-			Action: func(c *cli.Context) error {
-				if c.IsSet("text") {
-					stackedpr.TextEnabled = true
-				}
-				stackedpr.StatusPullRequests(ctx)
-				return nil
-			},
+				Before:  selectStack,
+				Action: func(c *cli.Context) error {
+					if c.IsSet("text") {
+						stackedpr.TextEnabled = true
+					}
+					if c.IsSet("format") {
+						stackedpr.OutputFormat = c.String("format")
+					}
+					if c.IsSet("json") {
+						stackedpr.OutputFormat = spr.OutputFormatJSON
+					}
+					return stackedpr.StatusPullRequests(ctx)
+				},
 				Flags: []cli.Flag{
 					detailFlag,
 					textFlag,
+					stackFlag,
+					targetFlag,
+					&cli.BoolFlag{
+						Name:  "json",
+						Value: false,
+						Usage: "Show machine readable json output (same as --format=json)",
+					},
+					&cli.StringFlag{
+						Name:  "format",
+						Usage: "Show machine readable output in the given format (json, yaml)",
+					},
+				},
+			},
+			{
+				Name:      "why",
+				Usage:     "Explain why a pull request is not mergeable",
+				ArgsUsage: "<pr#|position>",
+				Before:    selectStack,
+				Action: func(c *cli.Context) error {
+					if c.NArg() != 1 {
+						return errs.New(errs.Validation, "expected a pull request number or stack position")
+					}
+					return stackedpr.ExplainPullRequest(ctx, c.Args().First())
+				},
+				Flags: []cli.Flag{
+					stackFlag,
+					targetFlag,
+				},
+			},
+			{
+				Name:      "checkout",
+				Aliases:   []string{"co"},
+				Usage:     "Check out a pull request and the pull requests below it on a read-only branch",
+				ArgsUsage: "<pr#>",
+				Before:    selectStack,
+				Action: func(c *cli.Context) error {
+					if c.NArg() != 1 {
+						return errs.New(errs.Validation, "expected a pull request number")
+					}
+					return stackedpr.CheckoutStack(ctx, c.Args().First(), c.String("branch"))
+				},
+				Flags: []cli.Flag{
+					targetFlag,
+					&cli.StringFlag{
+						Name:    "branch",
+						Aliases: []string{"b"},
+						Usage:   "Name of the new local branch, defaults to pr-<pr#>",
+					},
+				},
+			},
+			{
+				Name:      "adopt",
+				Usage:     "Check out the stack of a pull request opened by another user to update and merge it",
+				ArgsUsage: "<pr#>",
+				Before:    selectStack,
+				Action: func(c *cli.Context) error {
+					if c.NArg() != 1 {
+						return errs.New(errs.Validation, "expected a pull request number")
+					}
+					return stackedpr.AdoptStack(ctx, c.Args().First(), c.String("branch"))
+				},
+				Flags: []cli.Flag{
+					targetFlag,
+					&cli.StringFlag{
+						Name:    "branch",
+						Aliases: []string{"b"},
+						Usage:   "Name of the new local branch, defaults to stack-<pr#> of the top pull request",
+					},
+				},
+			},
+			{
+				Name:  "stacks",
+				Usage: "Show all local stacks and the status of their pull requests",
+				Action: func(c *cli.Context) error {
+					stackedpr.AllStacks = c.Bool("all")
+					return stackedpr.ListStacks(ctx)
+				},
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:    "all",
+						Aliases: []string{"a"},
+						Usage:   "Also show remote stacks opened by any user, including stacks without a local branch",
+					},
+				},
+			},
+			{
+				Name:  "undo",
+				Usage: "Undo the last update or amend, restoring the local branch, the pull request branches and the pull requests",
+				Action: func(c *cli.Context) error {
+					return stackedpr.Undo(ctx)
+				},
+			},
+			{
+				Name:  "log",
+				Usage: "Show the history of spr operations in this repository",
+				Action: func(c *cli.Context) error {
+					if c.IsSet("json") {
+						stackedpr.OutputFormat = spr.OutputFormatJSON
+					}
+					return stackedpr.PrintLog(c.Int("count"), c.Bool("calls"))
+				},
+				Flags: []cli.Flag{
+					&cli.IntFlag{
+						Name:    "count",
+						Aliases: []string{"c"},
+						Value:   20,
+						Usage:   "Show the given number of most recent operations, 0 shows all of them",
+					},
+					&cli.BoolFlag{
+						Name:  "calls",
+						Usage: "Also show the git commands and GitHub calls made by each operation",
+					},
+					&cli.BoolFlag{
+						Name:  "json",
+						Usage: "Show the log as json, one operation per line",
+					},
 				},
 			},
 			{
 				Name:  "sync",
 				Usage: "Synchronize local stack with remote",
 				Action: func(c *cli.Context) error {
-					stackedpr.SyncStack(ctx)
-					return nil
+					return stackedpr.SyncStack(ctx)
 				},
 			},
 			{
@@ -214,7 +443,7 @@ VERSION: fork of {{.Version}}
 					cfg.User.NoRebase = c.Bool("no-rebase")
 				}
 				if c.IsSet("fetch") && c.IsSet("no-fetch") {
-					return fmt.Errorf("cannot use both --fetch and --no-fetch")
+					return errs.New(errs.Validation, "cannot use both --fetch and --no-fetch")
 				}
 				if c.IsSet("fetch") {
 					cfg.User.NoFetch = !c.Bool("fetch")
@@ -222,16 +451,26 @@ VERSION: fork of {{.Version}}
 				if c.IsSet("no-fetch") {
 					cfg.User.NoFetch = c.Bool("no-fetch")
 				}
-				return nil
+				return selectWritableStack(c)
 			},
 				Action: func(c *cli.Context) error {
+					if c.Bool("continue") && c.Bool("abort") {
+						return errs.New(errs.Validation, "cannot use both --continue and --abort")
+					}
+					if c.Bool("continue") {
+						return stackedpr.ContinueUpdate(ctx)
+					}
+					if c.Bool("abort") {
+						return stackedpr.AbortUpdate()
+					}
+					if c.IsSet("dry-run") {
+						stackedpr.DryRun = c.Bool("dry-run")
+					}
 					if c.IsSet("count") {
 						count := c.Uint("count")
-						stackedpr.UpdatePullRequests(ctx, c.StringSlice("reviewer"), &count)
-					} else {
-						stackedpr.UpdatePullRequests(ctx, c.StringSlice("reviewer"), nil)
+						return stackedpr.UpdatePullRequests(ctx, c.StringSlice("reviewer"), &count)
 					}
-					return nil
+					return stackedpr.UpdatePullRequests(ctx, c.StringSlice("reviewer"), nil)
 				},
 				Flags: []cli.Flag{
 					detailFlag,
@@ -245,6 +484,20 @@ VERSION: fork of {{.Version}}
 						Aliases: []string{"c"},
 						Usage:   "Update a specified number of pull requests from the bottom of the stack",
 					},
+					&cli.BoolFlag{
+						Name:  "dry-run",
+						Usage: "Show the planned changes without pushing branches or updating pull requests",
+					},
+					&cli.BoolFlag{
+						Name:  "continue",
+						Usage: "Finish an update which was interrupted",
+					},
+					&cli.BoolFlag{
+						Name:  "abort",
+						Usage: "Drop an update which was interrupted, leaving the pull requests as they are",
+					},
+					stackFlag,
+					targetFlag,
 				&cli.BoolFlag{
 					Name:    "no-rebase",
 					Aliases: []string{"nr"},
@@ -268,16 +521,18 @@ VERSION: fork of {{.Version}}
 				},
 			},
 			{
-				Name:  "merge",
-				Usage: "Merge all mergeable pull requests",
+				Name:   "merge",
+				Usage:  "Merge all mergeable pull requests",
+				Before: selectWritableStack,
 				Action: func(c *cli.Context) error {
+					if c.IsSet("dry-run") {
+						stackedpr.DryRun = c.Bool("dry-run")
+					}
 					if c.IsSet("count") {
 						count := c.Uint("count")
-						stackedpr.MergePullRequests(ctx, &count)
-					} else {
-						stackedpr.MergePullRequests(ctx, nil)
+						return stackedpr.MergePullRequests(ctx, &count)
 					}
-					return nil
+					return stackedpr.MergePullRequests(ctx, nil)
 				},
 				Flags: []cli.Flag{
 					detailFlag,
@@ -286,6 +541,12 @@ VERSION: fork of {{.Version}}
 						Aliases: []string{"c"},
 						Usage:   "Merge a specified number of pull requests from the bottom of the stack",
 					},
+					&cli.BoolFlag{
+						Name:  "dry-run",
+						Usage: "Show which pull requests would be merged and closed without merging",
+					},
+					stackFlag,
+					targetFlag,
 				},
 			},
 		{
@@ -299,12 +560,13 @@ VERSION: fork of {{.Version}}
 					Usage:   "Run spr update after amend",
 				},
 			},
+			Before: checkWritableOnUpdate,
 			Action: func(c *cli.Context) error {
-				stackedpr.AmendCommit(ctx)
-				if c.Bool("update") {
-					stackedpr.UpdatePullRequests(ctx, nil, nil)
+				err := stackedpr.AmendCommit(ctx)
+				if err != nil || !c.Bool("update") {
+					return err
 				}
-				return nil
+				return stackedpr.UpdatePullRequests(ctx, nil, nil)
 			},
 		},
 		{
@@ -327,23 +589,143 @@ VERSION: fork of {{.Version}}
 					Usage: "Abort the current edit session",
 				},
 			},
+			Before: checkWritableOnUpdate,
 			Action: func(c *cli.Context) error {
 				if c.Bool("abort") {
-					stackedpr.EditCommitAbort(ctx)
+					return stackedpr.EditCommitAbort(ctx)
 				} else if c.Bool("done") {
-					stackedpr.EditCommitDone(ctx, c.Bool("update"))
-				} else {
-					stackedpr.EditCommit(ctx)
+					return stackedpr.EditCommitDone(ctx, c.Bool("update"))
+				}
+				return stackedpr.EditCommit(ctx)
+			},
+		},
+		{
+			Name:      "move",
+			Usage:     "Move a commit of the stack below or above another commit and update the pull requests",
+			ArgsUsage: "<commit> --before|--after <commit>",
+			Before:    selectWritableStack,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "before",
+					Usage: "Move the commit right below this commit",
+				},
+				&cli.StringFlag{
+					Name:  "after",
+					Usage: "Move the commit right above this commit",
+				},
+				&cli.BoolFlag{
+					Name:  "no-update",
+					Usage: "Only rewrite the local stack, leaving the pull requests as they are",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				args, err := commandArgs(c)
+				if err != nil {
+					return err
+				}
+				if len(args) != 1 || c.IsSet("before") == c.IsSet("after") {
+					return errs.New(errs.Validation, "usage: spr move <commit> --before|--after <commit>, "+
+						"a commit is a stack position, a commit-id, a commit hash or #<pull request number>")
+				}
+				target := c.String("before")
+				if c.IsSet("after") {
+					target = c.String("after")
+				}
+				err = stackedpr.MoveCommit(ctx, args[0], target, c.IsSet("after"))
+				if err != nil || c.Bool("no-update") {
+					return err
 				}
-				return nil
+				return stackedpr.UpdatePullRequests(ctx, nil, nil)
+			},
+		},
+		{
+			Name:      "split",
+			Usage:     "Split a commit of the stack into several commits, each with its own pull request",
+			ArgsUsage: "<commit> [--piece <globs>...] | --commit [-m <subject>] [<glob>...] | --done | --abort",
+			Before:    selectWritableStack,
+			Flags: []cli.Flag{
+				&cli.StringSliceFlag{
+					Name:  "piece",
+					Usage: "Split off the changes to the files matching these space separated globs as a new commit, repeat for each new commit",
+				},
+				&cli.BoolFlag{
+					Name:  "commit",
+					Usage: "Commit the staged changes, or the files matching the globs given as arguments, as a new commit",
+				},
+				&cli.StringFlag{
+					Name:    "message",
+					Aliases: []string{"m"},
+					Usage:   "Subject of the new commit (use with --commit)",
+				},
+				&cli.BoolFlag{
+					Name:  "done",
+					Usage: "Commit the changes left as the split commit and restore the stack",
+				},
+				&cli.BoolFlag{
+					Name:    "update",
+					Aliases: []string{"u"},
+					Usage:   "Run spr update after finishing the split (use with --done or --piece)",
+				},
+				&cli.BoolFlag{
+					Name:  "abort",
+					Usage: "Abort the current split session",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				args, err := commandArgs(c)
+				if err != nil {
+					return err
+				}
+				switch {
+				case c.Bool("abort"):
+					return stackedpr.SplitAbort(ctx)
+				case c.Bool("done"):
+					return stackedpr.SplitDone(ctx, c.Bool("update"))
+				case c.Bool("commit"):
+					return stackedpr.SplitCommitPiece(ctx, c.String("message"), args)
+				}
+				if len(args) != 1 {
+					return errs.New(errs.Validation, "usage: spr split <commit>, "+
+						"a commit is a stack position, a commit-id, a commit hash or #<pull request number>")
+				}
+				err = stackedpr.SplitCommit(ctx, args[0], c.StringSlice("piece"))
+				if err != nil || !c.IsSet("piece") || !c.Bool("update") {
+					return err
+				}
+				return stackedpr.UpdatePullRequests(ctx, nil, nil)
+			},
+		},
+		{
+			Name:   "reorder",
+			Usage:  "Reorder, fold and drop the commits of the stack in an editor and update the pull requests",
+			Before: selectWritableStack,
+			Flags: []cli.Flag{
+				&cli.BoolFlag{
+					Name:  "no-update",
+					Usage: "Only rewrite the local stack, leaving the pull requests as they are",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				err := stackedpr.ReorderStack(ctx)
+				if err != nil || c.Bool("no-update") {
+					return err
+				}
+				return stackedpr.UpdatePullRequests(ctx, nil, nil)
+			},
+		},
+		{
+			Name:   "ui",
+			Usage:  "Manage the stack in a full screen terminal interface",
+			Before: selectWritableStack,
+			Action: func(c *cli.Context) error {
+				return stackedpr.RunUI(ctx)
 			},
 		},
 		{
 			Name:  "check",
 			Usage: "Run pre merge checks (configured by MergeCheck in repository config)",
 			Action: func(c *cli.Context) error {
-				stackedpr.RunMergeCheck(ctx)
-				return nil
+				return stackedpr.RunMergeCheck(ctx)
 			},
 		},
 			{
@@ -355,12 +737,78 @@ VERSION: fork of {{.Version}}
 			},
 		},
 		After: func(c *cli.Context) error {
+			if c.IsSet("verbose") {
+				if limited, ok := client.(interface {
+					RateLimit() (githubclient.RateLimit, bool)
+				}); ok {
+					if rateLimit, ok := limited.RateLimit(); ok {
+						fmt.Printf("> github rate limit : %s\n", rateLimit)
+					}
+				}
+			}
 			if c.IsSet("profile") {
-				stackedpr.ProfilingSummary()
+				return stackedpr.ProfilingSummary()
 			}
 			return nil
 		},
 	}
 
-	app.Run(os.Args)
+	err = app.Run(os.Args)
+	if err != nil {
+		exit(err)
+	}
+}
+
+// exit prints err and exits with the code of its kind, so scripts can tell
+//
+//	an auth failure or a rate limit from a conflict they have to resolve.
+func exit(err error) {
+	fmt.Fprintf(os.Stderr, "error: %s\n", err)
+	os.Exit(errs.ExitCode(err))
+}
+
+// commandArgs returns the arguments of the command, setting the flags which
+//
+//	follow them: cli stops parsing flags at the first argument, so a command
+//	like spr move 3 --before 1 gets its flags as arguments.
+func commandArgs(c *cli.Context) ([]string, error) {
+	var args []string
+	rest := c.Args().Slice()
+	for i := 0; i < len(rest); i++ {
+		arg := rest[i]
+		if arg == "--" {
+			args = append(args, rest[i+1:]...)
+			break
+		}
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			args = append(args, arg)
+			continue
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		var flag cli.Flag
+		for _, f := range c.Command.Flags {
+			for _, n := range f.Names() {
+				if n == name {
+					flag = f
+				}
+			}
+		}
+		if flag == nil {
+			return nil, errs.New(errs.Validation, "flag provided but not defined: %s", arg)
+		}
+		if _, isBool := flag.(*cli.BoolFlag); isBool && !hasValue {
+			value = "true"
+		} else if !hasValue {
+			if i+1 == len(rest) {
+				return nil, errs.New(errs.Validation, "flag needs an argument: %s", arg)
+			}
+			i++
+			value = rest[i]
+		}
+		err := c.Set(flag.Names()[0], value)
+		if err != nil {
+			return nil, errs.Wrap(errs.Validation, err)
+		}
+	}
+	return args, nil
 }
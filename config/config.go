@@ -12,6 +12,10 @@ type Config struct {
 	Repo  *RepoConfig
 	User  *UserConfig
 	State *InternalState
+
+	// Stack is the local branch holding the stack of commits spr operates on,
+	//  when empty the currently checked out branch is used. It is not persisted.
+	Stack string
 }
 
 // Config object to hold spr configuration
@@ -23,6 +27,13 @@ type RepoConfig struct {
 	GitHubRemote string `default:"origin" yaml:"githubRemote"`
 	GitHubBranch string `default:"main" yaml:"githubBranch"`
 
+	// TargetBranches are integration branches besides githubBranch, a local
+	//  branch of the same name tracking one of them targets it
+	TargetBranches []string `yaml:"targetBranches,omitempty"`
+
+	// Forge is the code hosting backend : github, gitlab, gitea or bitbucket
+	Forge string `default:"github" yaml:"forge"`
+
 	RequireChecks    bool     `default:"true" yaml:"requireChecks"`
 	RequiredChecks   []string `yaml:"requiredChecks"`
 	RequireApproval  bool     `default:"true" yaml:"requireApproval"`
@@ -44,6 +55,30 @@ type RepoConfig struct {
 	BranchPushIndividually bool `default:"false" yaml:"branchPushIndividually"`
 }
 
+const (
+	// ForgeGitHub is GitHub or GitHub Enterprise
+	ForgeGitHub = "github"
+
+	// ForgeGitLab is gitlab.com or a self-hosted GitLab
+	ForgeGitLab = "gitlab"
+
+	// ForgeGitea is a Gitea or Forgejo instance, including codeberg.org
+	ForgeGitea = "gitea"
+
+	// ForgeBitbucket is Bitbucket Server or Data Center, it is never
+	// detected from the remote and must be configured.
+	ForgeBitbucket = "bitbucket"
+)
+
+const (
+	// GitBackendCLI runs every git command with the git executable
+	GitBackendCLI = "cli"
+
+	// GitBackendGoGit reads logs, refs and status and pushes in process with
+	// go-git, only the commands go-git can't run use the git executable.
+	GitBackendGoGit = "go-git"
+)
+
 type UserConfig struct {
 	ShowPRLink       bool `default:"true" yaml:"showPRLink"`
 	LogGitCommands   bool `default:"true" yaml:"logGitCommands"`
@@ -59,6 +94,9 @@ type UserConfig struct {
 	ShortPRLink          bool `default:"false" yaml:"shortPRLink"`
 	ShowCommitID         bool `default:"false" yaml:"showCommitID"`
 	BranchPrefix         string `default:"spr" yaml:"branchPrefix"`
+
+	// GitBackend runs git commands with the git cli or go-git
+	GitBackend string `default:"cli" yaml:"gitBackend"`
 }
 
 type InternalState struct {
@@ -6,50 +6,66 @@ import (
 	"os"
 	"path"
 	"path/filepath"
-	"strings"
 
 	"github.com/ejoffe/rake"
 	"github.com/ejoffe/spr/config"
+	"github.com/ejoffe/spr/errs"
 	"github.com/ejoffe/spr/git"
 )
 
-func ParseConfig(gitcmd git.GitInterface) *config.Config {
+// ParseConfig loads the repository, user and internal state configuration,
+//
+//	creating the configuration files which don't exist yet.
+func ParseConfig(gitcmd git.GitInterface) (*config.Config, error) {
 	cfg := config.EmptyConfig()
 
+	remoteSource := NewGitHubRemoteSource(cfg, gitcmd)
+	remoteBranchSource := NewRemoteBranchSource(gitcmd)
 	rake.LoadSources(cfg.Repo,
 		rake.DefaultSource(),
-		NewGitHubRemoteSource(cfg, gitcmd),
+		remoteSource,
 		rake.YamlFileSource(RepoConfigFilePath(gitcmd)),
-		NewRemoteBranchSource(gitcmd),
+		remoteBranchSource,
 	)
+	if remoteSource.err != nil {
+		return nil, remoteSource.err
+	}
+	if remoteBranchSource.err != nil {
+		return nil, remoteBranchSource.err
+	}
 	if cfg.Repo.GitHubHost == "" {
-		fmt.Println("unable to auto configure repository host - must be set manually in .spr.yml")
-		os.Exit(2)
+		return nil, errs.New(errs.Validation, "unable to auto configure repository host - must be set manually in .spr.yml")
 	}
 	if cfg.Repo.GitHubRepoOwner == "" {
-		fmt.Println("unable to auto configure repository owner - must be set manually in .spr.yml")
-		os.Exit(3)
+		return nil, errs.New(errs.Validation, "unable to auto configure repository owner - must be set manually in .spr.yml")
 	}
-
 	if cfg.Repo.GitHubRepoName == "" {
-		fmt.Println("unable to auto configure repository name - must be set manually in .spr.yml")
-		os.Exit(4)
+		return nil, errs.New(errs.Validation, "unable to auto configure repository name - must be set manually in .spr.yml")
+	}
+
+	userConfigPath, err := UserConfigFilePath()
+	if err != nil {
+		return nil, err
+	}
+	internalConfigPath, err := InternalConfigFilePath()
+	if err != nil {
+		return nil, err
 	}
 
 	rake.LoadSources(cfg.User,
 		rake.DefaultSource(),
-		rake.YamlFileSource(UserConfigFilePath()),
+		rake.YamlFileSource(userConfigPath),
 	)
 
 	rake.LoadSources(cfg.State,
 		rake.DefaultSource(),
-		rake.YamlFileSource(InternalConfigFilePath()),
+		rake.YamlFileSource(internalConfigPath),
 	)
 
 	cfg.State.RunCount = cfg.State.RunCount + 1
 
 	rake.LoadSources(cfg.State,
-		rake.YamlFileWriter(InternalConfigFilePath()))
+		rake.YamlFileWriter(internalConfigPath))
 
 	// init case : if yaml config files not found : create them
 	if _, err := os.Stat(RepoConfigFilePath(gitcmd)); errors.Is(err, os.ErrNotExist) {
@@ -57,20 +73,39 @@ func ParseConfig(gitcmd git.GitInterface) *config.Config {
 			rake.YamlFileWriter(RepoConfigFilePath(gitcmd)))
 	}
 
-	if _, err := os.Stat(UserConfigFilePath()); errors.Is(err, os.ErrNotExist) {
+	if _, err := os.Stat(userConfigPath); errors.Is(err, os.ErrNotExist) {
 		rake.LoadSources(cfg.User,
-			rake.YamlFileWriter(UserConfigFilePath()))
+			rake.YamlFileWriter(userConfigPath))
 	}
 
 	// Normalize config (e.g., set PRTemplateType to "custom" if PRTemplatePath is provided)
 	cfg.Normalize()
 
-	return cfg
+	return cfg, nil
 }
 
+// CheckConfig returns an error when the target branch can't be used for
+//
+//	pull request branches. Pull request branch names embed the target branch,
+//	so it must be parsed back as is from them.
 func CheckConfig(cfg *config.Config) error {
-	if strings.Contains(cfg.Repo.GitHubBranch, "/") {
-		return errors.New("Remote branch name must not contain backslashes '/'")
+	if cfg.Repo.GitHubBranch == "" {
+		return errors.New("target branch must be set, configure githubBranch in .spr.yml")
+	}
+	branchName := git.BranchNameFromCommit(cfg, git.Commit{CommitID: "00000000"})
+	matches := git.BranchNameRegex(cfg.User.BranchPrefix).FindStringSubmatch(branchName)
+	if matches == nil || matches[1] != cfg.Repo.GitHubBranch {
+		return fmt.Errorf("unsupported target branch name %q", cfg.Repo.GitHubBranch)
+	}
+	switch cfg.Repo.Forge {
+	case config.ForgeGitHub, config.ForgeGitLab, config.ForgeGitea, config.ForgeBitbucket:
+	default:
+		return fmt.Errorf("unsupported forge %q, configure forge in .spr.yml", cfg.Repo.Forge)
+	}
+	switch cfg.User.GitBackend {
+	case "", config.GitBackendCLI, config.GitBackendGoGit:
+	default:
+		return fmt.Errorf("unsupported git backend %q, configure gitBackend in ~/.spr.yml", cfg.User.GitBackend)
 	}
 	return nil
 }
@@ -81,16 +116,20 @@ func RepoConfigFilePath(gitcmd git.GitInterface) string {
 	return filepath
 }
 
-func UserConfigFilePath() string {
+func UserConfigFilePath() (string, error) {
 	rootdir, err := os.UserHomeDir()
-	check(err)
+	if err != nil {
+		return "", errs.New(errs.Validation, "unable to locate the user config : %w", err)
+	}
 	filepath := filepath.Clean(path.Join(rootdir, ".spr.yml"))
-	return filepath
+	return filepath, nil
 }
 
-func InternalConfigFilePath() string {
+func InternalConfigFilePath() (string, error) {
 	rootdir, err := os.UserHomeDir()
-	check(err)
+	if err != nil {
+		return "", errs.New(errs.Validation, "unable to locate the internal state : %w", err)
+	}
 	filepath := filepath.Clean(path.Join(rootdir, ".spr.state"))
-	return filepath
+	return filepath, nil
 }
@@ -44,6 +44,11 @@ func TestGetRepoDetailsFromRemote(t *testing.T) {
 
 		// GitHub names are case-sensitive
 		{"origin  https://github.com/R2/D2.git (push)", "github.com", "R2", "D2", true},
+
+		// GitLab projects can be nested in subgroups
+		{"origin  git@gitlab.com:group/d2.git (push)", "gitlab.com", "group", "d2", true},
+		{"origin  git@gitlab.com:group/sub.group/d2.git (push)", "gitlab.com", "group/sub.group", "d2", true},
+		{"origin  https://gitlab.example.com/a/b/c/d2 (push)", "gitlab.example.com", "a/b/c", "d2", true},
 	}
 	for i, testCase := range testCases {
 		t.Logf("Testing %v %q", i, testCase.remote)
@@ -72,6 +77,7 @@ func TestGitHubRemoteSource(t *testing.T) {
 			GitHubRepoOwner: "r2",
 			GitHubRepoName:  "d2",
 			GitHubHost:      "github.com",
+			Forge:           "github",
 			RequireChecks:   false,
 			RequireApproval: false,
 			MergeMethod:     "",
@@ -93,3 +99,83 @@ func TestGitHubRemoteSource(t *testing.T) {
 	assert.Equal(t, expect, actual)
 	mock.ExpectationsMet()
 }
+
+func TestCheckConfig(t *testing.T) {
+	tests := []struct {
+		branch  string
+		forge   string
+		backend string
+		valid   bool
+	}{
+		{branch: "main", valid: true},
+		{branch: "release/2026.10", valid: true},
+		{branch: "team/payments", valid: true},
+		{branch: "", valid: false},
+		{branch: "feature+x", valid: false},
+		{branch: "main", forge: config.ForgeGitLab, valid: true},
+		{branch: "main", forge: config.ForgeGitea, valid: true},
+		{branch: "main", forge: config.ForgeBitbucket, valid: true},
+		{branch: "main", forge: "sourceforge", valid: false},
+		{branch: "main", backend: config.GitBackendCLI, valid: true},
+		{branch: "main", backend: config.GitBackendGoGit, valid: true},
+		{branch: "main", backend: "libgit2", valid: false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.branch+"@"+tc.forge+"+"+tc.backend, func(t *testing.T) {
+			cfg := config.EmptyConfig()
+			cfg.User.BranchPrefix = "spr"
+			cfg.Repo.GitHubBranch = tc.branch
+			cfg.Repo.Forge = config.ForgeGitHub
+			if tc.forge != "" {
+				cfg.Repo.Forge = tc.forge
+			}
+			cfg.User.GitBackend = tc.backend
+			err := CheckConfig(cfg)
+			if tc.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestGitLabRemoteSource(t *testing.T) {
+	mock := mockgit.NewMockGit(t)
+	mock.ExpectRemote("git@gitlab.example.com:platform/tools/d2.git")
+
+	actual := config.Config{
+		Repo: &config.RepoConfig{Forge: config.ForgeGitHub},
+		User: &config.UserConfig{},
+	}
+	source := NewGitHubRemoteSource(&actual, mock)
+	source.Load(nil)
+	assert.Equal(t, "gitlab.example.com", actual.Repo.GitHubHost)
+	assert.Equal(t, "platform/tools", actual.Repo.GitHubRepoOwner)
+	assert.Equal(t, "d2", actual.Repo.GitHubRepoName)
+	assert.Equal(t, config.ForgeGitLab, actual.Repo.Forge)
+	mock.ExpectationsMet()
+}
+
+func TestForgeFromHost(t *testing.T) {
+	tests := []struct {
+		host  string
+		forge string
+		found bool
+	}{
+		{host: "github.com", forge: config.ForgeGitHub, found: true},
+		{host: "github.example.com", forge: config.ForgeGitHub, found: true},
+		{host: "gitlab.com", forge: config.ForgeGitLab, found: true},
+		{host: "gitea.example.com", forge: config.ForgeGitea, found: true},
+		{host: "forgejo.internal", forge: config.ForgeGitea, found: true},
+		{host: "codeberg.org", forge: config.ForgeGitea, found: true},
+		{host: "git.example.com", found: false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.host, func(t *testing.T) {
+			forge, found := forgeFromHost(tc.host)
+			assert.Equal(t, tc.forge, forge)
+			assert.Equal(t, tc.found, found)
+		})
+	}
+}
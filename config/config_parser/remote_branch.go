@@ -1,6 +1,8 @@
 package config_parser
 
 import (
+	"context"
+	"fmt"
 	"regexp"
 
 	"github.com/ejoffe/spr/config"
@@ -9,6 +11,9 @@ import (
 
 type remoteBranch struct {
 	gitcmd git.GitInterface
+
+	// err is the error of the last Load, rake sources can't return one
+	err error
 }
 
 func NewRemoteBranchSource(gitcmd git.GitInterface) *remoteBranch {
@@ -20,9 +25,11 @@ func NewRemoteBranchSource(gitcmd git.GitInterface) *remoteBranch {
 var _remoteBranchRegex = regexp.MustCompile(`^## ([a-zA-Z0-9_\-/\.]+)\.\.\.([a-zA-Z0-9_\-\.]+)/([a-zA-Z0-9_\-/\.]+)`)
 
 func (s *remoteBranch) Load(cfg interface{}) {
-	var output string
-	err := s.gitcmd.Git("status -b --porcelain -u no", &output)
-	check(err)
+	output, err := s.gitcmd.Git(context.Background(), "status", "-b", "--porcelain", "-u", "no")
+	if err != nil {
+		s.err = fmt.Errorf("unable to read the upstream branch : %w", err)
+		return
+	}
 
 	matches := _remoteBranchRegex.FindStringSubmatch(output)
 	if matches == nil {
@@ -1,6 +1,7 @@
 package config_parser
 
 import (
+	"context"
 	"fmt"
 	"regexp"
 	"strings"
@@ -12,6 +13,9 @@ import (
 type remoteSource struct {
 	gitcmd git.GitInterface
 	config *config.Config
+
+	// err is the error of the last Load, rake sources can't return one
+	err error
 }
 
 func NewGitHubRemoteSource(config *config.Config, gitcmd git.GitInterface) *remoteSource {
@@ -22,9 +26,11 @@ func NewGitHubRemoteSource(config *config.Config, gitcmd git.GitInterface) *remo
 }
 
 func (s *remoteSource) Load(_ interface{}) {
-	var output string
-	err := s.gitcmd.Git("remote -v", &output)
-	check(err)
+	output, err := s.gitcmd.Git(context.Background(), "remote", "-v")
+	if err != nil {
+		s.err = fmt.Errorf("unable to list git remotes : %w", err)
+		return
+	}
 	lines := strings.Split(output, "\n")
 
 	for _, line := range lines {
@@ -33,6 +39,9 @@ func (s *remoteSource) Load(_ interface{}) {
 			s.config.Repo.GitHubHost = githubHost
 			s.config.Repo.GitHubRepoOwner = repoOwner
 			s.config.Repo.GitHubRepoName = repoName
+			if forge, found := forgeFromHost(githubHost); found {
+				s.config.Repo.Forge = forge
+			}
 			break
 		}
 	}
@@ -45,7 +54,9 @@ func getRepoDetailsFromRemote(remote string) (string, string, string, bool) {
 	userFormat := `(git@)?`
 	// "/" is expected in "http://" or "ssh://" protocol, when no protocol given
 	// it should be ":"
-	repoFormat := `(?P<githubHost>[a-z0-9._\-]+)(/|:)(?P<repoOwner>[\w-]+)/(?P<repoName>[\w-]+)`
+	// GitLab projects can be nested in subgroups, everything up to the
+	// repository name is the owner
+	repoFormat := `(?P<githubHost>[a-z0-9._\-]+)(/|:)(?P<repoOwner>[\w-]+(?:/[\w.-]+)*)/(?P<repoName>[\w-]+)`
 	// This is neither required in https access nor in ssh one
 	suffixFormat := `(.git)?`
 	regexFormat := fmt.Sprintf(`^origin\s+%s%s%s%s \(push\)`,
@@ -61,8 +72,18 @@ func getRepoDetailsFromRemote(remote string) (string, string, string, bool) {
 	return "", "", "", false
 }
 
-func check(err error) {
-	if err != nil {
-		panic(err)
+// forgeFromHost returns the forge of well known hosts
+//
+//	self-hosted instances are detected by the forge name in their host,
+//	other hosts must configure the forge in .spr.yml.
+func forgeFromHost(host string) (string, bool) {
+	switch {
+	case strings.Contains(host, "gitlab"):
+		return config.ForgeGitLab, true
+	case strings.Contains(host, "gitea"), strings.Contains(host, "forgejo"), host == "codeberg.org":
+		return config.ForgeGitea, true
+	case strings.Contains(host, "github"):
+		return config.ForgeGitHub, true
 	}
+	return "", false
 }
@@ -27,6 +27,7 @@ func TestDefaultConfig(t *testing.T) {
 			GitHubRemote:          "origin",
 			GitHubBranch:          "main",
 			GitHubHost:            "github.com",
+			Forge:                 "github",
 			RequireChecks:         true,
 			RequireApproval:       true,
 			MergeMethod:           "rebase",
@@ -43,6 +44,7 @@ func TestDefaultConfig(t *testing.T) {
 			StatusBitsHeader: true,
 			StatusBitsEmojis: true,
 			BranchPrefix:     "spr",
+			GitBackend:       "cli",
 		},
 		State: &InternalState{
 			MergeCheckCommit: map[string]string{},
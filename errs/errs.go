@@ -0,0 +1,148 @@
+// Package errs classifies the errors returned by spr, its git commands and
+// the forge clients, so callers can react to them and the command line can
+// map them to exit codes.
+package errs
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Kind is the class of an error. Kind implements error so it can be
+// matched with errors.Is, e.g. errors.Is(err, errs.RateLimit).
+type Kind int
+
+const (
+	// Unknown is the kind of errors which aren't classified
+	Unknown Kind = iota
+
+	// Validation is a request rejected as invalid, such as a bad argument,
+	//  a bad configuration or a stack spr can't operate on
+	Validation
+
+	// Auth is a missing or invalid token, or one without permission
+	Auth
+
+	// NotFound is a missing repository, branch, pull request or commit
+	NotFound
+
+	// Conflict is a change which can't be applied over the current state,
+	//  such as a merge conflict or a branch pushed by someone else
+	Conflict
+
+	// RateLimit is a request refused until the rate limit resets
+	RateLimit
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Validation:
+		return "validation"
+	case Auth:
+		return "auth"
+	case NotFound:
+		return "not found"
+	case Conflict:
+		return "conflict"
+	case RateLimit:
+		return "rate limit"
+	}
+	return "unknown"
+}
+
+func (k Kind) Error() string {
+	return k.String() + " error"
+}
+
+// Error is an error of a known kind
+type Error struct {
+	Kind Kind
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is matches the kind of the error
+func (e *Error) Is(target error) bool {
+	kind, ok := target.(Kind)
+	return ok && kind == e.Kind
+}
+
+// New returns an error of the given kind formatted like fmt.Errorf, %w
+//
+//	wraps an underlying error.
+func New(kind Kind, format string, args ...interface{}) error {
+	return &Error{Kind: kind, Err: fmt.Errorf(format, args...)}
+}
+
+// Wrap classifies err with the given kind, a nil err returns nil. An error
+//
+//	which is already classified keeps its kind.
+func Wrap(kind Kind, err error) error {
+	if err == nil {
+		return nil
+	}
+	if KindOf(err) != Unknown {
+		return err
+	}
+	return &Error{Kind: kind, Err: err}
+}
+
+// KindOf returns the kind of the first classified error in the chain of err
+func KindOf(err error) Kind {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	var kind Kind
+	if errors.As(err, &kind) {
+		return kind
+	}
+	return Unknown
+}
+
+// HTTPStatusKind returns the kind of an error response with the given status
+func HTTPStatusKind(status int) Kind {
+	switch status {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return Auth
+	case http.StatusNotFound, http.StatusGone:
+		return NotFound
+	case http.StatusConflict, http.StatusPreconditionFailed:
+		return Conflict
+	case http.StatusTooManyRequests:
+		return RateLimit
+	case http.StatusBadRequest, http.StatusUnprocessableEntity, http.StatusMethodNotAllowed:
+		return Validation
+	}
+	return Unknown
+}
+
+// ExitCode returns the process exit code of err, 0 for a nil err.
+//
+//	1 unknown, 2 validation, 3 auth, 4 not found, 5 conflict, 6 rate limit
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	switch KindOf(err) {
+	case Validation:
+		return 2
+	case Auth:
+		return 3
+	case NotFound:
+		return 4
+	case Conflict:
+		return 5
+	case RateLimit:
+		return 6
+	}
+	return 1
+}
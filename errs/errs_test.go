@@ -0,0 +1,51 @@
+package errs
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKindOf(t *testing.T) {
+	err := New(Conflict, "push rejected: %w", errors.New("stale info"))
+	require.Equal(t, "push rejected: stale info", err.Error())
+	require.Equal(t, Conflict, KindOf(err))
+	require.True(t, errors.Is(err, Conflict))
+	require.False(t, errors.Is(err, Auth))
+
+	// the kind survives wrapping and isn't replaced by Wrap
+	wrapped := fmt.Errorf("update failed: %w", err)
+	require.Equal(t, Conflict, KindOf(wrapped))
+	require.Equal(t, Conflict, KindOf(Wrap(NotFound, wrapped)))
+
+	require.Equal(t, Unknown, KindOf(errors.New("boom")))
+	require.Equal(t, NotFound, KindOf(Wrap(NotFound, errors.New("boom"))))
+	require.Nil(t, Wrap(NotFound, nil))
+	require.Equal(t, RateLimit, KindOf(RateLimit))
+}
+
+func TestHTTPStatusKind(t *testing.T) {
+	for status, kind := range map[int]Kind{
+		http.StatusUnauthorized:        Auth,
+		http.StatusForbidden:           Auth,
+		http.StatusNotFound:            NotFound,
+		http.StatusConflict:            Conflict,
+		http.StatusTooManyRequests:     RateLimit,
+		http.StatusUnprocessableEntity: Validation,
+		http.StatusInternalServerError: Unknown,
+	} {
+		require.Equal(t, kind, HTTPStatusKind(status), status)
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	require.Equal(t, 0, ExitCode(nil))
+	require.Equal(t, 1, ExitCode(errors.New("boom")))
+	require.Equal(t, 3, ExitCode(New(Auth, "bad credentials")))
+	// the first classified error of a joined error decides
+	joined := errors.Join(errors.New("boom"), New(RateLimit, "slow down"), New(Conflict, "stale"))
+	require.Equal(t, 6, ExitCode(joined))
+}
@@ -0,0 +1,55 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ExitError is the error of a git command which ran and exited with a
+//
+//	non-zero status. Its output is kept apart, git reports conflicts on
+//	stdout and most errors on stderr.
+type ExitError struct {
+	Args     []string
+	ExitCode int
+	Stdout   string
+	Stderr   string
+}
+
+func (e *ExitError) Error() string {
+	message := fmt.Sprintf("git %s : exit status %d", CommandString(e.Args), e.ExitCode)
+	for _, output := range []string{e.Stdout, e.Stderr} {
+		if output = strings.TrimSpace(output); output != "" {
+			message += "\n" + output
+		}
+	}
+	return message
+}
+
+// ExitCode returns the exit status of the git command which failed with err,
+//
+//	false when err isn't the error of a git command which ran.
+func ExitCode(err error) (int, bool) {
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode, true
+	}
+	return 0, false
+}
+
+// CommandString returns the arguments of a git command as they would be typed
+//
+//	in a shell, quoting the arguments which contain spaces. It is meant for
+//	logs and messages, commands are run with the arguments as they are.
+func CommandString(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg == "" || strings.ContainsAny(arg, " \t\n\"'\\") {
+			arg = strconv.Quote(arg)
+		}
+		quoted[i] = arg
+	}
+	return strings.Join(quoted, " ")
+}
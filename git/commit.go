@@ -2,10 +2,20 @@ package git
 
 import "context"
 
+// GitInterface runs git commands in a repository. Each argument is passed to
+//
+//	git as is, so arguments may contain spaces. Failed commands return an error
+//	classified by package errs, such as errs.Conflict for a rejected push or a
+//	rebase which stopped on conflicts, which wraps an *ExitError when git ran.
 type GitInterface interface {
-	GitWithEditor(args string, output *string, editorCmd string) error
-	Git(args string, output *string) error
-	MustGit(args string, output *string)
+	// Git runs git with the given arguments and returns its standard output
+	//  without surrounding white space. Cancelling ctx kills the command.
+	Git(ctx context.Context, args ...string) (string, error)
+
+	// GitWithEditor runs git like Git with editorCmd as the editor of commit
+	//  messages and of interactive rebase todo lists.
+	GitWithEditor(ctx context.Context, editorCmd string, args ...string) (string, error)
+
 	RootDir() string
 	DeleteRemoteBranch(ctx context.Context, branch string) error
 }
@@ -1,29 +1,75 @@
 package git
 
 import (
-	"fmt"
+	"context"
 	"os/exec"
 	"regexp"
 	"strings"
 
 	"github.com/ejoffe/spr/config"
+	"github.com/ejoffe/spr/errs"
 	"github.com/rs/zerolog/log"
 )
 
 // GetLocalBranchName returns the current local git branch
-func GetLocalBranchName(gitcmd GitInterface) string {
-	var output string
-	err := gitcmd.Git("branch --no-color", &output)
-	check(err)
+func GetLocalBranchName(ctx context.Context, gitcmd GitInterface) (string, error) {
+	output, err := gitcmd.Git(ctx, "branch", "--no-color")
+	if err != nil {
+		return "", err
+	}
 	lines := strings.Split(output, "\n")
 	for _, line := range lines {
 		if strings.HasPrefix(line, "* ") {
-			return line[2:]
+			return line[2:], nil
+		}
+	}
+	return "", errs.New(errs.NotFound, "cannot determine local git branch name")
+}
+
+// GetLocalBranches returns the names of all the local git branches
+func GetLocalBranches(ctx context.Context, gitcmd GitInterface) ([]string, error) {
+	output, err := gitcmd.Git(ctx, "for-each-ref", "--format=%(refname:short)", "refs/heads/")
+	if err != nil {
+		return nil, err
+	}
+	var branches []string
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			branches = append(branches, line)
 		}
 	}
-	panic("cannot determine local git branch name")
+	return branches, nil
 }
 
+// GetUpstreamBranch returns the branch on the configured remote tracked by
+//
+//	the given local branch. An empty string is returned when the local branch
+//	has no upstream or tracks a branch on another remote.
+func GetUpstreamBranch(ctx context.Context, cfg *config.Config, gitcmd GitInterface, branch string) string {
+	output, err := gitcmd.Git(ctx, "rev-parse", "--abbrev-ref", "--symbolic-full-name", branch+"@{upstream}")
+	if err != nil {
+		return ""
+	}
+	upstream, found := strings.CutPrefix(strings.TrimSpace(output), cfg.Repo.GitHubRemote+"/")
+	if !found {
+		return ""
+	}
+	return upstream
+}
+
+// StackHead returns the revision at the top of the stack spr operates on
+func StackHead(cfg *config.Config) string {
+	if cfg.Stack != "" {
+		return cfg.Stack
+	}
+	return "HEAD"
+}
+
+// BranchNameFromCommit returns the remote branch name of the pull request for commit
+//
+//	the name encodes the target branch, which may itself contain slashes,
+//	followed by the commit-id. It is parsed back with BranchNameRegex.
 func BranchNameFromCommit(cfg *config.Config, commit Commit) string {
 	remoteBranchName := cfg.Repo.GitHubBranch
 	branchPrefix := cfg.User.BranchPrefix
@@ -37,41 +83,73 @@ func BranchNameRegex(branchPrefix string) *regexp.Regexp {
 // GetLocalTopCommit returns the top unmerged commit in the stack
 //
 // return nil if there are no unmerged commits in the stack
-func GetLocalTopCommit(cfg *config.Config, gitcmd GitInterface) *Commit {
-	commits := GetLocalCommitStack(cfg, gitcmd)
-	if len(commits) == 0 {
-		return nil
+func GetLocalTopCommit(ctx context.Context, cfg *config.Config, gitcmd GitInterface) (*Commit, error) {
+	commits, err := GetLocalCommitStack(ctx, cfg, gitcmd)
+	if err != nil || len(commits) == 0 {
+		return nil, err
 	}
-	return &commits[len(commits)-1]
+	return &commits[len(commits)-1], nil
 }
 
 // GetLocalCommitStack returns a list of unmerged commits
 //
 //	the list is ordered with the bottom commit in the stack first
-func GetLocalCommitStack(cfg *config.Config, gitcmd GitInterface) []Commit {
-	var commitLog string
-	logCommand := fmt.Sprintf("log --format=medium --no-color %s/%s..HEAD",
-		cfg.Repo.GitHubRemote, cfg.Repo.GitHubBranch)
-	gitcmd.MustGit(logCommand, &commitLog)
+func GetLocalCommitStack(ctx context.Context, cfg *config.Config, gitcmd GitInterface) ([]Commit, error) {
+	logCommand := logCommand(cfg, StackHead(cfg))
+	commitLog, err := gitcmd.Git(ctx, logCommand...)
+	if err != nil {
+		return nil, err
+	}
 	commits, valid := parseLocalCommitStack(commitLog)
+	if !valid && cfg.Stack != "" {
+		// commit ids can only be added by rebasing the checked out branch
+		return nil, errs.New(errs.Validation, "stack %s has commits without a commit-id\n"+
+			" check out the branch and run spr update to add them", cfg.Stack)
+	}
 	if !valid {
 		// if not valid - run rebase to add commit ids
 		rewordPath, err := exec.LookPath("spr_reword_helper")
-		check(err)
-		rebaseCommand := fmt.Sprintf("rebase %s/%s -i --autosquash --autostash",
-			cfg.Repo.GitHubRemote, cfg.Repo.GitHubBranch)
-		gitcmd.GitWithEditor(rebaseCommand, nil, rewordPath)
+		if err != nil {
+			return nil, errs.Wrap(errs.NotFound, err)
+		}
+		_, err = gitcmd.GitWithEditor(ctx, rewordPath, "rebase",
+			cfg.Repo.GitHubRemote+"/"+cfg.Repo.GitHubBranch, "-i", "--autosquash", "--autostash")
+		if err != nil {
+			return nil, err
+		}
 
-		gitcmd.MustGit(logCommand, &commitLog)
+		commitLog, err = gitcmd.Git(ctx, logCommand...)
+		if err != nil {
+			return nil, err
+		}
 		commits, valid = parseLocalCommitStack(commitLog)
 		if !valid {
-			// if still not valid - panic
-			errMsg := "unable to fetch local commits\n"
-			errMsg += " most likely this is an issue with missing commit-id in the commit body\n"
-			panic(errMsg)
+			return nil, errs.New(errs.Validation, "unable to fetch local commits\n"+
+				" most likely this is an issue with missing commit-id in the commit body")
 		}
 	}
-	return commits
+	return commits, nil
+}
+
+// GetBranchCommitStack returns the list of unmerged commits on a local branch
+//
+//	the list is ordered with the bottom commit in the stack first.
+//	Unlike GetLocalCommitStack it never rewrites the branch, valid is false
+//	when some of the commits are missing a commit-id.
+func GetBranchCommitStack(ctx context.Context, cfg *config.Config, gitcmd GitInterface, branch string) (commits []Commit, valid bool) {
+	commitLog, err := gitcmd.Git(ctx, logCommand(cfg, branch)...)
+	if err != nil {
+		return nil, false
+	}
+	return parseLocalCommitStack(commitLog)
+}
+
+// logCommand returns the arguments of the log of the commits of rev which
+//
+//	are not on the target branch.
+func logCommand(cfg *config.Config, rev string) []string {
+	return []string{"log", "--format=medium", "--no-color",
+		cfg.Repo.GitHubRemote + "/" + cfg.Repo.GitHubBranch + ".." + rev}
 }
 
 func parseLocalCommitStack(commitLog string) ([]Commit, bool) {
@@ -158,9 +236,3 @@ func parseLocalCommitStack(commitLog string) ([]Commit, bool) {
 	log.Debug().Interface("commits", commits).Msg("parseLocalCommitStack")
 	return commits, true
 }
-
-func check(err error) {
-	if err != nil {
-		panic(err)
-	}
-}
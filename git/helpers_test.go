@@ -18,6 +18,8 @@ func TestBranchNameRegex(t *testing.T) {
 		{prefix: "spr", input: "spr/main/abcd1234", branch: "main", commit: "abcd1234"},
 		{prefix: "custom", input: "custom/main/deadbeef", branch: "main", commit: "deadbeef"},
 		{prefix: "my-team", input: "my-team/develop/abcd1234", branch: "develop", commit: "abcd1234"},
+		{prefix: "spr", input: "spr/release/2026.10/deadbeef", branch: "release/2026.10", commit: "deadbeef"},
+		{prefix: "spr", input: "spr/team/payments/abcd1234", branch: "team/payments", commit: "abcd1234"},
 	}
 
 	for _, tc := range tests {
@@ -69,6 +71,13 @@ func TestBranchNameFromCommit(t *testing.T) {
 			commitID: "abcd1234",
 			expected: "my-team/develop/abcd1234",
 		},
+		{
+			name:     "target branch with slashes",
+			prefix:   "spr",
+			branch:   "release/2026.10",
+			commitID: "deadbeef",
+			expected: "spr/release/2026.10/deadbeef",
+		},
 	}
 
 	for _, tc := range tests {
@@ -83,3 +92,10 @@ func TestBranchNameFromCommit(t *testing.T) {
 		})
 	}
 }
+
+func TestStackHead(t *testing.T) {
+	cfg := config.EmptyConfig()
+	assert.Equal(t, "HEAD", StackHead(cfg))
+	cfg.Stack = "feature"
+	assert.Equal(t, "feature", StackHead(cfg))
+}
@@ -24,37 +24,39 @@ func (m *Mock) SetRootDir(dir string) {
 	m.rootdir = dir
 }
 
-func (m *Mock) GitWithEditor(args string, output *string, editorCmd string) error {
-	return m.Git(args, output)
+func (m *Mock) GitWithEditor(ctx context.Context, editorCmd string, args ...string) (string, error) {
+	return m.Git(ctx, args...)
 }
 
-func (m *Mock) Git(args string, output *string) error {
-	fmt.Printf("CMD: git %s\n", args)
+// Git matches the command against the next expected one, expectations are
+//
+//	written as the command would be typed in a shell.
+func (m *Mock) Git(ctx context.Context, args ...string) (string, error) {
+	return m.call(git.CommandString(args))
+}
+
+func (m *Mock) call(command string) (string, error) {
+	fmt.Printf("CMD: git %s\n", command)
 
-	m.assert.NotEmpty(m.expectedCmd, fmt.Sprintf("Unexpected command: git %s\n", args))
+	m.assert.NotEmpty(m.expectedCmd, fmt.Sprintf("Unexpected command: git %s\n", command))
 
 	expected := m.expectedCmd[0]
-	actual := "git " + args
+	actual := "git " + command
 	m.assert.Equal(expected, actual)
 
-	if m.response[0].Valid() {
-		m.assert.NotNil(output)
-		*output = m.response[0].Output()
-	} else {
-		m.assert.Nil(output)
-	}
-
+	output := m.response[0].Output()
 	err := m.errors[0]
 
 	m.expectedCmd = m.expectedCmd[1:]
 	m.response = m.response[1:]
 	m.errors = m.errors[1:]
 
-	return err
+	return output, err
 }
 
 func (m *Mock) DeleteRemoteBranch(ctx context.Context, branch string) error {
-	return m.Git(fmt.Sprintf("DeleteRemoteBranch(%s)", branch), nil)
+	_, err := m.call(fmt.Sprintf("DeleteRemoteBranch(%s)", branch))
+	return err
 }
 
 func (m *Mock) ExpectationsMet() {
@@ -63,13 +65,6 @@ func (m *Mock) ExpectationsMet() {
 	m.assert.Empty(m.errors, fmt.Sprintf("expected additional git errors: %v", m.errors))
 }
 
-func (m *Mock) MustGit(argStr string, output *string) {
-	err := m.Git(argStr, output)
-	if err != nil {
-		panic(err)
-	}
-}
-
 func (m *Mock) RootDir() string {
 	return m.rootdir
 }
@@ -83,7 +78,6 @@ type Mock struct {
 }
 
 type responder interface {
-	Valid() bool
 	Output() string
 }
 
@@ -92,6 +86,16 @@ func (m *Mock) ExpectFetch() {
 	m.expect("git rebase origin/master --autostash")
 }
 
+// ExpectFetchOnly expects a fetch which is not followed by a rebase
+func (m *Mock) ExpectFetchOnly() {
+	m.expect("git fetch")
+}
+
+// ExpectRebase expects the stack to be rebased onto the given remote branch
+func (m *Mock) ExpectRebase(target string) {
+	m.expect("git rebase origin/%s --autostash", target)
+}
+
 func (m *Mock) ExpectNoFetch() {
 	m.expect("git rebase origin/master --autostash")
 }
@@ -134,6 +138,40 @@ func (m *Mock) ExpectLogAndRespond(commits []*git.Commit) {
 	m.expect("git log --format=medium --no-color origin/master..HEAD").commitRespond(commits)
 }
 
+// ExpectBranchLogAndRespond expects the log of the stack on a local branch
+func (m *Mock) ExpectBranchLogAndRespond(branch string, commits []*git.Commit) {
+	m.ExpectTargetLogAndRespond("master", branch, commits)
+}
+
+// ExpectTargetLogAndRespond expects the log of the stack on a local branch
+//
+//	which targets the given remote branch
+func (m *Mock) ExpectTargetLogAndRespond(target string, branch string, commits []*git.Commit) {
+	m.expect("git log --format=medium --no-color origin/%s..%s", target, branch).commitRespond(commits)
+}
+
+// ExpectUpstream expects a lookup of the upstream of a local branch,
+//
+//	an empty upstream means the branch doesn't track any branch
+func (m *Mock) ExpectUpstream(branch string, upstream string) {
+	cmd := "git rev-parse --abbrev-ref --symbolic-full-name %s@{upstream}"
+	if upstream == "" {
+		m.expectError(fmt.Sprintf(cmd, branch), errors.New("no upstream configured")).respond("")
+		return
+	}
+	m.expect(cmd, branch).respond(upstream + "\n")
+}
+
+// ExpectLocalBranches expects the listing of all local branches
+func (m *Mock) ExpectLocalBranches(names ...string) {
+	m.expect("git for-each-ref --format=%%(refname:short) refs/heads/").respond(strings.Join(names, "\n"))
+}
+
+// ExpectVerifyBranch expects a check that the local branch exists
+func (m *Mock) ExpectVerifyBranch(name string) {
+	m.expect("git rev-parse --verify --quiet refs/heads/%s", name)
+}
+
 func (m *Mock) ExpectStatus() {
 	m.expect("git status --porcelain --untracked-files=no").commitRespond(nil)
 }
@@ -160,6 +198,24 @@ func (m *Mock) ExpectFixup(commitHash string) {
 	m.expect("git rebase -i --autosquash --autostash origin/master")
 }
 
+// ExpectRevParse expects rev to be resolved to the given commit hash
+func (m *Mock) ExpectRevParse(rev string, hash string) {
+	m.expect("git rev-parse %s", rev).respond(hash + "\n")
+}
+
+// ExpectWritable expects the check that the selected stack isn't a read-only
+//
+//	checkout of pull requests, without a stack the master branch is checked
+//	out and looked up first.
+func (m *Mock) ExpectWritable(stack string) {
+	if stack == "" {
+		m.ExpectLocalBranch("* master")
+		stack = "master"
+	}
+	m.expectError(fmt.Sprintf("git config --get --type=bool branch.%s.sprReadOnly", stack),
+		&git.ExitError{Args: []string{"config"}, ExitCode: 1})
+}
+
 func (m *Mock) ExpectLocalBranch(name string) {
 	m.expect("git branch --no-color").respond(name)
 }
@@ -180,7 +236,6 @@ func (m *Mock) expectError(cmd string, err error) *Mock {
 
 func (m *Mock) respond(response string) {
 	m.response[len(m.response)-1] = &stringResponse{
-		valid:  true,
 		output: response,
 	}
 }
@@ -193,14 +248,9 @@ func (m *Mock) commitRespond(commits []*git.Commit) {
 }
 
 type stringResponse struct {
-	valid  bool
 	output string
 }
 
-func (r *stringResponse) Valid() bool {
-	return r.valid
-}
-
 func (r *stringResponse) Output() string {
 	return r.output
 }
@@ -210,10 +260,6 @@ type commitResponse struct {
 	commits []*git.Commit
 }
 
-func (r *commitResponse) Valid() bool {
-	return r.valid
-}
-
 func (r *commitResponse) Output() string {
 	if !r.valid {
 		return ""
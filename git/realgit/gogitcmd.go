@@ -0,0 +1,557 @@
+package realgit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ejoffe/spr/config"
+	"github.com/ejoffe/spr/errs"
+	"github.com/ejoffe/spr/git"
+	gogit "github.com/go-git/go-git/v5"
+	gogitconfig "github.com/go-git/go-git/v5/config"
+	gogitplumbing "github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/rs/zerolog/log"
+)
+
+// errNotNative is returned by a go-git command which has to be run with the
+//
+//	git executable after all, such as a push which needs a credential helper.
+var errNotNative = errors.New("not supported by go-git")
+
+var hashRegex = regexp.MustCompile(`^[a-f0-9]{40}$`)
+
+// NewGoGitCmd returns a git cmd instance for the repository of the working
+//
+//	directory which reads logs, refs and status and pushes in process with
+//	go-git. Commands go-git can't run, such as rebases, run the git executable.
+func NewGoGitCmd(cfg *config.Config) (*gogitcmd, error) {
+	cli, err := NewGitCmd(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &gogitcmd{
+		config: cfg,
+		repo:   cli.repo,
+		cli:    cli,
+	}, nil
+}
+
+// NewGoGitCmdForRepo returns a git cmd instance running commands in the given
+//
+//	repository, which may be held in memory. There is no worktree on disk for
+//	the git executable, so commands go-git can't run fail with errs.Validation.
+func NewGoGitCmdForRepo(cfg *config.Config, repo *gogit.Repository) *gogitcmd {
+	return &gogitcmd{
+		config: cfg,
+		repo:   repo,
+	}
+}
+
+type gogitcmd struct {
+	config *config.Config
+	repo   *gogit.Repository
+	cli    *gitcmd // nil for a repository without a worktree on disk
+}
+
+func (c *gogitcmd) Git(ctx context.Context, args ...string) (string, error) {
+	return c.GitWithEditor(ctx, "/usr/bin/true", args...)
+}
+
+func (c *gogitcmd) GitWithEditor(ctx context.Context, editorCmd string, args ...string) (string, error) {
+	command := git.CommandString(args)
+	run, native := c.nativeCommand(ctx, args)
+	if !native {
+		if c.cli == nil {
+			return "", errs.New(errs.Validation, "git %s : %s", command, errNotNative)
+		}
+		return c.cli.GitWithEditor(ctx, editorCmd, args...)
+	}
+
+	log.Debug().Msg("go-git " + command)
+	if c.config.User.LogGitCommands {
+		fmt.Printf("> git %s\n", command)
+	}
+	out, err := run()
+	if errors.Is(err, errNotNative) && c.cli != nil {
+		log.Debug().Err(err).Msg("go-git " + command + " : running git")
+		return c.cli.run(ctx, editorCmd, args)
+	}
+	if err != nil {
+		kind := errs.KindOf(err)
+		if kind == errs.Unknown {
+			kind = goGitErrorKind(err)
+		}
+		return "", errs.New(kind, "git %s : %w", command, err)
+	}
+	return strings.TrimSpace(out), nil
+}
+
+func (c *gogitcmd) RootDir() string {
+	if c.cli == nil {
+		return ""
+	}
+	return c.cli.rootdir
+}
+
+func (c *gogitcmd) DeleteRemoteBranch(ctx context.Context, branch string) error {
+	_, err := c.Git(ctx, "push", c.config.Repo.GitHubRemote,
+		":"+gogitplumbing.NewBranchReferenceName(branch).String())
+	return err
+}
+
+// goGitErrorKind classifies a failed go-git call
+func goGitErrorKind(err error) errs.Kind {
+	switch {
+	case errors.Is(err, gogitplumbing.ErrReferenceNotFound),
+		errors.Is(err, gogitplumbing.ErrObjectNotFound),
+		errors.Is(err, gogit.ErrRemoteNotFound),
+		errors.Is(err, gogit.ErrBranchNotFound):
+		return errs.NotFound
+	}
+	return gitErrorKind(err.Error())
+}
+
+// nativeCommand returns the go-git implementation of a git command, false
+//
+//	when the command, or one of its flags, has no go-git implementation.
+func (c *gogitcmd) nativeCommand(ctx context.Context, args []string) (func() (string, error), bool) {
+	if len(args) == 0 {
+		return nil, false
+	}
+	switch args[0] {
+	case "log":
+		// log --format=medium --no-color <exclude>..<include>
+		if len(args) == 4 && args[1] == "--format=medium" && args[2] == "--no-color" &&
+			!strings.Contains(args[3], "...") {
+			exclude, include, found := strings.Cut(args[3], "..")
+			if found && exclude != "" && include != "" {
+				return func() (string, error) { return c.log(exclude, include) }, true
+			}
+		}
+	case "rev-parse":
+		return c.revParseCommand(args[1:])
+	case "status":
+		return c.statusCommand(args[1:])
+	case "branch":
+		if len(args) == 2 && args[1] == "--no-color" {
+			return c.branch, true
+		}
+	case "for-each-ref":
+		if len(args) == 3 && args[1] == "--format=%(refname:short)" && args[2] == "refs/heads/" {
+			return c.localBranches, true
+		}
+	case "remote":
+		if len(args) == 2 && args[1] == "-v" {
+			return c.remotes, true
+		}
+	case "push":
+		return c.pushCommand(ctx, args[1:])
+	}
+	return nil, false
+}
+
+// resolve returns the commit hash of a revision. When go-git can't resolve a
+//
+//	revision which isn't a full ref name or hash, it may still be one only the
+//	git executable understands, such as branch@{upstream}.
+func (c *gogitcmd) resolve(rev string) (gogitplumbing.Hash, error) {
+	hash, err := c.repo.ResolveRevision(gogitplumbing.Revision(rev))
+	if err == nil {
+		return *hash, nil
+	}
+	if strings.HasPrefix(rev, "refs/") || hashRegex.MatchString(rev) || c.cli == nil {
+		return gogitplumbing.ZeroHash, errs.New(errs.NotFound, "unknown revision %s : %w", rev, err)
+	}
+	return gogitplumbing.ZeroHash, errNotNative
+}
+
+// log writes the commits reachable from include but not from exclude in the
+//
+//	medium format of git log, the newest first. The walk stops at the merge
+//	bases of the two revisions, which is exact for a stack of commits on top
+//	of its target branch.
+func (c *gogitcmd) log(exclude, include string) (string, error) {
+	includeHash, err := c.resolve(include)
+	if err != nil {
+		return "", err
+	}
+	excludeHash, err := c.resolve(exclude)
+	if err != nil {
+		return "", err
+	}
+	commits, err := c.commitRange(excludeHash, includeHash)
+	if err != nil {
+		return "", err
+	}
+	var out strings.Builder
+	for i, commit := range commits {
+		if i > 0 {
+			out.WriteString("\n")
+		}
+		writeMediumLog(&out, commit)
+	}
+	return out.String(), nil
+}
+
+func (c *gogitcmd) commitRange(exclude, include gogitplumbing.Hash) ([]*object.Commit, error) {
+	includeCommit, err := c.repo.CommitObject(include)
+	if err != nil {
+		return nil, err
+	}
+	excludeCommit, err := c.repo.CommitObject(exclude)
+	if err != nil {
+		return nil, err
+	}
+	bases, err := includeCommit.MergeBase(excludeCommit)
+	if err != nil {
+		return nil, err
+	}
+	var ignore []gogitplumbing.Hash
+	for _, base := range bases {
+		ignore = append(ignore, base.Hash)
+	}
+	var commits []*object.Commit
+	err = object.NewCommitPreorderIter(includeCommit, nil, ignore).ForEach(func(commit *object.Commit) error {
+		commits = append(commits, commit)
+		return nil
+	})
+	return commits, err
+}
+
+func writeMediumLog(out *strings.Builder, commit *object.Commit) {
+	fmt.Fprintf(out, "commit %s\n", commit.Hash)
+	if len(commit.ParentHashes) > 1 {
+		var parents []string
+		for _, parent := range commit.ParentHashes {
+			parents = append(parents, parent.String()[:7])
+		}
+		fmt.Fprintf(out, "Merge: %s\n", strings.Join(parents, " "))
+	}
+	fmt.Fprintf(out, "Author: %s <%s>\n", commit.Author.Name, commit.Author.Email)
+	fmt.Fprintf(out, "Date:   %s\n\n", commit.Author.When.Format("Mon Jan 2 15:04:05 2006 -0700"))
+	for _, line := range strings.Split(strings.TrimRight(commit.Message, "\n"), "\n") {
+		fmt.Fprintf(out, "    %s\n", line)
+	}
+}
+
+func (c *gogitcmd) revParseCommand(args []string) (func() (string, error), bool) {
+	switch {
+	case len(args) == 1 && !strings.HasPrefix(args[0], "-"):
+		return func() (string, error) { return c.revParse(args[0]) }, true
+	case len(args) == 3 && args[0] == "--verify" && args[1] == "--quiet":
+		return func() (string, error) { return c.revParse(args[2]) }, true
+	case len(args) == 2 && args[0] == "--abbrev-ref" && args[1] == "HEAD":
+		return c.abbrevHead, true
+	case len(args) == 3 && args[0] == "--abbrev-ref" && args[1] == "--symbolic-full-name" &&
+		strings.HasSuffix(args[2], "@{upstream}"):
+		return func() (string, error) { return c.upstream(strings.TrimSuffix(args[2], "@{upstream}")) }, true
+	}
+	return nil, false
+}
+
+func (c *gogitcmd) revParse(rev string) (string, error) {
+	hash, err := c.resolve(rev)
+	if err != nil {
+		return "", err
+	}
+	return hash.String(), nil
+}
+
+// headBranch returns the checked out branch, empty when the head is detached
+func (c *gogitcmd) headBranch() (string, gogitplumbing.Hash, error) {
+	head, err := c.repo.Head()
+	if err != nil {
+		return "", gogitplumbing.ZeroHash, err
+	}
+	if !head.Name().IsBranch() {
+		return "", head.Hash(), nil
+	}
+	return head.Name().Short(), head.Hash(), nil
+}
+
+func (c *gogitcmd) abbrevHead() (string, error) {
+	branch, _, err := c.headBranch()
+	if err != nil || branch == "" {
+		return "HEAD", err
+	}
+	return branch, nil
+}
+
+func (c *gogitcmd) upstream(branch string) (string, error) {
+	if branch == "" || branch == "HEAD" {
+		head, _, err := c.headBranch()
+		if err != nil {
+			return "", err
+		}
+		branch = head
+	}
+	cfg, err := c.repo.Config()
+	if err != nil {
+		return "", err
+	}
+	branchCfg, found := cfg.Branches[branch]
+	if !found || branchCfg.Remote == "" || branchCfg.Merge == "" {
+		return "", errs.New(errs.NotFound, "no upstream configured for branch '%s'", branch)
+	}
+	return branchCfg.Remote + "/" + branchCfg.Merge.Short(), nil
+}
+
+func (c *gogitcmd) statusCommand(args []string) (func() (string, error), bool) {
+	var porcelain, showBranch, untracked = false, false, true
+	var pathspecs []string
+	for _, arg := range args {
+		switch {
+		case arg == "--porcelain":
+			porcelain = true
+		case arg == "-b":
+			showBranch = true
+		case arg == "-u":
+		case arg == "--untracked-files=no":
+			untracked = false
+		case !strings.HasPrefix(arg, "-"):
+			// as the mode of -u has to be attached, 'status -u no' is a pathspec
+			pathspecs = append(pathspecs, arg)
+		default:
+			return nil, false
+		}
+	}
+	if !porcelain {
+		return nil, false
+	}
+	return func() (string, error) { return c.status(showBranch, untracked, pathspecs) }, true
+}
+
+// status writes the status of the worktree in the porcelain format of git
+func (c *gogitcmd) status(showBranch bool, untracked bool, pathspecs []string) (string, error) {
+	var lines []string
+	if showBranch {
+		header, err := c.statusBranch()
+		if err != nil {
+			return "", err
+		}
+		lines = append(lines, header)
+	}
+
+	worktree, err := c.repo.Worktree()
+	if err != nil {
+		return "", err
+	}
+	status, err := worktree.Status()
+	if err != nil {
+		return "", err
+	}
+	// tracked files are listed first, each group sorted by path
+	var paths []string
+	for path, fileStatus := range status {
+		if fileStatus.Worktree == gogit.Unmodified && fileStatus.Staging == gogit.Unmodified {
+			continue
+		}
+		if (fileStatus.Worktree == gogit.Untracked && !untracked) || !matchPathspecs(path, pathspecs) {
+			continue
+		}
+		paths = append(paths, path)
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		iUntracked := status[paths[i]].Worktree == gogit.Untracked
+		jUntracked := status[paths[j]].Worktree == gogit.Untracked
+		if iUntracked != jUntracked {
+			return jUntracked
+		}
+		return paths[i] < paths[j]
+	})
+	for _, path := range paths {
+		fileStatus := status[path]
+		name := path
+		if fileStatus.Staging == gogit.Renamed || fileStatus.Staging == gogit.Copied {
+			name = fileStatus.Extra + " -> " + path
+		}
+		lines = append(lines, fmt.Sprintf("%c%c %s", fileStatus.Staging, fileStatus.Worktree, name))
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+func matchPathspecs(path string, pathspecs []string) bool {
+	if len(pathspecs) == 0 {
+		return true
+	}
+	for _, pathspec := range pathspecs {
+		pathspec = strings.TrimSuffix(pathspec, "/")
+		if path == pathspec || strings.HasPrefix(path, pathspec+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// statusBranch returns the branch header of the porcelain status, with the
+//
+//	number of commits the branch is ahead and behind its upstream.
+func (c *gogitcmd) statusBranch() (string, error) {
+	branch, head, err := c.headBranch()
+	if err != nil {
+		return "", err
+	}
+	if branch == "" {
+		return "## HEAD (no branch)", nil
+	}
+	upstream, err := c.upstream(branch)
+	if err != nil {
+		return "## " + branch, nil
+	}
+	header := fmt.Sprintf("## %s...%s", branch, upstream)
+	upstreamHash, err := c.resolve(upstream)
+	if err != nil {
+		return header + " [gone]", nil
+	}
+	ahead, err := c.commitRange(upstreamHash, head)
+	if err != nil {
+		return "", err
+	}
+	behind, err := c.commitRange(head, upstreamHash)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case len(ahead) > 0 && len(behind) > 0:
+		header += fmt.Sprintf(" [ahead %d, behind %d]", len(ahead), len(behind))
+	case len(ahead) > 0:
+		header += fmt.Sprintf(" [ahead %d]", len(ahead))
+	case len(behind) > 0:
+		header += fmt.Sprintf(" [behind %d]", len(behind))
+	}
+	return header, nil
+}
+
+func (c *gogitcmd) branches() ([]string, error) {
+	refs, err := c.repo.Branches()
+	if err != nil {
+		return nil, err
+	}
+	var branches []string
+	err = refs.ForEach(func(ref *gogitplumbing.Reference) error {
+		branches = append(branches, ref.Name().Short())
+		return nil
+	})
+	sort.Strings(branches)
+	return branches, err
+}
+
+func (c *gogitcmd) branch() (string, error) {
+	head, hash, err := c.headBranch()
+	if err != nil {
+		return "", err
+	}
+	branches, err := c.branches()
+	if err != nil {
+		return "", err
+	}
+	var lines []string
+	if head == "" {
+		lines = append(lines, fmt.Sprintf("* (HEAD detached at %s)", hash.String()[:7]))
+	}
+	for _, branch := range branches {
+		if branch == head {
+			lines = append(lines, "* "+branch)
+		} else {
+			lines = append(lines, "  "+branch)
+		}
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+func (c *gogitcmd) localBranches() (string, error) {
+	branches, err := c.branches()
+	return strings.Join(branches, "\n"), err
+}
+
+func (c *gogitcmd) remotes() (string, error) {
+	cfg, err := c.repo.Config()
+	if err != nil {
+		return "", err
+	}
+	var names []string
+	for name := range cfg.Remotes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var lines []string
+	for _, name := range names {
+		urls := cfg.Remotes[name].URLs
+		if len(urls) == 0 {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s\t%s (fetch)", name, urls[0]))
+		for _, url := range urls {
+			lines = append(lines, fmt.Sprintf("%s\t%s (push)", name, url))
+		}
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// pushCommand parses a push of commits or refs to full ref names on a
+//
+//	remote, with --force, --atomic and --force-with-lease=<ref>:<hash> flags.
+func (c *gogitcmd) pushCommand(ctx context.Context, args []string) (func() (string, error), bool) {
+	opts := &gogit.PushOptions{}
+	force := false
+	leased := map[string]bool{}
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		switch flag := args[0]; {
+		case flag == "--force":
+			force = true
+		case flag == "--atomic":
+			opts.Atomic = true
+		case strings.HasPrefix(flag, "--force-with-lease="):
+			ref, hash, found := strings.Cut(strings.TrimPrefix(flag, "--force-with-lease="), ":")
+			if !found || !strings.HasPrefix(ref, "refs/") || !hashRegex.MatchString(hash) {
+				return nil, false
+			}
+			opts.RequireRemoteRefs = append(opts.RequireRemoteRefs, gogitconfig.RefSpec(hash+":"+ref))
+			leased[ref] = true
+		default:
+			return nil, false
+		}
+		args = args[1:]
+	}
+	if len(args) < 2 {
+		return nil, false
+	}
+	opts.RemoteName = args[0]
+	for _, arg := range args[1:] {
+		src, dst, found := strings.Cut(arg, ":")
+		// go-git only matches sources which are hashes or full ref names
+		if !found || !strings.HasPrefix(dst, "refs/") ||
+			(src != "" && !hashRegex.MatchString(src) && !strings.HasPrefix(src, "refs/")) {
+			return nil, false
+		}
+		refSpec := gogitconfig.RefSpec(arg)
+		if src != "" && (force || leased[dst]) {
+			refSpec = gogitconfig.RefSpec("+" + arg)
+		}
+		if refSpec.Validate() != nil {
+			return nil, false
+		}
+		opts.RefSpecs = append(opts.RefSpecs, refSpec)
+	}
+	return func() (string, error) { return "", c.push(ctx, opts) }, true
+}
+
+// push pushes with go-git. A push which failed for another reason than being
+//
+//	rejected, such as a remote which needs a credential helper, is left to
+//	the git executable.
+func (c *gogitcmd) push(ctx context.Context, opts *gogit.PushOptions) error {
+	err := c.repo.PushContext(ctx, opts)
+	if err == nil || errors.Is(err, gogit.NoErrAlreadyUpToDate) {
+		return nil
+	}
+	if kind := goGitErrorKind(err); kind == errs.Conflict || kind == errs.NotFound || c.cli == nil {
+		return err
+	}
+	return fmt.Errorf("%w : %s", errNotNative, err)
+}
@@ -0,0 +1,199 @@
+package realgit
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ejoffe/spr/config"
+	"github.com/ejoffe/spr/errs"
+	"github.com/ejoffe/spr/git"
+	"github.com/go-git/go-billy/v5/memfs"
+	gogit "github.com/go-git/go-git/v5"
+	gogitplumbing "github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/stretchr/testify/require"
+)
+
+func runGit(t *testing.T, dir string, args ...string) string {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=Test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=Test", "GIT_COMMITTER_EMAIL=test@example.com")
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+	return strings.TrimSpace(string(out))
+}
+
+// makeTestRepos returns the cli and go-git commands of a clone of a bare
+//
+//	origin, with a stack of two commits on main and uncommitted changes.
+func makeTestRepos(t *testing.T) (*gitcmd, *gogitcmd, string) {
+	dir := t.TempDir()
+	origin := filepath.Join(dir, "origin.git")
+	work := filepath.Join(dir, "work")
+	runGit(t, dir, "init", "--quiet", "--bare", "--initial-branch=main", origin)
+	runGit(t, dir, "clone", "--quiet", origin, work)
+	runGit(t, work, "config", "user.name", "Test")
+	runGit(t, work, "config", "user.email", "test@example.com")
+	runGit(t, work, "commit", "--quiet", "--allow-empty", "-m", "Initial commit")
+	runGit(t, work, "push", "--quiet", "origin", "main")
+	for _, commit := range []struct{ file, subject, commitID string }{
+		{"parser.go", "Add parser", "a1b2c3d0"},
+		{"lexer.go", "Add lexer", "a1b2c3d1"},
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(work, commit.file), []byte("package demo\n"), 0644))
+		runGit(t, work, "add", commit.file)
+		runGit(t, work, "commit", "--quiet", "-m", commit.subject,
+			"-m", "The body of the commit\n\nsecond paragraph", "-m", "commit-id:"+commit.commitID)
+	}
+	runGit(t, work, "branch", "--quiet", "feature", "HEAD~1")
+	require.NoError(t, os.WriteFile(filepath.Join(work, "parser.go"), []byte("package parser\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(work, "notes.txt"), []byte("todo\n"), 0644))
+
+	cfg := config.DefaultConfig()
+	cfg.User.LogGitCommands = false
+	repo, err := gogit.PlainOpen(work)
+	require.NoError(t, err)
+	cli := &gitcmd{config: cfg, repo: repo, rootdir: work}
+	return cli, &gogitcmd{config: cfg, repo: repo, cli: cli}, origin
+}
+
+func TestGoGitCmdMatchesGit(t *testing.T) {
+	cli, gogitcmd, _ := makeTestRepos(t)
+	ctx := context.Background()
+	commands := []string{
+		"log --format=medium --no-color origin/main..HEAD",
+		"log --format=medium --no-color origin/main..feature",
+		"log --format=medium --no-color HEAD..origin/main",
+		"rev-parse HEAD",
+		"rev-parse origin/main",
+		"rev-parse --verify --quiet refs/heads/feature",
+		"rev-parse --abbrev-ref HEAD",
+		"rev-parse --abbrev-ref --symbolic-full-name main@{upstream}",
+		"status --porcelain",
+		"status --porcelain --untracked-files=no",
+		"status -b --porcelain -u no",
+		"branch --no-color",
+		"for-each-ref --format=%(refname:short) refs/heads/",
+		"remote -v",
+	}
+	for _, command := range commands {
+		t.Run(command, func(t *testing.T) {
+			args := strings.Fields(command)
+			_, native := gogitcmd.nativeCommand(ctx, args)
+			require.True(t, native)
+			expected, err := cli.Git(ctx, args...)
+			require.NoError(t, err)
+			actual, err := gogitcmd.Git(ctx, args...)
+			require.NoError(t, err)
+			require.Equal(t, expected, actual)
+		})
+	}
+
+	// the parsed stack is the same with both
+	cfg := gogitcmd.config
+	commits, err := git.GetLocalCommitStack(ctx, cfg, gogitcmd)
+	require.NoError(t, err)
+	require.Len(t, commits, 2)
+	require.Equal(t, "a1b2c3d0", commits[0].CommitID)
+	require.Equal(t, "Add lexer", commits[1].Subject)
+	expected, err := git.GetLocalCommitStack(ctx, cfg, cli)
+	require.NoError(t, err)
+	require.Equal(t, expected, commits)
+
+	_, err = gogitcmd.Git(ctx, "rev-parse", "--verify", "--quiet", "refs/heads/missing")
+	require.Equal(t, errs.NotFound, errs.KindOf(err))
+	_, err = gogitcmd.Git(ctx, "rev-parse", "--abbrev-ref", "--symbolic-full-name", "feature@{upstream}")
+	require.Equal(t, errs.NotFound, errs.KindOf(err))
+
+	// commands without a go-git implementation run git
+	_, native := gogitcmd.nativeCommand(ctx, []string{"log", "--format=%B", "-n", "1", "HEAD"})
+	require.False(t, native)
+	message, err := gogitcmd.Git(ctx, "log", "--format=%B", "-n", "1", "HEAD")
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(message, "Add lexer\n"))
+}
+
+func TestGoGitCmdPush(t *testing.T) {
+	cli, gogitcmd, origin := makeTestRepos(t)
+	ctx := context.Background()
+	head := strings.TrimSpace(runGit(t, cli.rootdir, "rev-parse", "HEAD"))
+	parent := strings.TrimSpace(runGit(t, cli.rootdir, "rev-parse", "HEAD~1"))
+
+	for _, command := range []string{
+		"push --force --atomic origin " + parent + ":refs/heads/spr/main/a1b2c3d0 " + head + ":refs/heads/spr/main/a1b2c3d1",
+		"push --force origin " + parent + ":refs/heads/spr/main/a1b2c3d1",
+		"push --atomic --force-with-lease=refs/heads/spr/main/a1b2c3d1:" + parent + " origin " + head + ":refs/heads/spr/main/a1b2c3d1",
+	} {
+		args := strings.Fields(command)
+		_, native := gogitcmd.nativeCommand(ctx, args)
+		require.True(t, native, command)
+		_, err := gogitcmd.Git(ctx, args...)
+		require.NoError(t, err, command)
+	}
+	require.Equal(t, parent, runGit(t, origin, "rev-parse", "spr/main/a1b2c3d0"))
+	require.Equal(t, head, runGit(t, origin, "rev-parse", "spr/main/a1b2c3d1"))
+
+	// the lease fails the push when the branch has moved since
+	_, err := gogitcmd.Git(ctx, "push", "--force-with-lease=refs/heads/spr/main/a1b2c3d1:"+parent,
+		"origin", parent+":refs/heads/spr/main/a1b2c3d1")
+	require.Equal(t, errs.Conflict, errs.KindOf(err))
+	require.Equal(t, head, runGit(t, origin, "rev-parse", "spr/main/a1b2c3d1"))
+
+	// without --force a push which isn't a fast forward is rejected
+	_, err = gogitcmd.Git(ctx, "push", "origin", parent+":refs/heads/spr/main/a1b2c3d1")
+	require.Equal(t, errs.Conflict, errs.KindOf(err))
+
+	require.NoError(t, gogitcmd.DeleteRemoteBranch(ctx, "spr/main/a1b2c3d0"))
+	require.Equal(t, "spr/main/a1b2c3d1", runGit(t, origin, "for-each-ref", "--format=%(refname:short)", "refs/heads/spr/"))
+}
+
+func TestGoGitCmdInMemory(t *testing.T) {
+	repo, err := gogit.Init(memory.NewStorage(), memfs.New())
+	require.NoError(t, err)
+	worktree, err := repo.Worktree()
+	require.NoError(t, err)
+	commit := func(message string) gogitplumbing.Hash {
+		hash, err := worktree.Commit(message, &gogit.CommitOptions{
+			AllowEmptyCommits: true,
+			Author:            &object.Signature{Name: "Test", Email: "test@example.com", When: time.Now()},
+		})
+		require.NoError(t, err)
+		return hash
+	}
+	base := commit("Initial commit")
+	require.NoError(t, repo.Storer.SetReference(gogitplumbing.NewHashReference("refs/remotes/origin/main", base)))
+	commit("Add parser\n\ncommit-id: a1b2c3d0\n")
+	commit("Add lexer\n\nThe body\n\ncommit-id: a1b2c3d1\n")
+
+	cfg := config.DefaultConfig()
+	cfg.User.LogGitCommands = false
+	gitcmd := NewGoGitCmdForRepo(cfg, repo)
+	require.Empty(t, gitcmd.RootDir())
+	ctx := context.Background()
+	commits, err := git.GetLocalCommitStack(ctx, cfg, gitcmd)
+	require.NoError(t, err)
+	require.Equal(t, []git.Commit{
+		{CommitID: "a1b2c3d0", CommitHash: commits[0].CommitHash, Subject: "Add parser"},
+		{CommitID: "a1b2c3d1", CommitHash: commits[1].CommitHash, Subject: "Add lexer", Body: "The body"},
+	}, commits)
+
+	branch, err := git.GetLocalBranchName(ctx, gitcmd)
+	require.NoError(t, err)
+	require.Equal(t, "master", branch)
+
+	status, err := gitcmd.Git(ctx, "status", "--porcelain")
+	require.NoError(t, err)
+	require.Empty(t, status)
+
+	// there is no worktree on disk for the git executable
+	_, err = gitcmd.Git(ctx, "rebase", "origin/main")
+	require.Equal(t, errs.Validation, errs.KindOf(err))
+}
@@ -2,56 +2,80 @@ package realgit
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"strings"
 
 	"github.com/ejoffe/spr/config"
+	"github.com/ejoffe/spr/errs"
+	"github.com/ejoffe/spr/git"
 	gogit "github.com/go-git/go-git/v5"
 	gogitconfig "github.com/go-git/go-git/v5/config"
 	gogitplumbing "github.com/go-git/go-git/v5/plumbing"
 	"github.com/rs/zerolog/log"
 )
 
-// NewGitCmd returns a new git cmd instance
-func NewGitCmd(cfg *config.Config) *gitcmd {
+// NewGitInterface returns the git commands of the configured backend for
+//
+//	the repository of the working directory.
+func NewGitInterface(cfg *config.Config) (git.GitInterface, error) {
+	if cfg.User.GitBackend == config.GitBackendGoGit {
+		gitcmd, err := NewGoGitCmd(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return gitcmd, nil
+	}
+	gitcmd, err := NewGitCmd(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return gitcmd, nil
+}
+
+// NewGitCmd returns a new git cmd instance running commands in the
+//
+//	repository of the working directory.
+func NewGitCmd(cfg *config.Config) (*gitcmd, error) {
 	initcmd := &gitcmd{
 		config: cfg,
 	}
-	var rootdir string
-	err := initcmd.Git("rev-parse --show-toplevel", &rootdir)
+	rootdir, err := initcmd.Git(context.Background(), "rev-parse", "--show-toplevel")
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(-1)
+		return nil, err
 	}
-	rootdir = strings.TrimSpace(maybeAdjustPathPerPlatform(rootdir))
+	rootdir, err = maybeAdjustPathPerPlatform(rootdir)
+	if err != nil {
+		return nil, err
+	}
+	rootdir = strings.TrimSpace(rootdir)
 
 	repo, err := gogit.PlainOpen(rootdir)
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(-1)
+		return nil, errs.Wrap(errs.NotFound, err)
 	}
 
 	return &gitcmd{
 		config:  cfg,
 		repo:    repo,
 		rootdir: rootdir,
-	}
+	}, nil
 }
 
-func maybeAdjustPathPerPlatform(rawRootDir string) string {
+func maybeAdjustPathPerPlatform(rawRootDir string) (string, error) {
 	if strings.HasPrefix(rawRootDir, "/cygdrive") {
 		// This is safe to run also on "proper" Windows paths
 		cmd := exec.Command("cygpath", []string{"-w", rawRootDir}...)
 		out, err := cmd.CombinedOutput()
 		if err != nil {
-			panic(err)
+			return "", fmt.Errorf("unable to convert %s to a windows path : %w", strings.TrimSpace(rawRootDir), err)
 		}
-		return string(out)
+		return string(out), nil
 	}
 
-	return rawRootDir
+	return rawRootDir, nil
 }
 
 type gitcmd struct {
@@ -60,43 +84,38 @@ type gitcmd struct {
 	rootdir string
 }
 
-func (c *gitcmd) Git(argStr string, output *string) error {
-	return c.GitWithEditor(argStr, output, "/usr/bin/true")
+func (c *gitcmd) Git(ctx context.Context, args ...string) (string, error) {
+	return c.GitWithEditor(ctx, "/usr/bin/true", args...)
 }
 
-func (c *gitcmd) MustGit(argStr string, output *string) {
-	err := c.Git(argStr, output)
-	if err != nil {
-		panic(err)
-	}
-}
-
-func (c *gitcmd) GitWithEditor(argStr string, output *string, editorCmd string) error {
-	// runs a git command
-	//  if output is not nil it will be set to the output of the command
-
+func (c *gitcmd) GitWithEditor(ctx context.Context, editorCmd string, args ...string) (string, error) {
 	// Fetch disabled
-	if c.config.User.NoFetch && strings.HasPrefix(argStr, "fetch") {
-		return nil
+	if c.config.User.NoFetch && len(args) > 0 && args[0] == "fetch" {
+		return "", nil
 	}
 
 	// Rebase disabled
-	if (c.config.User.NoRebase) && strings.HasPrefix(argStr, "rebase") {
-		return nil
+	if c.config.User.NoRebase && len(args) > 0 && args[0] == "rebase" {
+		return "", nil
 	}
 
-	log.Debug().Msg("git " + argStr)
+	command := git.CommandString(args)
+	log.Debug().Msg("git " + command)
 	if c.config.User.LogGitCommands {
-		fmt.Printf("> git %s\n", argStr)
+		fmt.Printf("> git %s\n", command)
 	}
-	args := []string{
+	return c.run(ctx, editorCmd, args)
+}
+
+// run runs a git command with the git executable
+func (c *gitcmd) run(ctx context.Context, editorCmd string, args []string) (string, error) {
+	gitArgs := []string{
 		"-c", fmt.Sprintf("core.editor=%s", editorCmd),
 		"-c", "commit.verbose=false",
 		"-c", "rebase.abbreviateCommands=false",
 		"-c", fmt.Sprintf("sequence.editor=%s", editorCmd),
 	}
-	args = append(args, strings.Split(argStr, " ")...)
-	cmd := exec.Command("git", args...)
+	cmd := exec.CommandContext(ctx, "git", append(gitArgs, args...)...)
 	cmd.Dir = c.rootdir
 
 	for _, env := range os.Environ() {
@@ -107,21 +126,57 @@ func (c *gitcmd) GitWithEditor(argStr string, output *string, editorCmd string)
 		}
 	}
 
-	if output != nil {
-		out, err := cmd.CombinedOutput()
-		*output = strings.TrimSpace(string(out))
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "git error: %s", string(out))
-			return err
-		}
-	} else {
-		out, err := cmd.CombinedOutput()
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "git error: %s", string(out))
-			return err
+	var stdout, stderr strings.Builder
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if ctx.Err() != nil {
+		return "", errs.New(errs.Unknown, "git %s : %w", git.CommandString(args), ctx.Err())
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		err = &git.ExitError{
+			Args:     args,
+			ExitCode: exitErr.ExitCode(),
+			Stdout:   stdout.String(),
+			Stderr:   stderr.String(),
 		}
+		return "", errs.Wrap(gitErrorKind(stdout.String()+stderr.String()), err)
 	}
-	return nil
+	if err != nil {
+		return "", errs.New(errs.Unknown, "git %s : %w", git.CommandString(args), err)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// gitErrorKind classifies a failed git command from its output
+func gitErrorKind(out string) errs.Kind {
+	switch {
+	case strings.Contains(out, "CONFLICT"),
+		strings.Contains(out, "[rejected]"),
+		strings.Contains(out, "stale info"),
+		strings.Contains(out, "non-fast-forward"),
+		strings.Contains(out, "already exists"),
+		strings.Contains(out, "required to be"),
+		strings.Contains(out, "would be overwritten"):
+		return errs.Conflict
+	case strings.Contains(out, "Authentication failed"),
+		strings.Contains(out, "Permission denied"),
+		strings.Contains(out, "could not read Username"),
+		strings.Contains(out, "returned error: 403"):
+		return errs.Auth
+	case strings.Contains(out, "not a git repository"),
+		strings.Contains(out, "does not appear to be a git repository"),
+		strings.Contains(out, "couldn't find remote ref"),
+		strings.Contains(out, "unknown revision"),
+		strings.Contains(out, "not a valid object name"),
+		strings.Contains(out, "did not match any"):
+		return errs.NotFound
+	case strings.Contains(out, "usage: git"),
+		strings.Contains(out, "unknown option"):
+		return errs.Validation
+	}
+	return errs.Unknown
 }
 
 func (c *gitcmd) RootDir() string {
@@ -133,7 +188,7 @@ func (c *gitcmd) DeleteRemoteBranch(ctx context.Context, branch string) error {
 
 	remote, err := c.repo.Remote(remoteName)
 	if err != nil {
-		return fmt.Errorf("getting remote %s %w", remoteName, err)
+		return errs.New(errs.NotFound, "getting remote %s %w", remoteName, err)
 	}
 
 	// Construct the reference name for branch
@@ -148,7 +203,7 @@ func (c *gitcmd) DeleteRemoteBranch(ctx context.Context, branch string) error {
 	// Delete the remote branch
 	err = remote.Push(&pushOptions)
 	if err != nil {
-		return fmt.Errorf("removing remote branch %s %w", branch, err)
+		return errs.New(gitErrorKind(err.Error()), "removing remote branch %s %w", branch, err)
 	}
 
 	return nil
@@ -0,0 +1,45 @@
+package realgit
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ejoffe/spr/errs"
+	"github.com/ejoffe/spr/git"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGitCmd(t *testing.T) {
+	cli, _, _ := makeTestRepos(t)
+	ctx := context.Background()
+
+	// arguments with spaces are passed to git as they are
+	_, err := cli.Git(ctx, "commit", "--quiet", "--allow-empty", "-m", "Add a parser  with spaces")
+	require.NoError(t, err)
+	subject, err := cli.Git(ctx, "log", "--format=%s", "-n", "1")
+	require.NoError(t, err)
+	require.Equal(t, "Add a parser  with spaces", subject)
+
+	// stdout and stderr are kept apart, the exit code is exposed
+	_, err = cli.Git(ctx, "rev-parse", "--verify", "--quiet", "refs/heads/missing")
+	code, ok := git.ExitCode(err)
+	require.True(t, ok)
+	require.Equal(t, 1, code)
+	_, err = cli.Git(ctx, "checkout", "missing branch")
+	var exitErr *git.ExitError
+	require.True(t, errors.As(err, &exitErr))
+	require.Equal(t, []string{"checkout", "missing branch"}, exitErr.Args)
+	require.Empty(t, exitErr.Stdout)
+	require.Contains(t, exitErr.Stderr, "'missing branch' did not match any")
+	require.Equal(t, errs.NotFound, errs.KindOf(err))
+	require.Contains(t, err.Error(), `git checkout "missing branch" : exit status 1`)
+
+	// cancelling the context stops the command
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = cli.Git(cancelled, "status")
+	require.ErrorIs(t, err, context.Canceled)
+	_, ok = git.ExitCode(err)
+	require.False(t, ok)
+}
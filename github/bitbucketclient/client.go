@@ -0,0 +1,664 @@
+package bitbucketclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ejoffe/spr/config"
+	"github.com/ejoffe/spr/errs"
+	"github.com/ejoffe/spr/git"
+	"github.com/ejoffe/spr/github"
+	"github.com/ejoffe/spr/github/githubclient/gen/genclient"
+	"github.com/ejoffe/spr/github/internal/rest"
+	"github.com/ejoffe/spr/github/template/config_fetcher"
+	"github.com/rs/zerolog/log"
+)
+
+const tokenHelpText = `
+No Bitbucket token found! Create an HTTP access token with repository write
+permission in your Bitbucket account settings on %s and set the
+BITBUCKET_TOKEN environment variable.
+`
+
+// api is the Bitbucket Data Center REST API, list apis return page objects
+var api = rest.API{
+	Name:       "bitbucket",
+	AuthHeader: "Authorization",
+	AuthScheme: "Bearer",
+	TokenHelp: "make sure BITBUCKET_TOKEN env variable is set with a valid token" +
+		"\n the token needs repository write permission",
+	Paging:    rest.StartPaging,
+	PageParam: "limit",
+	PageLimit: 100,
+}
+
+// NewBitbucketClient returns a client for the REST API of the configured
+//
+//	Bitbucket Server or Data Center host. githubRepoOwner is the project key
+//	and githubRepoName the repository slug. githubHost may include a scheme
+//	and a context path, for instance https://example.com/bitbucket.
+func NewBitbucketClient(ctx context.Context, config *config.Config) (*client, error) {
+	token, err := rest.Token(tokenHelpText, config.Repo.GitHubHost, "BITBUCKET_TOKEN")
+	if err != nil {
+		return nil, err
+	}
+	endpoint := rest.Endpoint(config.Repo.GitHubHost, "/rest")
+	return NewClient(config, endpoint, token, http.DefaultClient), nil
+}
+
+// NewClient returns a client for the Bitbucket REST API at endpoint
+func NewClient(config *config.Config, endpoint string, token string, httpClient *http.Client) *client {
+	return &client{
+		config: config,
+		rest:   rest.NewClient(api, endpoint, token, httpClient),
+	}
+}
+
+type client struct {
+	config *config.Config
+	rest   *rest.Client
+}
+
+type user struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+type participant struct {
+	User user `json:"user"`
+
+	// Status is APPROVED, NEEDS_WORK or UNAPPROVED
+	Status string `json:"status"`
+}
+
+type repository struct {
+	ID int `json:"id"`
+}
+
+type ref struct {
+	ID           string `json:"id"`
+	DisplayID    string `json:"displayId"`
+	LatestCommit string `json:"latestCommit"`
+}
+
+type pullRequest struct {
+	ID          int           `json:"id"`
+	Version     int           `json:"version"`
+	State       string        `json:"state"`
+	Title       string        `json:"title"`
+	Description string        `json:"description"`
+	FromRef     ref           `json:"fromRef"`
+	ToRef       ref           `json:"toRef"`
+	Author      participant   `json:"author"`
+	Reviewers   []participant `json:"reviewers"`
+}
+
+type commit struct {
+	ID      string `json:"id"`
+	Message string `json:"message"`
+}
+
+type mergeability struct {
+	CanMerge   bool `json:"canMerge"`
+	Conflicted bool `json:"conflicted"`
+}
+
+type buildStatus struct {
+	Key   string `json:"key"`
+	Name  string `json:"name"`
+	State string `json:"state"`
+}
+
+// repoPath returns the api path of the configured repository
+func (c *client) repoPath() string {
+	return "/api/1.0/projects/" + url.PathEscape(c.config.Repo.GitHubRepoOwner) +
+		"/repos/" + url.PathEscape(c.config.Repo.GitHubRepoName)
+}
+
+func (c *client) GetInfo(ctx context.Context, gitcmd git.GitInterface) (*github.GitHubInfo, error) {
+	if c.config.User.LogGitHubCalls {
+		fmt.Printf("> bitbucket fetch pull requests\n")
+	}
+
+	// bitbucket has no current user api, the authenticated user name is
+	//  returned in a header of every response
+	var repo repository
+	header, err := c.rest.Do(ctx, http.MethodGet, c.repoPath(), nil, &repo)
+	if err != nil {
+		return nil, err
+	}
+	userName := header.Get("X-AUSERNAME")
+
+	openPullRequests, err := c.openPullRequests(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	localCommitStack, err := git.GetLocalCommitStack(ctx, c.config, gitcmd)
+	if err != nil {
+		return nil, err
+	}
+	localCommitIDs := map[string]bool{}
+	for _, c := range localCommitStack {
+		localCommitIDs[c.CommitID] = true
+	}
+
+	branchRegex := git.BranchNameRegex(c.config.User.BranchPrefix)
+	pullRequestMap := map[string]*github.PullRequest{}
+	for _, listed := range openPullRequests {
+		matches := branchRegex.FindStringSubmatch(listed.FromRef.DisplayID)
+		if matches == nil || !localCommitIDs[matches[2]] {
+			continue
+		}
+		pr, err := c.fetchPullRequest(ctx, listed, matches[2])
+		if err != nil {
+			return nil, err
+		}
+		pullRequestMap[pr.Commit.CommitID] = pr
+	}
+
+	pullRequests, err := github.MatchPullRequestStack(c.config.User.BranchPrefix,
+		c.config.Repo.GitHubBranch, localCommitStack, pullRequestMap)
+	if err != nil {
+		return nil, errs.Wrap(errs.Validation, err)
+	}
+	github.MarkStacked(c.config, pullRequests)
+
+	localBranch := c.config.Stack
+	if localBranch == "" {
+		localBranch, err = git.GetLocalBranchName(ctx, gitcmd)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	info := &github.GitHubInfo{
+		UserName:     userName,
+		RepositoryID: strconv.Itoa(repo.ID),
+		LocalBranch:  localBranch,
+		PullRequests: pullRequests,
+	}
+
+	log.Debug().Interface("Info", info).Msg("GetInfo")
+	return info, nil
+}
+
+func (c *client) GetPullRequests(ctx context.Context) ([]*github.PullRequest, error) {
+	if c.config.User.LogGitHubCalls {
+		fmt.Printf("> bitbucket fetch pull requests\n")
+	}
+	openPullRequests, err := c.openPullRequests(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var pullRequests []*github.PullRequest
+	for _, listed := range openPullRequests {
+		pullRequests = append(pullRequests, &github.PullRequest{
+			ID:         strconv.Itoa(listed.ID),
+			Number:     listed.ID,
+			Title:      listed.Title,
+			Body:       listed.Description,
+			FromBranch: listed.FromRef.DisplayID,
+			ToBranch:   listed.ToRef.DisplayID,
+			Author:     listed.Author.User.Name,
+		})
+	}
+	return pullRequests, nil
+}
+
+// openPullRequests lists the open pull requests of the stacks into the
+// target branch, pull requests can only be filtered by exact branch name
+// so the head ref prefix is matched here.
+func (c *client) openPullRequests(ctx context.Context) ([]pullRequest, error) {
+	var listed []pullRequest
+	err := c.rest.RequestAll(ctx, c.repoPath()+"/pull-requests?state=OPEN", &listed)
+	if err != nil {
+		return nil, err
+	}
+	headRefPrefix := github.HeadRefPrefix(c.config.User.BranchPrefix, c.config.Repo.GitHubBranch)
+	var pullRequests []pullRequest
+	for _, pr := range listed {
+		if strings.HasPrefix(pr.FromRef.DisplayID, headRefPrefix) {
+			pullRequests = append(pullRequests, pr)
+		}
+	}
+	return pullRequests, nil
+}
+
+// fetchPullRequest fetches the commits, mergeability and build statuses of a
+//
+//	listed pull request and converts it to a spr pull request.
+func (c *client) fetchPullRequest(ctx context.Context, listed pullRequest, commitID string) (*github.PullRequest, error) {
+	prPath := fmt.Sprintf("%s/pull-requests/%d", c.repoPath(), listed.ID)
+
+	// commits are returned with the most recent commit first
+	var prCommits []commit
+	err := c.rest.RequestAll(ctx, prPath+"/commits", &prCommits)
+	if err != nil {
+		return nil, err
+	}
+	var commits []git.Commit
+	for i := len(prCommits) - 1; i >= 0; i-- {
+		subject, _, _ := strings.Cut(prCommits[i].Message, "\n")
+		for _, line := range strings.Split(prCommits[i].Message, "\n") {
+			if strings.HasPrefix(line, "commit-id:") {
+				commits = append(commits, git.Commit{
+					CommitID:   strings.TrimSpace(strings.Split(line, ":")[1]),
+					CommitHash: prCommits[i].ID,
+					Subject:    subject,
+					Body:       prCommits[i].Message,
+				})
+			}
+		}
+	}
+
+	var merge mergeability
+	err = c.rest.Request(ctx, http.MethodGet, prPath+"/merge", nil, &merge)
+	if err != nil {
+		return nil, err
+	}
+
+	var builds []buildStatus
+	err = c.rest.RequestAll(ctx, "/build-status/1.0/commits/"+listed.FromRef.LatestCommit, &builds)
+	if err != nil {
+		return nil, err
+	}
+
+	approved, changesRequested := reviewDecision(listed.Reviewers)
+	pr := &github.PullRequest{
+		ID:         strconv.Itoa(listed.ID),
+		Number:     listed.ID,
+		Title:      listed.Title,
+		Body:       listed.Description,
+		FromBranch: listed.FromRef.DisplayID,
+		ToBranch:   listed.ToRef.DisplayID,
+		Author:     listed.Author.User.Name,
+		Commits:    commits,
+		Commit: git.Commit{
+			CommitID:   commitID,
+			CommitHash: listed.FromRef.LatestCommit,
+		},
+		MergeStatus: github.PullRequestMergeStatus{
+			ReviewApproved:   approved,
+			ChangesRequested: changesRequested,
+			NoConflicts:      !merge.Conflicted,
+		},
+	}
+	if len(prCommits) > 0 {
+		pr.Commit.Subject, _, _ = strings.Cut(prCommits[0].Message, "\n")
+		pr.Commit.Body = prCommits[0].Message
+	}
+
+	reported := buildResults(builds)
+	pr.MergeStatus.ChecksPass = github.AggregateCheckStatus(reported)
+	if c.config.Repo.RequireChecks && len(c.config.Repo.RequiredChecks) > 0 {
+		required := map[string]bool{}
+		for _, name := range c.config.Repo.RequiredChecks {
+			required[name] = true
+		}
+		pr.Checks = github.RequiredCheckResults(reported, required)
+		pr.MergeStatus.ChecksPass = github.AggregateCheckStatus(pr.Checks)
+	}
+	return pr, nil
+}
+
+// reviewDecision returns whether a reviewer approved the pull request, and
+// whether any reviewer marked it as needs work, which withholds the approval.
+func reviewDecision(reviewers []participant) (approved bool, changesRequested bool) {
+	for _, reviewer := range reviewers {
+		switch reviewer.Status {
+		case "APPROVED":
+			approved = true
+		case "NEEDS_WORK":
+			changesRequested = true
+		}
+	}
+	return approved && !changesRequested, changesRequested
+}
+
+// buildResults returns the latest result of each build key. Builds are
+// listed with the most recent first, so reruns replace older results.
+func buildResults(builds []buildStatus) []github.Check {
+	seen := map[string]bool{}
+	checks := []github.Check{}
+	for _, build := range builds {
+		if seen[build.Key] {
+			continue
+		}
+		seen[build.Key] = true
+		checks = append(checks, github.Check{Name: build.Key, Status: buildCheckStatus(build.State)})
+	}
+	return checks
+}
+
+// buildCheckStatus maps a Bitbucket build state to a check status
+func buildCheckStatus(state string) github.CheckStatus {
+	switch state {
+	case "SUCCESSFUL":
+		return github.CheckStatusPass
+	case "FAILED", "CANCELLED":
+		return github.CheckStatusFail
+	default:
+		// INPROGRESS, UNKNOWN
+		return github.CheckStatusPending
+	}
+}
+
+// GetAssignableUsers returns the users with read access to the repository.
+// Bitbucket identifies users by name, so the name is also used as the ID.
+func (c *client) GetAssignableUsers(ctx context.Context) ([]github.RepoAssignee, error) {
+	if c.config.User.LogGitHubCalls {
+		fmt.Printf("> bitbucket get users\n")
+	}
+
+	query := url.Values{
+		"permission.1":                {"REPO_READ"},
+		"permission.1.projectKey":     {c.config.Repo.GitHubRepoOwner},
+		"permission.1.repositorySlug": {c.config.Repo.GitHubRepoName},
+	}
+	var users []user
+	err := c.rest.RequestAll(ctx, "/api/1.0/users?"+query.Encode(), &users)
+	if err != nil {
+		return nil, err
+	}
+
+	assignees := []github.RepoAssignee{}
+	for _, u := range users {
+		assignees = append(assignees, github.RepoAssignee{
+			ID:    u.Name,
+			Login: u.Name,
+			Name:  u.DisplayName,
+		})
+	}
+	return assignees, nil
+}
+
+func (c *client) CreatePullRequest(ctx context.Context, gitcmd git.GitInterface,
+	info *github.GitHubInfo, commit git.Commit, prevCommit *git.Commit) (*github.PullRequest, error) {
+
+	baseRefName := c.config.Repo.GitHubBranch
+	if prevCommit != nil {
+		baseRefName = git.BranchNameFromCommit(c.config, *prevCommit)
+	}
+	headRefName := git.BranchNameFromCommit(c.config, commit)
+
+	log.Debug().Interface("Commit", commit).
+		Str("FromBranch", headRefName).Str("ToBranch", baseRefName).
+		Msg("CreatePullRequest")
+
+	reviewers, err := c.defaultReviewers(ctx, info, headRefName, baseRefName)
+	if err != nil {
+		return nil, err
+	}
+
+	templatizer := config_fetcher.PRTemplatizer(c.config, gitcmd)
+	body, err := templatizer.Body(info, commit, nil)
+	if err != nil {
+		return nil, err
+	}
+	input := map[string]interface{}{
+		"title":       templatizer.Title(info, commit),
+		"description": body,
+		"fromRef":     map[string]string{"id": "refs/heads/" + headRefName},
+		"toRef":       map[string]string{"id": "refs/heads/" + baseRefName},
+		"reviewers":   reviewers,
+	}
+	if c.config.User.CreateDraftPRs {
+		input["draft"] = true
+	}
+
+	var created pullRequest
+	err = c.rest.Request(ctx, http.MethodPost, c.repoPath()+"/pull-requests", input, &created)
+	if err != nil {
+		return nil, err
+	}
+
+	pr := &github.PullRequest{
+		ID:         strconv.Itoa(created.ID),
+		Number:     created.ID,
+		FromBranch: headRefName,
+		ToBranch:   baseRefName,
+		Commit:     commit,
+		Title:      commit.Subject,
+		Body:       created.Description,
+		MergeStatus: github.PullRequestMergeStatus{
+			ChecksPass:     github.CheckStatusUnknown,
+			ReviewApproved: false,
+			NoConflicts:    false,
+			Stacked:        false,
+		},
+	}
+
+	if c.config.User.LogGitHubCalls {
+		fmt.Printf("> bitbucket create %d : %s\n", pr.Number, pr.Title)
+	}
+
+	return pr, nil
+}
+
+// defaultReviewers returns the default reviewers configured in Bitbucket for
+//
+//	a pull request from headRefName to baseRefName. Pull requests created
+//	through the api don't get default reviewers added automatically.
+func (c *client) defaultReviewers(ctx context.Context, info *github.GitHubInfo,
+	headRefName string, baseRefName string) ([]participant, error) {
+	query := url.Values{
+		"sourceRepoId": {info.RepositoryID},
+		"targetRepoId": {info.RepositoryID},
+		"sourceRefId":  {"refs/heads/" + headRefName},
+		"targetRefId":  {"refs/heads/" + baseRefName},
+	}
+	path := "/default-reviewers/1.0/projects/" + url.PathEscape(c.config.Repo.GitHubRepoOwner) +
+		"/repos/" + url.PathEscape(c.config.Repo.GitHubRepoName) + "/reviewers?" + query.Encode()
+	var users []user
+	err := c.rest.Request(ctx, http.MethodGet, path, nil, &users)
+	if err != nil {
+		return nil, err
+	}
+
+	reviewers := []participant{}
+	for _, u := range users {
+		// the author can't review their own pull request
+		if u.Name != info.UserName {
+			reviewers = append(reviewers, participant{User: user{Name: u.Name}})
+		}
+	}
+	return reviewers, nil
+}
+
+func (c *client) UpdatePullRequest(ctx context.Context, gitcmd git.GitInterface,
+	info *github.GitHubInfo, pullRequests []*github.PullRequest, pr *github.PullRequest,
+	commit git.Commit, prevCommit *git.Commit) error {
+
+	baseRefName := c.config.Repo.GitHubBranch
+	if prevCommit != nil {
+		baseRefName = git.BranchNameFromCommit(c.config, *prevCommit)
+	}
+
+	log.Debug().Interface("Commit", commit).
+		Str("FromBranch", pr.FromBranch).Str("ToBranch", baseRefName).
+		Interface("PR", pr).Msg("UpdatePullRequest")
+
+	templatizer := config_fetcher.PRTemplatizer(c.config, gitcmd)
+	title := templatizer.Title(info, commit)
+	body, err := templatizer.Body(info, commit, pr)
+	if err != nil {
+		return err
+	}
+
+	titleUnchanged := c.config.User.PreserveTitleAndBody || title == pr.Title
+	bodyUnchanged := c.config.User.PreserveTitleAndBody || body == pr.Body
+	if titleUnchanged && bodyUnchanged && baseRefName == pr.ToBranch {
+		if c.config.User.LogGitHubCalls {
+			fmt.Printf("> bitbucket update %d : %s (skipped, no changes)\n", pr.Number, pr.Title)
+		}
+		return nil
+	}
+
+	if c.config.User.LogGitHubCalls {
+		fmt.Printf("> bitbucket update %d : %s\n", pr.Number, pr.Title)
+	}
+
+	// updates must send the current version, description and reviewers,
+	//  which are removed when missing from the update
+	current, err := c.getPullRequest(ctx, pr)
+	if err != nil {
+		return err
+	}
+	input := map[string]interface{}{
+		"version":     current.Version,
+		"title":       current.Title,
+		"description": current.Description,
+		"reviewers":   current.Reviewers,
+		"toRef":       map[string]string{"id": "refs/heads/" + baseRefName},
+	}
+	if !c.config.User.PreserveTitleAndBody {
+		input["title"] = title
+		input["description"] = body
+	}
+
+	return c.rest.Request(ctx, http.MethodPut, c.pullRequestPath(pr), input, nil)
+}
+
+// AddReviewers adds reviewers, userIDs are the names returned by GetAssignableUsers
+func (c *client) AddReviewers(ctx context.Context, pr *github.PullRequest, userIDs []string) error {
+	log.Debug().Strs("userIDs", userIDs).Msg("AddReviewers")
+	if c.config.User.LogGitHubCalls {
+		fmt.Printf("> bitbucket add reviewers %d : %s - %+v\n", pr.Number, pr.Title, userIDs)
+	}
+	for _, userID := range userIDs {
+		err := c.rest.Request(ctx, http.MethodPost, c.pullRequestPath(pr)+"/participants", map[string]interface{}{
+			"user": map[string]string{"name": userID},
+			"role": "REVIEWER",
+		}, nil)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *client) CommentPullRequest(ctx context.Context, pr *github.PullRequest, comment string) error {
+	err := c.rest.Request(ctx, http.MethodPost, c.pullRequestPath(pr)+"/comments", map[string]interface{}{
+		"text": comment,
+	}, nil)
+	if err != nil {
+		return err
+	}
+
+	if c.config.User.LogGitHubCalls {
+		fmt.Printf("> bitbucket add comment %d : %s\n", pr.Number, pr.Title)
+	}
+	return nil
+}
+
+// MergePullRequest merges the pull request with the merge strategy matching
+// the configured merge method. The strategy must be enabled on the repository.
+func (c *client) MergePullRequest(ctx context.Context,
+	pr *github.PullRequest, mergeMethod genclient.PullRequestMergeMethod) error {
+	log.Debug().
+		Interface("PR", pr).
+		Str("mergeMethod", string(mergeMethod)).
+		Msg("MergePullRequest")
+
+	current, err := c.getPullRequest(ctx, pr)
+	if err != nil {
+		return err
+	}
+	path := fmt.Sprintf("%s/merge?version=%d", c.pullRequestPath(pr), current.Version)
+	err = c.rest.Request(ctx, http.MethodPost, path, map[string]interface{}{
+		"strategyId": mergeStrategy(mergeMethod),
+	}, nil)
+	if err != nil {
+		return err
+	}
+
+	if c.config.User.LogGitHubCalls {
+		fmt.Printf("> bitbucket merge %d : %s\n", pr.Number, pr.Title)
+	}
+	return nil
+}
+
+// mergeStrategy returns the bitbucket merge strategy of a merge method
+func mergeStrategy(mergeMethod genclient.PullRequestMergeMethod) string {
+	switch mergeMethod {
+	case genclient.PullRequestMergeMethod_SQUASH:
+		return "squash"
+	case genclient.PullRequestMergeMethod_REBASE:
+		return "rebase-ff-only"
+	default:
+		return "no-ff"
+	}
+}
+
+func (c *client) ClosePullRequest(ctx context.Context, pr *github.PullRequest) error {
+	log.Debug().Interface("PR", pr).Msg("ClosePullRequest")
+	current, err := c.getPullRequest(ctx, pr)
+	if err != nil {
+		return err
+	}
+	path := fmt.Sprintf("%s/decline?version=%d", c.pullRequestPath(pr), current.Version)
+	err = c.rest.Request(ctx, http.MethodPost, path, map[string]interface{}{}, nil)
+	if err != nil {
+		return err
+	}
+
+	if c.config.User.LogGitHubCalls {
+		fmt.Printf("> bitbucket close %d : %s\n", pr.Number, pr.Title)
+	}
+	return nil
+}
+
+func (c *client) RestorePullRequest(ctx context.Context, pr *github.PullRequest) error {
+	log.Debug().Interface("PR", pr).Msg("RestorePullRequest")
+	current, err := c.getPullRequest(ctx, pr)
+	if err != nil {
+		return err
+	}
+	if current.State == "DECLINED" {
+		path := fmt.Sprintf("%s/reopen?version=%d", c.pullRequestPath(pr), current.Version)
+		err = c.rest.Request(ctx, http.MethodPost, path, map[string]interface{}{}, nil)
+		if err != nil {
+			return err
+		}
+		current, err = c.getPullRequest(ctx, pr)
+		if err != nil {
+			return err
+		}
+	}
+	err = c.rest.Request(ctx, http.MethodPut, c.pullRequestPath(pr), map[string]interface{}{
+		"version":     current.Version,
+		"title":       pr.Title,
+		"description": pr.Body,
+		"reviewers":   current.Reviewers,
+		"toRef":       map[string]string{"id": "refs/heads/" + pr.ToBranch},
+	}, nil)
+	if err != nil {
+		return err
+	}
+
+	if c.config.User.LogGitHubCalls {
+		fmt.Printf("> bitbucket restore %d : %s\n", pr.Number, pr.Title)
+	}
+	return nil
+}
+
+// getPullRequest fetches the current state of the pull request, mutations
+// are rejected unless they send the current version.
+func (c *client) getPullRequest(ctx context.Context, pr *github.PullRequest) (pullRequest, error) {
+	var current pullRequest
+	err := c.rest.Request(ctx, http.MethodGet, c.pullRequestPath(pr), nil, &current)
+	return current, err
+}
+
+func (c *client) pullRequestPath(pr *github.PullRequest) string {
+	return fmt.Sprintf("%s/pull-requests/%d", c.repoPath(), pr.Number)
+}
+
+// requestAll fetches every page of a list api into result, which must be a
+// pointer to a slice.
@@ -0,0 +1,344 @@
+package bitbucketclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ejoffe/spr/config"
+	"github.com/ejoffe/spr/git"
+	"github.com/ejoffe/spr/git/mockgit"
+	"github.com/ejoffe/spr/github"
+	"github.com/ejoffe/spr/github/githubclient/gen/genclient"
+	"github.com/ejoffe/spr/github/internal/rest"
+	"github.com/ejoffe/spr/github/internal/resttest"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeBitbucket is a local stand-in for the parts of the Bitbucket Data
+//
+//	Center REST API used by spr.
+type fakeBitbucket struct {
+	*resttest.Server
+	pullRequests     []pullRequest
+	commits          map[int][]commit
+	conflicted       map[int]bool
+	declined         map[int]bool
+	builds           map[string][]buildStatus
+	users            []user
+	defaultReviewers []user
+}
+
+func newFakeBitbucket() *fakeBitbucket {
+	f := &fakeBitbucket{
+		commits:    map[int][]commit{},
+		conflicted: map[int]bool{},
+		declined:   map[int]bool{},
+		builds:     map[string][]buildStatus{},
+	}
+	f.Server = &resttest.Server{
+		AuthHeader:   "Authorization",
+		Auth:         "Bearer token",
+		Unauthorized: `{"errors":[{"message":"Authentication failed"}]}`,
+		Prefix:       repoPrefix,
+		Handler:      f.handle,
+	}
+	return f
+}
+
+const repoPrefix = "/rest/api/1.0/projects/PROJ/repos/repo"
+
+func (f *fakeBitbucket) handle(w http.ResponseWriter, r *http.Request, path string, body map[string]interface{}) {
+	w.Header().Set("X-AUSERNAME", "nobody")
+
+	switch {
+	case path == repoPrefix:
+		resttest.WriteJSON(w, repository{ID: 42})
+	case path == "/rest/api/1.0/users":
+		resttest.WritePage(w, r, rest.StartPaging, f.users)
+	case strings.HasPrefix(path, "/rest/default-reviewers/1.0/projects/PROJ/repos/repo/reviewers"):
+		resttest.WriteJSON(w, f.defaultReviewers)
+	case strings.HasPrefix(path, "/rest/build-status/1.0/commits/"):
+		resttest.WritePage(w, r, rest.StartPaging, f.builds[strings.TrimPrefix(path, "/rest/build-status/1.0/commits/")])
+	case path == repoPrefix+"/pull-requests" && r.Method == http.MethodGet:
+		var open []pullRequest
+		for _, pr := range f.pullRequests {
+			if r.URL.Query().Get("state") == "OPEN" {
+				open = append(open, pr)
+			}
+		}
+		resttest.WritePage(w, r, rest.StartPaging, open)
+	case path == repoPrefix+"/pull-requests" && r.Method == http.MethodPost:
+		resttest.WriteJSON(w, pullRequest{ID: 11, Version: 0,
+			Title:       body["title"].(string),
+			Description: body["description"].(string),
+		})
+	case strings.HasPrefix(path, repoPrefix+"/pull-requests/"):
+		parts := strings.Split(strings.TrimPrefix(path, repoPrefix+"/pull-requests/"), "/")
+		id, _ := strconv.Atoi(parts[0])
+		switch {
+		case len(parts) == 1 && r.Method == http.MethodGet:
+			state := "OPEN"
+			if f.declined[id] {
+				state = "DECLINED"
+			}
+			resttest.WriteJSON(w, pullRequest{ID: id, Version: 3, State: state, Title: "current",
+				Description: "current description",
+				Reviewers:   []participant{{User: user{Name: "alice"}, Status: "UNAPPROVED"}}})
+		case len(parts) == 1:
+			resttest.WriteJSON(w, map[string]interface{}{})
+		case parts[1] == "commits":
+			resttest.WritePage(w, r, rest.StartPaging, f.commits[id])
+		case parts[1] == "decline" || parts[1] == "reopen":
+			f.declined[id] = parts[1] == "decline"
+			resttest.WriteJSON(w, map[string]interface{}{})
+		case parts[1] == "merge" && r.Method == http.MethodGet:
+			resttest.WriteJSON(w, mergeability{CanMerge: !f.conflicted[id], Conflicted: f.conflicted[id]})
+		default:
+			resttest.WriteJSON(w, map[string]interface{}{})
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func makeTestClient(t *testing.T) (*client, *fakeBitbucket) {
+	fake := newFakeBitbucket()
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	cfg := config.EmptyConfig()
+	cfg.Repo.GitHubRepoOwner = "PROJ"
+	cfg.Repo.GitHubRepoName = "repo"
+	cfg.Repo.GitHubRemote = "origin"
+	cfg.Repo.GitHubBranch = "master"
+	cfg.Repo.RequireChecks = true
+	cfg.Repo.RequireApproval = true
+	cfg.Repo.PRTemplateType = "basic"
+	cfg.User.BranchPrefix = "spr"
+	return NewClient(cfg, server.URL+"/rest", "token", server.Client()), fake
+}
+
+func TestGetInfo(t *testing.T) {
+	c, fake := makeTestClient(t)
+	c.config.Repo.RequiredChecks = []string{"test"}
+
+	me := participant{User: user{Name: "nobody"}}
+	fake.pullRequests = []pullRequest{
+		{ID: 1, Title: "commit 1", Author: me,
+			FromRef: ref{DisplayID: "spr/master/00000001", LatestCommit: "c1"}, ToRef: ref{DisplayID: "master"},
+			Reviewers: []participant{{User: user{Name: "alice"}, Status: "APPROVED"}}},
+		{ID: 2, Title: "commit 2", Author: me,
+			FromRef: ref{DisplayID: "spr/master/00000002", LatestCommit: "c2"}, ToRef: ref{DisplayID: "spr/master/00000001"},
+			Reviewers: []participant{
+				{User: user{Name: "alice"}, Status: "APPROVED"},
+				{User: user{Name: "bob"}, Status: "NEEDS_WORK"},
+			}},
+		{ID: 3, Title: "not spr", Author: participant{User: user{Name: "other"}},
+			FromRef: ref{DisplayID: "feature", LatestCommit: "c3"}, ToRef: ref{DisplayID: "master"}},
+	}
+	fake.commits[1] = []commit{{ID: "c1", Message: "commit 1\n\ncommit-id:00000001"}}
+	fake.commits[2] = []commit{{ID: "c2", Message: "commit 2\n\ncommit-id:00000002"}}
+	fake.conflicted[2] = true
+	fake.builds["c1"] = []buildStatus{
+		{Key: "test", State: "SUCCESSFUL"},
+		{Key: "lint", State: "FAILED"},
+		{Key: "test", State: "FAILED"},
+	}
+	fake.builds["c2"] = []buildStatus{{Key: "test", State: "INPROGRESS"}}
+
+	gitmock := mockgit.NewMockGit(t)
+	gitmock.ExpectLogAndRespond([]*git.Commit{
+		{CommitID: "00000002", CommitHash: "l2", Subject: "commit 2"},
+		{CommitID: "00000001", CommitHash: "l1", Subject: "commit 1"},
+	})
+	gitmock.ExpectLocalBranch("* master")
+
+	info, err := c.GetInfo(context.Background(), gitmock)
+	require.NoError(t, err)
+	gitmock.ExpectationsMet()
+
+	require.Equal(t, "nobody", info.UserName)
+	require.Equal(t, "42", info.RepositoryID)
+	require.Equal(t, "master", info.LocalBranch)
+	require.Equal(t, []*github.PullRequest{
+		{
+			ID:         "1",
+			Number:     1,
+			Title:      "commit 1",
+			FromBranch: "spr/master/00000001",
+			ToBranch:   "master",
+			Author:     "nobody",
+			Commit: git.Commit{CommitID: "00000001", CommitHash: "c1",
+				Subject: "commit 1", Body: "commit 1\n\ncommit-id:00000001"},
+			Commits: []git.Commit{{CommitID: "00000001", CommitHash: "c1",
+				Subject: "commit 1", Body: "commit 1\n\ncommit-id:00000001"}},
+			Checks: []github.Check{{Name: "test", Status: github.CheckStatusPass}},
+			MergeStatus: github.PullRequestMergeStatus{
+				ChecksPass:     github.CheckStatusPass,
+				ReviewApproved: true,
+				NoConflicts:    true,
+				Stacked:        true,
+			},
+		},
+		{
+			ID:         "2",
+			Number:     2,
+			Title:      "commit 2",
+			FromBranch: "spr/master/00000002",
+			ToBranch:   "spr/master/00000001",
+			Author:     "nobody",
+			Commit: git.Commit{CommitID: "00000002", CommitHash: "c2",
+				Subject: "commit 2", Body: "commit 2\n\ncommit-id:00000002"},
+			Commits: []git.Commit{{CommitID: "00000002", CommitHash: "c2",
+				Subject: "commit 2", Body: "commit 2\n\ncommit-id:00000002"}},
+			Checks: []github.Check{{Name: "test", Status: github.CheckStatusPending}},
+			MergeStatus: github.PullRequestMergeStatus{
+				ChecksPass:       github.CheckStatusPending,
+				ChangesRequested: true,
+			},
+		},
+	}, info.PullRequests)
+}
+
+func TestGetPullRequests(t *testing.T) {
+	c, fake := makeTestClient(t)
+	fake.pullRequests = []pullRequest{
+		{ID: 1, Title: "commit 1", Author: participant{User: user{Name: "nobody"}},
+			FromRef: ref{DisplayID: "spr/master/00000001"}, ToRef: ref{DisplayID: "master"}},
+		{ID: 2, Title: "their commit", Author: participant{User: user{Name: "other"}},
+			FromRef: ref{DisplayID: "spr/master/000000a1"}, ToRef: ref{DisplayID: "master"}},
+		{ID: 3, Title: "not spr", Author: participant{User: user{Name: "other"}},
+			FromRef: ref{DisplayID: "feature"}, ToRef: ref{DisplayID: "master"}},
+	}
+
+	pullRequests, err := c.GetPullRequests(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []*github.PullRequest{
+		{ID: "1", Number: 1, Title: "commit 1", Author: "nobody",
+			FromBranch: "spr/master/00000001", ToBranch: "master"},
+		{ID: "2", Number: 2, Title: "their commit", Author: "other",
+			FromBranch: "spr/master/000000a1", ToBranch: "master"},
+	}, pullRequests)
+}
+
+func TestGetAssignableUsers(t *testing.T) {
+	c, fake := makeTestClient(t)
+	fake.users = []user{
+		{ID: 1, Name: "alice", DisplayName: "Alice"},
+		{ID: 2, Name: "bob", DisplayName: "Bob"},
+	}
+	users, err := c.GetAssignableUsers(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []github.RepoAssignee{
+		{ID: "alice", Login: "alice", Name: "Alice"},
+		{ID: "bob", Login: "bob", Name: "Bob"},
+	}, users)
+}
+
+func TestPullRequestMutations(t *testing.T) {
+	c, fake := makeTestClient(t)
+	fake.defaultReviewers = []user{{Name: "carol"}, {Name: "nobody"}}
+	ctx := context.Background()
+	info := &github.GitHubInfo{UserName: "nobody", RepositoryID: "42"}
+	c1 := git.Commit{CommitID: "00000001", CommitHash: "c1", Subject: "commit 1"}
+	c2 := git.Commit{CommitID: "00000002", CommitHash: "c2", Subject: "commit 2"}
+
+	pr, err := c.CreatePullRequest(ctx, nil, info, c2, &c1)
+	require.NoError(t, err)
+	require.Equal(t, 11, pr.Number)
+	require.Equal(t, "spr/master/00000002", pr.FromBranch)
+	require.Equal(t, "spr/master/00000001", pr.ToBranch)
+	description, _ := json.Marshal(pr.Body)
+
+	// retarget onto master when the commit below is merged
+	require.NoError(t, c.UpdatePullRequest(ctx, nil, info, nil, pr, c2, nil))
+	// nothing changed : no request
+	pr.ToBranch = "master"
+	require.NoError(t, c.UpdatePullRequest(ctx, nil, info, nil, pr, c2, nil))
+
+	require.NoError(t, c.AddReviewers(ctx, pr, []string{"bob"}))
+	require.NoError(t, c.CommentPullRequest(ctx, pr, "merged"))
+	require.NoError(t, c.MergePullRequest(ctx, pr, genclient.PullRequestMergeMethod_SQUASH))
+	require.NoError(t, c.ClosePullRequest(ctx, pr))
+	pr.Title = "restored"
+	require.NoError(t, c.RestorePullRequest(ctx, pr))
+
+	reviewers := `[{"user":{"id":0,"name":"alice","displayName":""},"status":"UNAPPROVED"}]`
+	require.Equal(t, []string{
+		`POST /pull-requests {"description":` + string(description) + `,"fromRef":{"id":"refs/heads/spr/master/00000002"},` +
+			`"reviewers":[{"status":"","user":{"displayName":"","id":0,"name":"carol"}}],"title":"commit 2","toRef":{"id":"refs/heads/spr/master/00000001"}}`,
+		`PUT /pull-requests/11 {"description":` + string(description) + `,"reviewers":` + normalize(reviewers) +
+			`,"title":"commit 2","toRef":{"id":"refs/heads/master"},"version":3}`,
+		`POST /pull-requests/11/participants {"role":"REVIEWER","user":{"name":"bob"}}`,
+		`POST /pull-requests/11/comments {"text":"merged"}`,
+		`POST /pull-requests/11/merge?version=3 {"strategyId":"squash"}`,
+		`POST /pull-requests/11/decline?version=3 {}`,
+		`POST /pull-requests/11/reopen?version=3 {}`,
+		`PUT /pull-requests/11 {"description":` + string(description) + `,"reviewers":` + normalize(reviewers) +
+			`,"title":"restored","toRef":{"id":"refs/heads/master"},"version":3}`,
+	}, fake.Requests())
+}
+
+func TestUpdatePreservesTitleAndBody(t *testing.T) {
+	c, fake := makeTestClient(t)
+	c.config.User.PreserveTitleAndBody = true
+	ctx := context.Background()
+	info := &github.GitHubInfo{UserName: "nobody", RepositoryID: "42"}
+	c1 := git.Commit{CommitID: "00000001", CommitHash: "c1", Subject: "commit 1"}
+	pr := &github.PullRequest{Number: 11, Title: "current", Body: "current description",
+		FromBranch: "spr/master/00000001", ToBranch: "spr/master/00000000"}
+
+	// only the base changes, the title and description are sent as they are
+	require.NoError(t, c.UpdatePullRequest(ctx, nil, info, nil, pr, c1, nil))
+	reviewers := `[{"user":{"id":0,"name":"alice","displayName":""},"status":"UNAPPROVED"}]`
+	require.Equal(t, []string{
+		`PUT /pull-requests/11 {"description":"current description","reviewers":` + normalize(reviewers) +
+			`,"title":"current","toRef":{"id":"refs/heads/master"},"version":3}`,
+	}, fake.Requests())
+}
+
+// normalize re-encodes json the way the fake server records request bodies
+func normalize(data string) string {
+	var v interface{}
+	json.Unmarshal([]byte(data), &v)
+	out, _ := json.Marshal(v)
+	return string(out)
+}
+
+func TestReviewDecision(t *testing.T) {
+	tests := []struct {
+		name             string
+		reviewers        []participant
+		approved         bool
+		changesRequested bool
+	}{
+		{name: "none"},
+		{name: "unapproved", reviewers: []participant{{Status: "UNAPPROVED"}}},
+		{name: "approved", approved: true, reviewers: []participant{
+			{Status: "APPROVED"},
+			{Status: "UNAPPROVED"},
+		}},
+		{name: "needs work", changesRequested: true, reviewers: []participant{
+			{Status: "APPROVED"},
+			{Status: "NEEDS_WORK"},
+		}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			approved, changesRequested := reviewDecision(tc.reviewers)
+			require.Equal(t, tc.approved, approved)
+			require.Equal(t, tc.changesRequested, changesRequested)
+		})
+	}
+}
+
+func TestMergeStrategy(t *testing.T) {
+	require.Equal(t, "squash", mergeStrategy(genclient.PullRequestMergeMethod_SQUASH))
+	require.Equal(t, "rebase-ff-only", mergeStrategy(genclient.PullRequestMergeMethod_REBASE))
+	require.Equal(t, "no-ff", mergeStrategy(genclient.PullRequestMergeMethod_MERGE))
+}
@@ -0,0 +1,170 @@
+package fakegithub
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	SandboxOwner  = "spr-sandbox"
+	SandboxRepo   = "demo"
+	SandboxViewer = "octocat"
+	SandboxBranch = "main"
+)
+
+// Sandbox is a local playground for spr, made of a bare repository acting
+//
+//	as the GitHub remote, a fake GitHub server serving it and a clone with a
+//	stack of commits ready to be turned into pull requests.
+type Sandbox struct {
+	Server *Server
+
+	// URL is the base url of the fake GitHub server
+	URL string
+
+	// OriginDir is the bare repository used as the origin remote
+	OriginDir string
+
+	// WorkDir is the clone spr is run in
+	WorkDir string
+
+	httpServer *httptest.Server
+}
+
+// NewSandbox creates a sandbox in dir and starts its fake GitHub server.
+//
+//	The clone is configured through its .spr.yml to talk to the fake server,
+//	Close must be called to stop the server.
+func NewSandbox(dir string) (*Sandbox, error) {
+	sb := &Sandbox{
+		OriginDir: filepath.Join(dir, "origin.git"),
+		WorkDir:   filepath.Join(dir, SandboxRepo),
+	}
+
+	err := initOrigin(dir, sb.OriginDir)
+	if err != nil {
+		return nil, err
+	}
+	_, err = runGit(dir, "clone", "--quiet", sb.OriginDir, sb.WorkDir)
+	if err != nil {
+		return nil, err
+	}
+	_, err = runGit(sb.WorkDir, "config", "user.name", "Sandbox User")
+	if err != nil {
+		return nil, err
+	}
+	_, err = runGit(sb.WorkDir, "config", "user.email", "sandbox@example.com")
+	if err != nil {
+		return nil, err
+	}
+
+	sb.Server = NewServer(sb.OriginDir, SandboxOwner, SandboxRepo, SandboxViewer)
+	sb.Server.AddUser("hubot", "Hubot")
+	sb.httpServer = httptest.NewServer(sb.Server)
+	sb.URL = sb.httpServer.URL
+
+	config := strings.Join([]string{
+		"githubRepoOwner: " + SandboxOwner,
+		"githubRepoName: " + SandboxRepo,
+		"githubHost: " + sb.URL,
+		"githubRemote: origin",
+		"githubBranch: " + SandboxBranch,
+		"forge: github",
+		"requireChecks: false",
+		"requireApproval: false",
+		"mergeMethod: rebase",
+		"",
+	}, "\n")
+	err = os.WriteFile(filepath.Join(sb.WorkDir, ".spr.yml"), []byte(config), 0644)
+	if err != nil {
+		sb.Close()
+		return nil, err
+	}
+	err = os.WriteFile(filepath.Join(sb.WorkDir, ".git", "info", "exclude"), []byte(".spr.yml\n"), 0644)
+	if err != nil {
+		sb.Close()
+		return nil, err
+	}
+
+	for i, feature := range []string{"parser", "lexer", "printer"} {
+		err = sb.Commit(fmt.Sprintf("Add %s", feature), fmt.Sprintf("%s.txt", feature),
+			fmt.Sprintf("the %s\n", feature), fmt.Sprintf("%08x", 0xa1b2c3d0+i))
+		if err != nil {
+			sb.Close()
+			return nil, err
+		}
+	}
+	return sb, nil
+}
+
+// Commit writes content to file in the clone and commits it with the given
+// headline and commit-id.
+func (sb *Sandbox) Commit(headline string, file string, content string, commitID string) error {
+	err := os.WriteFile(filepath.Join(sb.WorkDir, file), []byte(content), 0644)
+	if err != nil {
+		return err
+	}
+	_, err = runGit(sb.WorkDir, "add", file)
+	if err != nil {
+		return err
+	}
+	_, err = runGit(sb.WorkDir, "commit", "--quiet", "-m", headline, "-m", "commit-id:"+commitID)
+	return err
+}
+
+// Push pushes the commit at rev in the clone to branch on the origin, as
+// another user working on the repository would.
+func (sb *Sandbox) Push(rev string, branch string) error {
+	_, err := runGit(sb.WorkDir, "push", "--quiet", "--force", "origin", rev+":refs/heads/"+branch)
+	return err
+}
+
+// Close stops the fake GitHub server
+func (sb *Sandbox) Close() {
+	sb.httpServer.Close()
+}
+
+// initOrigin creates the bare origin repository with an initial commit on
+// the sandbox branch.
+func initOrigin(dir string, originDir string) error {
+	_, err := runGit(dir, "init", "--quiet", "--bare", "--initial-branch="+SandboxBranch, originDir)
+	if err != nil {
+		return err
+	}
+	blob, err := runGitInput(originDir, "# demo\n", "hash-object", "-w", "--stdin")
+	if err != nil {
+		return err
+	}
+	tree, err := runGitInput(originDir, "100644 blob "+blob+"\treadme.md\n", "mktree")
+	if err != nil {
+		return err
+	}
+	commit, err := runGit(originDir, "commit-tree", tree, "-m", "Initial commit")
+	if err != nil {
+		return err
+	}
+	_, err = runGit(originDir, "update-ref", "refs/heads/"+SandboxBranch, commit)
+	return err
+}
+
+func runGit(dir string, args ...string) (string, error) {
+	return runGitInput(dir, "", args...)
+}
+
+func runGitInput(dir string, input string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Stdin = strings.NewReader(input)
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=Sandbox User", "GIT_AUTHOR_EMAIL=sandbox@example.com",
+		"GIT_COMMITTER_NAME=Sandbox User", "GIT_COMMITTER_EMAIL=sandbox@example.com")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("git %s : %w\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,958 @@
+package fakegithub
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ejoffe/spr/github/githubclient/gen/genclient"
+	"github.com/rs/zerolog/log"
+)
+
+// CheckState is the state of a check run reported on a commit
+type CheckState string
+
+const (
+	CheckSuccess CheckState = "SUCCESS"
+	CheckFailure CheckState = "FAILURE"
+	CheckPending CheckState = "PENDING"
+)
+
+// PullRequestState is the state of a pull request
+type PullRequestState string
+
+const (
+	StateOpen   PullRequestState = "OPEN"
+	StateClosed PullRequestState = "CLOSED"
+	StateMerged PullRequestState = "MERGED"
+)
+
+// PullRequest is a pull request stored by the fake server
+type PullRequest struct {
+	ID          string
+	Number      int
+	Author      string
+	Title       string
+	Body        string
+	BaseRefName string
+	HeadRefName string
+	State       PullRequestState
+	Draft       bool
+
+	// ReviewDecision is empty, APPROVED or CHANGES_REQUESTED
+	ReviewDecision string
+
+	// InMergeQueue is set when auto merge is enabled, the pull request is
+	// merged by MergeQueued.
+	InMergeQueue bool
+	MergeMethod  genclient.PullRequestMergeMethod
+
+	Reviewers []string
+	Comments  []string
+}
+
+// User is an assignable user of the fake repository
+type User struct {
+	Login string
+	Name  string
+}
+
+// Server is an in-process fake of the GitHub GraphQL api used by spr.
+//
+//	It serves the operations of githubclient/queries.graphql and the raw
+//	check contexts query. Pull requests are kept in memory, their commits,
+//	mergeability and merges are computed from a bare git repository which
+//	plays the role of the GitHub remote.
+type Server struct {
+	// PageSize is the number of nodes returned per page of a connection
+	PageSize int
+
+	mu sync.Mutex
+
+	repoDir string
+	owner   string
+	name    string
+	viewer  string
+
+	pullRequests []*PullRequest
+	users        []User
+
+	// checks maps a commit oid to the state of each check run on it
+	checks map[string]map[string]CheckState
+
+	// operations counts the requests served by operation name
+	operations map[string]int
+}
+
+// NewServer returns a fake GitHub server for the repository owner/name stored
+// in the bare git repository at repoDir. Requests are made as viewer.
+func NewServer(repoDir string, owner string, name string, viewer string) *Server {
+	return &Server{
+		PageSize: 100,
+		repoDir:  repoDir,
+		owner:    owner,
+		name:     name,
+		viewer:   viewer,
+		users:    []User{{Login: viewer}},
+		checks:   map[string]map[string]CheckState{},
+
+		operations: map[string]int{},
+	}
+}
+
+// RepositoryID returns the graphql id of the fake repository
+func (s *Server) RepositoryID() string {
+	return "R_" + s.owner + "_" + s.name
+}
+
+// AddUser adds an assignable user, which can be requested as a reviewer
+func (s *Server) AddUser(login string, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users = append(s.users, User{Login: login, Name: name})
+}
+
+// PullRequests returns a copy of all the pull requests, ordered by number
+func (s *Server) PullRequests() []PullRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prs := make([]PullRequest, 0, len(s.pullRequests))
+	for _, pr := range s.pullRequests {
+		prs = append(prs, *pr)
+	}
+	return prs
+}
+
+// Operations returns the number of requests served for each operation
+func (s *Server) Operations() map[string]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	operations := make(map[string]int, len(s.operations))
+	for name, count := range s.operations {
+		operations[name] = count
+	}
+	return operations
+}
+
+// Approve sets the review decision of the pull request to approved
+func (s *Server) Approve(number int) error {
+	return s.setReviewDecision(number, "APPROVED")
+}
+
+// RequestChanges sets the review decision of the pull request to changes requested
+func (s *Server) RequestChanges(number int) error {
+	return s.setReviewDecision(number, "CHANGES_REQUESTED")
+}
+
+func (s *Server) setReviewDecision(number int, decision string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pr := s.pullRequestByNumber(number)
+	if pr == nil {
+		return fmt.Errorf("pull request #%d not found", number)
+	}
+	pr.ReviewDecision = decision
+	return nil
+}
+
+// SetCheck reports a check run on the current head commit of the pull
+// request. Pushing new commits to the pull request resets its checks.
+func (s *Server) SetCheck(number int, name string, state CheckState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pr := s.pullRequestByNumber(number)
+	if pr == nil {
+		return fmt.Errorf("pull request #%d not found", number)
+	}
+	oid, err := s.revParse(pr.HeadRefName)
+	if err != nil {
+		return err
+	}
+	if s.checks[oid] == nil {
+		s.checks[oid] = map[string]CheckState{}
+	}
+	s.checks[oid][name] = state
+	return nil
+}
+
+// MergeQueued merges the pull requests with auto merge enabled, in the order
+// they were created.
+func (s *Server) MergeQueued() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, pr := range s.pullRequests {
+		if pr.State == StateOpen && pr.InMergeQueue {
+			err := s.merge(pr, pr.MergeMethod)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+type graphqlRequest struct {
+	OperationName string          `json:"operationName"`
+	Query         string          `json:"query"`
+	Variables     json.RawMessage `json:"variables"`
+}
+
+type graphqlError struct {
+	Message string `json:"message"`
+}
+
+type graphqlResponse struct {
+	Data   interface{}    `json:"data"`
+	Errors []graphqlError `json:"errors,omitempty"`
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.URL.Path != "/api/graphql" {
+		http.NotFound(w, r)
+		return
+	}
+
+	var req graphqlRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Debug().Str("operation", req.OperationName).Msg("fakegithub request")
+
+	s.mu.Lock()
+	s.operations[req.OperationName]++
+	data, err := s.handle(req)
+	s.mu.Unlock()
+
+	resp := graphqlResponse{Data: data}
+	if err != nil {
+		resp = graphqlResponse{Errors: []graphqlError{{Message: err.Error()}}}
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// checkContextsRegex matches the aliased pull request nodes of the raw
+// check contexts query built by githubclient.
+var checkContextsRegex = regexp.MustCompile(`pr_(\d+): node\(id: "([^"]+)"\)`)
+
+func (s *Server) handle(req graphqlRequest) (interface{}, error) {
+	switch req.OperationName {
+	case "PullRequestHeads":
+		var vars struct {
+			RepoOwner string `json:"repo_owner"`
+			RepoName  string `json:"repo_name"`
+			EndCursor string `json:"end_cursor"`
+		}
+		if err := json.Unmarshal(req.Variables, &vars); err != nil {
+			return nil, err
+		}
+		return s.pullRequestHeads(vars.RepoOwner, vars.RepoName, vars.EndCursor)
+	case "PullRequest", "PullRequestWithMergeQueue":
+		var vars struct {
+			RepoOwner string `json:"repo_owner"`
+			RepoName  string `json:"repo_name"`
+			Number    int    `json:"number"`
+		}
+		if err := json.Unmarshal(req.Variables, &vars); err != nil {
+			return nil, err
+		}
+		return s.repositoryPullRequest(vars.RepoOwner, vars.RepoName, vars.Number)
+	case "PullRequestCommits":
+		var vars struct {
+			RepoOwner string `json:"repo_owner"`
+			RepoName  string `json:"repo_name"`
+			Number    int    `json:"number"`
+			EndCursor string `json:"end_cursor"`
+		}
+		if err := json.Unmarshal(req.Variables, &vars); err != nil {
+			return nil, err
+		}
+		return s.pullRequestCommits(vars.RepoOwner, vars.RepoName, vars.Number, vars.EndCursor)
+	case "AssignableUsers":
+		return s.assignableUsers(), nil
+	case "CreatePullRequest":
+		var input genclient.CreatePullRequestInput
+		if err := decodeInput(req.Variables, &input); err != nil {
+			return nil, err
+		}
+		return s.createPullRequest(input)
+	case "UpdatePullRequest":
+		var input genclient.UpdatePullRequestInput
+		if err := decodeInput(req.Variables, &input); err != nil {
+			return nil, err
+		}
+		return s.updatePullRequest(input)
+	case "AddReviewers":
+		var input genclient.RequestReviewsInput
+		if err := decodeInput(req.Variables, &input); err != nil {
+			return nil, err
+		}
+		return s.requestReviews(input)
+	case "CommentPullRequest":
+		var input genclient.AddCommentInput
+		if err := decodeInput(req.Variables, &input); err != nil {
+			return nil, err
+		}
+		return s.addComment(input)
+	case "MergePullRequest":
+		var input genclient.MergePullRequestInput
+		if err := decodeInput(req.Variables, &input); err != nil {
+			return nil, err
+		}
+		return s.mergePullRequest(input)
+	case "AutoMergePullRequest":
+		var input genclient.EnablePullRequestAutoMergeInput
+		if err := decodeInput(req.Variables, &input); err != nil {
+			return nil, err
+		}
+		return s.enableAutoMerge(input)
+	case "ClosePullRequest":
+		var input genclient.ClosePullRequestInput
+		if err := decodeInput(req.Variables, &input); err != nil {
+			return nil, err
+		}
+		return s.closePullRequest(input)
+	case "StarCheck":
+		// nothing is ever starred on the fake server
+		return map[string]interface{}{
+			"viewer": map[string]interface{}{
+				"starredRepositories": map[string]interface{}{
+					"nodes": []interface{}{}, "edges": []interface{}{}, "totalCount": 0,
+				},
+			},
+		}, nil
+	case "StarGetRepo":
+		return map[string]interface{}{"repository": map[string]interface{}{"id": "R_ejoffe_spr"}}, nil
+	case "StarAdd":
+		return map[string]interface{}{"addStar": map[string]interface{}{"clientMutationId": nil}}, nil
+	case "":
+		if matches := checkContextsRegex.FindAllStringSubmatch(req.Query, -1); matches != nil {
+			return s.checkContexts(matches)
+		}
+	}
+	return nil, fmt.Errorf("fake github: unsupported operation %q", req.OperationName)
+}
+
+// decodeInput decodes the input variable of a mutation
+func decodeInput(variables json.RawMessage, input interface{}) error {
+	var vars struct {
+		Input json.RawMessage `json:"input"`
+	}
+	err := json.Unmarshal(variables, &vars)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(vars.Input, input)
+}
+
+func (s *Server) checkRepository(owner string, name string) error {
+	if owner != s.owner || name != s.name {
+		return fmt.Errorf("Could not resolve to a Repository with the name '%s/%s'.", owner, name)
+	}
+	return nil
+}
+
+// page returns the bounds of the page of a connection of count items
+//
+//	starting after cursor, and the page info of the connection. Cursors are
+//	the index of the last item of the previous page.
+func (s *Server) page(count int, cursor string) (int, int, interface{}, error) {
+	start := 0
+	if cursor != "" {
+		index, err := strconv.Atoi(cursor)
+		if err != nil {
+			return 0, 0, nil, fmt.Errorf("`%s` does not appear to be a valid cursor.", cursor)
+		}
+		start = index + 1
+	}
+	start = min(start, count)
+	end := min(start+s.PageSize, count)
+
+	var endCursor interface{}
+	if end > start {
+		endCursor = strconv.Itoa(end - 1)
+	}
+	pageInfo := map[string]interface{}{
+		"hasNextPage": end < count,
+		"endCursor":   endCursor,
+	}
+	return start, end, pageInfo, nil
+}
+
+func (s *Server) pullRequestHeads(owner string, name string, cursor string) (interface{}, error) {
+	err := s.checkRepository(owner, name)
+	if err != nil {
+		return nil, err
+	}
+	var open []*PullRequest
+	for _, pr := range s.pullRequests {
+		if pr.State == StateOpen {
+			open = append(open, pr)
+		}
+	}
+	start, end, pageInfo, err := s.page(len(open), cursor)
+	if err != nil {
+		return nil, err
+	}
+	nodes := []interface{}{}
+	for _, pr := range open[start:end] {
+		nodes = append(nodes, map[string]interface{}{
+			"id":          pr.ID,
+			"number":      pr.Number,
+			"title":       pr.Title,
+			"body":        pr.Body,
+			"baseRefName": pr.BaseRefName,
+			"headRefName": pr.HeadRefName,
+			"author":      map[string]interface{}{"login": pr.Author},
+		})
+	}
+	return map[string]interface{}{
+		"viewer": map[string]interface{}{"login": s.viewer},
+		"repository": map[string]interface{}{
+			"id": s.RepositoryID(),
+			"pullRequests": map[string]interface{}{
+				"nodes":    nodes,
+				"pageInfo": pageInfo,
+			},
+		},
+	}, nil
+}
+
+func (s *Server) repositoryPullRequest(owner string, name string, number int) (interface{}, error) {
+	err := s.checkRepository(owner, name)
+	if err != nil {
+		return nil, err
+	}
+	pr := s.pullRequestByNumber(number)
+	if pr == nil {
+		return nil, fmt.Errorf("Could not resolve to a PullRequest with the number of %d.", number)
+	}
+	node, err := s.pullRequestNode(pr)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"repository": map[string]interface{}{"pullRequest": node},
+	}, nil
+}
+
+func (s *Server) pullRequestCommits(owner string, name string, number int, cursor string) (interface{}, error) {
+	err := s.checkRepository(owner, name)
+	if err != nil {
+		return nil, err
+	}
+	pr := s.pullRequestByNumber(number)
+	if pr == nil {
+		return nil, fmt.Errorf("Could not resolve to a PullRequest with the number of %d.", number)
+	}
+	commits, err := s.commitConnection(pr, cursor)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"repository": map[string]interface{}{
+			"pullRequest": map[string]interface{}{"commits": commits},
+		},
+	}, nil
+}
+
+func (s *Server) pullRequestNode(pr *PullRequest) (interface{}, error) {
+	commits, err := s.commitConnection(pr, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var reviewDecision interface{}
+	if pr.ReviewDecision != "" {
+		reviewDecision = pr.ReviewDecision
+	}
+	var mergeQueueEntry interface{}
+	if pr.InMergeQueue {
+		mergeQueueEntry = map[string]interface{}{"id": "MQE_" + strconv.Itoa(pr.Number)}
+	}
+	return map[string]interface{}{
+		"id":              pr.ID,
+		"number":          pr.Number,
+		"title":           pr.Title,
+		"body":            pr.Body,
+		"state":           pr.State,
+		"baseRefName":     pr.BaseRefName,
+		"headRefName":     pr.HeadRefName,
+		"mergeable":       s.mergeable(pr),
+		"reviewDecision":  reviewDecision,
+		"author":          map[string]interface{}{"login": pr.Author},
+		"repository":      map[string]interface{}{"id": s.RepositoryID()},
+		"mergeQueueEntry": mergeQueueEntry,
+		"commits":         commits,
+	}, nil
+}
+
+// commitConnection returns the page of the commits of the pull request
+// starting after cursor.
+func (s *Server) commitConnection(pr *PullRequest, cursor string) (interface{}, error) {
+	commits, err := s.commits(pr.BaseRefName, pr.HeadRefName)
+	if err != nil {
+		return nil, err
+	}
+	start, end, pageInfo, err := s.page(len(commits), cursor)
+	if err != nil {
+		return nil, err
+	}
+	nodes := []interface{}{}
+	for _, c := range commits[start:end] {
+		var rollup interface{}
+		if state, found := s.rollupState(c.oid); found {
+			rollup = map[string]interface{}{"state": state}
+		}
+		nodes = append(nodes, map[string]interface{}{
+			"commit": map[string]interface{}{
+				"oid":               c.oid,
+				"messageHeadline":   c.headline,
+				"messageBody":       c.body,
+				"statusCheckRollup": rollup,
+			},
+		})
+	}
+	return map[string]interface{}{"nodes": nodes, "pageInfo": pageInfo}, nil
+}
+
+// rollupState returns the combined state of the checks on a commit
+func (s *Server) rollupState(oid string) (CheckState, bool) {
+	checks := s.checks[oid]
+	if len(checks) == 0 {
+		return "", false
+	}
+	state := CheckSuccess
+	for _, checkState := range checks {
+		if checkState == CheckFailure {
+			return CheckFailure, true
+		}
+		if checkState == CheckPending {
+			state = CheckPending
+		}
+	}
+	return state, true
+}
+
+func (s *Server) checkContexts(matches [][]string) (interface{}, error) {
+	data := map[string]interface{}{}
+	for _, match := range matches {
+		pr := s.pullRequestByID(match[2])
+		if pr == nil {
+			data["pr_"+match[1]] = nil
+			continue
+		}
+		oid, err := s.revParse(pr.HeadRefName)
+		if err != nil {
+			return nil, err
+		}
+
+		var rollup interface{}
+		if checks := s.checks[oid]; len(checks) > 0 {
+			names := make([]string, 0, len(checks))
+			for name := range checks {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			contexts := []interface{}{}
+			for _, name := range names {
+				node := map[string]interface{}{
+					"__typename": "CheckRun",
+					"name":       name,
+					"status":     "COMPLETED",
+					"conclusion": string(checks[name]),
+				}
+				if checks[name] == CheckPending {
+					node["status"] = "IN_PROGRESS"
+					node["conclusion"] = nil
+				}
+				contexts = append(contexts, node)
+			}
+			rollup = map[string]interface{}{"contexts": map[string]interface{}{"nodes": contexts}}
+		}
+
+		data["pr_"+match[1]] = map[string]interface{}{
+			"number": pr.Number,
+			"commits": map[string]interface{}{"nodes": []interface{}{
+				map[string]interface{}{"commit": map[string]interface{}{"statusCheckRollup": rollup}},
+			}},
+		}
+	}
+	return data, nil
+}
+
+func (s *Server) assignableUsers() interface{} {
+	nodes := []interface{}{}
+	for _, u := range s.users {
+		nodes = append(nodes, map[string]interface{}{
+			"id":    userID(u.Login),
+			"login": u.Login,
+			"name":  u.Name,
+		})
+	}
+	return map[string]interface{}{
+		"repository": map[string]interface{}{
+			"assignableUsers": map[string]interface{}{
+				"nodes":    nodes,
+				"pageInfo": map[string]interface{}{"hasNextPage": false, "endCursor": nil},
+			},
+		},
+	}
+}
+
+func userID(login string) string {
+	return "U_" + login
+}
+
+// CreatePullRequest opens a pull request authored by another user than the
+// viewer, it returns the number of the pull request.
+func (s *Server) CreatePullRequest(author string, base string, head string, title string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pr, err := s.newPullRequest(author, genclient.CreatePullRequestInput{
+		RepositoryId: s.RepositoryID(),
+		BaseRefName:  base,
+		HeadRefName:  head,
+		Title:        title,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return pr.Number, nil
+}
+
+func (s *Server) createPullRequest(input genclient.CreatePullRequestInput) (interface{}, error) {
+	pr, err := s.newPullRequest(s.viewer, input)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"createPullRequest": map[string]interface{}{
+			"pullRequest": map[string]interface{}{"id": pr.ID, "number": pr.Number, "body": pr.Body},
+		},
+	}, nil
+}
+
+func (s *Server) newPullRequest(author string, input genclient.CreatePullRequestInput) (*PullRequest, error) {
+	if input.RepositoryId != s.RepositoryID() {
+		return nil, fmt.Errorf("Could not resolve to a node with the global id of '%s'", input.RepositoryId)
+	}
+	for _, pr := range s.pullRequests {
+		if pr.State == StateOpen && pr.HeadRefName == input.HeadRefName {
+			return nil, fmt.Errorf("A pull request already exists for %s:%s.", s.owner, input.HeadRefName)
+		}
+	}
+	commits, err := s.commits(input.BaseRefName, input.HeadRefName)
+	if err != nil {
+		return nil, err
+	}
+	if len(commits) == 0 {
+		return nil, fmt.Errorf("No commits between %s and %s", input.BaseRefName, input.HeadRefName)
+	}
+
+	number := len(s.pullRequests) + 1
+	pr := &PullRequest{
+		ID:          "PR_" + strconv.Itoa(number),
+		Number:      number,
+		Author:      author,
+		Title:       input.Title,
+		BaseRefName: input.BaseRefName,
+		HeadRefName: input.HeadRefName,
+		State:       StateOpen,
+	}
+	if input.Body != nil {
+		pr.Body = *input.Body
+	}
+	if input.Draft != nil {
+		pr.Draft = *input.Draft
+	}
+	s.pullRequests = append(s.pullRequests, pr)
+	return pr, nil
+}
+
+func (s *Server) updatePullRequest(input genclient.UpdatePullRequestInput) (interface{}, error) {
+	// closed pull requests can be reopened by the update, merged ones can't
+	if input.State != nil && *input.State == genclient.PullRequestUpdateState_OPEN {
+		pr := s.pullRequestByID(input.PullRequestId)
+		if pr != nil && pr.State == StateClosed {
+			if err := s.reopen(pr); err != nil {
+				return nil, err
+			}
+		}
+	}
+	pr, err := s.openPullRequest(input.PullRequestId)
+	if err != nil {
+		return nil, err
+	}
+	if input.State != nil && *input.State == genclient.PullRequestUpdateState_CLOSED {
+		pr.State = StateClosed
+		pr.InMergeQueue = false
+	}
+	if input.BaseRefName != nil {
+		if _, err := s.revParse(*input.BaseRefName); err != nil {
+			return nil, fmt.Errorf("Proposed base branch '%s' was not found", *input.BaseRefName)
+		}
+		pr.BaseRefName = *input.BaseRefName
+	}
+	if input.Title != nil {
+		pr.Title = *input.Title
+	}
+	if input.Body != nil {
+		pr.Body = *input.Body
+	}
+	return pullRequestPayload("updatePullRequest", pr), nil
+}
+
+func (s *Server) requestReviews(input genclient.RequestReviewsInput) (interface{}, error) {
+	pr, err := s.openPullRequest(input.PullRequestId)
+	if err != nil {
+		return nil, err
+	}
+	var reviewers []string
+	if input.Union != nil && *input.Union {
+		reviewers = pr.Reviewers
+	}
+	if input.UserIds != nil {
+		for _, id := range *input.UserIds {
+			login, found := strings.CutPrefix(id, "U_")
+			if !found {
+				return nil, fmt.Errorf("Could not resolve to a node with the global id of '%s'", id)
+			}
+			reviewers = append(reviewers, login)
+		}
+	}
+	pr.Reviewers = reviewers
+	return map[string]interface{}{
+		"requestReviews": map[string]interface{}{"pullRequest": map[string]interface{}{"id": pr.ID}},
+	}, nil
+}
+
+func (s *Server) addComment(input genclient.AddCommentInput) (interface{}, error) {
+	pr := s.pullRequestByID(input.SubjectId)
+	if pr == nil {
+		return nil, fmt.Errorf("Could not resolve to a node with the global id of '%s'", input.SubjectId)
+	}
+	pr.Comments = append(pr.Comments, input.Body)
+	return map[string]interface{}{
+		"addComment": map[string]interface{}{"clientMutationId": nil},
+	}, nil
+}
+
+func (s *Server) mergePullRequest(input genclient.MergePullRequestInput) (interface{}, error) {
+	pr, err := s.openPullRequest(input.PullRequestId)
+	if err != nil {
+		return nil, err
+	}
+	mergeMethod := genclient.PullRequestMergeMethod_MERGE
+	if input.MergeMethod != nil {
+		mergeMethod = *input.MergeMethod
+	}
+	err = s.merge(pr, mergeMethod)
+	if err != nil {
+		return nil, err
+	}
+	return pullRequestPayload("mergePullRequest", pr), nil
+}
+
+func (s *Server) enableAutoMerge(input genclient.EnablePullRequestAutoMergeInput) (interface{}, error) {
+	pr, err := s.openPullRequest(input.PullRequestId)
+	if err != nil {
+		return nil, err
+	}
+	pr.InMergeQueue = true
+	pr.MergeMethod = genclient.PullRequestMergeMethod_MERGE
+	if input.MergeMethod != nil {
+		pr.MergeMethod = *input.MergeMethod
+	}
+	return pullRequestPayload("enablePullRequestAutoMerge", pr), nil
+}
+
+func (s *Server) closePullRequest(input genclient.ClosePullRequestInput) (interface{}, error) {
+	pr, err := s.openPullRequest(input.PullRequestId)
+	if err != nil {
+		return nil, err
+	}
+	pr.State = StateClosed
+	pr.InMergeQueue = false
+	return pullRequestPayload("closePullRequest", pr), nil
+}
+
+// reopen reopens a closed pull request, which requires its head branch
+//
+//	and no other open pull request from the same head branch.
+func (s *Server) reopen(pr *PullRequest) error {
+	if _, err := s.revParse(pr.HeadRefName); err != nil {
+		return fmt.Errorf("Could not open the pull request: head branch %s was deleted", pr.HeadRefName)
+	}
+	for _, other := range s.pullRequests {
+		if other.State == StateOpen && other.HeadRefName == pr.HeadRefName {
+			return fmt.Errorf("A pull request already exists for %s", pr.HeadRefName)
+		}
+	}
+	pr.State = StateOpen
+	return nil
+}
+
+func pullRequestPayload(mutation string, pr *PullRequest) interface{} {
+	return map[string]interface{}{
+		mutation: map[string]interface{}{"pullRequest": map[string]interface{}{"number": pr.Number}},
+	}
+}
+
+func (s *Server) pullRequestByID(id string) *PullRequest {
+	for _, pr := range s.pullRequests {
+		if pr.ID == id {
+			return pr
+		}
+	}
+	return nil
+}
+
+func (s *Server) pullRequestByNumber(number int) *PullRequest {
+	for _, pr := range s.pullRequests {
+		if pr.Number == number {
+			return pr
+		}
+	}
+	return nil
+}
+
+func (s *Server) openPullRequest(id string) (*PullRequest, error) {
+	pr := s.pullRequestByID(id)
+	if pr == nil {
+		return nil, fmt.Errorf("Could not resolve to a node with the global id of '%s'", id)
+	}
+	if pr.State != StateOpen {
+		return nil, fmt.Errorf("Pull request #%d is %s", pr.Number, strings.ToLower(string(pr.State)))
+	}
+	return pr, nil
+}
+
+// mergeable returns MERGEABLE when the head branch merges into the base
+// branch without conflicts, as computed by git merge-tree.
+func (s *Server) mergeable(pr *PullRequest) string {
+	_, err := s.mergeTree(pr.BaseRefName, pr.HeadRefName)
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return "MERGEABLE"
+	case errors.As(err, &exitErr) && exitErr.ExitCode() == 1:
+		return "CONFLICTING"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// merge merges the head branch of the pull request into its base branch
+//
+//	in the bare repository. Rebase merges fast-forward the base branch and
+//	are rejected when the head branch is not up to date with it.
+func (s *Server) merge(pr *PullRequest, mergeMethod genclient.PullRequestMergeMethod) error {
+	baseOid, err := s.revParse(pr.BaseRefName)
+	if err != nil {
+		return err
+	}
+	headOid, err := s.revParse(pr.HeadRefName)
+	if err != nil {
+		return err
+	}
+	tree, err := s.mergeTree(pr.BaseRefName, pr.HeadRefName)
+	if err != nil {
+		return fmt.Errorf("Pull request #%d is not mergeable", pr.Number)
+	}
+
+	var mergedOid string
+	switch mergeMethod {
+	case genclient.PullRequestMergeMethod_REBASE:
+		if _, err := s.git("merge-base", "--is-ancestor", baseOid, headOid); err != nil {
+			return fmt.Errorf("Pull request #%d can't be rebased, update the branch", pr.Number)
+		}
+		mergedOid = headOid
+	case genclient.PullRequestMergeMethod_SQUASH:
+		message := fmt.Sprintf("%s (#%d)\n\n%s", pr.Title, pr.Number, pr.Body)
+		mergedOid, err = s.git("commit-tree", tree, "-p", baseOid, "-m", message)
+	default:
+		message := fmt.Sprintf("Merge pull request #%d from %s/%s\n\n%s",
+			pr.Number, s.owner, pr.HeadRefName, pr.Title)
+		mergedOid, err = s.git("commit-tree", tree, "-p", baseOid, "-p", headOid, "-m", message)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = s.git("update-ref", "refs/heads/"+pr.BaseRefName, mergedOid, baseOid)
+	if err != nil {
+		return err
+	}
+	pr.State = StateMerged
+	pr.InMergeQueue = false
+	return nil
+}
+
+type commit struct {
+	oid      string
+	headline string
+	body     string
+}
+
+// commits returns the commits on head which are not on base, oldest first
+func (s *Server) commits(base string, head string) ([]commit, error) {
+	if _, err := s.revParse(base); err != nil {
+		return nil, fmt.Errorf("Base ref must be a branch, '%s' was not found", base)
+	}
+	if _, err := s.revParse(head); err != nil {
+		return nil, fmt.Errorf("Head sha can't be blank, '%s' was not found", head)
+	}
+	out, err := s.git("log", "--reverse", "--format=%H%x1f%s%x1f%b%x1e",
+		"refs/heads/"+base+"..refs/heads/"+head)
+	if err != nil {
+		return nil, err
+	}
+	var commits []commit
+	for _, record := range strings.Split(out, "\x1e") {
+		fields := strings.Split(strings.TrimSpace(record), "\x1f")
+		if len(fields) != 3 {
+			continue
+		}
+		commits = append(commits, commit{
+			oid:      fields[0],
+			headline: fields[1],
+			body:     strings.TrimSpace(fields[2]),
+		})
+	}
+	return commits, nil
+}
+
+func (s *Server) mergeTree(base string, head string) (string, error) {
+	out, err := s.git("merge-tree", "--write-tree", "refs/heads/"+base, "refs/heads/"+head)
+	if err != nil {
+		return "", err
+	}
+	tree, _, _ := strings.Cut(out, "\n")
+	return tree, nil
+}
+
+func (s *Server) revParse(branch string) (string, error) {
+	return s.git("rev-parse", "--verify", "--quiet", "refs/heads/"+branch)
+}
+
+// git runs a git command in the bare repository and returns its output
+func (s *Server) git(args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = s.repoDir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=GitHub", "GIT_AUTHOR_EMAIL=noreply@github.com",
+		"GIT_COMMITTER_NAME=GitHub", "GIT_COMMITTER_EMAIL=noreply@github.com")
+	out, err := cmd.Output()
+	return strings.TrimSpace(string(out)), err
+}
@@ -0,0 +1,256 @@
+package fakegithub
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/ejoffe/spr/github/githubclient/gen/genclient"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestSandbox(t *testing.T) (*Sandbox, genclient.Client) {
+	sb, err := NewSandbox(t.TempDir())
+	require.NoError(t, err)
+	t.Cleanup(sb.Close)
+	return sb, genclient.NewClient(sb.URL+"/api/graphql", http.DefaultClient)
+}
+
+// push pushes the commit at rev in the sandbox clone to branch on the origin
+func push(t *testing.T, sb *Sandbox, rev string, branch string) {
+	require.NoError(t, sb.Push(rev, branch))
+}
+
+func createPullRequest(t *testing.T, api genclient.Client, base string, head string, title string) int {
+	resp, err := api.CreatePullRequest(context.Background(), genclient.CreatePullRequestInput{
+		RepositoryId: "R_" + SandboxOwner + "_" + SandboxRepo,
+		BaseRefName:  base,
+		HeadRefName:  head,
+		Title:        title,
+	})
+	require.NoError(t, err)
+	return resp.CreatePullRequest.PullRequest.Number
+}
+
+func TestPullRequests(t *testing.T) {
+	sb, api := newTestSandbox(t)
+	ctx := context.Background()
+	push(t, sb, "HEAD~1", "spr/main/a1b2c3d1")
+	push(t, sb, "HEAD", "spr/main/a1b2c3d2")
+	createPullRequest(t, api, "main", "spr/main/a1b2c3d1", "Add lexer")
+	number := createPullRequest(t, api, "spr/main/a1b2c3d1", "spr/main/a1b2c3d2", "Add printer")
+
+	require.NoError(t, sb.Server.Approve(number))
+	require.NoError(t, sb.Server.SetCheck(number, "build", CheckSuccess))
+
+	resp, err := api.PullRequestHeads(ctx, SandboxOwner, SandboxRepo, nil)
+	require.NoError(t, err)
+	require.Equal(t, SandboxViewer, resp.Viewer.Login)
+	require.Equal(t, sb.Server.RepositoryID(), resp.Repository.Id)
+	require.False(t, resp.Repository.PullRequests.PageInfo.HasNextPage)
+
+	heads := *resp.Repository.PullRequests.Nodes
+	require.Len(t, heads, 2)
+	require.Equal(t, "spr/main/a1b2c3d1", heads[0].HeadRefName)
+	require.Equal(t, number, heads[1].Number)
+	require.Equal(t, "spr/main/a1b2c3d1", heads[1].BaseRefName)
+	require.Equal(t, "Add printer", heads[1].Title)
+	require.Equal(t, SandboxViewer, heads[1].Author.Login)
+
+	// the first pull request holds the parser and lexer commits
+	first, err := api.PullRequest(ctx, SandboxOwner, SandboxRepo, heads[0].Number)
+	require.NoError(t, err)
+	bottom := first.Repository.PullRequest
+	require.Equal(t, "main", bottom.BaseRefName)
+	require.Equal(t, "OPEN", string(bottom.State))
+	require.Equal(t, "MERGEABLE", string(bottom.Mergeable))
+	require.Len(t, *bottom.Commits.Nodes, 2)
+	require.Nil(t, bottom.ReviewDecision)
+
+	second, err := api.PullRequestWithMergeQueue(ctx, SandboxOwner, SandboxRepo, number)
+	require.NoError(t, err)
+	top := second.Repository.PullRequest
+	require.Nil(t, top.MergeQueueEntry)
+	require.Equal(t, number, top.Number)
+	require.Equal(t, "Add printer", top.Title)
+	require.Equal(t, SandboxViewer, top.Author.Login)
+	require.Equal(t, "APPROVED", string(*top.ReviewDecision))
+	commits := *top.Commits.Nodes
+	require.Len(t, commits, 1)
+	require.Equal(t, "Add printer", commits[0].Commit.MessageHeadline)
+	require.Equal(t, "commit-id:a1b2c3d2", commits[0].Commit.MessageBody)
+	require.Equal(t, "SUCCESS", string(commits[0].Commit.StatusCheckRollup.State))
+
+	_, err = api.PullRequestHeads(ctx, SandboxOwner, "other", nil)
+	require.Error(t, err)
+	_, err = api.PullRequest(ctx, SandboxOwner, SandboxRepo, 42)
+	require.Error(t, err)
+}
+
+func TestPagination(t *testing.T) {
+	sb, api := newTestSandbox(t)
+	ctx := context.Background()
+	sb.Server.PageSize = 2
+	push(t, sb, "HEAD~2", "spr/main/a1b2c3d0")
+	push(t, sb, "HEAD~1", "spr/main/a1b2c3d1")
+	push(t, sb, "HEAD", "spr/main/a1b2c3d2")
+	createPullRequest(t, api, "main", "spr/main/a1b2c3d0", "Add parser")
+	createPullRequest(t, api, "main", "spr/main/a1b2c3d1", "Add lexer")
+	_, err := sb.Server.CreatePullRequest("hubot", "main", "spr/main/a1b2c3d2", "Add printer")
+	require.NoError(t, err)
+
+	resp, err := api.PullRequestHeads(ctx, SandboxOwner, SandboxRepo, nil)
+	require.NoError(t, err)
+	connection := resp.Repository.PullRequests
+	require.Len(t, *connection.Nodes, 2)
+	require.True(t, connection.PageInfo.HasNextPage)
+
+	resp, err = api.PullRequestHeads(ctx, SandboxOwner, SandboxRepo, connection.PageInfo.EndCursor)
+	require.NoError(t, err)
+	connection = resp.Repository.PullRequests
+	require.Len(t, *connection.Nodes, 1)
+	require.False(t, connection.PageInfo.HasNextPage)
+	last, err := api.PullRequest(ctx, SandboxOwner, SandboxRepo, (*connection.Nodes)[0].Number)
+	require.NoError(t, err)
+	top := last.Repository.PullRequest
+	require.Equal(t, "hubot", top.Author.Login)
+
+	// the pull request into main holds the 3 commits of the stack
+	commits := top.Commits
+	require.Len(t, *commits.Nodes, 2)
+	require.True(t, commits.PageInfo.HasNextPage)
+	more, err := api.PullRequestCommits(ctx, SandboxOwner, SandboxRepo, top.Number, commits.PageInfo.EndCursor)
+	require.NoError(t, err)
+	commits = more.Repository.PullRequest.Commits
+	require.Len(t, *commits.Nodes, 1)
+	require.False(t, commits.PageInfo.HasNextPage)
+	require.Equal(t, "Add printer", (*commits.Nodes)[0].Commit.MessageHeadline)
+}
+
+func TestCreatePullRequestErrors(t *testing.T) {
+	sb, api := newTestSandbox(t)
+	push(t, sb, "HEAD", "spr/main/a1b2c3d2")
+	createPullRequest(t, api, "main", "spr/main/a1b2c3d2", "Add printer")
+
+	input := genclient.CreatePullRequestInput{
+		RepositoryId: sb.Server.RepositoryID(),
+		BaseRefName:  "main",
+		HeadRefName:  "spr/main/a1b2c3d2",
+		Title:        "duplicate",
+	}
+	_, err := api.CreatePullRequest(context.Background(), input)
+	require.Error(t, err)
+
+	input.HeadRefName = "missing"
+	_, err = api.CreatePullRequest(context.Background(), input)
+	require.Error(t, err)
+
+	input.HeadRefName = "main"
+	_, err = api.CreatePullRequest(context.Background(), input)
+	require.Error(t, err, "no commits between main and main")
+}
+
+func TestMergePullRequest(t *testing.T) {
+	sb, api := newTestSandbox(t)
+	ctx := context.Background()
+	push(t, sb, "HEAD", "spr/main/a1b2c3d2")
+	number := createPullRequest(t, api, "main", "spr/main/a1b2c3d2", "Add printer")
+	pr := sb.Server.PullRequests()[0]
+
+	rebase := genclient.PullRequestMergeMethod_REBASE
+	_, err := api.MergePullRequest(ctx, genclient.MergePullRequestInput{
+		PullRequestId: pr.ID,
+		MergeMethod:   &rebase,
+	})
+	require.NoError(t, err)
+
+	head, err := runGit(sb.OriginDir, "rev-parse", "refs/heads/spr/main/a1b2c3d2")
+	require.NoError(t, err)
+	main, err := runGit(sb.OriginDir, "rev-parse", "refs/heads/main")
+	require.NoError(t, err)
+	require.Equal(t, head, main, "rebase merge fast-forwards main")
+	require.Equal(t, StateMerged, sb.Server.PullRequests()[0].State)
+
+	_, err = api.ClosePullRequest(ctx, genclient.ClosePullRequestInput{PullRequestId: pr.ID})
+	require.Error(t, err, "pull request #%d is already merged", number)
+}
+
+func TestMergeQueue(t *testing.T) {
+	sb, api := newTestSandbox(t)
+	ctx := context.Background()
+	push(t, sb, "HEAD", "spr/main/a1b2c3d2")
+	createPullRequest(t, api, "main", "spr/main/a1b2c3d2", "Add printer")
+	pr := sb.Server.PullRequests()[0]
+
+	squash := genclient.PullRequestMergeMethod_SQUASH
+	_, err := api.AutoMergePullRequest(ctx, genclient.EnablePullRequestAutoMergeInput{
+		PullRequestId: pr.ID,
+		MergeMethod:   &squash,
+	})
+	require.NoError(t, err)
+	require.True(t, sb.Server.PullRequests()[0].InMergeQueue)
+
+	require.NoError(t, sb.Server.MergeQueued())
+	require.Equal(t, StateMerged, sb.Server.PullRequests()[0].State)
+	parents, err := runGit(sb.OriginDir, "rev-list", "--count", "main")
+	require.NoError(t, err)
+	require.Equal(t, "2", parents, "squash merge adds a single commit")
+}
+
+func TestReviewersAndComments(t *testing.T) {
+	sb, api := newTestSandbox(t)
+	ctx := context.Background()
+	push(t, sb, "HEAD", "spr/main/a1b2c3d2")
+	createPullRequest(t, api, "main", "spr/main/a1b2c3d2", "Add printer")
+	pr := sb.Server.PullRequests()[0]
+
+	users, err := api.AssignableUsers(ctx, SandboxOwner, SandboxRepo, nil)
+	require.NoError(t, err)
+	nodes := *users.Repository.AssignableUsers.Nodes
+	require.Len(t, nodes, 2)
+	require.Equal(t, "hubot", nodes[1].Login)
+
+	_, err = api.AddReviewers(ctx, genclient.RequestReviewsInput{
+		PullRequestId: pr.ID,
+		UserIds:       &[]string{nodes[1].Id},
+	})
+	require.NoError(t, err)
+	_, err = api.CommentPullRequest(ctx, genclient.AddCommentInput{SubjectId: pr.ID, Body: "lgtm"})
+	require.NoError(t, err)
+
+	pr = sb.Server.PullRequests()[0]
+	require.Equal(t, []string{"hubot"}, pr.Reviewers)
+	require.Equal(t, []string{"lgtm"}, pr.Comments)
+}
+
+func TestReopenPullRequest(t *testing.T) {
+	sb, api := newTestSandbox(t)
+	ctx := context.Background()
+	push(t, sb, "HEAD", "spr/main/a1b2c3d2")
+	createPullRequest(t, api, "main", "spr/main/a1b2c3d2", "Add printer")
+	pr := sb.Server.PullRequests()[0]
+
+	_, err := api.ClosePullRequest(ctx, genclient.ClosePullRequestInput{PullRequestId: pr.ID})
+	require.NoError(t, err)
+	_, err = api.UpdatePullRequest(ctx, genclient.UpdatePullRequestInput{PullRequestId: pr.ID})
+	require.Error(t, err, "a closed pull request can't be updated")
+
+	open := genclient.PullRequestUpdateState_OPEN
+	title := "Add printer again"
+	_, err = api.UpdatePullRequest(ctx, genclient.UpdatePullRequestInput{
+		PullRequestId: pr.ID,
+		State:         &open,
+		Title:         &title,
+	})
+	require.NoError(t, err)
+	pr = sb.Server.PullRequests()[0]
+	require.Equal(t, StateOpen, pr.State)
+	require.Equal(t, title, pr.Title)
+
+	// another pull request from the same branch prevents reopening
+	_, err = api.ClosePullRequest(ctx, genclient.ClosePullRequestInput{PullRequestId: pr.ID})
+	require.NoError(t, err)
+	createPullRequest(t, api, "main", "spr/main/a1b2c3d2", "Add printer")
+	_, err = api.UpdatePullRequest(ctx, genclient.UpdatePullRequestInput{PullRequestId: pr.ID, State: &open})
+	require.Error(t, err)
+}
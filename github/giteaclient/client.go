@@ -0,0 +1,592 @@
+package giteaclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ejoffe/spr/config"
+	"github.com/ejoffe/spr/errs"
+	"github.com/ejoffe/spr/git"
+	"github.com/ejoffe/spr/github"
+	"github.com/ejoffe/spr/github/githubclient/gen/genclient"
+	"github.com/ejoffe/spr/github/internal/rest"
+	"github.com/ejoffe/spr/github/template/config_fetcher"
+	"github.com/rs/zerolog/log"
+)
+
+const tokenHelpText = `
+No Gitea token found! Create an access token with read and write access to
+repositories and issues at https://%s/user/settings/applications and set
+the GITEA_TOKEN environment variable.
+`
+
+// api is the Gitea REST API, list apis link the next page
+var api = rest.API{
+	Name:       "gitea",
+	AuthHeader: "Authorization",
+	AuthScheme: "token",
+	TokenHelp: "make sure GITEA_TOKEN env variable is set with a valid token" +
+		"\n the token needs read and write access to repositories and issues",
+	Paging:    rest.LinkPaging,
+	PageParam: "limit",
+	PageLimit: 50,
+}
+
+// NewGiteaClient returns a client for the Gitea REST API of the configured host.
+//
+//	Forgejo serves the same api, so both are supported by this client. The
+//	token is read from GITEA_TOKEN, or FORGEJO_TOKEN when that is not set.
+func NewGiteaClient(ctx context.Context, config *config.Config) (*client, error) {
+	token, err := rest.Token(tokenHelpText, config.Repo.GitHubHost, "GITEA_TOKEN", "FORGEJO_TOKEN")
+	if err != nil {
+		return nil, err
+	}
+	endpoint := rest.Endpoint(config.Repo.GitHubHost, "/api/v1")
+	return NewClient(config, endpoint, token, http.DefaultClient), nil
+}
+
+// NewClient returns a client for the Gitea REST API at endpoint
+func NewClient(config *config.Config, endpoint string, token string, httpClient *http.Client) *client {
+	return &client{
+		config: config,
+		rest:   rest.NewClient(api, endpoint, token, httpClient),
+	}
+}
+
+type client struct {
+	config *config.Config
+	rest   *rest.Client
+}
+
+type user struct {
+	ID       int    `json:"id"`
+	Login    string `json:"login"`
+	FullName string `json:"full_name"`
+}
+
+type repository struct {
+	ID int `json:"id"`
+}
+
+type branchRef struct {
+	Ref string `json:"ref"`
+	SHA string `json:"sha"`
+}
+
+type pullRequest struct {
+	ID        int       `json:"id"`
+	Number    int       `json:"number"`
+	Title     string    `json:"title"`
+	Body      string    `json:"body"`
+	User      user      `json:"user"`
+	Mergeable bool      `json:"mergeable"`
+	Head      branchRef `json:"head"`
+	Base      branchRef `json:"base"`
+}
+
+type commit struct {
+	SHA    string `json:"sha"`
+	Commit struct {
+		Message string `json:"message"`
+	} `json:"commit"`
+}
+
+type review struct {
+	State     string `json:"state"`
+	User      user   `json:"user"`
+	Stale     bool   `json:"stale"`
+	Dismissed bool   `json:"dismissed"`
+}
+
+type commitStatus struct {
+	Context string `json:"context"`
+	Status  string `json:"status"`
+}
+
+type combinedStatus struct {
+	State    string         `json:"state"`
+	Statuses []commitStatus `json:"statuses"`
+}
+
+// repoPath returns the api path of the configured repository
+func (c *client) repoPath() string {
+	return "/repos/" + url.PathEscape(c.config.Repo.GitHubRepoOwner) +
+		"/" + url.PathEscape(c.config.Repo.GitHubRepoName)
+}
+
+func (c *client) GetInfo(ctx context.Context, gitcmd git.GitInterface) (*github.GitHubInfo, error) {
+	if c.config.User.LogGitHubCalls {
+		fmt.Printf("> gitea fetch pull requests\n")
+	}
+
+	var currentUser user
+	err := c.rest.Request(ctx, http.MethodGet, "/user", nil, &currentUser)
+	if err != nil {
+		return nil, err
+	}
+	var repo repository
+	err = c.rest.Request(ctx, http.MethodGet, c.repoPath(), nil, &repo)
+	if err != nil {
+		return nil, err
+	}
+
+	openPullRequests, err := c.openPullRequests(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	localCommitStack, err := git.GetLocalCommitStack(ctx, c.config, gitcmd)
+	if err != nil {
+		return nil, err
+	}
+	localCommitIDs := map[string]bool{}
+	for _, c := range localCommitStack {
+		localCommitIDs[c.CommitID] = true
+	}
+
+	branchRegex := git.BranchNameRegex(c.config.User.BranchPrefix)
+	pullRequestMap := map[string]*github.PullRequest{}
+	for _, listed := range openPullRequests {
+		matches := branchRegex.FindStringSubmatch(listed.Head.Ref)
+		if matches == nil || !localCommitIDs[matches[2]] {
+			continue
+		}
+		pr, err := c.fetchPullRequest(ctx, listed, matches[2])
+		if err != nil {
+			return nil, err
+		}
+		pullRequestMap[pr.Commit.CommitID] = pr
+	}
+
+	pullRequests, err := github.MatchPullRequestStack(c.config.User.BranchPrefix,
+		c.config.Repo.GitHubBranch, localCommitStack, pullRequestMap)
+	if err != nil {
+		return nil, errs.Wrap(errs.Validation, err)
+	}
+	github.MarkStacked(c.config, pullRequests)
+
+	localBranch := c.config.Stack
+	if localBranch == "" {
+		localBranch, err = git.GetLocalBranchName(ctx, gitcmd)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	info := &github.GitHubInfo{
+		UserName:     currentUser.Login,
+		RepositoryID: strconv.Itoa(repo.ID),
+		LocalBranch:  localBranch,
+		PullRequests: pullRequests,
+	}
+
+	log.Debug().Interface("Info", info).Msg("GetInfo")
+	return info, nil
+}
+
+func (c *client) GetPullRequests(ctx context.Context) ([]*github.PullRequest, error) {
+	if c.config.User.LogGitHubCalls {
+		fmt.Printf("> gitea fetch pull requests\n")
+	}
+	openPullRequests, err := c.openPullRequests(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var pullRequests []*github.PullRequest
+	for _, listed := range openPullRequests {
+		pullRequests = append(pullRequests, &github.PullRequest{
+			ID:         strconv.Itoa(listed.ID),
+			Number:     listed.Number,
+			Title:      listed.Title,
+			Body:       listed.Body,
+			FromBranch: listed.Head.Ref,
+			ToBranch:   listed.Base.Ref,
+			Author:     listed.User.Login,
+		})
+	}
+	return pullRequests, nil
+}
+
+// openPullRequests lists the open pull requests of the stacks into the
+// target branch. The list api can't filter by head branch prefix, so all
+// the open pull requests of the repository are listed.
+func (c *client) openPullRequests(ctx context.Context) ([]pullRequest, error) {
+	var listed []pullRequest
+	err := c.rest.RequestAll(ctx, c.repoPath()+"/pulls?state=open", &listed)
+	if err != nil {
+		return nil, err
+	}
+	headRefPrefix := github.HeadRefPrefix(c.config.User.BranchPrefix, c.config.Repo.GitHubBranch)
+	var pullRequests []pullRequest
+	for _, pr := range listed {
+		if strings.HasPrefix(pr.Head.Ref, headRefPrefix) {
+			pullRequests = append(pullRequests, pr)
+		}
+	}
+	return pullRequests, nil
+}
+
+// fetchPullRequest fetches the commits, reviews and commit statuses of a
+//
+//	listed pull request and converts it to a spr pull request.
+func (c *client) fetchPullRequest(ctx context.Context, listed pullRequest, commitID string) (*github.PullRequest, error) {
+	prPath := fmt.Sprintf("%s/pulls/%d", c.repoPath(), listed.Number)
+
+	var prCommits []commit
+	err := c.rest.RequestAll(ctx, prPath+"/commits", &prCommits)
+	if err != nil {
+		return nil, err
+	}
+	var commits []git.Commit
+	var headCommit git.Commit
+	for _, prCommit := range prCommits {
+		subject, _, _ := strings.Cut(prCommit.Commit.Message, "\n")
+		for _, line := range strings.Split(prCommit.Commit.Message, "\n") {
+			if strings.HasPrefix(line, "commit-id:") {
+				c := git.Commit{
+					CommitID:   strings.TrimSpace(strings.Split(line, ":")[1]),
+					CommitHash: prCommit.SHA,
+					Subject:    subject,
+					Body:       prCommit.Commit.Message,
+				}
+				commits = append(commits, c)
+				if prCommit.SHA == listed.Head.SHA {
+					headCommit = c
+				}
+			}
+		}
+	}
+
+	var reviews []review
+	err = c.rest.RequestAll(ctx, prPath+"/reviews", &reviews)
+	if err != nil {
+		return nil, err
+	}
+	approved, changesRequested := reviewDecision(reviews)
+
+	var status combinedStatus
+	err = c.rest.Request(ctx, http.MethodGet,
+		fmt.Sprintf("%s/commits/%s/status", c.repoPath(), listed.Head.SHA), nil, &status)
+	if err != nil {
+		return nil, err
+	}
+
+	pr := &github.PullRequest{
+		ID:         strconv.Itoa(listed.ID),
+		Number:     listed.Number,
+		Title:      listed.Title,
+		Body:       listed.Body,
+		FromBranch: listed.Head.Ref,
+		ToBranch:   listed.Base.Ref,
+		Author:     listed.User.Login,
+		Commits:    commits,
+		Commit: git.Commit{
+			CommitID:   commitID,
+			CommitHash: listed.Head.SHA,
+			Subject:    headCommit.Subject,
+			Body:       headCommit.Body,
+		},
+		MergeStatus: github.PullRequestMergeStatus{
+			ChecksPass:       github.CheckStatusPass,
+			ReviewApproved:   approved,
+			ChangesRequested: changesRequested,
+			NoConflicts:      listed.Mergeable,
+		},
+	}
+
+	if len(status.Statuses) > 0 {
+		pr.MergeStatus.ChecksPass = statusCheckStatus(status.State)
+		if c.config.Repo.RequireChecks && len(c.config.Repo.RequiredChecks) > 0 {
+			pr.Checks = requiredStatusResults(status.Statuses, c.config.Repo.RequiredChecks)
+			pr.MergeStatus.ChecksPass = github.AggregateCheckStatus(pr.Checks)
+		}
+	}
+	return pr, nil
+}
+
+// reviewDecision returns whether the pull request is approved or has changes
+//
+//	requested, based on the latest review of each reviewer. Comments, stale
+//	and dismissed reviews don't count.
+func reviewDecision(reviews []review) (approved bool, changesRequested bool) {
+	latest := map[string]string{}
+	for _, r := range reviews {
+		if r.Stale || r.Dismissed {
+			continue
+		}
+		switch r.State {
+		case "APPROVED", "REQUEST_CHANGES":
+			latest[r.User.Login] = r.State
+		}
+	}
+	for _, state := range latest {
+		switch state {
+		case "APPROVED":
+			approved = true
+		case "REQUEST_CHANGES":
+			changesRequested = true
+		}
+	}
+	return approved && !changesRequested, changesRequested
+}
+
+// statusCheckStatus maps a Gitea commit status state to a check status
+func statusCheckStatus(state string) github.CheckStatus {
+	switch state {
+	case "success", "warning":
+		return github.CheckStatusPass
+	case "failure", "error":
+		return github.CheckStatusFail
+	default:
+		return github.CheckStatusPending
+	}
+}
+
+// requiredStatusResults returns the status of each required status context
+func requiredStatusResults(statuses []commitStatus, requiredChecks []string) []github.Check {
+	required := map[string]bool{}
+	for _, name := range requiredChecks {
+		required[name] = true
+	}
+	reported := make([]github.Check, 0, len(statuses))
+	for _, s := range statuses {
+		reported = append(reported, github.Check{Name: s.Context, Status: statusCheckStatus(s.Status)})
+	}
+	return github.RequiredCheckResults(reported, required)
+}
+
+// GetAssignableUsers returns the users that can be assigned to pull requests.
+// Gitea requests reviewers by login, so the login is also used as the ID.
+func (c *client) GetAssignableUsers(ctx context.Context) ([]github.RepoAssignee, error) {
+	if c.config.User.LogGitHubCalls {
+		fmt.Printf("> gitea get assignees\n")
+	}
+
+	var assignees []user
+	err := c.rest.RequestAll(ctx, c.repoPath()+"/assignees", &assignees)
+	if err != nil {
+		return nil, err
+	}
+
+	users := []github.RepoAssignee{}
+	for _, assignee := range assignees {
+		users = append(users, github.RepoAssignee{
+			ID:    assignee.Login,
+			Login: assignee.Login,
+			Name:  assignee.FullName,
+		})
+	}
+	return users, nil
+}
+
+func (c *client) CreatePullRequest(ctx context.Context, gitcmd git.GitInterface,
+	info *github.GitHubInfo, commit git.Commit, prevCommit *git.Commit) (*github.PullRequest, error) {
+
+	baseRefName := c.config.Repo.GitHubBranch
+	if prevCommit != nil {
+		baseRefName = git.BranchNameFromCommit(c.config, *prevCommit)
+	}
+	headRefName := git.BranchNameFromCommit(c.config, commit)
+
+	log.Debug().Interface("Commit", commit).
+		Str("FromBranch", headRefName).Str("ToBranch", baseRefName).
+		Msg("CreatePullRequest")
+
+	templatizer := config_fetcher.PRTemplatizer(c.config, gitcmd)
+	title := templatizer.Title(info, commit)
+	if c.config.User.CreateDraftPRs {
+		// gitea marks pull requests with a WIP: title prefix as drafts
+		title = "WIP: " + title
+	}
+	body, err := templatizer.Body(info, commit, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var created pullRequest
+	err = c.rest.Request(ctx, http.MethodPost, c.repoPath()+"/pulls", map[string]interface{}{
+		"head":  headRefName,
+		"base":  baseRefName,
+		"title": title,
+		"body":  body,
+	}, &created)
+	if err != nil {
+		return nil, err
+	}
+
+	pr := &github.PullRequest{
+		ID:         strconv.Itoa(created.ID),
+		Number:     created.Number,
+		FromBranch: headRefName,
+		ToBranch:   baseRefName,
+		Commit:     commit,
+		Title:      commit.Subject,
+		Body:       created.Body,
+		MergeStatus: github.PullRequestMergeStatus{
+			ChecksPass:     github.CheckStatusUnknown,
+			ReviewApproved: false,
+			NoConflicts:    false,
+			Stacked:        false,
+		},
+	}
+
+	if c.config.User.LogGitHubCalls {
+		fmt.Printf("> gitea create %d : %s\n", pr.Number, pr.Title)
+	}
+
+	return pr, nil
+}
+
+func (c *client) UpdatePullRequest(ctx context.Context, gitcmd git.GitInterface,
+	info *github.GitHubInfo, pullRequests []*github.PullRequest, pr *github.PullRequest,
+	commit git.Commit, prevCommit *git.Commit) error {
+
+	baseRefName := c.config.Repo.GitHubBranch
+	if prevCommit != nil {
+		baseRefName = git.BranchNameFromCommit(c.config, *prevCommit)
+	}
+
+	log.Debug().Interface("Commit", commit).
+		Str("FromBranch", pr.FromBranch).Str("ToBranch", baseRefName).
+		Interface("PR", pr).Msg("UpdatePullRequest")
+
+	templatizer := config_fetcher.PRTemplatizer(c.config, gitcmd)
+	title := templatizer.Title(info, commit)
+	body, err := templatizer.Body(info, commit, pr)
+	if err != nil {
+		return err
+	}
+
+	titleUnchanged := c.config.User.PreserveTitleAndBody || title == pr.Title
+	bodyUnchanged := c.config.User.PreserveTitleAndBody || body == pr.Body
+	if titleUnchanged && bodyUnchanged && baseRefName == pr.ToBranch {
+		if c.config.User.LogGitHubCalls {
+			fmt.Printf("> gitea update %d : %s (skipped, no changes)\n", pr.Number, pr.Title)
+		}
+		return nil
+	}
+
+	if c.config.User.LogGitHubCalls {
+		fmt.Printf("> gitea update %d : %s\n", pr.Number, pr.Title)
+	}
+
+	input := map[string]interface{}{
+		"base": baseRefName,
+	}
+	if !c.config.User.PreserveTitleAndBody {
+		input["title"] = title
+		input["body"] = body
+	}
+
+	return c.rest.Request(ctx, http.MethodPatch, c.pullRequestPath(pr), input, nil)
+}
+
+// AddReviewers requests reviews, userIDs are the logins returned by GetAssignableUsers
+func (c *client) AddReviewers(ctx context.Context, pr *github.PullRequest, userIDs []string) error {
+	log.Debug().Strs("userIDs", userIDs).Msg("AddReviewers")
+	if c.config.User.LogGitHubCalls {
+		fmt.Printf("> gitea add reviewers %d : %s - %+v\n", pr.Number, pr.Title, userIDs)
+	}
+	return c.rest.Request(ctx, http.MethodPost, c.pullRequestPath(pr)+"/requested_reviewers", map[string]interface{}{
+		"reviewers": userIDs,
+	}, nil)
+}
+
+func (c *client) CommentPullRequest(ctx context.Context, pr *github.PullRequest, comment string) error {
+	// pull requests share their number with the issue api
+	err := c.rest.Request(ctx, http.MethodPost, fmt.Sprintf("%s/issues/%d/comments", c.repoPath(), pr.Number),
+		map[string]interface{}{
+			"body": comment,
+		}, nil)
+	if err != nil {
+		return err
+	}
+
+	if c.config.User.LogGitHubCalls {
+		fmt.Printf("> gitea add comment %d : %s\n", pr.Number, pr.Title)
+	}
+	return nil
+}
+
+// MergePullRequest merges the pull request with the given merge method.
+// With a merge queue the pull request is scheduled to merge once its
+// required status checks succeed.
+func (c *client) MergePullRequest(ctx context.Context,
+	pr *github.PullRequest, mergeMethod genclient.PullRequestMergeMethod) error {
+	log.Debug().
+		Interface("PR", pr).
+		Str("mergeMethod", string(mergeMethod)).
+		Msg("MergePullRequest")
+
+	input := map[string]interface{}{
+		"Do": mergeStyle(mergeMethod),
+	}
+	if c.config.Repo.MergeQueue {
+		input["merge_when_checks_succeed"] = true
+	}
+	err := c.rest.Request(ctx, http.MethodPost, c.pullRequestPath(pr)+"/merge", input, nil)
+	if err != nil {
+		return err
+	}
+
+	if c.config.User.LogGitHubCalls {
+		fmt.Printf("> gitea merge %d : %s\n", pr.Number, pr.Title)
+	}
+	return nil
+}
+
+// mergeStyle returns the gitea merge style of a merge method
+func mergeStyle(mergeMethod genclient.PullRequestMergeMethod) string {
+	switch mergeMethod {
+	case genclient.PullRequestMergeMethod_SQUASH:
+		return "squash"
+	case genclient.PullRequestMergeMethod_REBASE:
+		return "rebase"
+	default:
+		return "merge"
+	}
+}
+
+func (c *client) ClosePullRequest(ctx context.Context, pr *github.PullRequest) error {
+	log.Debug().Interface("PR", pr).Msg("ClosePullRequest")
+	err := c.rest.Request(ctx, http.MethodPatch, c.pullRequestPath(pr), map[string]interface{}{
+		"state": "closed",
+	}, nil)
+	if err != nil {
+		return err
+	}
+
+	if c.config.User.LogGitHubCalls {
+		fmt.Printf("> gitea close %d : %s\n", pr.Number, pr.Title)
+	}
+	return nil
+}
+
+func (c *client) RestorePullRequest(ctx context.Context, pr *github.PullRequest) error {
+	log.Debug().Interface("PR", pr).Msg("RestorePullRequest")
+	err := c.rest.Request(ctx, http.MethodPatch, c.pullRequestPath(pr), map[string]interface{}{
+		"state": "open",
+		"base":  pr.ToBranch,
+		"title": pr.Title,
+		"body":  pr.Body,
+	}, nil)
+	if err != nil {
+		return err
+	}
+
+	if c.config.User.LogGitHubCalls {
+		fmt.Printf("> gitea restore %d : %s\n", pr.Number, pr.Title)
+	}
+	return nil
+}
+
+func (c *client) pullRequestPath(pr *github.PullRequest) string {
+	return fmt.Sprintf("%s/pulls/%d", c.repoPath(), pr.Number)
+}
+
+// requestAll fetches every page of a list api into result, which must be a
+// pointer to a slice. Pages are followed through the rel="next" Link header.
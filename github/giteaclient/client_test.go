@@ -0,0 +1,287 @@
+package giteaclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ejoffe/spr/config"
+	"github.com/ejoffe/spr/git"
+	"github.com/ejoffe/spr/git/mockgit"
+	"github.com/ejoffe/spr/github"
+	"github.com/ejoffe/spr/github/githubclient/gen/genclient"
+	"github.com/ejoffe/spr/github/internal/rest"
+	"github.com/ejoffe/spr/github/internal/resttest"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeGitea is a local stand-in for the parts of the Gitea REST API used by spr
+type fakeGitea struct {
+	*resttest.Server
+	pullRequests []pullRequest
+	commits      map[int][]commit
+	reviews      map[int][]review
+	statuses     map[string]combinedStatus
+	assignees    []user
+}
+
+func newFakeGitea() *fakeGitea {
+	f := &fakeGitea{
+		commits:  map[int][]commit{},
+		reviews:  map[int][]review{},
+		statuses: map[string]combinedStatus{},
+	}
+	f.Server = &resttest.Server{
+		AuthHeader:   "Authorization",
+		Auth:         "token token",
+		Unauthorized: `{"message":"token is required"}`,
+		Prefix:       repoPrefix,
+		Handler:      f.handle,
+	}
+	return f
+}
+
+const repoPrefix = "/api/v1/repos/owner/repo"
+
+func (f *fakeGitea) handle(w http.ResponseWriter, r *http.Request, path string, body map[string]interface{}) {
+	switch {
+	case path == "/api/v1/user":
+		resttest.WriteJSON(w, user{ID: 7, Login: "nobody"})
+	case path == repoPrefix:
+		resttest.WriteJSON(w, repository{ID: 42})
+	case path == repoPrefix+"/assignees":
+		resttest.WritePage(w, r, rest.LinkPaging, f.assignees)
+	case path == repoPrefix+"/pulls" && r.Method == http.MethodGet:
+		resttest.WritePage(w, r, rest.LinkPaging, f.pullRequests)
+	case path == repoPrefix+"/pulls" && r.Method == http.MethodPost:
+		resttest.WriteJSON(w, pullRequest{ID: 1001, Number: 11,
+			Title: body["title"].(string),
+			Body:  body["body"].(string),
+			Head:  branchRef{Ref: body["head"].(string)},
+			Base:  branchRef{Ref: body["base"].(string)},
+		})
+	case strings.HasPrefix(path, repoPrefix+"/commits/"):
+		sha := strings.Split(strings.TrimPrefix(path, repoPrefix+"/commits/"), "/")[0]
+		resttest.WriteJSON(w, f.statuses[sha])
+	case strings.HasPrefix(path, repoPrefix+"/pulls/"):
+		parts := strings.Split(strings.TrimPrefix(path, repoPrefix+"/pulls/"), "/")
+		number, _ := strconv.Atoi(parts[0])
+		switch {
+		case len(parts) == 1:
+			resttest.WriteJSON(w, map[string]interface{}{})
+		case parts[1] == "commits":
+			resttest.WritePage(w, r, rest.LinkPaging, f.commits[number])
+		case parts[1] == "reviews":
+			resttest.WritePage(w, r, rest.LinkPaging, f.reviews[number])
+		default:
+			resttest.WriteJSON(w, map[string]interface{}{})
+		}
+	default:
+		resttest.WriteJSON(w, map[string]interface{}{})
+	}
+}
+
+func makeTestClient(t *testing.T) (*client, *fakeGitea) {
+	fake := newFakeGitea()
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	cfg := config.EmptyConfig()
+	cfg.Repo.GitHubRepoOwner = "owner"
+	cfg.Repo.GitHubRepoName = "repo"
+	cfg.Repo.GitHubRemote = "origin"
+	cfg.Repo.GitHubBranch = "master"
+	cfg.Repo.RequireChecks = true
+	cfg.Repo.RequireApproval = true
+	cfg.Repo.PRTemplateType = "basic"
+	cfg.User.BranchPrefix = "spr"
+	return NewClient(cfg, server.URL+"/api/v1", "token", server.Client()), fake
+}
+
+func TestGetInfo(t *testing.T) {
+	c, fake := makeTestClient(t)
+	c.config.Repo.RequiredChecks = []string{"ci/test"}
+
+	me := user{Login: "nobody"}
+	fake.pullRequests = []pullRequest{
+		{ID: 101, Number: 1, Title: "commit 1", User: me, Mergeable: true,
+			Head: branchRef{Ref: "spr/master/00000001", SHA: "c1"}, Base: branchRef{Ref: "master"}},
+		{ID: 102, Number: 2, Title: "commit 2", User: me,
+			Head: branchRef{Ref: "spr/master/00000002", SHA: "c2"}, Base: branchRef{Ref: "spr/master/00000001"}},
+		{ID: 103, Number: 3, Title: "not spr", User: user{Login: "other"},
+			Head: branchRef{Ref: "feature", SHA: "c3"}, Base: branchRef{Ref: "master"}},
+	}
+	fake.commits[1] = []commit{{SHA: "c1"}}
+	fake.commits[1][0].Commit.Message = "commit 1\n\ncommit-id:00000001"
+	fake.commits[2] = []commit{{SHA: "c2"}}
+	fake.commits[2][0].Commit.Message = "commit 2\n\ncommit-id:00000002"
+	fake.reviews[1] = []review{
+		{State: "REQUEST_CHANGES", User: user{Login: "alice"}},
+		{State: "COMMENT", User: user{Login: "bob"}},
+		{State: "APPROVED", User: user{Login: "alice"}},
+	}
+	fake.reviews[2] = []review{
+		{State: "APPROVED", User: user{Login: "alice"}},
+		{State: "REQUEST_CHANGES", User: user{Login: "bob"}},
+	}
+	fake.statuses["c1"] = combinedStatus{State: "failure", Statuses: []commitStatus{
+		{Context: "ci/lint", Status: "failure"},
+		{Context: "ci/test", Status: "success"},
+	}}
+	fake.statuses["c2"] = combinedStatus{State: "pending", Statuses: []commitStatus{
+		{Context: "ci/test", Status: "pending"},
+	}}
+
+	gitmock := mockgit.NewMockGit(t)
+	gitmock.ExpectLogAndRespond([]*git.Commit{
+		{CommitID: "00000002", CommitHash: "l2", Subject: "commit 2"},
+		{CommitID: "00000001", CommitHash: "l1", Subject: "commit 1"},
+	})
+	gitmock.ExpectLocalBranch("* master")
+
+	info, err := c.GetInfo(context.Background(), gitmock)
+	require.NoError(t, err)
+	gitmock.ExpectationsMet()
+
+	require.Equal(t, "nobody", info.UserName)
+	require.Equal(t, "42", info.RepositoryID)
+	require.Equal(t, "master", info.LocalBranch)
+	require.Equal(t, []*github.PullRequest{
+		{
+			ID:         "101",
+			Number:     1,
+			Title:      "commit 1",
+			FromBranch: "spr/master/00000001",
+			ToBranch:   "master",
+			Author:     "nobody",
+			Commit: git.Commit{CommitID: "00000001", CommitHash: "c1",
+				Subject: "commit 1", Body: "commit 1\n\ncommit-id:00000001"},
+			Commits: []git.Commit{{CommitID: "00000001", CommitHash: "c1",
+				Subject: "commit 1", Body: "commit 1\n\ncommit-id:00000001"}},
+			Checks: []github.Check{{Name: "ci/test", Status: github.CheckStatusPass}},
+			MergeStatus: github.PullRequestMergeStatus{
+				ChecksPass:     github.CheckStatusPass,
+				ReviewApproved: true,
+				NoConflicts:    true,
+				Stacked:        true,
+			},
+		},
+		{
+			ID:         "102",
+			Number:     2,
+			Title:      "commit 2",
+			FromBranch: "spr/master/00000002",
+			ToBranch:   "spr/master/00000001",
+			Author:     "nobody",
+			Commit: git.Commit{CommitID: "00000002", CommitHash: "c2",
+				Subject: "commit 2", Body: "commit 2\n\ncommit-id:00000002"},
+			Commits: []git.Commit{{CommitID: "00000002", CommitHash: "c2",
+				Subject: "commit 2", Body: "commit 2\n\ncommit-id:00000002"}},
+			Checks: []github.Check{{Name: "ci/test", Status: github.CheckStatusPending}},
+			MergeStatus: github.PullRequestMergeStatus{
+				ChecksPass:       github.CheckStatusPending,
+				ChangesRequested: true,
+			},
+		},
+	}, info.PullRequests)
+}
+
+func TestGetAssignableUsers(t *testing.T) {
+	c, fake := makeTestClient(t)
+	fake.assignees = []user{
+		{ID: 1, Login: "alice", FullName: "Alice"},
+		{ID: 2, Login: "bob", FullName: "Bob"},
+	}
+	users, err := c.GetAssignableUsers(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []github.RepoAssignee{
+		{ID: "alice", Login: "alice", Name: "Alice"},
+		{ID: "bob", Login: "bob", Name: "Bob"},
+	}, users)
+}
+
+func TestPullRequestMutations(t *testing.T) {
+	c, fake := makeTestClient(t)
+	c.config.Repo.MergeQueue = true
+	ctx := context.Background()
+	info := &github.GitHubInfo{}
+	c1 := git.Commit{CommitID: "00000001", CommitHash: "c1", Subject: "commit 1"}
+	c2 := git.Commit{CommitID: "00000002", CommitHash: "c2", Subject: "commit 2"}
+
+	pr, err := c.CreatePullRequest(ctx, nil, info, c2, &c1)
+	require.NoError(t, err)
+	require.Equal(t, 11, pr.Number)
+	require.Equal(t, "spr/master/00000002", pr.FromBranch)
+	require.Equal(t, "spr/master/00000001", pr.ToBranch)
+	body, _ := json.Marshal(pr.Body)
+
+	// retarget onto master when the commit below is merged
+	require.NoError(t, c.UpdatePullRequest(ctx, nil, info, nil, pr, c2, nil))
+	// nothing changed : no request
+	pr.ToBranch = "master"
+	require.NoError(t, c.UpdatePullRequest(ctx, nil, info, nil, pr, c2, nil))
+
+	require.NoError(t, c.AddReviewers(ctx, pr, []string{"alice", "bob"}))
+	require.NoError(t, c.CommentPullRequest(ctx, pr, "merged"))
+	require.NoError(t, c.MergePullRequest(ctx, pr, genclient.PullRequestMergeMethod_REBASE))
+	require.NoError(t, c.ClosePullRequest(ctx, pr))
+	pr.Title = "restored"
+	require.NoError(t, c.RestorePullRequest(ctx, pr))
+
+	require.Equal(t, []string{
+		`POST /pulls {"base":"spr/master/00000001","body":` + string(body) + `,"head":"spr/master/00000002","title":"commit 2"}`,
+		`PATCH /pulls/11 {"base":"master","body":` + string(body) + `,"title":"commit 2"}`,
+		`POST /pulls/11/requested_reviewers {"reviewers":["alice","bob"]}`,
+		`POST /issues/11/comments {"body":"merged"}`,
+		`POST /pulls/11/merge {"Do":"rebase","merge_when_checks_succeed":true}`,
+		`PATCH /pulls/11 {"state":"closed"}`,
+		`PATCH /pulls/11 {"base":"master","body":` + string(body) + `,"state":"open","title":"restored"}`,
+	}, fake.Requests())
+}
+
+func TestReviewDecision(t *testing.T) {
+	tests := []struct {
+		name             string
+		reviews          []review
+		approved         bool
+		changesRequested bool
+	}{
+		{name: "none"},
+		{name: "comment only", reviews: []review{{State: "COMMENT", User: user{Login: "a"}}}},
+		{name: "approved", approved: true,
+			reviews: []review{{State: "APPROVED", User: user{Login: "a"}}}},
+		{name: "stale approval",
+			reviews: []review{{State: "APPROVED", User: user{Login: "a"}, Stale: true}}},
+		{name: "dismissed change request", approved: true, reviews: []review{
+			{State: "REQUEST_CHANGES", User: user{Login: "b"}, Dismissed: true},
+			{State: "APPROVED", User: user{Login: "a"}},
+		}},
+		{name: "changes requested", changesRequested: true, reviews: []review{
+			{State: "APPROVED", User: user{Login: "a"}},
+			{State: "REQUEST_CHANGES", User: user{Login: "b"}},
+		}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			approved, changesRequested := reviewDecision(tc.reviews)
+			require.Equal(t, tc.approved, approved)
+			require.Equal(t, tc.changesRequested, changesRequested)
+		})
+	}
+}
+
+func TestStatusCheckStatus(t *testing.T) {
+	for state, expect := range map[string]github.CheckStatus{
+		"success": github.CheckStatusPass,
+		"warning": github.CheckStatusPass,
+		"failure": github.CheckStatusFail,
+		"error":   github.CheckStatusFail,
+		"pending": github.CheckStatusPending,
+	} {
+		require.Equal(t, expect, statusCheckStatus(state), state)
+	}
+}
@@ -14,6 +14,7 @@ import (
 	"gopkg.in/yaml.v3"
 
 	"github.com/ejoffe/spr/config"
+	"github.com/ejoffe/spr/errs"
 	"github.com/ejoffe/spr/git"
 	"github.com/ejoffe/spr/github"
 	"github.com/ejoffe/spr/github/githubclient/fezzik_types"
@@ -143,25 +144,25 @@ This configuration file is shared with GitHub's "hub" CLI (https://hub.github.co
 so if you already use that, spr will automatically pick up your token.
 `
 
-func NewGitHubClient(ctx context.Context, config *config.Config) *client {
+func NewGitHubClient(ctx context.Context, config *config.Config) (*client, error) {
 	token := findToken(config.Repo.GitHubHost)
 	if token == "" {
-		fmt.Printf(tokenHelpText, config.Repo.GitHubHost)
-		os.Exit(3)
+		return nil, errs.New(errs.Auth, strings.TrimSpace(tokenHelpText), config.Repo.GitHubHost)
 	}
 	ts := oauth2.StaticTokenSource(
 		&oauth2.Token{AccessToken: token},
 	)
 	tc := oauth2.NewClient(ctx, ts)
 
-	var api genclient.Client
 	var endpoint string
 	if strings.HasSuffix(config.Repo.GitHubHost, "github.com") {
 		endpoint = "https://api.github.com/graphql"
 	} else {
 		var scheme, host string
 		gitHubRemoteUrl, err := url.Parse(config.Repo.GitHubHost)
-		check(err)
+		if err != nil {
+			return nil, errs.Wrap(errs.Validation, err)
+		}
 		if gitHubRemoteUrl.Host == "" {
 			host = config.Repo.GitHubHost
 			scheme = "https"
@@ -171,12 +172,22 @@ func NewGitHubClient(ctx context.Context, config *config.Config) *client {
 		}
 		endpoint = fmt.Sprintf("%s://%s/api/graphql", scheme, host)
 	}
-	api = genclient.NewClient(endpoint, tc)
+	return NewClient(config, endpoint, tc), nil
+}
+
+// NewClient returns a client for the graphql api at endpoint. The http client
+// is expected to authenticate the requests.
+func NewClient(config *config.Config, endpoint string, httpClient *http.Client) *client {
+	retry := newRetryTransport(httpClient.Transport)
+	statusClient := *httpClient
+	statusClient.Transport = &statusTransport{base: retry}
+	httpClient = &statusClient
 	return &client{
 		config:          config,
-		api:             api,
+		api:             genclient.NewClient(endpoint, httpClient),
 		graphqlEndpoint: endpoint,
-		httpClient:      tc,
+		httpClient:      httpClient,
+		retry:           retry,
 	}
 }
 
@@ -185,71 +196,205 @@ type client struct {
 	api             genclient.Client
 	graphqlEndpoint string
 	httpClient      *http.Client
+	retry           *retryTransport
 }
 
-func (c *client) GetInfo(ctx context.Context, gitcmd git.GitInterface) *github.GitHubInfo {
+// RateLimit returns the api quota left, as reported by the last response
+func (c *client) RateLimit() (RateLimit, bool) {
+	return c.retry.RateLimit()
+}
+
+func (c *client) GetInfo(ctx context.Context, gitcmd git.GitInterface) (*github.GitHubInfo, error) {
 	if c.config.User.LogGitHubCalls {
 		fmt.Printf("> github fetch pull requests\n")
 	}
 
-	var pullRequestConnection fezzik_types.PullRequestConnection
-	var loginName string
-	var repoID string
-	if c.config.Repo.MergeQueue {
-		resp, err := c.api.PullRequestsWithMergeQueue(ctx,
-			c.config.Repo.GitHubRepoOwner,
-			c.config.Repo.GitHubRepoName)
-		check(err)
-		pullRequestConnection = resp.Viewer.PullRequests
-		loginName = resp.Viewer.Login
-		repoID = resp.Repository.Id
-	} else {
-		resp, err := c.api.PullRequests(ctx,
-			c.config.Repo.GitHubRepoOwner,
-			c.config.Repo.GitHubRepoName)
-		check(err)
-		pullRequestConnection = resp.Viewer.PullRequests
-		loginName = resp.Viewer.Login
-		repoID = resp.Repository.Id
+	loginName, repoID, heads, err := c.fetchPullRequestHeads(ctx)
+	if err != nil {
+		return nil, err
 	}
 
 	targetBranch := c.config.Repo.GitHubBranch
-	localCommitStack := git.GetLocalCommitStack(c.config, gitcmd)
+	localCommitStack, err := git.GetLocalCommitStack(ctx, c.config, gitcmd)
+	if err != nil {
+		return nil, err
+	}
 
-	pullRequests := matchPullRequestStack(c.config.Repo, c.config.User.BranchPrefix, targetBranch, localCommitStack, pullRequestConnection)
+	// the stack is matched on the branches of the pull requests first, the
+	//  details and all the commits are only fetched for its pull requests
+	headMap := make(map[string]*github.PullRequest)
+	for _, pr := range heads {
+		if pr.Commit.CommitID != "" {
+			headMap[pr.Commit.CommitID] = pr
+		}
+	}
+	stack, err := github.MatchPullRequestStack(c.config.User.BranchPrefix, targetBranch, localCommitStack, headMap)
+	if err != nil {
+		return nil, errs.Wrap(errs.Validation, err)
+	}
+	pullRequestConnection, err := c.fetchPullRequests(ctx, stack)
+	if err != nil {
+		return nil, err
+	}
+
+	pullRequests, err := matchPullRequestStack(c.config.Repo, c.config.User.BranchPrefix, targetBranch, localCommitStack, pullRequestConnection)
+	if err != nil {
+		return nil, errs.Wrap(errs.Validation, err)
+	}
 
 	// When RequiredChecks is explicitly configured, fetch individual check contexts
 	// and only evaluate the listed checks. This allows non-required check failures
 	// to be ignored. When RequiredChecks is not set, the statusCheckRollup.state
 	// from the fezzik query is used as-is (all checks matter).
 	if c.config.Repo.RequireChecks && len(c.config.Repo.RequiredChecks) > 0 && len(pullRequests) > 0 {
-		requiredStatus := c.fetchRequiredChecksStatus(ctx, pullRequests)
-		if requiredStatus != nil {
+		requiredChecks := c.fetchRequiredChecks(ctx, pullRequests)
+		if requiredChecks != nil {
 			for _, pr := range pullRequests {
-				if status, ok := requiredStatus[pr.Number]; ok {
-					pr.MergeStatus.ChecksPass = status
+				if checks, ok := requiredChecks[pr.Number]; ok {
+					pr.Checks = checks
+					pr.MergeStatus.ChecksPass = github.AggregateCheckStatus(checks)
 				}
 			}
 		}
 	}
 
-	for _, pr := range pullRequests {
-		if pr.Ready(c.config) {
-			pr.MergeStatus.Stacked = true
-		} else {
-			break
+	github.MarkStacked(c.config, pullRequests)
+
+	localBranch := c.config.Stack
+	if localBranch == "" {
+		localBranch, err = git.GetLocalBranchName(ctx, gitcmd)
+		if err != nil {
+			return nil, err
 		}
 	}
 
 	info := &github.GitHubInfo{
 		UserName:     loginName,
 		RepositoryID: repoID,
-		LocalBranch:  git.GetLocalBranchName(gitcmd),
+		LocalBranch:  localBranch,
 		PullRequests: pullRequests,
 	}
 
 	log.Debug().Interface("Info", info).Msg("GetInfo")
-	return info
+	return info, nil
+}
+
+// fetchPullRequestHeads returns the login of the viewer, the id of the
+//
+//	repository and the open pull requests in the repository whose head
+//	branch starts with the head ref prefix of the target branch, opened by
+//	any user. Only the numbers, titles, bodies, authors and branches of the
+//	pull requests are listed, their commits are left out.
+func (c *client) fetchPullRequestHeads(ctx context.Context) (string, string, []*github.PullRequest, error) {
+	headRefPrefix := github.HeadRefPrefix(c.config.User.BranchPrefix, c.config.Repo.GitHubBranch)
+	branchNameRegex := git.BranchNameRegex(c.config.User.BranchPrefix)
+	var loginName string
+	var repoID string
+	var pullRequests []*github.PullRequest
+	var endCursor *string
+	for {
+		resp, err := c.api.PullRequestHeads(ctx,
+			c.config.Repo.GitHubRepoOwner,
+			c.config.Repo.GitHubRepoName,
+			endCursor)
+		if err != nil {
+			return "", "", nil, apiError(err, "fetch pull requests")
+		}
+		loginName = resp.Viewer.Login
+		repoID = resp.Repository.Id
+		heads := resp.Repository.PullRequests
+		if heads.Nodes != nil {
+			for _, node := range *heads.Nodes {
+				if !strings.HasPrefix(node.HeadRefName, headRefPrefix) {
+					continue
+				}
+				pr := &github.PullRequest{
+					ID:         node.Id,
+					Number:     node.Number,
+					Title:      node.Title,
+					Body:       node.Body,
+					FromBranch: node.HeadRefName,
+					ToBranch:   node.BaseRefName,
+				}
+				if node.Author != nil {
+					pr.Author = node.Author.Login
+				}
+				if matches := branchNameRegex.FindStringSubmatch(node.HeadRefName); matches != nil {
+					pr.Commit.CommitID = matches[2]
+				}
+				pullRequests = append(pullRequests, pr)
+			}
+		}
+		if !heads.PageInfo.HasNextPage {
+			break
+		}
+		endCursor = heads.PageInfo.EndCursor
+	}
+	return loginName, repoID, pullRequests, nil
+}
+
+// fetchPullRequests returns the details and all the commits of the given
+//
+//	pull requests, skipping the ones closed since they were listed.
+func (c *client) fetchPullRequests(ctx context.Context, pullRequests []*github.PullRequest) (fezzik_types.PullRequestConnection, error) {
+	nodes := fezzik_types.PullRequestsViewerPullRequestsNodes{}
+	for _, pr := range pullRequests {
+		node, err := c.fetchPullRequest(ctx, pr.Number)
+		if err != nil {
+			return fezzik_types.PullRequestConnection{}, err
+		}
+		if node != nil && node.State == fezzik_types.PullRequestState_OPEN {
+			nodes = append(nodes, node)
+		}
+	}
+	return fezzik_types.PullRequestConnection{Nodes: &nodes}, nil
+}
+
+// fetchPullRequest returns the pull request with the given number and all
+//
+//	the pages of its commits.
+func (c *client) fetchPullRequest(ctx context.Context, number int) (*fezzik_types.PullRequest, error) {
+	var node *fezzik_types.PullRequest
+	if c.config.Repo.MergeQueue {
+		resp, err := c.api.PullRequestWithMergeQueue(ctx,
+			c.config.Repo.GitHubRepoOwner,
+			c.config.Repo.GitHubRepoName,
+			number)
+		if err != nil {
+			return nil, apiError(err, "fetch pull request #%d", number)
+		}
+		node = resp.Repository.PullRequest
+	} else {
+		resp, err := c.api.PullRequest(ctx,
+			c.config.Repo.GitHubRepoOwner,
+			c.config.Repo.GitHubRepoName,
+			number)
+		if err != nil {
+			return nil, apiError(err, "fetch pull request #%d", number)
+		}
+		node = resp.Repository.PullRequest
+	}
+	if node == nil {
+		return nil, nil
+	}
+
+	commits := &node.Commits
+	for commits.PageInfo.HasNextPage {
+		resp, err := c.api.PullRequestCommits(ctx,
+			c.config.Repo.GitHubRepoOwner,
+			c.config.Repo.GitHubRepoName,
+			number,
+			commits.PageInfo.EndCursor)
+		if err != nil {
+			return nil, apiError(err, "fetch commits of pull request #%d", number)
+		}
+		page := resp.Repository.PullRequest.Commits
+		if page.Nodes != nil {
+			*commits.Nodes = append(*commits.Nodes, *page.Nodes...)
+		}
+		commits.PageInfo = page.PageInfo
+	}
+	return node, nil
 }
 
 func matchPullRequestStack(
@@ -257,10 +402,10 @@ func matchPullRequestStack(
 	branchPrefix string,
 	targetBranch string,
 	localCommitStack []git.Commit,
-	allPullRequests fezzik_types.PullRequestConnection) []*github.PullRequest {
+	allPullRequests fezzik_types.PullRequestConnection) ([]*github.PullRequest, error) {
 
-	if len(localCommitStack) == 0 || allPullRequests.Nodes == nil {
-		return []*github.PullRequest{}
+	if allPullRequests.Nodes == nil {
+		return []*github.PullRequest{}, nil
 	}
 
 	// pullRequestMap is a map from commit-id to pull request
@@ -290,9 +435,12 @@ func matchPullRequestStack(
 			Commits:    commits,
 			InQueue:    node.MergeQueueEntry != nil,
 		}
+		if node.Author != nil {
+			pullRequest.Author = node.Author.Login
+		}
 
 		matches := git.BranchNameRegex(branchPrefix).FindStringSubmatch(node.HeadRefName)
-		if matches != nil {
+		if matches != nil && len(*node.Commits.Nodes) > 0 {
 			commit := (*node.Commits.Nodes)[len(*node.Commits.Nodes)-1].Commit
 			pullRequest.Commit = git.Commit{
 				CommitID:   matches[2],
@@ -314,67 +462,33 @@ func matchPullRequestStack(
 			}
 
 			pullRequest.MergeStatus = github.PullRequestMergeStatus{
-				ChecksPass:     checkStatus,
-				ReviewApproved: node.ReviewDecision != nil && *node.ReviewDecision == "APPROVED",
-				NoConflicts:    node.Mergeable == "MERGEABLE",
+				ChecksPass:       checkStatus,
+				ReviewApproved:   node.ReviewDecision != nil && *node.ReviewDecision == "APPROVED",
+				ChangesRequested: node.ReviewDecision != nil && *node.ReviewDecision == "CHANGES_REQUESTED",
+				NoConflicts:      node.Mergeable == "MERGEABLE",
 			}
 
 			pullRequestMap[pullRequest.Commit.CommitID] = pullRequest
 		}
 	}
 
-	// store local commit hashes on PRs for display purposes
-	//  (the remote CommitHash is preserved for update detection in syncCommitStackToGitHub)
-	for _, c := range localCommitStack {
-		if pr, ok := pullRequestMap[c.CommitID]; ok && c.CommitHash != "" {
-			pr.LocalCommitHash = c.CommitHash
-		}
-	}
-
-	var pullRequests []*github.PullRequest
-
-	// find top pr
-	var currpr *github.PullRequest
-	var found bool
-	for i := len(localCommitStack) - 1; i >= 0; i-- {
-		currpr, found = pullRequestMap[localCommitStack[i].CommitID]
-		if found {
-			break
-		}
-	}
+	return github.MatchPullRequestStack(branchPrefix, targetBranch, localCommitStack, pullRequestMap)
+}
 
-	// The list of commits from the command line actually starts at the
-	//  most recent commit. In order to reverse the list we use a
-	//  custom prepend function instead of append
-	prepend := func(l []*github.PullRequest, pr *github.PullRequest) []*github.PullRequest {
-		l = append(l, &github.PullRequest{})
-		copy(l[1:], l)
-		l[0] = pr
-		return l
+func (c *client) GetPullRequests(ctx context.Context) ([]*github.PullRequest, error) {
+	if c.config.User.LogGitHubCalls {
+		fmt.Printf("> github fetch pull requests\n")
 	}
-
-	// build pr stack
-	for currpr != nil {
-		pullRequests = prepend(pullRequests, currpr)
-		if currpr.ToBranch == targetBranch {
-			break
-		}
-
-		matches := git.BranchNameRegex(branchPrefix).FindStringSubmatch(currpr.ToBranch)
-		if matches == nil {
-			panic(fmt.Errorf("invalid base branch for pull request:%s", currpr.ToBranch))
-		}
-		nextCommitID := matches[2]
-
-		currpr = pullRequestMap[nextCommitID]
+	_, _, pullRequests, err := c.fetchPullRequestHeads(ctx)
+	if err != nil {
+		return nil, err
 	}
-
-	return pullRequests
+	return pullRequests, nil
 }
 
 // GetAssignableUsers is taken from github.com/cli/cli/api and is the approach used by the official gh
 // client to resolve user IDs to "ID" values for the update PR API calls. See api.RepoAssignableUsers.
-func (c *client) GetAssignableUsers(ctx context.Context) []github.RepoAssignee {
+func (c *client) GetAssignableUsers(ctx context.Context) ([]github.RepoAssignee, error) {
 	if c.config.User.LogGitHubCalls {
 		fmt.Printf("> github get assignable users\n")
 	}
@@ -386,8 +500,7 @@ func (c *client) GetAssignableUsers(ctx context.Context) []github.RepoAssignee {
 			c.config.Repo.GitHubRepoOwner,
 			c.config.Repo.GitHubRepoName, endCursor)
 		if err != nil {
-			log.Fatal().Err(err).Msg("get assignable users failed")
-			return nil
+			return nil, apiError(err, "get assignable users")
 		}
 
 		for _, node := range *resp.Repository.AssignableUsers.Nodes {
@@ -406,11 +519,11 @@ func (c *client) GetAssignableUsers(ctx context.Context) []github.RepoAssignee {
 		endCursor = resp.Repository.AssignableUsers.PageInfo.EndCursor
 	}
 
-	return users
+	return users, nil
 }
 
 func (c *client) CreatePullRequest(ctx context.Context, gitcmd git.GitInterface,
-	info *github.GitHubInfo, commit git.Commit, prevCommit *git.Commit) *github.PullRequest {
+	info *github.GitHubInfo, commit git.Commit, prevCommit *git.Commit) (*github.PullRequest, error) {
 
 	baseRefName := c.config.Repo.GitHubBranch
 	if prevCommit != nil {
@@ -424,7 +537,10 @@ func (c *client) CreatePullRequest(ctx context.Context, gitcmd git.GitInterface,
 
 	templatizer := config_fetcher.PRTemplatizer(c.config, gitcmd)
 
-	body := templatizer.Body(info, commit, nil)
+	body, err := templatizer.Body(info, commit, nil)
+	if err != nil {
+		return nil, err
+	}
 	resp, err := c.api.CreatePullRequest(ctx, genclient.CreatePullRequestInput{
 		RepositoryId: info.RepositoryID,
 		BaseRefName:  baseRefName,
@@ -433,7 +549,9 @@ func (c *client) CreatePullRequest(ctx context.Context, gitcmd git.GitInterface,
 		Body:         &body,
 		Draft:        &c.config.User.CreateDraftPRs,
 	})
-	check(err)
+	if err != nil {
+		return nil, apiError(err, "create pull request %s", headRefName)
+	}
 
 	pr := &github.PullRequest{
 		ID:         resp.CreatePullRequest.PullRequest.Id,
@@ -455,12 +573,12 @@ func (c *client) CreatePullRequest(ctx context.Context, gitcmd git.GitInterface,
 		fmt.Printf("> github create %d : %s\n", pr.Number, pr.Title)
 	}
 
-	return pr
+	return pr, nil
 }
 
 func (c *client) UpdatePullRequest(ctx context.Context, gitcmd git.GitInterface,
 	info *github.GitHubInfo, pullRequests []*github.PullRequest, pr *github.PullRequest,
-	commit git.Commit, prevCommit *git.Commit) {
+	commit git.Commit, prevCommit *git.Commit) error {
 
 	baseRefName := c.config.Repo.GitHubBranch
 	if prevCommit != nil {
@@ -473,7 +591,10 @@ func (c *client) UpdatePullRequest(ctx context.Context, gitcmd git.GitInterface,
 
 	templatizer := config_fetcher.PRTemplatizer(c.config, gitcmd)
 	title := templatizer.Title(info, commit)
-	body := templatizer.Body(info, commit, pr)
+	body, err := templatizer.Body(info, commit, pr)
+	if err != nil {
+		return err
+	}
 
 	// Skip the API call if nothing has actually changed. This avoids
 	// triggering a spurious pull_request "edited" event on GitHub which
@@ -487,7 +608,7 @@ func (c *client) UpdatePullRequest(ctx context.Context, gitcmd git.GitInterface,
 		if c.config.User.LogGitHubCalls {
 			fmt.Printf("> github update %d : %s (skipped, no changes)\n", pr.Number, pr.Title)
 		}
-		return
+		return nil
 	}
 
 	if c.config.User.LogGitHubCalls {
@@ -508,22 +629,17 @@ func (c *client) UpdatePullRequest(ctx context.Context, gitcmd git.GitInterface,
 		input.BaseRefName = &baseRefName
 	}
 
-	_, err := c.api.UpdatePullRequest(ctx, input)
-
+	_, err = c.api.UpdatePullRequest(ctx, input)
 	if err != nil {
-		log.Fatal().
-			Str("id", pr.ID).
-			Int("number", pr.Number).
-			Str("title", pr.Title).
-			Err(err).
-			Msg("pull request update failed")
+		return apiError(err, "update pull request #%d", pr.Number)
 	}
+	return nil
 }
 
 // AddReviewers adds reviewers to the provided pull request using the requestReviews() API call. It
 // takes github user IDs (ID type) as its input. These can be found by first querying the AssignableUsers
 // for the repo, and then mapping login name to ID.
-func (c *client) AddReviewers(ctx context.Context, pr *github.PullRequest, userIDs []string) {
+func (c *client) AddReviewers(ctx context.Context, pr *github.PullRequest, userIDs []string) error {
 	log.Debug().Strs("userIDs", userIDs).Msg("AddReviewers")
 	if c.config.User.LogGitHubCalls {
 		fmt.Printf("> github add reviewers %d : %s - %+v\n", pr.Number, pr.Title, userIDs)
@@ -535,37 +651,28 @@ func (c *client) AddReviewers(ctx context.Context, pr *github.PullRequest, userI
 		UserIds:       &userIDs,
 	})
 	if err != nil {
-		log.Fatal().
-			Str("id", pr.ID).
-			Int("number", pr.Number).
-			Str("title", pr.Title).
-			Strs("userIDs", userIDs).
-			Err(err).
-			Msg("add reviewers failed")
+		return apiError(err, "add reviewers to pull request #%d", pr.Number)
 	}
+	return nil
 }
 
-func (c *client) CommentPullRequest(ctx context.Context, pr *github.PullRequest, comment string) {
+func (c *client) CommentPullRequest(ctx context.Context, pr *github.PullRequest, comment string) error {
 	_, err := c.api.CommentPullRequest(ctx, genclient.AddCommentInput{
 		SubjectId: pr.ID,
 		Body:      comment,
 	})
 	if err != nil {
-		log.Fatal().
-			Str("id", pr.ID).
-			Int("number", pr.Number).
-			Str("title", pr.Title).
-			Err(err).
-			Msg("pull request update failed")
+		return apiError(err, "comment on pull request #%d", pr.Number)
 	}
 
 	if c.config.User.LogGitHubCalls {
 		fmt.Printf("> github add comment %d : %s\n", pr.Number, pr.Title)
 	}
+	return nil
 }
 
 func (c *client) MergePullRequest(ctx context.Context,
-	pr *github.PullRequest, mergeMethod genclient.PullRequestMergeMethod) {
+	pr *github.PullRequest, mergeMethod genclient.PullRequestMergeMethod) error {
 	log.Debug().
 		Interface("PR", pr).
 		Str("mergeMethod", string(mergeMethod)).
@@ -584,37 +691,48 @@ func (c *client) MergePullRequest(ctx context.Context,
 		})
 	}
 	if err != nil {
-		log.Fatal().
-			Str("id", pr.ID).
-			Int("number", pr.Number).
-			Str("title", pr.Title).
-			Err(err).
-			Msg("pull request merge failed")
+		return apiError(err, "merge pull request #%d", pr.Number)
 	}
-	check(err)
 
 	if c.config.User.LogGitHubCalls {
 		fmt.Printf("> github merge %d : %s\n", pr.Number, pr.Title)
 	}
+	return nil
 }
 
-func (c *client) ClosePullRequest(ctx context.Context, pr *github.PullRequest) {
+func (c *client) ClosePullRequest(ctx context.Context, pr *github.PullRequest) error {
 	log.Debug().Interface("PR", pr).Msg("ClosePullRequest")
 	_, err := c.api.ClosePullRequest(ctx, genclient.ClosePullRequestInput{
 		PullRequestId: pr.ID,
 	})
 	if err != nil {
-		log.Fatal().
-			Str("id", pr.ID).
-			Int("number", pr.Number).
-			Str("title", pr.Title).
-			Err(err).
-			Msg("pull request close failed")
+		return apiError(err, "close pull request #%d", pr.Number)
 	}
 
 	if c.config.User.LogGitHubCalls {
 		fmt.Printf("> github close %d : %s\n", pr.Number, pr.Title)
 	}
+	return nil
+}
+
+func (c *client) RestorePullRequest(ctx context.Context, pr *github.PullRequest) error {
+	log.Debug().Interface("PR", pr).Msg("RestorePullRequest")
+	state := genclient.PullRequestUpdateState_OPEN
+	_, err := c.api.UpdatePullRequest(ctx, genclient.UpdatePullRequestInput{
+		PullRequestId: pr.ID,
+		BaseRefName:   &pr.ToBranch,
+		Title:         &pr.Title,
+		Body:          &pr.Body,
+		State:         &state,
+	})
+	if err != nil {
+		return apiError(err, "restore pull request #%d", pr.Number)
+	}
+
+	if c.config.User.LogGitHubCalls {
+		fmt.Printf("> github restore %d : %s\n", pr.Number, pr.Title)
+	}
+	return nil
 }
 
 // Response types for the raw GraphQL query that fetches individual check contexts.
@@ -656,11 +774,11 @@ type graphqlResponse struct {
 	} `json:"errors"`
 }
 
-// fetchRequiredChecksStatus makes a single batched GraphQL query to fetch
+// fetchRequiredChecks makes a single batched GraphQL query to fetch
 // individual check contexts for all given pull requests. It evaluates only
 // the checks listed in config.Repo.RequiredChecks and returns a map from
-// PR number to the computed status.
-func (c *client) fetchRequiredChecksStatus(ctx context.Context, pullRequests []*github.PullRequest) map[int]github.CheckStatus {
+// PR number to the status of each required check.
+func (c *client) fetchRequiredChecks(ctx context.Context, pullRequests []*github.PullRequest) map[int][]github.Check {
 	if len(pullRequests) == 0 {
 		return nil
 	}
@@ -743,7 +861,7 @@ func (c *client) fetchRequiredChecksStatus(ctx context.Context, pullRequests []*
 		requiredSet[name] = true
 	}
 
-	result := make(map[int]github.CheckStatus)
+	result := make(map[int][]github.Check)
 	for _, pr := range pullRequests {
 		alias := fmt.Sprintf("pr_%d", pr.Number)
 		raw, ok := gqlResp.Data[alias]
@@ -761,10 +879,10 @@ func (c *client) fetchRequiredChecksStatus(ctx context.Context, pullRequests []*
 		commit := prResult.Commits.Nodes[0].Commit
 		if commit.StatusCheckRollup == nil {
 			// No checks configured — treat as pass
-			result[pr.Number] = github.CheckStatusPass
+			result[pr.Number] = []github.Check{}
 			continue
 		}
-		result[pr.Number] = computeRequiredCheckStatus(commit.StatusCheckRollup.Contexts.Nodes, requiredSet)
+		result[pr.Number] = requiredCheckResults(commit.StatusCheckRollup.Contexts.Nodes, requiredSet)
 	}
 
 	return result
@@ -784,75 +902,46 @@ func contextName(ctx checkContextNode) string {
 // If a required check hasn't reported yet (not present in contexts), it is
 // treated as pending.
 func computeRequiredCheckStatus(contexts []checkContextNode, requiredChecks map[string]bool) github.CheckStatus {
-	// Track which required checks we've seen
-	seen := make(map[string]bool, len(requiredChecks))
-	hasPending := false
-	hasFail := false
+	return github.AggregateCheckStatus(requiredCheckResults(contexts, requiredChecks))
+}
 
+// requiredCheckResults returns the status of each check in requiredChecks
+func requiredCheckResults(contexts []checkContextNode, requiredChecks map[string]bool) []github.Check {
+	reported := make([]github.Check, 0, len(contexts))
 	for _, ctx := range contexts {
-		name := contextName(ctx)
-		if !requiredChecks[name] {
-			continue
-		}
-		seen[name] = true
-
-		switch ctx.TypeName {
-		case "CheckRun":
-			switch ctx.Status {
-			case "COMPLETED":
-				if ctx.Conclusion == nil {
-					hasFail = true
-				} else {
-					switch *ctx.Conclusion {
-					case "SUCCESS", "NEUTRAL", "SKIPPED":
-						// pass
-					default:
-						hasFail = true
-					}
-				}
-			default:
-				// IN_PROGRESS, QUEUED, REQUESTED, WAITING, PENDING
-				hasPending = true
+		reported = append(reported, github.Check{Name: contextName(ctx), Status: contextStatus(ctx)})
+	}
+	return github.RequiredCheckResults(reported, requiredChecks)
+}
+
+// contextStatus returns the status of a single check context node
+func contextStatus(ctx checkContextNode) github.CheckStatus {
+	switch ctx.TypeName {
+	case "CheckRun":
+		switch ctx.Status {
+		case "COMPLETED":
+			if ctx.Conclusion == nil {
+				return github.CheckStatusFail
 			}
-		case "StatusContext":
-			switch ctx.State {
-			case "SUCCESS":
-				// pass
-			case "PENDING", "EXPECTED":
-				hasPending = true
+			switch *ctx.Conclusion {
+			case "SUCCESS", "NEUTRAL", "SKIPPED":
+				return github.CheckStatusPass
 			default:
-				hasFail = true
+				return github.CheckStatusFail
 			}
+		default:
+			// IN_PROGRESS, QUEUED, REQUESTED, WAITING, PENDING
+			return github.CheckStatusPending
 		}
-	}
-
-	// Any required check that hasn't reported yet is pending
-	for name := range requiredChecks {
-		if !seen[name] {
-			hasPending = true
+	case "StatusContext":
+		switch ctx.State {
+		case "SUCCESS":
+			return github.CheckStatusPass
+		case "PENDING", "EXPECTED":
+			return github.CheckStatusPending
+		default:
+			return github.CheckStatusFail
 		}
 	}
-
-	if hasFail {
-		return github.CheckStatusFail
-	}
-	if hasPending {
-		return github.CheckStatusPending
-	}
 	return github.CheckStatusPass
 }
-
-func check(err error) {
-	if err != nil {
-		msg := err.Error()
-		if strings.Contains(msg, "401 Unauthorized") {
-			errmsg := "error : 401 Unauthorized\n"
-			errmsg += " make sure GITHUB_TOKEN env variable is set with a valid token\n"
-			errmsg += " to create a valid token goto: https://github.com/settings/tokens\n"
-			fmt.Fprint(os.Stderr, errmsg)
-			os.Exit(-1)
-		} else {
-			panic(err)
-		}
-	}
-}
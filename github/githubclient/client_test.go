@@ -16,6 +16,7 @@ func TestMatchPullRequestStack(t *testing.T) {
 		commits []git.Commit
 		prs     fezzik_types.PullRequestConnection
 		expect  []*github.PullRequest
+		err     bool
 	}{
 		{
 			name: "ThirdCommitQueue",
@@ -31,7 +32,7 @@ func TestMatchPullRequestStack(t *testing.T) {
 						HeadRefName:     "spr/master/00000002",
 						BaseRefName:     "master",
 						MergeQueueEntry: &fezzik_types.PullRequestsViewerPullRequestsNodesMergeQueueEntry{Id: "020"},
-						Commits: fezzik_types.PullRequestsViewerPullRequestsNodesCommits{
+						Commits: fezzik_types.PullRequestCommitConnection{
 							Nodes: &fezzik_types.PullRequestsViewerPullRequestsNodesCommitsNodes{
 								{
 									fezzik_types.PullRequestsViewerPullRequestsNodesCommitsNodesCommit{Oid: "1", MessageBody: "commit-id:1"},
@@ -80,7 +81,7 @@ func TestMatchPullRequestStack(t *testing.T) {
 						HeadRefName:     "spr/master/00000002",
 						BaseRefName:     "master",
 						MergeQueueEntry: &fezzik_types.PullRequestsViewerPullRequestsNodesMergeQueueEntry{Id: "020"},
-						Commits: fezzik_types.PullRequestsViewerPullRequestsNodesCommits{
+						Commits: fezzik_types.PullRequestCommitConnection{
 							Nodes: &fezzik_types.PullRequestsViewerPullRequestsNodesCommitsNodes{
 								{
 									fezzik_types.PullRequestsViewerPullRequestsNodesCommitsNodesCommit{Oid: "1", MessageBody: "commit-id:1"},
@@ -95,7 +96,7 @@ func TestMatchPullRequestStack(t *testing.T) {
 						Id:          "3",
 						HeadRefName: "spr/master/00000003",
 						BaseRefName: "spr/master/00000002",
-						Commits: fezzik_types.PullRequestsViewerPullRequestsNodesCommits{
+						Commits: fezzik_types.PullRequestCommitConnection{
 							Nodes: &fezzik_types.PullRequestsViewerPullRequestsNodesCommitsNodes{
 								{
 									fezzik_types.PullRequestsViewerPullRequestsNodesCommitsNodesCommit{Oid: "3", MessageBody: "commit-id:3"},
@@ -166,7 +167,7 @@ func TestMatchPullRequestStack(t *testing.T) {
 						Id:          "1",
 						HeadRefName: "spr/master/00000001",
 						BaseRefName: "master",
-						Commits: fezzik_types.PullRequestsViewerPullRequestsNodesCommits{
+						Commits: fezzik_types.PullRequestCommitConnection{
 							Nodes: &fezzik_types.PullRequestsViewerPullRequestsNodesCommitsNodes{
 								{
 									fezzik_types.PullRequestsViewerPullRequestsNodesCommitsNodesCommit{Oid: "1"},
@@ -204,7 +205,7 @@ func TestMatchPullRequestStack(t *testing.T) {
 						Id:          "1",
 						HeadRefName: "spr/master/00000001",
 						BaseRefName: "master",
-						Commits: fezzik_types.PullRequestsViewerPullRequestsNodesCommits{
+						Commits: fezzik_types.PullRequestCommitConnection{
 							Nodes: &fezzik_types.PullRequestsViewerPullRequestsNodesCommitsNodes{
 								{
 									fezzik_types.PullRequestsViewerPullRequestsNodesCommitsNodesCommit{Oid: "1"},
@@ -216,7 +217,7 @@ func TestMatchPullRequestStack(t *testing.T) {
 						Id:          "2",
 						HeadRefName: "spr/master/00000002",
 						BaseRefName: "spr/master/00000001",
-						Commits: fezzik_types.PullRequestsViewerPullRequestsNodesCommits{
+						Commits: fezzik_types.PullRequestCommitConnection{
 							Nodes: &fezzik_types.PullRequestsViewerPullRequestsNodesCommitsNodes{
 								{
 									fezzik_types.PullRequestsViewerPullRequestsNodesCommitsNodesCommit{Oid: "2"},
@@ -262,7 +263,7 @@ func TestMatchPullRequestStack(t *testing.T) {
 						Id:          "1",
 						HeadRefName: "spr/master/00000001",
 						BaseRefName: "master",
-						Commits: fezzik_types.PullRequestsViewerPullRequestsNodesCommits{
+						Commits: fezzik_types.PullRequestCommitConnection{
 							Nodes: &fezzik_types.PullRequestsViewerPullRequestsNodesCommitsNodes{
 								{
 									fezzik_types.PullRequestsViewerPullRequestsNodesCommitsNodesCommit{Oid: "1"},
@@ -286,7 +287,7 @@ func TestMatchPullRequestStack(t *testing.T) {
 						Id:          "1",
 						HeadRefName: "spr/master/00000001",
 						BaseRefName: "master",
-						Commits: fezzik_types.PullRequestsViewerPullRequestsNodesCommits{
+						Commits: fezzik_types.PullRequestCommitConnection{
 							Nodes: &fezzik_types.PullRequestsViewerPullRequestsNodesCommitsNodes{
 								{
 									fezzik_types.PullRequestsViewerPullRequestsNodesCommitsNodesCommit{Oid: "1"},
@@ -298,7 +299,7 @@ func TestMatchPullRequestStack(t *testing.T) {
 						Id:          "3",
 						HeadRefName: "spr/master/00000003",
 						BaseRefName: "spr/master/00000002",
-						Commits: fezzik_types.PullRequestsViewerPullRequestsNodesCommits{
+						Commits: fezzik_types.PullRequestCommitConnection{
 							Nodes: &fezzik_types.PullRequestsViewerPullRequestsNodesCommitsNodes{
 								{
 									fezzik_types.PullRequestsViewerPullRequestsNodesCommitsNodesCommit{Oid: "2"},
@@ -310,7 +311,7 @@ func TestMatchPullRequestStack(t *testing.T) {
 						Id:          "2",
 						HeadRefName: "spr/master/00000002",
 						BaseRefName: "spr/master/00000001",
-						Commits: fezzik_types.PullRequestsViewerPullRequestsNodesCommits{
+						Commits: fezzik_types.PullRequestCommitConnection{
 							Nodes: &fezzik_types.PullRequestsViewerPullRequestsNodesCommitsNodes{
 								{
 									fezzik_types.PullRequestsViewerPullRequestsNodesCommitsNodesCommit{Oid: "2"},
@@ -359,7 +360,7 @@ func TestMatchPullRequestStack(t *testing.T) {
 						Id:          "1",
 						HeadRefName: "spr/master/00000001",
 						BaseRefName: "master",
-						Commits: fezzik_types.PullRequestsViewerPullRequestsNodesCommits{
+						Commits: fezzik_types.PullRequestCommitConnection{
 							Nodes: &fezzik_types.PullRequestsViewerPullRequestsNodesCommitsNodes{
 								{
 									fezzik_types.PullRequestsViewerPullRequestsNodesCommitsNodesCommit{Oid: "1"},
@@ -371,7 +372,7 @@ func TestMatchPullRequestStack(t *testing.T) {
 						Id:          "2",
 						HeadRefName: "spr/master/00000002",
 						BaseRefName: "spr/master/00000001",
-						Commits: fezzik_types.PullRequestsViewerPullRequestsNodesCommits{
+						Commits: fezzik_types.PullRequestCommitConnection{
 							Nodes: &fezzik_types.PullRequestsViewerPullRequestsNodesCommitsNodes{
 								{
 									fezzik_types.PullRequestsViewerPullRequestsNodesCommitsNodesCommit{Oid: "2"},
@@ -383,7 +384,7 @@ func TestMatchPullRequestStack(t *testing.T) {
 						Id:          "3",
 						HeadRefName: "spr/master/00000003",
 						BaseRefName: "spr/master/00000002",
-						Commits: fezzik_types.PullRequestsViewerPullRequestsNodesCommits{
+						Commits: fezzik_types.PullRequestCommitConnection{
 							Nodes: &fezzik_types.PullRequestsViewerPullRequestsNodesCommitsNodes{
 								{
 									fezzik_types.PullRequestsViewerPullRequestsNodesCommitsNodesCommit{Oid: "3"},
@@ -444,7 +445,7 @@ func TestMatchPullRequestStack(t *testing.T) {
 						Id:          "1",
 						HeadRefName: "spr/master/00000001",
 						BaseRefName: "master",
-						Commits: fezzik_types.PullRequestsViewerPullRequestsNodesCommits{
+						Commits: fezzik_types.PullRequestCommitConnection{
 							Nodes: &fezzik_types.PullRequestsViewerPullRequestsNodesCommitsNodes{
 								{
 									fezzik_types.PullRequestsViewerPullRequestsNodesCommitsNodesCommit{Oid: "1"},
@@ -456,7 +457,7 @@ func TestMatchPullRequestStack(t *testing.T) {
 						Id:          "2",
 						HeadRefName: "spr/master/00000002",
 						BaseRefName: "spr/master/00000001",
-						Commits: fezzik_types.PullRequestsViewerPullRequestsNodesCommits{
+						Commits: fezzik_types.PullRequestCommitConnection{
 							Nodes: &fezzik_types.PullRequestsViewerPullRequestsNodesCommitsNodes{
 								{
 									fezzik_types.PullRequestsViewerPullRequestsNodesCommitsNodesCommit{Oid: "2"},
@@ -468,7 +469,7 @@ func TestMatchPullRequestStack(t *testing.T) {
 						Id:          "3",
 						HeadRefName: "spr/master/00000003",
 						BaseRefName: "spr/master/00000002",
-						Commits: fezzik_types.PullRequestsViewerPullRequestsNodesCommits{
+						Commits: fezzik_types.PullRequestCommitConnection{
 							Nodes: &fezzik_types.PullRequestsViewerPullRequestsNodesCommitsNodes{
 								{
 									fezzik_types.PullRequestsViewerPullRequestsNodesCommitsNodesCommit{Oid: "3"},
@@ -518,12 +519,212 @@ func TestMatchPullRequestStack(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "OtherTargetBranchWithSlashes",
+			commits: []git.Commit{
+				{CommitID: "00000001"},
+				{CommitID: "00000002"},
+			},
+			prs: fezzik_types.PullRequestConnection{
+				Nodes: &fezzik_types.PullRequestsViewerPullRequestsNodes{
+					{
+						Id:          "1",
+						HeadRefName: "spr/release/2026.10/00000001",
+						BaseRefName: "release/2026.10",
+						Commits: fezzik_types.PullRequestCommitConnection{
+							Nodes: &fezzik_types.PullRequestsViewerPullRequestsNodesCommitsNodes{
+								{
+									fezzik_types.PullRequestsViewerPullRequestsNodesCommitsNodesCommit{Oid: "1"},
+								},
+							},
+						},
+					},
+					{
+						Id:          "2",
+						HeadRefName: "spr/release/2026.10/00000002",
+						BaseRefName: "spr/release/2026.10/00000001",
+						Commits: fezzik_types.PullRequestCommitConnection{
+							Nodes: &fezzik_types.PullRequestsViewerPullRequestsNodesCommitsNodes{
+								{
+									fezzik_types.PullRequestsViewerPullRequestsNodesCommitsNodesCommit{Oid: "2"},
+								},
+							},
+						},
+					},
+				},
+			},
+			expect: []*github.PullRequest{
+				{
+					ID:         "1",
+					FromBranch: "spr/release/2026.10/00000001",
+					ToBranch:   "release/2026.10",
+					Commit: git.Commit{
+						CommitID:   "00000001",
+						CommitHash: "1",
+					},
+					MergeStatus: github.PullRequestMergeStatus{
+						ChecksPass: github.CheckStatusPass,
+					},
+				},
+				{
+					ID:         "2",
+					FromBranch: "spr/release/2026.10/00000002",
+					ToBranch:   "spr/release/2026.10/00000001",
+					Commit: git.Commit{
+						CommitID:   "00000002",
+						CommitHash: "2",
+					},
+					MergeStatus: github.PullRequestMergeStatus{
+						ChecksPass: github.CheckStatusPass,
+					},
+				},
+			},
+		},
+		{
+			name: "BaseBranchLoop",
+			commits: []git.Commit{
+				{CommitID: "00000001"},
+				{CommitID: "00000002"},
+			},
+			prs: fezzik_types.PullRequestConnection{
+				Nodes: &fezzik_types.PullRequestsViewerPullRequestsNodes{
+					{
+						Id:          "1",
+						Number:      1,
+						HeadRefName: "spr/master/00000001",
+						BaseRefName: "spr/master/00000002",
+						Commits: fezzik_types.PullRequestCommitConnection{
+							Nodes: &fezzik_types.PullRequestsViewerPullRequestsNodesCommitsNodes{
+								{
+									fezzik_types.PullRequestsViewerPullRequestsNodesCommitsNodesCommit{Oid: "1"},
+								},
+							},
+						},
+					},
+					{
+						Id:          "2",
+						Number:      2,
+						HeadRefName: "spr/master/00000002",
+						BaseRefName: "spr/master/00000001",
+						Commits: fezzik_types.PullRequestCommitConnection{
+							Nodes: &fezzik_types.PullRequestsViewerPullRequestsNodesCommitsNodes{
+								{
+									fezzik_types.PullRequestsViewerPullRequestsNodesCommitsNodesCommit{Oid: "2"},
+								},
+							},
+						},
+					},
+				},
+			},
+			err: true,
+		},
+		{
+			name: "MovedBelowTop",
+			commits: []git.Commit{
+				{CommitID: "00000001"},
+				{CommitID: "00000003"},
+				{CommitID: "00000002"},
+			},
+			prs: fezzik_types.PullRequestConnection{
+				Nodes: &fezzik_types.PullRequestsViewerPullRequestsNodes{
+					{
+						Id:          "1",
+						HeadRefName: "spr/master/00000001",
+						BaseRefName: "master",
+						Commits: fezzik_types.PullRequestCommitConnection{
+							Nodes: &fezzik_types.PullRequestsViewerPullRequestsNodesCommitsNodes{
+								{
+									fezzik_types.PullRequestsViewerPullRequestsNodesCommitsNodesCommit{Oid: "1"},
+								},
+							},
+						},
+					},
+					{
+						Id:          "2",
+						HeadRefName: "spr/master/00000002",
+						BaseRefName: "spr/master/00000001",
+						Commits: fezzik_types.PullRequestCommitConnection{
+							Nodes: &fezzik_types.PullRequestsViewerPullRequestsNodesCommitsNodes{
+								{
+									fezzik_types.PullRequestsViewerPullRequestsNodesCommitsNodesCommit{Oid: "2"},
+								},
+							},
+						},
+					},
+					{
+						Id:          "3",
+						HeadRefName: "spr/master/00000003",
+						BaseRefName: "spr/master/00000002",
+						Commits: fezzik_types.PullRequestCommitConnection{
+							Nodes: &fezzik_types.PullRequestsViewerPullRequestsNodesCommitsNodes{
+								{
+									fezzik_types.PullRequestsViewerPullRequestsNodesCommitsNodesCommit{Oid: "3"},
+								},
+							},
+						},
+					},
+				},
+			},
+			expect: []*github.PullRequest{
+				{
+					ID:         "1",
+					FromBranch: "spr/master/00000001",
+					ToBranch:   "master",
+					Commit:     git.Commit{CommitID: "00000001", CommitHash: "1"},
+					MergeStatus: github.PullRequestMergeStatus{
+						ChecksPass: github.CheckStatusPass,
+					},
+				},
+				{
+					ID:         "2",
+					FromBranch: "spr/master/00000002",
+					ToBranch:   "spr/master/00000001",
+					Commit:     git.Commit{CommitID: "00000002", CommitHash: "2"},
+					MergeStatus: github.PullRequestMergeStatus{
+						ChecksPass: github.CheckStatusPass,
+					},
+				},
+				{
+					ID:         "3",
+					FromBranch: "spr/master/00000003",
+					ToBranch:   "spr/master/00000002",
+					Commit:     git.Commit{CommitID: "00000003", CommitHash: "3"},
+					MergeStatus: github.PullRequestMergeStatus{
+						ChecksPass: github.CheckStatusPass,
+					},
+				},
+			},
+		},
+		{
+			name: "PullRequestWithoutCommits",
+			commits: []git.Commit{
+				{CommitID: "00000001"},
+			},
+			prs: fezzik_types.PullRequestConnection{
+				Nodes: &fezzik_types.PullRequestsViewerPullRequestsNodes{
+					{
+						Id:          "1",
+						HeadRefName: "spr/master/00000001",
+						BaseRefName: "master",
+						Commits: fezzik_types.PullRequestCommitConnection{
+							Nodes: &fezzik_types.PullRequestsViewerPullRequestsNodesCommitsNodes{},
+						},
+					},
+				},
+			},
+			expect: []*github.PullRequest{},
+		},
 	}
 
 	for _, tc := range tests {
 		repoConfig := &config.RepoConfig{}
 		t.Run(tc.name, func(t *testing.T) {
-			actual := matchPullRequestStack(repoConfig, "spr", "master", tc.commits, tc.prs)
+			actual, err := matchPullRequestStack(repoConfig, "spr", "master", tc.commits, tc.prs)
+			if tc.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
 			require.Equal(t, tc.expect, actual)
 		})
 	}
@@ -753,3 +954,22 @@ func TestComputeRequiredCheckStatus(t *testing.T) {
 		})
 	}
 }
+
+func TestRequiredCheckResults(t *testing.T) {
+	strPtr := func(s string) *string { return &s }
+
+	contexts := []checkContextNode{
+		{TypeName: "StatusContext", Context: "ci/lint", State: "SUCCESS"},
+		{TypeName: "CheckRun", Name: "build", Status: "COMPLETED", Conclusion: strPtr("SUCCESS")},
+		{TypeName: "CheckRun", Name: "build", Status: "COMPLETED", Conclusion: strPtr("FAILURE")},
+		{TypeName: "CheckRun", Name: "optional", Status: "COMPLETED", Conclusion: strPtr("FAILURE")},
+	}
+	required := map[string]bool{"build": true, "ci/lint": true, "deploy": true}
+
+	actual := requiredCheckResults(contexts, required)
+	require.Equal(t, []github.Check{
+		{Name: "build", Status: github.CheckStatusFail},
+		{Name: "ci/lint", Status: github.CheckStatusPass},
+		{Name: "deploy", Status: github.CheckStatusPending},
+	}, actual)
+}
@@ -0,0 +1,94 @@
+package githubclient
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ejoffe/spr/errs"
+	fezzik "github.com/inigolabs/fezzik/client"
+)
+
+// statusTransport turns error responses of the api into classified errors.
+//
+//	The generated client decodes any json body, so without it a 401 or a
+//	rate limited request would read as an empty response.
+type statusTransport struct {
+	base http.RoundTripper
+}
+
+func (t *statusTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	resp, err := base.RoundTrip(req)
+	if err != nil || resp.StatusCode < 300 {
+		return resp, err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	message := strings.TrimSpace(string(body))
+	if message == "" {
+		message = http.StatusText(resp.StatusCode)
+	}
+
+	kind := errs.HTTPStatusKind(resp.StatusCode)
+	if resp.StatusCode == http.StatusForbidden &&
+		(resp.Header.Get("X-RateLimit-Remaining") == "0" ||
+			bytes.Contains(bytes.ToLower(body), []byte("rate limit"))) {
+		kind = errs.RateLimit
+	}
+	if kind == errs.Auth {
+		message += "\n make sure GITHUB_TOKEN env variable is set with a valid token" +
+			"\n to create a valid token goto: https://github.com/settings/tokens"
+	}
+	if reset, ok := rateLimitReset(resp.Header); ok && kind == errs.RateLimit {
+		message += fmt.Sprintf("\n the rate limit resets at %s", reset.Local().Format(time.TimeOnly))
+	}
+	return nil, errs.New(kind, "%d %s : %s", resp.StatusCode, http.StatusText(resp.StatusCode), message)
+}
+
+// graphqlErrorKinds classifies the errors github returns in a 200 response
+//
+//	by their message, the first match wins.
+var graphqlErrorKinds = []struct {
+	match string
+	kind  errs.Kind
+}{
+	{"rate limit", errs.RateLimit},
+	{"submitted too quickly", errs.RateLimit},
+	{"bad credentials", errs.Auth},
+	{"resource not accessible", errs.Auth},
+	{"must have push access", errs.Auth},
+	{"could not resolve", errs.NotFound},
+	{"not found", errs.NotFound},
+	{"not mergeable", errs.Conflict},
+	{"base branch was modified", errs.Conflict},
+	{"already exists", errs.Conflict},
+	{"merge conflict", errs.Conflict},
+}
+
+// apiError describes a failed api call. Graphql errors are classified by
+//
+//	their message, the transport classifies error responses and network
+//	failures are left unknown.
+func apiError(err error, format string, args ...interface{}) error {
+	kind := errs.KindOf(err)
+	var gqlErrors *fezzik.GQLErrors
+	if kind == errs.Unknown && errors.As(err, &gqlErrors) {
+		kind = errs.Validation
+		message := strings.ToLower(err.Error())
+		for _, k := range graphqlErrorKinds {
+			if strings.Contains(message, k.match) {
+				kind = k.kind
+				break
+			}
+		}
+	}
+	return errs.New(kind, "github %s : %w", fmt.Sprintf(format, args...), err)
+}
@@ -0,0 +1,81 @@
+package githubclient
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ejoffe/spr/errs"
+	fezzik "github.com/inigolabs/fezzik/client"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatusTransport(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		remaining string
+		body      string
+		kind      errs.Kind
+	}{
+		{name: "BadCredentials", status: http.StatusUnauthorized, body: `{"message":"Bad credentials"}`, kind: errs.Auth},
+		{name: "Forbidden", status: http.StatusForbidden, remaining: "4000", body: `{"message":"Forbidden"}`, kind: errs.Auth},
+		{name: "RateLimited", status: http.StatusForbidden, remaining: "0", kind: errs.RateLimit},
+		{name: "SecondaryRateLimit", status: http.StatusForbidden, body: `{"message":"You have exceeded a secondary rate limit"}`, kind: errs.RateLimit},
+		{name: "ServerError", status: http.StatusBadGateway, kind: errs.Unknown},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tc.remaining != "" {
+					w.Header().Set("X-RateLimit-Remaining", tc.remaining)
+				}
+				w.WriteHeader(tc.status)
+				w.Write([]byte(tc.body))
+			}))
+			defer server.Close()
+
+			client := &http.Client{Transport: &statusTransport{}}
+			_, err := client.Get(server.URL)
+			require.Error(t, err)
+			require.Equal(t, tc.kind, errs.KindOf(err))
+			require.Contains(t, err.Error(), http.StatusText(tc.status))
+		})
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data":{}}`))
+	}))
+	defer server.Close()
+	client := &http.Client{Transport: &statusTransport{}}
+	resp, err := client.Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+}
+
+func TestAPIError(t *testing.T) {
+	gqlErrors := func(message string) error {
+		return &fezzik.GQLErrors{{Message: message}}
+	}
+	tests := []struct {
+		name string
+		err  error
+		kind errs.Kind
+	}{
+		{name: "NotMergeable", err: gqlErrors("Pull Request is not mergeable"), kind: errs.Conflict},
+		{name: "MissingRepository", err: gqlErrors("Could not resolve to a Repository with the name 'demo'."), kind: errs.NotFound},
+		{name: "RateLimited", err: gqlErrors("API rate limit exceeded for user ID 1."), kind: errs.RateLimit},
+		{name: "Unclassified", err: gqlErrors("Title can't be blank"), kind: errs.Validation},
+		{name: "Transport", err: errs.New(errs.Auth, "401 Unauthorized"), kind: errs.Auth},
+		{name: "Network", err: errors.New("connection refused"), kind: errs.Unknown},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := apiError(tc.err, "merge #%d", 3)
+			require.Equal(t, tc.kind, errs.KindOf(err))
+			require.ErrorIs(t, err, tc.err)
+			require.Contains(t, err.Error(), "github merge #3 : ")
+		})
+	}
+}
@@ -16,6 +16,14 @@ const (
 	PullRequestReviewDecision_REVIEW_REQUIRED   PullRequestReviewDecision = "REVIEW_REQUIRED"
 )
 
+type PullRequestState string
+
+const (
+	PullRequestState_CLOSED PullRequestState = "CLOSED"
+	PullRequestState_MERGED PullRequestState = "MERGED"
+	PullRequestState_OPEN   PullRequestState = "OPEN"
+)
+
 type StatusState string
 
 const (
@@ -26,22 +34,36 @@ const (
 	StatusState_SUCCESS  StatusState = "SUCCESS"
 )
 
+type PageInfo struct {
+	HasNextPage bool
+	EndCursor   *string
+}
+
 type PullRequestConnection struct {
-	Nodes *PullRequestsViewerPullRequestsNodes
+	Nodes    *PullRequestsViewerPullRequestsNodes
+	PageInfo PageInfo
 }
 
-type PullRequestsViewerPullRequestsNodes []*struct {
+type PullRequestsViewerPullRequestsNodes []*PullRequest
+
+type PullRequest struct {
 	Id              string
 	Number          int
 	Title           string
 	Body            string
+	State           PullRequestState
 	BaseRefName     string
 	HeadRefName     string
 	Mergeable       MergeableState
 	ReviewDecision  *PullRequestReviewDecision
+	Author          *PullRequestsViewerPullRequestsNodesAuthor
 	Repository      PullRequestsViewerPullRequestsNodesRepository
 	MergeQueueEntry *PullRequestsViewerPullRequestsNodesMergeQueueEntry
-	Commits         PullRequestsViewerPullRequestsNodesCommits
+	Commits         PullRequestCommitConnection
+}
+
+type PullRequestsViewerPullRequestsNodesAuthor struct {
+	Login string
 }
 
 type PullRequestsViewerPullRequestsNodesRepository struct {
@@ -52,8 +74,9 @@ type PullRequestsViewerPullRequestsNodesMergeQueueEntry struct {
 	Id string
 }
 
-type PullRequestsViewerPullRequestsNodesCommits struct {
-	Nodes *PullRequestsViewerPullRequestsNodesCommitsNodes
+type PullRequestCommitConnection struct {
+	Nodes    *PullRequestsViewerPullRequestsNodesCommitsNodes
+	PageInfo PageInfo
 }
 
 type PullRequestsViewerPullRequestsNodesCommitsNodes []*struct {
@@ -10,72 +10,89 @@ import (
 )
 
 type Client interface {
-	// PullRequests from github/githubclient/queries.graphql:1
-	PullRequests(ctx context.Context,
+	// PullRequestHeads from github/githubclient/queries.graphql:1
+	PullRequestHeads(ctx context.Context,
 		repoOwner string,
 		repoName string,
-	) (*PullRequestsResponse, error)
+		endCursor *string,
+	) (*PullRequestHeadsResponse, error)
+
+	// PullRequest from github/githubclient/queries.graphql:24
+	PullRequest(ctx context.Context,
+		repoOwner string,
+		repoName string,
+		number int,
+	) (*PullRequestResponse, error)
 
-	// PullRequestsWithMergeQueue from github/githubclient/queries.graphql:40
-	PullRequestsWithMergeQueue(ctx context.Context,
+	// PullRequestWithMergeQueue from github/githubclient/queries.graphql:66
+	PullRequestWithMergeQueue(ctx context.Context,
 		repoOwner string,
 		repoName string,
-	) (*PullRequestsWithMergeQueueResponse, error)
+		number int,
+	) (*PullRequestWithMergeQueueResponse, error)
+
+	// PullRequestCommits from github/githubclient/queries.graphql:111
+	PullRequestCommits(ctx context.Context,
+		repoOwner string,
+		repoName string,
+		number int,
+		endCursor *string,
+	) (*PullRequestCommitsResponse, error)
 
-	// AssignableUsers from github/githubclient/queries.graphql:82
+	// AssignableUsers from github/githubclient/queries.graphql:139
 	AssignableUsers(ctx context.Context,
 		repoOwner string,
 		repoName string,
 		endCursor *string,
 	) (*AssignableUsersResponse, error)
 
-	// CreatePullRequest from github/githubclient/queries.graphql:102
+	// CreatePullRequest from github/githubclient/queries.graphql:159
 	CreatePullRequest(ctx context.Context,
 		input CreatePullRequestInput,
 	) (*CreatePullRequestResponse, error)
 
-	// UpdatePullRequest from github/githubclient/queries.graphql:116
+	// UpdatePullRequest from github/githubclient/queries.graphql:173
 	UpdatePullRequest(ctx context.Context,
 		input UpdatePullRequestInput,
 	) (*UpdatePullRequestResponse, error)
 
-	// AddReviewers from github/githubclient/queries.graphql:128
+	// AddReviewers from github/githubclient/queries.graphql:185
 	AddReviewers(ctx context.Context,
 		input RequestReviewsInput,
 	) (*AddReviewersResponse, error)
 
-	// CommentPullRequest from github/githubclient/queries.graphql:140
+	// CommentPullRequest from github/githubclient/queries.graphql:197
 	CommentPullRequest(ctx context.Context,
 		input AddCommentInput,
 	) (*CommentPullRequestResponse, error)
 
-	// MergePullRequest from github/githubclient/queries.graphql:150
+	// MergePullRequest from github/githubclient/queries.graphql:207
 	MergePullRequest(ctx context.Context,
 		input MergePullRequestInput,
 	) (*MergePullRequestResponse, error)
 
-	// AutoMergePullRequest from github/githubclient/queries.graphql:162
+	// AutoMergePullRequest from github/githubclient/queries.graphql:219
 	AutoMergePullRequest(ctx context.Context,
 		input EnablePullRequestAutoMergeInput,
 	) (*AutoMergePullRequestResponse, error)
 
-	// ClosePullRequest from github/githubclient/queries.graphql:174
+	// ClosePullRequest from github/githubclient/queries.graphql:231
 	ClosePullRequest(ctx context.Context,
 		input ClosePullRequestInput,
 	) (*ClosePullRequestResponse, error)
 
-	// StarCheck from github/githubclient/queries.graphql:186
+	// StarCheck from github/githubclient/queries.graphql:243
 	StarCheck(ctx context.Context,
 		after *string,
 	) (*StarCheckResponse, error)
 
-	// StarGetRepo from github/githubclient/queries.graphql:202
+	// StarGetRepo from github/githubclient/queries.graphql:259
 	StarGetRepo(ctx context.Context,
 		owner string,
 		name string,
 	) (*StarGetRepoResponse, error)
 
-	// StarAdd from github/githubclient/queries.graphql:211
+	// StarAdd from github/githubclient/queries.graphql:268
 	StarAdd(ctx context.Context,
 		input AddStarInput,
 	) (*StarAddResponse, error)
@@ -9,32 +9,55 @@ import (
 	"github.com/inigolabs/fezzik/client"
 )
 
-type PullRequestsViewer struct {
-	Login        string
-	PullRequests fezzik_types.PullRequestConnection
+type PullRequestHeadsViewer struct {
+	Login string
 }
 
-type PullRequestsRepository struct {
-	Id string
+type PullRequestHeadsRepository struct {
+	Id           string
+	PullRequests PullRequestHeadsRepositoryPullRequests
+}
+
+type PullRequestHeadsRepositoryPullRequests struct {
+	Nodes    *PullRequestHeadsRepositoryPullRequestsNodes
+	PageInfo fezzik_types.PageInfo
+}
+
+type PullRequestHeadsRepositoryPullRequestsNodes []*struct {
+	Id          string
+	Number      int
+	Title       string
+	Body        string
+	BaseRefName string
+	HeadRefName string
+	Author      *PullRequestHeadsRepositoryPullRequestsNodesAuthor
+}
+
+type PullRequestHeadsRepositoryPullRequestsNodesAuthor struct {
+	Login string
 }
 
-// PullRequestsResponse response type for PullRequests
-type PullRequestsResponse struct {
-	Viewer     PullRequestsViewer
-	Repository *PullRequestsRepository
+// PullRequestHeadsResponse response type for PullRequestHeads
+type PullRequestHeadsResponse struct {
+	Viewer     PullRequestHeadsViewer
+	Repository *PullRequestHeadsRepository
 }
 
-// PullRequests from github/githubclient/queries.graphql:1
-func (c *gqlclient) PullRequests(ctx context.Context,
+// PullRequestHeads from github/githubclient/queries.graphql:1
+func (c *gqlclient) PullRequestHeads(ctx context.Context,
 	repoOwner string,
 	repoName string,
-) (*PullRequestsResponse, error) {
+	endCursor *string,
+) (*PullRequestHeadsResponse, error) {
 
-	var pullRequestsOperation string = `
-	query PullRequests ($repo_owner: String!, $repo_name: String!) {
+	var pullRequestHeadsOperation string = `
+	query PullRequestHeads ($repo_owner: String!, $repo_name: String!, $end_cursor: String) {
 	viewer {
 		login
-		pullRequests(first: 100, states: [OPEN]) {
+	}
+	repository(owner: $repo_owner, name: $repo_name) {
+		id
+		pullRequests(first: 100, after: $end_cursor, states: [OPEN]) {
 			nodes {
 				id
 				number
@@ -42,43 +65,208 @@ func (c *gqlclient) PullRequests(ctx context.Context,
 				body
 				baseRefName
 				headRefName
-				mergeable
-				reviewDecision
-				repository {
-					id
+				author {
+					login
 				}
-				commits(first: 100) {
-					nodes {
-						commit {
-							oid
-							messageHeadline
-							messageBody
-							statusCheckRollup {
-								state
-							}
+			}
+			pageInfo {
+				hasNextPage
+				endCursor
+			}
+		}
+	}
+}
+`
+
+	gqlreq := &client.GQLRequest{
+		OperationName: "PullRequestHeads",
+		Query:         pullRequestHeadsOperation,
+		Variables: map[string]interface{}{
+			"repo_owner": repoOwner,
+			"repo_name":  repoName,
+			"end_cursor": endCursor,
+		},
+	}
+
+	resp := &client.GQLResponse{
+		Data: &PullRequestHeadsResponse{},
+	}
+
+	err := c.gql.Query(ctx, gqlreq, resp)
+	if err != nil {
+		return nil, err
+	}
+
+	var data *PullRequestHeadsResponse
+	if resp.Data != nil {
+		data = resp.Data.(*PullRequestHeadsResponse)
+	}
+
+	if resp.Errors == nil {
+		return data, nil
+	}
+
+	return data, resp.Errors
+}
+
+type PullRequestRepository struct {
+	PullRequest *fezzik_types.PullRequest
+}
+
+// PullRequestResponse response type for PullRequest
+type PullRequestResponse struct {
+	Repository *PullRequestRepository
+}
+
+// PullRequest from github/githubclient/queries.graphql:31
+func (c *gqlclient) PullRequest(ctx context.Context,
+	repoOwner string,
+	repoName string,
+	number int,
+) (*PullRequestResponse, error) {
+
+	var pullRequestOperation string = `
+	query PullRequest ($repo_owner: String!, $repo_name: String!, $number: Int!) {
+	repository(owner: $repo_owner, name: $repo_name) {
+		pullRequest(number: $number) {
+			id
+			number
+			title
+			body
+			state
+			baseRefName
+			headRefName
+			mergeable
+			reviewDecision
+			author {
+				login
+			}
+			repository {
+				id
+			}
+			commits(first: 100) {
+				nodes {
+					commit {
+						oid
+						messageHeadline
+						messageBody
+						statusCheckRollup {
+							state
 						}
 					}
 				}
+				pageInfo {
+					hasNextPage
+					endCursor
+				}
 			}
 		}
 	}
+}
+`
+
+	gqlreq := &client.GQLRequest{
+		OperationName: "PullRequest",
+		Query:         pullRequestOperation,
+		Variables: map[string]interface{}{
+			"repo_owner": repoOwner,
+			"repo_name":  repoName,
+			"number":     number,
+		},
+	}
+
+	resp := &client.GQLResponse{
+		Data: &PullRequestResponse{},
+	}
+
+	err := c.gql.Query(ctx, gqlreq, resp)
+	if err != nil {
+		return nil, err
+	}
+
+	var data *PullRequestResponse
+	if resp.Data != nil {
+		data = resp.Data.(*PullRequestResponse)
+	}
+
+	if resp.Errors == nil {
+		return data, nil
+	}
+
+	return data, resp.Errors
+}
+
+type PullRequestWithMergeQueueRepository struct {
+	PullRequest *fezzik_types.PullRequest
+}
+
+// PullRequestWithMergeQueueResponse response type for PullRequestWithMergeQueue
+type PullRequestWithMergeQueueResponse struct {
+	Repository *PullRequestWithMergeQueueRepository
+}
+
+// PullRequestWithMergeQueue from github/githubclient/queries.graphql:73
+func (c *gqlclient) PullRequestWithMergeQueue(ctx context.Context,
+	repoOwner string,
+	repoName string,
+	number int,
+) (*PullRequestWithMergeQueueResponse, error) {
+
+	var pullRequestWithMergeQueueOperation string = `
+	query PullRequestWithMergeQueue ($repo_owner: String!, $repo_name: String!, $number: Int!) {
 	repository(owner: $repo_owner, name: $repo_name) {
-		id
+		pullRequest(number: $number) {
+			id
+			number
+			title
+			body
+			state
+			baseRefName
+			headRefName
+			mergeable
+			reviewDecision
+			author {
+				login
+			}
+			repository {
+				id
+			}
+			mergeQueueEntry {
+				id
+			}
+			commits(first: 100) {
+				nodes {
+					commit {
+						oid
+						messageHeadline
+						messageBody
+						statusCheckRollup {
+							state
+						}
+					}
+				}
+				pageInfo {
+					hasNextPage
+					endCursor
+				}
+			}
+		}
 	}
 }
 `
 
 	gqlreq := &client.GQLRequest{
-		OperationName: "PullRequests",
-		Query:         pullRequestsOperation,
+		OperationName: "PullRequestWithMergeQueue",
+		Query:         pullRequestWithMergeQueueOperation,
 		Variables: map[string]interface{}{
 			"repo_owner": repoOwner,
 			"repo_name":  repoName,
+			"number":     number,
 		},
 	}
 
 	resp := &client.GQLResponse{
-		Data: &PullRequestsResponse{},
+		Data: &PullRequestWithMergeQueueResponse{},
 	}
 
 	err := c.gql.Query(ctx, gqlreq, resp)
@@ -86,9 +274,9 @@ func (c *gqlclient) PullRequests(ctx context.Context,
 		return nil, err
 	}
 
-	var data *PullRequestsResponse
+	var data *PullRequestWithMergeQueueResponse
 	if resp.Data != nil {
-		data = resp.Data.(*PullRequestsResponse)
+		data = resp.Data.(*PullRequestWithMergeQueueResponse)
 	}
 
 	if resp.Errors == nil {
@@ -98,79 +286,65 @@ func (c *gqlclient) PullRequests(ctx context.Context,
 	return data, resp.Errors
 }
 
-type PullRequestsWithMergeQueueViewer struct {
-	Login        string
-	PullRequests fezzik_types.PullRequestConnection
+type PullRequestCommitsRepository struct {
+	PullRequest *PullRequestCommitsRepositoryPullRequest
 }
 
-type PullRequestsWithMergeQueueRepository struct {
-	Id string
+type PullRequestCommitsRepositoryPullRequest struct {
+	Commits fezzik_types.PullRequestCommitConnection
 }
 
-// PullRequestsWithMergeQueueResponse response type for PullRequestsWithMergeQueue
-type PullRequestsWithMergeQueueResponse struct {
-	Viewer     PullRequestsWithMergeQueueViewer
-	Repository *PullRequestsWithMergeQueueRepository
+// PullRequestCommitsResponse response type for PullRequestCommits
+type PullRequestCommitsResponse struct {
+	Repository *PullRequestCommitsRepository
 }
 
-// PullRequestsWithMergeQueue from github/githubclient/queries.graphql:40
-func (c *gqlclient) PullRequestsWithMergeQueue(ctx context.Context,
+// PullRequestCommits from github/githubclient/queries.graphql:118
+func (c *gqlclient) PullRequestCommits(ctx context.Context,
 	repoOwner string,
 	repoName string,
-) (*PullRequestsWithMergeQueueResponse, error) {
+	number int,
+	endCursor *string,
+) (*PullRequestCommitsResponse, error) {
 
-	var pullRequestsWithMergeQueueOperation string = `
-	query PullRequestsWithMergeQueue ($repo_owner: String!, $repo_name: String!) {
-	viewer {
-		login
-		pullRequests(first: 100, states: [OPEN]) {
-			nodes {
-				id
-				number
-				title
-				body
-				baseRefName
-				headRefName
-				mergeable
-				reviewDecision
-				repository {
-					id
-				}
-				mergeQueueEntry {
-					id
-				}
-				commits(first: 100) {
-					nodes {
-						commit {
-							oid
-							messageHeadline
-							messageBody
-							statusCheckRollup {
-								state
-							}
+	var pullRequestCommitsOperation string = `
+	query PullRequestCommits ($repo_owner: String!, $repo_name: String!, $number: Int!, $end_cursor: String) {
+	repository(owner: $repo_owner, name: $repo_name) {
+		pullRequest(number: $number) {
+			commits(first: 100, after: $end_cursor) {
+				nodes {
+					commit {
+						oid
+						messageHeadline
+						messageBody
+						statusCheckRollup {
+							state
 						}
 					}
 				}
+				pageInfo {
+					hasNextPage
+					endCursor
+				}
 			}
 		}
 	}
-	repository(owner: $repo_owner, name: $repo_name) {
-		id
-	}
 }
 `
 
 	gqlreq := &client.GQLRequest{
-		OperationName: "PullRequestsWithMergeQueue",
-		Query:         pullRequestsWithMergeQueueOperation,
+		OperationName: "PullRequestCommits",
+		Query:         pullRequestCommitsOperation,
 		Variables: map[string]interface{}{
 			"repo_owner": repoOwner,
 			"repo_name":  repoName,
+			"number":     number,
+			"end_cursor": endCursor,
 		},
 	}
 
 	resp := &client.GQLResponse{
-		Data: &PullRequestsWithMergeQueueResponse{},
+		Data: &PullRequestCommitsResponse{},
 	}
 
 	err := c.gql.Query(ctx, gqlreq, resp)
@@ -178,9 +352,9 @@ func (c *gqlclient) PullRequestsWithMergeQueue(ctx context.Context,
 		return nil, err
 	}
 
-	var data *PullRequestsWithMergeQueueResponse
+	var data *PullRequestCommitsResponse
 	if resp.Data != nil {
-		data = resp.Data.(*PullRequestsWithMergeQueueResponse)
+		data = resp.Data.(*PullRequestCommitsResponse)
 	}
 
 	if resp.Errors == nil {
@@ -196,7 +370,7 @@ type AssignableUsersRepository struct {
 
 type AssignableUsersRepositoryAssignableUsers struct {
 	Nodes    *AssignableUsersRepositoryAssignableUsersNodes
-	PageInfo AssignableUsersRepositoryAssignableUsersPageInfo
+	PageInfo fezzik_types.PageInfo
 }
 
 type AssignableUsersRepositoryAssignableUsersNodes []*struct {
@@ -205,17 +379,12 @@ type AssignableUsersRepositoryAssignableUsersNodes []*struct {
 	Name  *string
 }
 
-type AssignableUsersRepositoryAssignableUsersPageInfo struct {
-	HasNextPage bool
-	EndCursor   *string
-}
-
 // AssignableUsersResponse response type for AssignableUsers
 type AssignableUsersResponse struct {
 	Repository *AssignableUsersRepository
 }
 
-// AssignableUsers from github/githubclient/queries.graphql:82
+// AssignableUsers from github/githubclient/queries.graphql:146
 func (c *gqlclient) AssignableUsers(ctx context.Context,
 	repoOwner string,
 	repoName string,
@@ -286,7 +455,7 @@ type CreatePullRequestResponse struct {
 	CreatePullRequest *CreatePullRequestCreatePullRequest
 }
 
-// CreatePullRequest from github/githubclient/queries.graphql:102
+// CreatePullRequest from github/githubclient/queries.graphql:166
 func (c *gqlclient) CreatePullRequest(ctx context.Context,
 	input CreatePullRequestInput,
 ) (*CreatePullRequestResponse, error) {
@@ -345,7 +514,7 @@ type UpdatePullRequestResponse struct {
 	UpdatePullRequest *UpdatePullRequestUpdatePullRequest
 }
 
-// UpdatePullRequest from github/githubclient/queries.graphql:116
+// UpdatePullRequest from github/githubclient/queries.graphql:180
 func (c *gqlclient) UpdatePullRequest(ctx context.Context,
 	input UpdatePullRequestInput,
 ) (*UpdatePullRequestResponse, error) {
@@ -402,7 +571,7 @@ type AddReviewersResponse struct {
 	RequestReviews *AddReviewersRequestReviews
 }
 
-// AddReviewers from github/githubclient/queries.graphql:128
+// AddReviewers from github/githubclient/queries.graphql:192
 func (c *gqlclient) AddReviewers(ctx context.Context,
 	input RequestReviewsInput,
 ) (*AddReviewersResponse, error) {
@@ -455,7 +624,7 @@ type CommentPullRequestResponse struct {
 	AddComment *CommentPullRequestAddComment
 }
 
-// CommentPullRequest from github/githubclient/queries.graphql:140
+// CommentPullRequest from github/githubclient/queries.graphql:204
 func (c *gqlclient) CommentPullRequest(ctx context.Context,
 	input AddCommentInput,
 ) (*CommentPullRequestResponse, error) {
@@ -510,7 +679,7 @@ type MergePullRequestResponse struct {
 	MergePullRequest *MergePullRequestMergePullRequest
 }
 
-// MergePullRequest from github/githubclient/queries.graphql:150
+// MergePullRequest from github/githubclient/queries.graphql:214
 func (c *gqlclient) MergePullRequest(ctx context.Context,
 	input MergePullRequestInput,
 ) (*MergePullRequestResponse, error) {
@@ -567,7 +736,7 @@ type AutoMergePullRequestResponse struct {
 	EnablePullRequestAutoMerge *AutoMergePullRequestEnablePullRequestAutoMerge
 }
 
-// AutoMergePullRequest from github/githubclient/queries.graphql:162
+// AutoMergePullRequest from github/githubclient/queries.graphql:226
 func (c *gqlclient) AutoMergePullRequest(ctx context.Context,
 	input EnablePullRequestAutoMergeInput,
 ) (*AutoMergePullRequestResponse, error) {
@@ -624,7 +793,7 @@ type ClosePullRequestResponse struct {
 	ClosePullRequest *ClosePullRequestClosePullRequest
 }
 
-// ClosePullRequest from github/githubclient/queries.graphql:174
+// ClosePullRequest from github/githubclient/queries.graphql:238
 func (c *gqlclient) ClosePullRequest(ctx context.Context,
 	input ClosePullRequestInput,
 ) (*ClosePullRequestResponse, error) {
@@ -691,7 +860,7 @@ type StarCheckResponse struct {
 	Viewer StarCheckViewer
 }
 
-// StarCheck from github/githubclient/queries.graphql:186
+// StarCheck from github/githubclient/queries.graphql:250
 func (c *gqlclient) StarCheck(ctx context.Context,
 	after *string,
 ) (*StarCheckResponse, error) {
@@ -750,7 +919,7 @@ type StarGetRepoResponse struct {
 	Repository *StarGetRepoRepository
 }
 
-// StarGetRepo from github/githubclient/queries.graphql:202
+// StarGetRepo from github/githubclient/queries.graphql:266
 func (c *gqlclient) StarGetRepo(ctx context.Context,
 	owner string,
 	name string,
@@ -803,7 +972,7 @@ type StarAddResponse struct {
 	AddStar *StarAddAddStar
 }
 
-// StarAdd from github/githubclient/queries.graphql:211
+// StarAdd from github/githubclient/queries.graphql:275
 func (c *gqlclient) StarAdd(ctx context.Context,
 	input AddStarInput,
 ) (*StarAddResponse, error) {
@@ -31,8 +31,7 @@ func (c *client) MaybeStar(ctx context.Context, cfg *config.Config) {
 			line = strings.TrimSpace(line)
 			if line != "n" {
 				cfg.State.Stargazer = true
-				rake.LoadSources(cfg.State,
-					rake.YamlFileWriter(config_parser.InternalConfigFilePath()))
+				saveState(cfg)
 				fmt.Println("Thank You! Happy Coding!")
 			}
 		}
@@ -40,8 +39,7 @@ func (c *client) MaybeStar(ctx context.Context, cfg *config.Config) {
 		if starred {
 			log.Debug().Bool("stargazer", true).Msg("MaybeStar")
 			cfg.State.Stargazer = true
-			rake.LoadSources(cfg.State,
-				rake.YamlFileWriter(config_parser.InternalConfigFilePath()))
+			saveState(cfg)
 		} else {
 			log.Debug().Bool("stargazer", false).Msg("MaybeStar")
 			fmt.Print("enjoying git spr? add a GitHub star? [Y/n]:")
@@ -50,16 +48,29 @@ func (c *client) MaybeStar(ctx context.Context, cfg *config.Config) {
 			line = strings.TrimSpace(line)
 			if line != "n" {
 				log.Debug().Msg("MaybeStar : adding star")
-				c.addStar(ctx)
+				if err := c.addStar(ctx); err != nil {
+					log.Debug().Err(err).Msg("MaybeStar : add star failed")
+				}
 				cfg.State.Stargazer = true
-				rake.LoadSources(cfg.State,
-					rake.YamlFileWriter(config_parser.InternalConfigFilePath()))
+				saveState(cfg)
 				fmt.Println("Thank You! Happy Coding!")
 			}
 		}
 	}
 }
 
+// saveState writes the internal state, the star prompt doesn't fail a
+//
+//	command so an error is only logged.
+func saveState(cfg *config.Config) {
+	path, err := config_parser.InternalConfigFilePath()
+	if err != nil {
+		log.Debug().Err(err).Msg("MaybeStar : save state failed")
+		return
+	}
+	rake.LoadSources(cfg.State, rake.YamlFileWriter(path))
+}
+
 func (c *client) isStar(ctx context.Context) (bool, error) {
 	iteration := 0
 	cursor := ""
@@ -95,12 +106,17 @@ func (c *client) isStar(ctx context.Context) (bool, error) {
 	}
 }
 
-func (c *client) addStar(ctx context.Context) {
+func (c *client) addStar(ctx context.Context) error {
 	resp, err := c.api.StarGetRepo(ctx, sprRepoOwner, sprRepoName)
-	check(err)
+	if err != nil {
+		return apiError(err, "get repository %s/%s", sprRepoOwner, sprRepoName)
+	}
 
 	_, err = c.api.StarAdd(ctx, genclient.AddStarInput{
 		StarrableId: resp.Repository.Id,
 	})
-	check(err)
+	if err != nil {
+		return apiError(err, "star repository %s/%s", sprRepoOwner, sprRepoName)
+	}
+	return nil
 }
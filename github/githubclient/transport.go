@@ -0,0 +1,223 @@
+package githubclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// maxConcurrentRequests bounds the requests in flight, github's secondary
+	//  rate limits trip on bursts of concurrent mutations
+	maxConcurrentRequests = 4
+
+	// maxAttempts is the number of times a request is sent before its error
+	//  response is returned
+	maxAttempts = 4
+
+	// maxRetryWait is the longest spr waits for a rate limit to reset, longer
+	//  waits return the rate limit error instead
+	maxRetryWait = time.Minute
+)
+
+// RateLimit is the api quota reported by the last github response
+type RateLimit struct {
+	Limit     int
+	Remaining int
+	Reset     time.Time
+}
+
+func (r RateLimit) String() string {
+	return fmt.Sprintf("%d of %d remaining, resets at %s",
+		r.Remaining, r.Limit, r.Reset.Local().Format(time.TimeOnly))
+}
+
+// retryTransport resends requests which were rate limited, waiting as long
+//
+//	as the response asks to, and the queries which failed with a transient
+//	server error, and bounds the number of concurrent requests. It records
+//	the quota reported by the responses.
+type retryTransport struct {
+	base    http.RoundTripper
+	backoff time.Duration // first wait between attempts, doubled after each one
+	sem     chan struct{}
+
+	mu        sync.Mutex
+	rateLimit *RateLimit
+}
+
+func newRetryTransport(base http.RoundTripper) *retryTransport {
+	return &retryTransport{
+		base:    base,
+		backoff: time.Second,
+		sem:     make(chan struct{}, maxConcurrentRequests),
+	}
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	ctx := req.Context()
+	backoff := t.backoff
+	// a mutation failing with a server error may have been applied anyway
+	repeatable := isRepeatable(req)
+	for attempt := 1; ; attempt++ {
+		select {
+		case t.sem <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		resp, err := base.RoundTrip(req)
+		<-t.sem
+		if err != nil {
+			return nil, err
+		}
+		t.recordRateLimit(resp.Header)
+
+		wait, retry := retryWait(resp, backoff)
+		if resp.StatusCode >= 500 && !repeatable {
+			retry = false
+		}
+		// a body which can't be read again can't be resent
+		if !retry || attempt == maxAttempts || wait > maxRetryWait ||
+			(req.Body != nil && req.GetBody == nil) {
+			return resp, nil
+		}
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+
+		if resp.StatusCode >= 500 {
+			log.Debug().Int("status", resp.StatusCode).Dur("wait", wait).Msg("github request failed, retrying")
+		} else {
+			log.Warn().Msgf("github rate limit reached, retrying in %s", wait.Round(time.Second))
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+		backoff *= 2
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(ctx)
+			req.Body = body
+		}
+	}
+}
+
+// isRepeatable returns true when req can be sent again after a server
+//
+//	error without changing anything twice: GET requests and graphql queries,
+//	but not graphql mutations nor other REST requests.
+func isRepeatable(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		return true
+	case http.MethodPost:
+	default:
+		return false
+	}
+	if req.GetBody == nil {
+		return false
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return false
+	}
+	defer body.Close()
+	var request struct {
+		Query string `json:"query"`
+	}
+	err = json.NewDecoder(body).Decode(&request)
+	if err != nil {
+		return false
+	}
+	// the shorthand { ... } is a query as well
+	query := strings.TrimSpace(request.Query)
+	return strings.HasPrefix(query, "query") || strings.HasPrefix(query, "{")
+}
+
+// retryWait returns how long to wait before resending the request of resp,
+//
+//	false when the response isn't worth retrying. Rate limited responses wait
+//	for Retry-After, or for the quota to reset when it's used up.
+func retryWait(resp *http.Response, backoff time.Duration) (time.Duration, bool) {
+	switch resp.StatusCode {
+	case http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return backoff, true
+	case http.StatusForbidden, http.StatusTooManyRequests:
+	default:
+		return 0, false
+	}
+
+	if after := resp.Header.Get("Retry-After"); after != "" {
+		if seconds, err := strconv.Atoi(after); err == nil {
+			return time.Duration(seconds) * time.Second, true
+		}
+		if at, err := http.ParseTime(after); err == nil {
+			return time.Until(at), true
+		}
+	}
+	if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		if reset, ok := rateLimitReset(resp.Header); ok {
+			// the reset time has a resolution of a second
+			return time.Until(reset) + time.Second, true
+		}
+	}
+	// a 403 which isn't about the rate limit is a permission error
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return backoff, true
+	}
+	return 0, false
+}
+
+func rateLimitReset(header http.Header) (time.Time, bool) {
+	reset, err := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(reset, 0), true
+}
+
+func (t *retryTransport) recordRateLimit(header http.Header) {
+	limit, err := strconv.Atoi(header.Get("X-RateLimit-Limit"))
+	if err != nil {
+		return
+	}
+	remaining, err := strconv.Atoi(header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+	reset, _ := rateLimitReset(header)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rateLimit = &RateLimit{Limit: limit, Remaining: remaining, Reset: reset}
+}
+
+// RateLimit returns the quota reported by the last response, false when no
+//
+//	response reported it.
+func (t *retryTransport) RateLimit() (RateLimit, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.rateLimit == nil {
+		return RateLimit{}, false
+	}
+	return *t.rateLimit, true
+}
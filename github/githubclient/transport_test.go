@@ -0,0 +1,142 @@
+package githubclient
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ejoffe/spr/errs"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestRetryTransport returns a retry transport which doesn't wait
+// between attempts unless a response asks to.
+func newTestRetryTransport() *retryTransport {
+	t := newRetryTransport(nil)
+	t.backoff = time.Millisecond
+	return t
+}
+
+const (
+	testQuery    = `{"query":"query PullRequestHeads { viewer { login } }"}`
+	testMutation = `{"query":"mutation MergePullRequest ($input: MergePullRequestInput!) { }"}`
+)
+
+func TestRetryTransport(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		statuses []int
+		header   http.Header
+		attempts int
+		status   int
+	}{
+		{name: "BadGateway", statuses: []int{502, 200}, attempts: 2, status: 200},
+		{name: "ServerErrors", statuses: []int{500, 503, 504, 200}, attempts: 4, status: 200},
+		{name: "GiveUp", statuses: []int{502, 502, 502, 502, 200}, attempts: maxAttempts, status: 502},
+		{name: "TooManyRequests", statuses: []int{429, 200}, attempts: 2, status: 200},
+		{name: "RetryAfter", statuses: []int{403, 200}, header: http.Header{"Retry-After": {"0"}}, attempts: 2, status: 200},
+		{name: "RetryAfterTooLong", statuses: []int{403, 200}, header: http.Header{"Retry-After": {"3600"}}, attempts: 1, status: 403},
+		{name: "QuotaReset", statuses: []int{403, 200}, header: http.Header{
+			"X-Ratelimit-Remaining": {"0"},
+			"X-Ratelimit-Reset":     {strconv.FormatInt(time.Now().Add(-time.Second).Unix(), 10)},
+		}, attempts: 2, status: 200},
+		{name: "Forbidden", statuses: []int{403, 200}, attempts: 1, status: 403},
+		{name: "NotFound", statuses: []int{404, 200}, attempts: 1, status: 404},
+		{name: "MutationBadGateway", body: testMutation, statuses: []int{502, 200}, attempts: 1, status: 502},
+		{name: "MutationTooManyRequests", body: testMutation, statuses: []int{429, 200}, attempts: 2, status: 200},
+		{name: "MutationRetryAfter", body: testMutation, statuses: []int{403, 200}, header: http.Header{"Retry-After": {"0"}}, attempts: 2, status: 200},
+		{name: "RESTBadGateway", body: "{}", statuses: []int{502, 200}, attempts: 1, status: 502},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.body == "" {
+				tc.body = testQuery
+			}
+			var attempts int
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// the body is sent again with each attempt
+				body, _ := io.ReadAll(r.Body)
+				require.Equal(t, tc.body, string(body))
+				status := tc.statuses[attempts]
+				attempts++
+				if status != http.StatusOK {
+					for k, v := range tc.header {
+						w.Header()[k] = v
+					}
+				}
+				w.WriteHeader(status)
+			}))
+			defer server.Close()
+
+			client := &http.Client{Transport: newTestRetryTransport()}
+			resp, err := client.Post(server.URL, "application/json", strings.NewReader(tc.body))
+			require.NoError(t, err)
+			resp.Body.Close()
+			require.Equal(t, tc.status, resp.StatusCode)
+			require.Equal(t, tc.attempts, attempts)
+		})
+	}
+}
+
+func TestRetryTransportRateLimitError(t *testing.T) {
+	reset := time.Now().Add(time.Hour)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Limit", "5000")
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	retry := newTestRetryTransport()
+	client := &http.Client{Transport: &statusTransport{base: retry}}
+	_, err := client.Get(server.URL)
+	require.ErrorIs(t, err, errs.RateLimit)
+	require.Contains(t, err.Error(), "the rate limit resets at "+reset.Local().Format(time.TimeOnly))
+
+	rateLimit, ok := retry.RateLimit()
+	require.True(t, ok)
+	require.Equal(t, 5000, rateLimit.Limit)
+	require.Equal(t, 0, rateLimit.Remaining)
+	require.Equal(t, reset.Unix(), rateLimit.Reset.Unix())
+}
+
+func TestRetryTransportConcurrency(t *testing.T) {
+	var inFlight, maxInFlight int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	retry := newTestRetryTransport()
+	_, ok := retry.RateLimit()
+	require.False(t, ok)
+	client := &http.Client{Transport: retry}
+	var wg sync.WaitGroup
+	for i := 0; i < 3*maxConcurrentRequests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := client.Get(server.URL)
+			require.NoError(t, err)
+			resp.Body.Close()
+		}()
+	}
+	wg.Wait()
+	require.LessOrEqual(t, maxInFlight, int32(maxConcurrentRequests))
+}
@@ -0,0 +1,588 @@
+package gitlabclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ejoffe/spr/config"
+	"github.com/ejoffe/spr/errs"
+	"github.com/ejoffe/spr/git"
+	"github.com/ejoffe/spr/github"
+	"github.com/ejoffe/spr/github/githubclient/gen/genclient"
+	"github.com/ejoffe/spr/github/internal/rest"
+	"github.com/ejoffe/spr/github/template/config_fetcher"
+	"github.com/rs/zerolog/log"
+)
+
+const tokenHelpText = `
+No GitLab token found! Create a personal access token with the "api" scope
+at https://%s/-/user_settings/personal_access_tokens and set the
+GITLAB_TOKEN environment variable.
+`
+
+// api is the GitLab REST API, list apis return the next page in a header
+var api = rest.API{
+	Name:       "gitlab",
+	AuthHeader: "PRIVATE-TOKEN",
+	TokenHelp: "make sure GITLAB_TOKEN env variable is set with a valid token" +
+		"\n the token needs the api scope",
+	Paging:    rest.NextPagePaging,
+	PageParam: "per_page",
+	PageLimit: 100,
+}
+
+// NewGitLabClient returns a client for the GitLab REST API of the configured host.
+//
+//	Merge requests play the role of pull requests: each commit in the stack
+//	gets a merge request targeting the branch of the previous commit.
+func NewGitLabClient(ctx context.Context, config *config.Config) (*client, error) {
+	token, err := rest.Token(tokenHelpText, config.Repo.GitHubHost, "GITLAB_TOKEN")
+	if err != nil {
+		return nil, err
+	}
+	endpoint := rest.Endpoint(config.Repo.GitHubHost, "/api/v4")
+	return NewClient(config, endpoint, token, http.DefaultClient), nil
+}
+
+// NewClient returns a client for the GitLab REST API at endpoint
+func NewClient(config *config.Config, endpoint string, token string, httpClient *http.Client) *client {
+	return &client{
+		config: config,
+		rest:   rest.NewClient(api, endpoint, token, httpClient),
+	}
+}
+
+type client struct {
+	config *config.Config
+	rest   *rest.Client
+}
+
+type user struct {
+	ID       int    `json:"id"`
+	Username string `json:"username"`
+	Name     string `json:"name"`
+}
+
+type project struct {
+	ID int `json:"id"`
+}
+
+type pipeline struct {
+	ID     int    `json:"id"`
+	Status string `json:"status"`
+}
+
+type job struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+}
+
+type mergeRequest struct {
+	ID           int       `json:"id"`
+	IID          int       `json:"iid"`
+	Title        string    `json:"title"`
+	Description  string    `json:"description"`
+	State        string    `json:"state"`
+	SourceBranch string    `json:"source_branch"`
+	TargetBranch string    `json:"target_branch"`
+	SHA          string    `json:"sha"`
+	Author       user      `json:"author"`
+	HasConflicts bool      `json:"has_conflicts"`
+	HeadPipeline *pipeline `json:"head_pipeline"`
+
+	// DetailedMergeStatus is requested_changes when a reviewer requested changes
+	DetailedMergeStatus string `json:"detailed_merge_status"`
+}
+
+type commit struct {
+	ID      string `json:"id"`
+	Title   string `json:"title"`
+	Message string `json:"message"`
+}
+
+type approvals struct {
+	Approved bool `json:"approved"`
+}
+
+type mergeTrainCar struct {
+	MergeRequest struct {
+		IID int `json:"iid"`
+	} `json:"merge_request"`
+}
+
+// projectPath returns the api path of the configured project
+func (c *client) projectPath() string {
+	return "/projects/" + url.PathEscape(c.config.Repo.GitHubRepoOwner+"/"+c.config.Repo.GitHubRepoName)
+}
+
+func (c *client) GetInfo(ctx context.Context, gitcmd git.GitInterface) (*github.GitHubInfo, error) {
+	if c.config.User.LogGitHubCalls {
+		fmt.Printf("> gitlab fetch merge requests\n")
+	}
+
+	var currentUser user
+	err := c.rest.Request(ctx, http.MethodGet, "/user", nil, &currentUser)
+	if err != nil {
+		return nil, err
+	}
+	var proj project
+	err = c.rest.Request(ctx, http.MethodGet, c.projectPath(), nil, &proj)
+	if err != nil {
+		return nil, err
+	}
+
+	openMergeRequests, err := c.openMergeRequests(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	inTrain := map[int]bool{}
+	if c.config.Repo.MergeQueue {
+		var cars []mergeTrainCar
+		err = c.rest.RequestAll(ctx, c.projectPath()+"/merge_trains?scope=active", &cars)
+		if err != nil {
+			return nil, err
+		}
+		for _, car := range cars {
+			inTrain[car.MergeRequest.IID] = true
+		}
+	}
+
+	localCommitStack, err := git.GetLocalCommitStack(ctx, c.config, gitcmd)
+	if err != nil {
+		return nil, err
+	}
+	localCommitIDs := map[string]bool{}
+	for _, c := range localCommitStack {
+		localCommitIDs[c.CommitID] = true
+	}
+
+	// only merge requests of local commits can be part of the stack,
+	//  the others are not fetched in detail
+	branchRegex := git.BranchNameRegex(c.config.User.BranchPrefix)
+	pullRequestMap := map[string]*github.PullRequest{}
+	for _, listed := range openMergeRequests {
+		matches := branchRegex.FindStringSubmatch(listed.SourceBranch)
+		if matches == nil || !localCommitIDs[matches[2]] {
+			continue
+		}
+		pr, err := c.fetchPullRequest(ctx, listed.IID, matches[2])
+		if err != nil {
+			return nil, err
+		}
+		pr.InQueue = inTrain[pr.Number]
+		pullRequestMap[pr.Commit.CommitID] = pr
+	}
+
+	pullRequests, err := github.MatchPullRequestStack(c.config.User.BranchPrefix,
+		c.config.Repo.GitHubBranch, localCommitStack, pullRequestMap)
+	if err != nil {
+		return nil, errs.Wrap(errs.Validation, err)
+	}
+	github.MarkStacked(c.config, pullRequests)
+
+	localBranch := c.config.Stack
+	if localBranch == "" {
+		localBranch, err = git.GetLocalBranchName(ctx, gitcmd)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	info := &github.GitHubInfo{
+		UserName:     currentUser.Username,
+		RepositoryID: strconv.Itoa(proj.ID),
+		LocalBranch:  localBranch,
+		PullRequests: pullRequests,
+	}
+
+	log.Debug().Interface("Info", info).Msg("GetInfo")
+	return info, nil
+}
+
+func (c *client) GetPullRequests(ctx context.Context) ([]*github.PullRequest, error) {
+	if c.config.User.LogGitHubCalls {
+		fmt.Printf("> gitlab fetch merge requests\n")
+	}
+	openMergeRequests, err := c.openMergeRequests(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var pullRequests []*github.PullRequest
+	for _, listed := range openMergeRequests {
+		pullRequests = append(pullRequests, &github.PullRequest{
+			ID:         strconv.Itoa(listed.ID),
+			Number:     listed.IID,
+			Title:      listed.Title,
+			Body:       listed.Description,
+			FromBranch: listed.SourceBranch,
+			ToBranch:   listed.TargetBranch,
+			Author:     listed.Author.Username,
+		})
+	}
+	return pullRequests, nil
+}
+
+// openMergeRequests lists the open merge requests of the stacks into the
+// target branch, source branches can only be filtered by exact name so
+// the head ref prefix is matched here.
+func (c *client) openMergeRequests(ctx context.Context) ([]mergeRequest, error) {
+	var listed []mergeRequest
+	err := c.rest.RequestAll(ctx, c.projectPath()+"/merge_requests?state=opened", &listed)
+	if err != nil {
+		return nil, err
+	}
+	headRefPrefix := github.HeadRefPrefix(c.config.User.BranchPrefix, c.config.Repo.GitHubBranch)
+	var mergeRequests []mergeRequest
+	for _, mr := range listed {
+		if strings.HasPrefix(mr.SourceBranch, headRefPrefix) {
+			mergeRequests = append(mergeRequests, mr)
+		}
+	}
+	return mergeRequests, nil
+}
+
+// fetchPullRequest fetches a single merge request with its commits, approval
+//
+//	and pipeline status. The merge request list api doesn't include the head
+//	pipeline or conflicts, so each merge request in the stack is fetched.
+func (c *client) fetchPullRequest(ctx context.Context, iid int, commitID string) (*github.PullRequest, error) {
+	mrPath := fmt.Sprintf("%s/merge_requests/%d", c.projectPath(), iid)
+	var mr mergeRequest
+	err := c.rest.Request(ctx, http.MethodGet, mrPath, nil, &mr)
+	if err != nil {
+		return nil, err
+	}
+
+	// commits are returned with the most recent commit first
+	var mrCommits []commit
+	err = c.rest.RequestAll(ctx, mrPath+"/commits", &mrCommits)
+	if err != nil {
+		return nil, err
+	}
+	var commits []git.Commit
+	for i := len(mrCommits) - 1; i >= 0; i-- {
+		for _, line := range strings.Split(mrCommits[i].Message, "\n") {
+			if strings.HasPrefix(line, "commit-id:") {
+				commits = append(commits, git.Commit{
+					CommitID:   strings.TrimSpace(strings.Split(line, ":")[1]),
+					CommitHash: mrCommits[i].ID,
+					Subject:    mrCommits[i].Title,
+					Body:       mrCommits[i].Message,
+				})
+			}
+		}
+	}
+
+	var approval approvals
+	err = c.rest.Request(ctx, http.MethodGet, mrPath+"/approvals", nil, &approval)
+	if err != nil {
+		return nil, err
+	}
+
+	pr := &github.PullRequest{
+		ID:         strconv.Itoa(mr.ID),
+		Number:     mr.IID,
+		Title:      mr.Title,
+		Body:       mr.Description,
+		FromBranch: mr.SourceBranch,
+		ToBranch:   mr.TargetBranch,
+		Author:     mr.Author.Username,
+		Commits:    commits,
+		Commit: git.Commit{
+			CommitID:   commitID,
+			CommitHash: mr.SHA,
+			Subject:    mr.Title,
+		},
+		MergeStatus: github.PullRequestMergeStatus{
+			ChecksPass:       github.CheckStatusPass,
+			ReviewApproved:   approval.Approved,
+			ChangesRequested: mr.DetailedMergeStatus == "requested_changes",
+			NoConflicts:      !mr.HasConflicts,
+		},
+	}
+	if len(mrCommits) > 0 {
+		pr.Commit.Subject = mrCommits[0].Title
+		pr.Commit.Body = mrCommits[0].Message
+	}
+
+	if mr.HeadPipeline != nil {
+		pr.MergeStatus.ChecksPass = pipelineStatus(mr.HeadPipeline.Status)
+		if c.config.Repo.RequireChecks && len(c.config.Repo.RequiredChecks) > 0 {
+			var jobs []job
+			err = c.rest.RequestAll(ctx, fmt.Sprintf("%s/pipelines/%d/jobs", c.projectPath(), mr.HeadPipeline.ID), &jobs)
+			if err != nil {
+				return nil, err
+			}
+			pr.Checks = requiredJobResults(jobs, c.config.Repo.RequiredChecks)
+			pr.MergeStatus.ChecksPass = github.AggregateCheckStatus(pr.Checks)
+		}
+	}
+	return pr, nil
+}
+
+// pipelineStatus maps a GitLab pipeline or job status to a check status
+func pipelineStatus(status string) github.CheckStatus {
+	switch status {
+	case "success", "skipped":
+		return github.CheckStatusPass
+	case "failed", "canceled":
+		return github.CheckStatusFail
+	default:
+		// created, waiting_for_resource, preparing, pending, running, scheduled, manual
+		return github.CheckStatusPending
+	}
+}
+
+// requiredJobResults returns the status of each required pipeline job
+func requiredJobResults(jobs []job, requiredChecks []string) []github.Check {
+	required := map[string]bool{}
+	for _, name := range requiredChecks {
+		required[name] = true
+	}
+	reported := make([]github.Check, 0, len(jobs))
+	for _, j := range jobs {
+		reported = append(reported, github.Check{Name: j.Name, Status: pipelineStatus(j.Status)})
+	}
+	return github.RequiredCheckResults(reported, required)
+}
+
+func (c *client) GetAssignableUsers(ctx context.Context) ([]github.RepoAssignee, error) {
+	if c.config.User.LogGitHubCalls {
+		fmt.Printf("> gitlab get project members\n")
+	}
+
+	var members []user
+	err := c.rest.RequestAll(ctx, c.projectPath()+"/members/all", &members)
+	if err != nil {
+		return nil, err
+	}
+
+	users := []github.RepoAssignee{}
+	for _, member := range members {
+		users = append(users, github.RepoAssignee{
+			ID:    strconv.Itoa(member.ID),
+			Login: member.Username,
+			Name:  member.Name,
+		})
+	}
+	return users, nil
+}
+
+func (c *client) CreatePullRequest(ctx context.Context, gitcmd git.GitInterface,
+	info *github.GitHubInfo, commit git.Commit, prevCommit *git.Commit) (*github.PullRequest, error) {
+
+	baseRefName := c.config.Repo.GitHubBranch
+	if prevCommit != nil {
+		baseRefName = git.BranchNameFromCommit(c.config, *prevCommit)
+	}
+	headRefName := git.BranchNameFromCommit(c.config, commit)
+
+	log.Debug().Interface("Commit", commit).
+		Str("FromBranch", headRefName).Str("ToBranch", baseRefName).
+		Msg("CreatePullRequest")
+
+	templatizer := config_fetcher.PRTemplatizer(c.config, gitcmd)
+	title := templatizer.Title(info, commit)
+	if c.config.User.CreateDraftPRs {
+		title = "Draft: " + title
+	}
+	body, err := templatizer.Body(info, commit, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var mr mergeRequest
+	err = c.rest.Request(ctx, http.MethodPost, c.projectPath()+"/merge_requests", map[string]interface{}{
+		"source_branch": headRefName,
+		"target_branch": baseRefName,
+		"title":         title,
+		"description":   body,
+	}, &mr)
+	if err != nil {
+		return nil, err
+	}
+
+	pr := &github.PullRequest{
+		ID:         strconv.Itoa(mr.ID),
+		Number:     mr.IID,
+		FromBranch: headRefName,
+		ToBranch:   baseRefName,
+		Commit:     commit,
+		Title:      commit.Subject,
+		Body:       mr.Description,
+		MergeStatus: github.PullRequestMergeStatus{
+			ChecksPass:     github.CheckStatusUnknown,
+			ReviewApproved: false,
+			NoConflicts:    false,
+			Stacked:        false,
+		},
+	}
+
+	if c.config.User.LogGitHubCalls {
+		fmt.Printf("> gitlab create %d : %s\n", pr.Number, pr.Title)
+	}
+
+	return pr, nil
+}
+
+func (c *client) UpdatePullRequest(ctx context.Context, gitcmd git.GitInterface,
+	info *github.GitHubInfo, pullRequests []*github.PullRequest, pr *github.PullRequest,
+	commit git.Commit, prevCommit *git.Commit) error {
+
+	baseRefName := c.config.Repo.GitHubBranch
+	if prevCommit != nil {
+		baseRefName = git.BranchNameFromCommit(c.config, *prevCommit)
+	}
+
+	log.Debug().Interface("Commit", commit).
+		Str("FromBranch", pr.FromBranch).Str("ToBranch", baseRefName).
+		Interface("PR", pr).Msg("UpdatePullRequest")
+
+	templatizer := config_fetcher.PRTemplatizer(c.config, gitcmd)
+	title := templatizer.Title(info, commit)
+	body, err := templatizer.Body(info, commit, pr)
+	if err != nil {
+		return err
+	}
+
+	titleUnchanged := c.config.User.PreserveTitleAndBody || title == pr.Title
+	bodyUnchanged := c.config.User.PreserveTitleAndBody || body == pr.Body
+	baseUnchanged := pr.InQueue || baseRefName == pr.ToBranch
+	if titleUnchanged && bodyUnchanged && baseUnchanged {
+		if c.config.User.LogGitHubCalls {
+			fmt.Printf("> gitlab update %d : %s (skipped, no changes)\n", pr.Number, pr.Title)
+		}
+		return nil
+	}
+
+	if c.config.User.LogGitHubCalls {
+		fmt.Printf("> gitlab update %d : %s\n", pr.Number, pr.Title)
+	}
+
+	input := map[string]interface{}{}
+	if !c.config.User.PreserveTitleAndBody {
+		input["title"] = title
+		input["description"] = body
+	}
+	// merge requests in a merge train can't be retargeted
+	if !pr.InQueue {
+		input["target_branch"] = baseRefName
+	}
+
+	return c.rest.Request(ctx, http.MethodPut, c.mergeRequestPath(pr), input, nil)
+}
+
+// AddReviewers sets the reviewers of the merge request, userIDs are the
+// GitLab user ids returned by GetAssignableUsers.
+func (c *client) AddReviewers(ctx context.Context, pr *github.PullRequest, userIDs []string) error {
+	log.Debug().Strs("userIDs", userIDs).Msg("AddReviewers")
+	if c.config.User.LogGitHubCalls {
+		fmt.Printf("> gitlab add reviewers %d : %s - %+v\n", pr.Number, pr.Title, userIDs)
+	}
+	reviewerIDs := []int{}
+	for _, userID := range userIDs {
+		id, err := strconv.Atoi(userID)
+		if err != nil {
+			return errs.New(errs.Validation, "invalid gitlab user id %q", userID)
+		}
+		reviewerIDs = append(reviewerIDs, id)
+	}
+	return c.rest.Request(ctx, http.MethodPut, c.mergeRequestPath(pr), map[string]interface{}{
+		"reviewer_ids": reviewerIDs,
+	}, nil)
+}
+
+func (c *client) CommentPullRequest(ctx context.Context, pr *github.PullRequest, comment string) error {
+	err := c.rest.Request(ctx, http.MethodPost, c.mergeRequestPath(pr)+"/notes", map[string]interface{}{
+		"body": comment,
+	}, nil)
+	if err != nil {
+		return err
+	}
+
+	if c.config.User.LogGitHubCalls {
+		fmt.Printf("> gitlab add comment %d : %s\n", pr.Number, pr.Title)
+	}
+	return nil
+}
+
+// MergePullRequest merges the merge request. GitLab configures merge commits
+// versus fast-forward merges on the project, only squashing is requested per
+// merge request. With a merge queue the merge request is set to merge when
+// the pipeline succeeds, which adds it to the merge train.
+func (c *client) MergePullRequest(ctx context.Context,
+	pr *github.PullRequest, mergeMethod genclient.PullRequestMergeMethod) error {
+	log.Debug().
+		Interface("PR", pr).
+		Str("mergeMethod", string(mergeMethod)).
+		Msg("MergePullRequest")
+
+	input := map[string]interface{}{
+		"squash": mergeMethod == genclient.PullRequestMergeMethod_SQUASH,
+	}
+	if c.config.Repo.MergeQueue {
+		input["merge_when_pipeline_succeeds"] = true
+	}
+	err := c.rest.Request(ctx, http.MethodPut, c.mergeRequestPath(pr)+"/merge", input, nil)
+	if err != nil {
+		return err
+	}
+
+	if c.config.User.LogGitHubCalls {
+		fmt.Printf("> gitlab merge %d : %s\n", pr.Number, pr.Title)
+	}
+	return nil
+}
+
+func (c *client) ClosePullRequest(ctx context.Context, pr *github.PullRequest) error {
+	log.Debug().Interface("PR", pr).Msg("ClosePullRequest")
+	err := c.rest.Request(ctx, http.MethodPut, c.mergeRequestPath(pr), map[string]interface{}{
+		"state_event": "close",
+	}, nil)
+	if err != nil {
+		return err
+	}
+
+	if c.config.User.LogGitHubCalls {
+		fmt.Printf("> gitlab close %d : %s\n", pr.Number, pr.Title)
+	}
+	return nil
+}
+
+func (c *client) RestorePullRequest(ctx context.Context, pr *github.PullRequest) error {
+	log.Debug().Interface("PR", pr).Msg("RestorePullRequest")
+	var current mergeRequest
+	err := c.rest.Request(ctx, http.MethodGet, c.mergeRequestPath(pr), nil, &current)
+	if err != nil {
+		return err
+	}
+	input := map[string]interface{}{
+		"target_branch": pr.ToBranch,
+		"title":         pr.Title,
+		"description":   pr.Body,
+	}
+	if current.State == "closed" {
+		input["state_event"] = "reopen"
+	}
+	err = c.rest.Request(ctx, http.MethodPut, c.mergeRequestPath(pr), input, nil)
+	if err != nil {
+		return err
+	}
+
+	if c.config.User.LogGitHubCalls {
+		fmt.Printf("> gitlab restore %d : %s\n", pr.Number, pr.Title)
+	}
+	return nil
+}
+
+func (c *client) mergeRequestPath(pr *github.PullRequest) string {
+	return fmt.Sprintf("%s/merge_requests/%d", c.projectPath(), pr.Number)
+}
+
+// requestAll fetches every page of a list api into result, which must be a
+// pointer to a slice.
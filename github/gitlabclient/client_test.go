@@ -0,0 +1,263 @@
+package gitlabclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ejoffe/spr/config"
+	"github.com/ejoffe/spr/git"
+	"github.com/ejoffe/spr/git/mockgit"
+	"github.com/ejoffe/spr/github"
+	"github.com/ejoffe/spr/github/githubclient/gen/genclient"
+	"github.com/ejoffe/spr/github/internal/rest"
+	"github.com/ejoffe/spr/github/internal/resttest"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeGitLab is a local stand-in for the parts of the GitLab REST API used by spr
+type fakeGitLab struct {
+	*resttest.Server
+	mergeRequests []mergeRequest
+	commits       map[int][]commit
+	approved      map[int]bool
+	jobs          map[int][]job
+	members       []user
+	train         []int
+}
+
+func newFakeGitLab() *fakeGitLab {
+	f := &fakeGitLab{
+		commits:  map[int][]commit{},
+		approved: map[int]bool{},
+		jobs:     map[int][]job{},
+	}
+	f.Server = &resttest.Server{
+		AuthHeader:   "PRIVATE-TOKEN",
+		Auth:         "token",
+		Unauthorized: `{"message":"401 Unauthorized"}`,
+		Prefix:       projectPrefix,
+		Handler:      f.handle,
+	}
+	return f
+}
+
+const projectPrefix = "/api/v4/projects/owner%2Frepo"
+
+func (f *fakeGitLab) handle(w http.ResponseWriter, r *http.Request, path string, body map[string]interface{}) {
+	switch {
+	case path == "/api/v4/user":
+		resttest.WriteJSON(w, user{ID: 7, Username: "nobody"})
+	case path == projectPrefix:
+		resttest.WriteJSON(w, project{ID: 42})
+	case path == projectPrefix+"/members/all":
+		resttest.WritePage(w, r, rest.NextPagePaging, f.members)
+	case path == projectPrefix+"/merge_trains":
+		var cars []mergeTrainCar
+		for _, iid := range f.train {
+			car := mergeTrainCar{}
+			car.MergeRequest.IID = iid
+			cars = append(cars, car)
+		}
+		resttest.WritePage(w, r, rest.NextPagePaging, cars)
+	case path == projectPrefix+"/merge_requests" && r.Method == http.MethodGet:
+		resttest.WritePage(w, r, rest.NextPagePaging, f.mergeRequests)
+	case path == projectPrefix+"/merge_requests" && r.Method == http.MethodPost:
+		resttest.WriteJSON(w, mergeRequest{ID: 1001, IID: 11,
+			Title:        body["title"].(string),
+			Description:  body["description"].(string),
+			SourceBranch: body["source_branch"].(string),
+			TargetBranch: body["target_branch"].(string),
+		})
+	case strings.HasPrefix(path, projectPrefix+"/pipelines/"):
+		id, _ := strconv.Atoi(strings.Split(strings.TrimPrefix(path, projectPrefix+"/pipelines/"), "/")[0])
+		resttest.WritePage(w, r, rest.NextPagePaging, f.jobs[id])
+	case strings.HasPrefix(path, projectPrefix+"/merge_requests/"):
+		parts := strings.Split(strings.TrimPrefix(path, projectPrefix+"/merge_requests/"), "/")
+		iid, _ := strconv.Atoi(parts[0])
+		switch {
+		case len(parts) == 1 && r.Method != http.MethodGet:
+			resttest.WriteJSON(w, map[string]interface{}{})
+		case len(parts) == 1:
+			for _, mr := range f.mergeRequests {
+				if mr.IID == iid {
+					resttest.WriteJSON(w, mr)
+					return
+				}
+			}
+			http.NotFound(w, r)
+		case parts[1] == "commits":
+			resttest.WritePage(w, r, rest.NextPagePaging, f.commits[iid])
+		case parts[1] == "approvals":
+			resttest.WriteJSON(w, approvals{Approved: f.approved[iid]})
+		default:
+			resttest.WriteJSON(w, map[string]interface{}{})
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func makeTestClient(t *testing.T) (*client, *fakeGitLab) {
+	fake := newFakeGitLab()
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	cfg := config.EmptyConfig()
+	cfg.Repo.GitHubRepoOwner = "owner"
+	cfg.Repo.GitHubRepoName = "repo"
+	cfg.Repo.GitHubRemote = "origin"
+	cfg.Repo.GitHubBranch = "master"
+	cfg.Repo.RequireChecks = true
+	cfg.Repo.RequireApproval = true
+	cfg.Repo.PRTemplateType = "basic"
+	cfg.User.BranchPrefix = "spr"
+	return NewClient(cfg, server.URL+"/api/v4", "token", server.Client()), fake
+}
+
+func TestGetInfo(t *testing.T) {
+	c, fake := makeTestClient(t)
+	c.config.Repo.MergeQueue = true
+	c.config.Repo.RequiredChecks = []string{"test"}
+
+	me := user{ID: 7, Username: "nobody"}
+	fake.mergeRequests = []mergeRequest{
+		{ID: 101, IID: 1, Title: "commit 1", Author: me, SourceBranch: "spr/master/00000001", TargetBranch: "master",
+			SHA: "c1", HeadPipeline: &pipeline{ID: 501, Status: "failed"}},
+		{ID: 102, IID: 2, Title: "commit 2", Author: me, SourceBranch: "spr/master/00000002", TargetBranch: "spr/master/00000001",
+			SHA: "c2", HasConflicts: true, DetailedMergeStatus: "requested_changes",
+			HeadPipeline: &pipeline{ID: 502, Status: "running"}},
+		{ID: 103, IID: 3, Title: "not spr", SourceBranch: "feature", TargetBranch: "master"},
+	}
+	fake.commits[1] = []commit{{ID: "c1", Title: "commit 1", Message: "commit 1\n\ncommit-id:00000001"}}
+	fake.commits[2] = []commit{{ID: "c2", Title: "commit 2", Message: "commit 2\n\ncommit-id:00000002"}}
+	fake.approved[1] = true
+	fake.jobs[501] = []job{{Name: "lint", Status: "failed"}, {Name: "test", Status: "success"}}
+	fake.jobs[502] = []job{{Name: "test", Status: "running"}}
+	fake.train = []int{1}
+
+	gitmock := mockgit.NewMockGit(t)
+	gitmock.ExpectLogAndRespond([]*git.Commit{
+		{CommitID: "00000002", CommitHash: "l2", Subject: "commit 2"},
+		{CommitID: "00000001", CommitHash: "l1", Subject: "commit 1"},
+	})
+	gitmock.ExpectLocalBranch("* master")
+
+	info, err := c.GetInfo(context.Background(), gitmock)
+	require.NoError(t, err)
+	gitmock.ExpectationsMet()
+
+	require.Equal(t, "nobody", info.UserName)
+	require.Equal(t, "42", info.RepositoryID)
+	require.Equal(t, "master", info.LocalBranch)
+	require.Equal(t, []*github.PullRequest{
+		{
+			ID:         "101",
+			Number:     1,
+			Title:      "commit 1",
+			FromBranch: "spr/master/00000001",
+			ToBranch:   "master",
+			Author:     "nobody",
+			Commit: git.Commit{CommitID: "00000001", CommitHash: "c1",
+				Subject: "commit 1", Body: "commit 1\n\ncommit-id:00000001"},
+			Commits: []git.Commit{{CommitID: "00000001", CommitHash: "c1",
+				Subject: "commit 1", Body: "commit 1\n\ncommit-id:00000001"}},
+			InQueue: true,
+			Checks:  []github.Check{{Name: "test", Status: github.CheckStatusPass}},
+			MergeStatus: github.PullRequestMergeStatus{
+				ChecksPass:     github.CheckStatusPass,
+				ReviewApproved: true,
+				NoConflicts:    true,
+				Stacked:        true,
+			},
+		},
+		{
+			ID:         "102",
+			Number:     2,
+			Title:      "commit 2",
+			FromBranch: "spr/master/00000002",
+			ToBranch:   "spr/master/00000001",
+			Author:     "nobody",
+			Commit: git.Commit{CommitID: "00000002", CommitHash: "c2",
+				Subject: "commit 2", Body: "commit 2\n\ncommit-id:00000002"},
+			Commits: []git.Commit{{CommitID: "00000002", CommitHash: "c2",
+				Subject: "commit 2", Body: "commit 2\n\ncommit-id:00000002"}},
+			Checks: []github.Check{{Name: "test", Status: github.CheckStatusPending}},
+			MergeStatus: github.PullRequestMergeStatus{
+				ChecksPass:       github.CheckStatusPending,
+				ChangesRequested: true,
+			},
+		},
+	}, info.PullRequests)
+}
+
+func TestGetAssignableUsers(t *testing.T) {
+	c, fake := makeTestClient(t)
+	fake.members = []user{
+		{ID: 1, Username: "alice", Name: "Alice"},
+		{ID: 2, Username: "bob", Name: "Bob"},
+	}
+	users, err := c.GetAssignableUsers(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []github.RepoAssignee{
+		{ID: "1", Login: "alice", Name: "Alice"},
+		{ID: "2", Login: "bob", Name: "Bob"},
+	}, users)
+}
+
+func TestMergeRequestMutations(t *testing.T) {
+	c, fake := makeTestClient(t)
+	ctx := context.Background()
+	info := &github.GitHubInfo{}
+	c1 := git.Commit{CommitID: "00000001", CommitHash: "c1", Subject: "commit 1"}
+	c2 := git.Commit{CommitID: "00000002", CommitHash: "c2", Subject: "commit 2"}
+
+	pr, err := c.CreatePullRequest(ctx, nil, info, c2, &c1)
+	require.NoError(t, err)
+	require.Equal(t, 11, pr.Number)
+	require.Equal(t, "spr/master/00000002", pr.FromBranch)
+	require.Equal(t, "spr/master/00000001", pr.ToBranch)
+
+	description, _ := json.Marshal(pr.Body)
+
+	// retarget onto master when the commit below is merged
+	require.NoError(t, c.UpdatePullRequest(ctx, nil, info, nil, pr, c2, nil))
+	// nothing changed : no request
+	pr.ToBranch = "master"
+	require.NoError(t, c.UpdatePullRequest(ctx, nil, info, nil, pr, c2, nil))
+
+	require.NoError(t, c.AddReviewers(ctx, pr, []string{"1", "2"}))
+	require.NoError(t, c.CommentPullRequest(ctx, pr, "merged"))
+	require.NoError(t, c.MergePullRequest(ctx, pr, genclient.PullRequestMergeMethod_SQUASH))
+	require.NoError(t, c.ClosePullRequest(ctx, pr))
+	fake.mergeRequests = []mergeRequest{{ID: 1001, IID: 11, State: "closed"}}
+	pr.Title = "restored"
+	require.NoError(t, c.RestorePullRequest(ctx, pr))
+
+	require.Equal(t, []string{
+		`POST /merge_requests {"description":` + string(description) + `,"source_branch":"spr/master/00000002","target_branch":"spr/master/00000001","title":"commit 2"}`,
+		`PUT /merge_requests/11 {"description":` + string(description) + `,"target_branch":"master","title":"commit 2"}`,
+		`PUT /merge_requests/11 {"reviewer_ids":[1,2]}`,
+		`POST /merge_requests/11/notes {"body":"merged"}`,
+		`PUT /merge_requests/11/merge {"squash":true}`,
+		`PUT /merge_requests/11 {"state_event":"close"}`,
+		`PUT /merge_requests/11 {"description":` + string(description) + `,"state_event":"reopen","target_branch":"master","title":"restored"}`,
+	}, fake.Requests())
+}
+
+func TestPipelineStatus(t *testing.T) {
+	for status, expect := range map[string]github.CheckStatus{
+		"success":  github.CheckStatusPass,
+		"skipped":  github.CheckStatusPass,
+		"failed":   github.CheckStatusFail,
+		"canceled": github.CheckStatusFail,
+		"running":  github.CheckStatusPending,
+		"manual":   github.CheckStatusPending,
+	} {
+		require.Equal(t, expect, pipelineStatus(status), status)
+	}
+}
@@ -7,30 +7,42 @@ import (
 	"github.com/ejoffe/spr/github/githubclient/gen/genclient"
 )
 
+// GitHubInterface is the forge holding the pull requests. Failed calls return
+//
+//	an error classified by package errs, such as errs.Auth for a bad token or
+//	errs.RateLimit when the api refuses requests until the limit resets.
 type GitHubInterface interface {
 	// GetInfo returns the list of pull requests from GitHub which match the local stack of commits
-	GetInfo(ctx context.Context, gitcmd git.GitInterface) *GitHubInfo
+	GetInfo(ctx context.Context, gitcmd git.GitInterface) (*GitHubInfo, error)
+
+	// GetPullRequests returns the open spr pull requests into the target branch
+	//  opened by any user, without their commits and merge status
+	GetPullRequests(ctx context.Context) ([]*PullRequest, error)
 
 	// GetAssignableUsers returns a list of valid GitHub users that can review the pull request
-	GetAssignableUsers(ctx context.Context) []RepoAssignee
+	GetAssignableUsers(ctx context.Context) ([]RepoAssignee, error)
 
 	// CreatePullRequest creates a pull request
-	CreatePullRequest(ctx context.Context, gitcmd git.GitInterface, info *GitHubInfo, commit git.Commit, prevCommit *git.Commit) *PullRequest
+	CreatePullRequest(ctx context.Context, gitcmd git.GitInterface, info *GitHubInfo, commit git.Commit, prevCommit *git.Commit) (*PullRequest, error)
 
 	// UpdatePullRequest updates a pull request with current commit
-	UpdatePullRequest(ctx context.Context, gitcmd git.GitInterface, info *GitHubInfo, pullRequests []*PullRequest, pr *PullRequest, commit git.Commit, prevCommit *git.Commit)
+	UpdatePullRequest(ctx context.Context, gitcmd git.GitInterface, info *GitHubInfo, pullRequests []*PullRequest, pr *PullRequest, commit git.Commit, prevCommit *git.Commit) error
 
 	// AddReviewers adds a reviewer to the given pull request
-	AddReviewers(ctx context.Context, pr *PullRequest, userIDs []string)
+	AddReviewers(ctx context.Context, pr *PullRequest, userIDs []string) error
 
 	// CommentPullRequest add a comment to the given pull request
-	CommentPullRequest(ctx context.Context, pr *PullRequest, comment string)
+	CommentPullRequest(ctx context.Context, pr *PullRequest, comment string) error
 
 	// MergePullRequest merged the given pull request
-	MergePullRequest(ctx context.Context, pr *PullRequest, mergeMethod genclient.PullRequestMergeMethod)
+	MergePullRequest(ctx context.Context, pr *PullRequest, mergeMethod genclient.PullRequestMergeMethod) error
 
 	// ClosePullRequest closes the given pull request
-	ClosePullRequest(ctx context.Context, pr *PullRequest)
+	ClosePullRequest(ctx context.Context, pr *PullRequest) error
+
+	// RestorePullRequest reopens the given pull request when it is closed and sets
+	//  its base branch, title and body back to the ones of pr
+	RestorePullRequest(ctx context.Context, pr *PullRequest) error
 }
 
 type GitHubInfo struct {
@@ -0,0 +1,229 @@
+// Package rest is the plumbing shared by the clients of the forges spr
+// talks to over a REST API: reading the token, building the endpoint,
+// sending json requests, mapping error responses and reading paged lists.
+package rest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ejoffe/spr/errs"
+)
+
+// Paging is the way a list api splits its items into pages
+type Paging int
+
+const (
+	// LinkPaging requests pages by number while the Link header of the
+	//  response has a next page, the way gitea does
+	LinkPaging Paging = iota
+
+	// NextPagePaging requests the page number in the X-Next-Page header of
+	//  the response until it is empty, the way gitlab does
+	NextPagePaging
+
+	// StartPaging reads the items from the values of a page object and
+	//  requests the next one from nextPageStart until isLastPage, the way
+	//  bitbucket does
+	StartPaging
+)
+
+// API describes the REST API of a forge
+type API struct {
+	// Name is the name of the forge in error messages
+	Name string
+
+	// AuthHeader is the request header carrying the token, prefixed by
+	//  AuthScheme when one is set
+	AuthHeader string
+	AuthScheme string
+
+	// TokenHelp is added to authentication errors, it names the variable
+	//  holding the token and the permissions the token needs
+	TokenHelp string
+
+	Paging Paging
+
+	// PageParam is the query parameter setting the number of items in a page
+	PageParam string
+	PageLimit int
+}
+
+// Client sends requests to a forge REST API
+type Client struct {
+	api        API
+	endpoint   string
+	token      string
+	httpClient *http.Client
+}
+
+// NewClient returns a client for the api at endpoint
+func NewClient(api API, endpoint string, token string, httpClient *http.Client) *Client {
+	return &Client{
+		api:        api,
+		endpoint:   strings.TrimSuffix(endpoint, "/"),
+		token:      token,
+		httpClient: httpClient,
+	}
+}
+
+// Token returns the token set in the first of the environment variables
+//
+//	which is set, or an authentication error formatting help with host.
+func Token(help string, host string, envs ...string) (string, error) {
+	for _, env := range envs {
+		if token := os.Getenv(env); token != "" {
+			return token, nil
+		}
+	}
+	return "", errs.New(errs.Auth, strings.TrimSpace(help), host)
+}
+
+// Endpoint returns the url of the api at path on host. The host may include
+//
+//	a scheme, https is used otherwise, and a context path.
+func Endpoint(host string, path string) string {
+	if !strings.Contains(host, "://") {
+		host = "https://" + host
+	}
+	return strings.TrimSuffix(host, "/") + path
+}
+
+// RequestAll gets every page of the list at path and decodes the items
+//
+//	into result, which must point to a slice.
+func (c *Client) RequestAll(ctx context.Context, path string, result interface{}) error {
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+	path = fmt.Sprintf("%s%s%s=%d", path, separator, c.api.PageParam, c.api.PageLimit)
+
+	var all []json.RawMessage
+	next := "page=1"
+	if c.api.Paging == StartPaging {
+		next = "start=0"
+	}
+	for next != "" {
+		var items []json.RawMessage
+		var err error
+		items, next, err = c.requestPage(ctx, path+"&"+next)
+		if err != nil {
+			return err
+		}
+		all = append(all, items...)
+	}
+
+	data, err := json.Marshal(all)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, result)
+}
+
+// requestPage returns the items of the page at path and the query of the
+//
+//	next page, empty on the last page.
+func (c *Client) requestPage(ctx context.Context, path string) ([]json.RawMessage, string, error) {
+	if c.api.Paging == StartPaging {
+		var p struct {
+			Values        []json.RawMessage `json:"values"`
+			IsLastPage    bool              `json:"isLastPage"`
+			NextPageStart int               `json:"nextPageStart"`
+		}
+		err := c.Request(ctx, http.MethodGet, path, nil, &p)
+		if err != nil || p.IsLastPage {
+			return p.Values, "", err
+		}
+		return p.Values, fmt.Sprintf("start=%d", p.NextPageStart), nil
+	}
+
+	var items []json.RawMessage
+	header, err := c.Do(ctx, http.MethodGet, path, nil, &items)
+	if err != nil {
+		return nil, "", err
+	}
+	if c.api.Paging == NextPagePaging {
+		if page := header.Get("X-Next-Page"); page != "" {
+			return items, "page=" + page, nil
+		}
+		return items, "", nil
+	}
+	if !strings.Contains(header.Get("Link"), `rel="next"`) {
+		return items, "", nil
+	}
+	_, query, _ := strings.Cut(path, "?")
+	values, _ := url.ParseQuery(query)
+	page, _ := strconv.Atoi(values.Get("page"))
+	return items, fmt.Sprintf("page=%d", page+1), nil
+}
+
+// Request sends input as json and decodes the response into result, either
+//
+//	may be nil.
+func (c *Client) Request(ctx context.Context, method string, path string,
+	input interface{}, result interface{}) error {
+	_, err := c.Do(ctx, method, path, input, result)
+	return err
+}
+
+// Do is Request returning the headers of the response
+func (c *Client) Do(ctx context.Context, method string, path string,
+	input interface{}, result interface{}) (http.Header, error) {
+	var body io.Reader
+	if input != nil {
+		data, err := json.Marshal(input)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.endpoint+path, body)
+	if err != nil {
+		return nil, err
+	}
+	auth := c.token
+	if c.api.AuthScheme != "" {
+		auth = c.api.AuthScheme + " " + c.token
+	}
+	req.Header.Set(c.api.AuthHeader, auth)
+	req.Header.Set("Accept", "application/json")
+	if input != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		kind := errs.HTTPStatusKind(resp.StatusCode)
+		message := strings.TrimSpace(string(data))
+		if kind == errs.Auth && c.api.TokenHelp != "" {
+			message += "\n " + c.api.TokenHelp
+		}
+		return nil, errs.New(kind, "%s %s %s: %s: %s", c.api.Name, method, path, resp.Status, message)
+	}
+	if result != nil && len(data) > 0 {
+		err = json.Unmarshal(data, result)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return resp.Header, nil
+}
@@ -0,0 +1,37 @@
+package rest
+
+import (
+	"testing"
+
+	"github.com/ejoffe/spr/errs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEndpoint(t *testing.T) {
+	tests := []struct {
+		host     string
+		endpoint string
+	}{
+		{host: "gitlab.com", endpoint: "https://gitlab.com/api/v4"},
+		{host: "http://gitea.internal:3000", endpoint: "http://gitea.internal:3000/api/v4"},
+		{host: "https://example.com/bitbucket/", endpoint: "https://example.com/bitbucket/api/v4"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.host, func(t *testing.T) {
+			require.Equal(t, tc.endpoint, Endpoint(tc.host, "/api/v4"))
+		})
+	}
+}
+
+func TestToken(t *testing.T) {
+	t.Setenv("GITEA_TOKEN", "")
+	t.Setenv("FORGEJO_TOKEN", "forgejo")
+	token, err := Token("no token for %s", "codeberg.org", "GITEA_TOKEN", "FORGEJO_TOKEN")
+	require.NoError(t, err)
+	require.Equal(t, "forgejo", token)
+
+	t.Setenv("FORGEJO_TOKEN", "")
+	_, err = Token("no token for %s", "codeberg.org", "GITEA_TOKEN", "FORGEJO_TOKEN")
+	require.ErrorIs(t, err, errs.Auth)
+	require.EqualError(t, err, "no token for codeberg.org")
+}
@@ -0,0 +1,117 @@
+// Package resttest is a fake forge REST API for the tests of the clients
+// built on the rest package. The tests of each forge configure it with the
+// token they send and a handler serving the endpoints spr uses. List
+// endpoints return one item per page to exercise pagination.
+package resttest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ejoffe/spr/github/internal/rest"
+)
+
+// Handler serves a request, body is the decoded json body of requests
+//
+//	other than GETs.
+type Handler func(w http.ResponseWriter, r *http.Request, path string, body map[string]interface{})
+
+// Server checks the token of the requests, records the mutating ones and
+//
+//	passes them to its handler, one at a time.
+type Server struct {
+	// AuthHeader is the header carrying the token, Auth its expected value
+	AuthHeader string
+	Auth       string
+
+	// Unauthorized is the body of the response to unauthorized requests
+	Unauthorized string
+
+	// Prefix is trimmed from the paths of the recorded requests
+	Prefix string
+
+	Handler Handler
+
+	mu sync.Mutex
+
+	// requests are the mutating requests received : "METHOD path body"
+	requests []string
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.Header.Get(s.AuthHeader) != s.Auth {
+		http.Error(w, s.Unauthorized, http.StatusUnauthorized)
+		return
+	}
+
+	path := r.URL.EscapedPath()
+	var body map[string]interface{}
+	if r.Method != http.MethodGet {
+		json.NewDecoder(r.Body).Decode(&body)
+		data, _ := json.Marshal(body)
+		request := strings.TrimPrefix(path, s.Prefix)
+		if r.URL.RawQuery != "" {
+			request += "?" + r.URL.RawQuery
+		}
+		s.requests = append(s.requests, fmt.Sprintf("%s %s %s", r.Method, request, data))
+	}
+	s.Handler(w, r, path, body)
+}
+
+// Requests returns the mutating requests received : "METHOD path body"
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// WriteJSON writes v as a json response
+func WriteJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// WritePage writes a single item page of a list the way paging splits it
+func WritePage[T any](w http.ResponseWriter, r *http.Request, paging rest.Paging, items []T) {
+	if paging == rest.StartPaging {
+		start, _ := strconv.Atoi(r.URL.Query().Get("start"))
+		values := []T{}
+		if start < len(items) {
+			values = items[start : start+1]
+		}
+		WriteJSON(w, map[string]interface{}{
+			"values":        values,
+			"isLastPage":    start+1 >= len(items),
+			"nextPageStart": start + 1,
+		})
+		return
+	}
+
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	if page < len(items) {
+		if paging == rest.NextPagePaging {
+			w.Header().Set("X-Next-Page", strconv.Itoa(page+1))
+		} else {
+			next := *r.URL
+			query := next.Query()
+			query.Set("page", strconv.Itoa(page+1))
+			next.RawQuery = query.Encode()
+			w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, next.String()))
+		}
+	}
+	if page > len(items) {
+		WriteJSON(w, []T{})
+		return
+	}
+	WriteJSON(w, items[page-1:page])
+}
@@ -28,20 +28,29 @@ func NewMockClient(t *testing.T) *MockClient {
 type MockClient struct {
 	assert       *require.Assertions
 	Info         *github.GitHubInfo
+	PullRequests []*github.PullRequest // Returned by GetPullRequests
 	expect       []expectation
 	expectMutex  sync.Mutex
 	Synchronized bool // When true code is executed without goroutines. Allows test to be deterministic
 }
 
-func (c *MockClient) GetInfo(ctx context.Context, gitcmd git.GitInterface) *github.GitHubInfo {
+func (c *MockClient) GetInfo(ctx context.Context, gitcmd git.GitInterface) (*github.GitHubInfo, error) {
 	fmt.Printf("HUB: GetInfo\n")
 	c.verifyExpectation(expectation{
 		op: getInfoOP,
 	})
-	return c.Info
+	return c.Info, nil
 }
 
-func (c *MockClient) GetAssignableUsers(ctx context.Context) []github.RepoAssignee {
+func (c *MockClient) GetPullRequests(ctx context.Context) ([]*github.PullRequest, error) {
+	fmt.Printf("HUB: GetPullRequests\n")
+	c.verifyExpectation(expectation{
+		op: getPullRequestsOP,
+	})
+	return c.PullRequests, nil
+}
+
+func (c *MockClient) GetAssignableUsers(ctx context.Context) ([]github.RepoAssignee, error) {
 	fmt.Printf("HUB: GetAssignableUsers\n")
 	c.verifyExpectation(expectation{
 		op: getAssignableUsersOP,
@@ -52,11 +61,11 @@ func (c *MockClient) GetAssignableUsers(ctx context.Context) []github.RepoAssign
 			Login: NobodyLogin,
 			Name:  "No Body",
 		},
-	}
+	}, nil
 }
 
 func (c *MockClient) CreatePullRequest(ctx context.Context, gitcmd git.GitInterface, info *github.GitHubInfo,
-	commit git.Commit, prevCommit *git.Commit) *github.PullRequest {
+	commit git.Commit, prevCommit *git.Commit) (*github.PullRequest, error) {
 	fmt.Printf("HUB: CreatePullRequest\n")
 	c.verifyExpectation(expectation{
 		op:     createPullRequestOP,
@@ -79,49 +88,63 @@ func (c *MockClient) CreatePullRequest(ctx context.Context, gitcmd git.GitInterf
 			NoConflicts:    true,
 			Stacked:        true,
 		},
-	}
+	}, nil
 }
 
-func (c *MockClient) UpdatePullRequest(ctx context.Context, gitcmd git.GitInterface, info *github.GitHubInfo, pullRequests []*github.PullRequest, pr *github.PullRequest, commit git.Commit, prevCommit *git.Commit) {
+func (c *MockClient) UpdatePullRequest(ctx context.Context, gitcmd git.GitInterface, info *github.GitHubInfo, pullRequests []*github.PullRequest, pr *github.PullRequest, commit git.Commit, prevCommit *git.Commit) error {
 	fmt.Printf("HUB: UpdatePullRequest\n")
 	c.verifyExpectation(expectation{
 		op:     updatePullRequestOP,
 		commit: commit,
 		prev:   prevCommit,
 	})
+	return nil
 }
 
-func (c *MockClient) AddReviewers(ctx context.Context, pr *github.PullRequest, userIDs []string) {
+func (c *MockClient) AddReviewers(ctx context.Context, pr *github.PullRequest, userIDs []string) error {
 	c.verifyExpectation(expectation{
 		op:      addReviewersOP,
 		userIDs: userIDs,
 	})
+	return nil
 }
 
-func (c *MockClient) CommentPullRequest(ctx context.Context, pr *github.PullRequest, comment string) {
+func (c *MockClient) CommentPullRequest(ctx context.Context, pr *github.PullRequest, comment string) error {
 	fmt.Printf("HUB: CommentPullRequest\n")
 	c.verifyExpectation(expectation{
 		op:     commentPullRequestOP,
 		commit: pr.Commit,
 	})
+	return nil
 }
 
 func (c *MockClient) MergePullRequest(ctx context.Context,
-	pr *github.PullRequest, mergeMethod genclient.PullRequestMergeMethod) {
+	pr *github.PullRequest, mergeMethod genclient.PullRequestMergeMethod) error {
 	fmt.Printf("HUB: MergePullRequest, method=%q\n", mergeMethod)
 	c.verifyExpectation(expectation{
 		op:          mergePullRequestOP,
 		commit:      pr.Commit,
 		mergeMethod: mergeMethod,
 	})
+	return nil
 }
 
-func (c *MockClient) ClosePullRequest(ctx context.Context, pr *github.PullRequest) {
+func (c *MockClient) ClosePullRequest(ctx context.Context, pr *github.PullRequest) error {
 	fmt.Printf("HUB: ClosePullRequest\n")
 	c.verifyExpectation(expectation{
 		op:     closePullRequestOP,
 		commit: pr.Commit,
 	})
+	return nil
+}
+
+func (c *MockClient) RestorePullRequest(ctx context.Context, pr *github.PullRequest) error {
+	fmt.Printf("HUB: RestorePullRequest\n")
+	c.verifyExpectation(expectation{
+		op:     restorePullRequestOP,
+		commit: pr.Commit,
+	})
+	return nil
 }
 
 func (c *MockClient) ExpectGetInfo() {
@@ -133,6 +156,15 @@ func (c *MockClient) ExpectGetInfo() {
 	})
 }
 
+func (c *MockClient) ExpectGetPullRequests() {
+	c.expectMutex.Lock()
+	defer c.expectMutex.Unlock()
+
+	c.expect = append(c.expect, expectation{
+		op: getPullRequestsOP,
+	})
+}
+
 func (c *MockClient) ExpectGetAssignableUsers() {
 	c.expectMutex.Lock()
 	defer c.expectMutex.Unlock()
@@ -205,6 +237,16 @@ func (c *MockClient) ExpectClosePullRequest(commit git.Commit) {
 	})
 }
 
+func (c *MockClient) ExpectRestorePullRequest(commit git.Commit) {
+	c.expectMutex.Lock()
+	defer c.expectMutex.Unlock()
+
+	c.expect = append(c.expect, expectation{
+		op:     restorePullRequestOP,
+		commit: commit,
+	})
+}
+
 func (c *MockClient) verifyExpectation(actual expectation) {
 	c.expectMutex.Lock()
 	defer c.expectMutex.Unlock()
@@ -244,6 +286,7 @@ type operation string
 
 const (
 	getInfoOP            operation = "GetInfo"
+	getPullRequestsOP    operation = "GetPullRequests"
 	getAssignableUsersOP operation = "GetAssignableUsers"
 	createPullRequestOP  operation = "CreatePullRequest"
 	updatePullRequestOP  operation = "UpdatePullRequest"
@@ -251,6 +294,7 @@ const (
 	commentPullRequestOP operation = "CommentPullRequest"
 	mergePullRequestOP   operation = "MergePullRequest"
 	closePullRequestOP   operation = "ClosePullRequest"
+	restorePullRequestOP operation = "RestorePullRequest"
 )
 
 type expectation struct {
@@ -2,6 +2,7 @@ package github
 
 import (
 	"fmt"
+	"strings"
 	"unicode/utf8"
 
 	"github.com/ejoffe/spr/config"
@@ -19,11 +20,24 @@ type PullRequest struct {
 	Title      string
 	Body       string
 
-	MergeStatus    PullRequestMergeStatus
-	Merged         bool
-	Commits        []git.Commit
-	InQueue        bool
+	// Author is the login of the user who opened the pull request
+	Author string
+
+	MergeStatus     PullRequestMergeStatus
+	Merged          bool
+	Commits         []git.Commit
+	InQueue         bool
 	LocalCommitHash string
+
+	// Checks is the individual status of each required check,
+	//  only set when specific required checks are configured
+	Checks []Check
+}
+
+// Check is the status of a single named check on a pull request
+type Check struct {
+	Name   string
+	Status CheckStatus
 }
 
 // CheckStatus represents the aggregate status of GitHub checks on a pull request
@@ -51,6 +65,9 @@ type PullRequestMergeStatus struct {
 	// ReviewApproved is true when a pull request is approved by a fellow reviewer
 	ReviewApproved bool
 
+	// ChangesRequested is true when a reviewer has requested changes
+	ChangesRequested bool
+
 	// NoConflicts is true when there are no merge conflicts
 	NoConflicts bool
 
@@ -92,6 +109,88 @@ func (pr *PullRequest) Ready(config *config.Config) bool {
 	return true
 }
 
+// MergeBlockerKind is the kind of condition preventing a pull request from being merged
+type MergeBlockerKind string
+
+const (
+	// MergeBlockerConflicts when the pull request has merge conflicts
+	MergeBlockerConflicts MergeBlockerKind = "conflicts"
+
+	// MergeBlockerChecks when required checks are pending or have failed
+	MergeBlockerChecks MergeBlockerKind = "checks"
+
+	// MergeBlockerApproval when the pull request is not approved
+	MergeBlockerApproval MergeBlockerKind = "approval"
+
+	// MergeBlockerWIP when the commit is marked as work in progress
+	MergeBlockerWIP MergeBlockerKind = "wip"
+
+	// MergeBlockerStack when a pull request lower in the stack is not ready
+	MergeBlockerStack MergeBlockerKind = "stack"
+
+	// MergeBlockerMergeCheck when the configured merge check has not passed
+	MergeBlockerMergeCheck MergeBlockerKind = "mergecheck"
+)
+
+// MergeBlocker is a condition preventing a pull request from being merged
+type MergeBlocker struct {
+	Kind   MergeBlockerKind
+	Reason string
+}
+
+// MergeBlockers returns every condition which prevents the pull request from being merged.
+//
+//	An empty list means the pull request is ready to merge. The stack blocker
+//	is only returned when the pull request is ready by itself but is on top
+//	of a pull request which is not ready.
+func (pr *PullRequest) MergeBlockers(config *config.Config) []MergeBlocker {
+	var blockers []MergeBlocker
+	if !pr.MergeStatus.NoConflicts {
+		blockers = append(blockers, MergeBlocker{MergeBlockerConflicts, "pull request has merge conflicts"})
+	}
+	if config.Repo.RequireChecks && pr.MergeStatus.ChecksPass != CheckStatusPass {
+		failing := false
+		for _, check := range pr.Checks {
+			switch check.Status {
+			case CheckStatusPass:
+				continue
+			case CheckStatusFail:
+				blockers = append(blockers, MergeBlocker{MergeBlockerChecks,
+					fmt.Sprintf("required check %q failed", check.Name)})
+			default:
+				blockers = append(blockers, MergeBlocker{MergeBlockerChecks,
+					fmt.Sprintf("required check %q is pending", check.Name)})
+			}
+			failing = true
+		}
+		if !failing {
+			switch pr.MergeStatus.ChecksPass {
+			case CheckStatusPending:
+				blockers = append(blockers, MergeBlocker{MergeBlockerChecks, "checks are pending"})
+			case CheckStatusFail:
+				blockers = append(blockers, MergeBlocker{MergeBlockerChecks, "checks failed"})
+			default:
+				blockers = append(blockers, MergeBlocker{MergeBlockerChecks, "check status is unknown"})
+			}
+		}
+	}
+	if config.Repo.RequireApproval && !pr.MergeStatus.ReviewApproved {
+		if pr.MergeStatus.ChangesRequested {
+			blockers = append(blockers, MergeBlocker{MergeBlockerApproval, "changes requested by a reviewer"})
+		} else {
+			blockers = append(blockers, MergeBlocker{MergeBlockerApproval, "pull request is not approved"})
+		}
+	}
+	if pr.Commit.WIP {
+		blockers = append(blockers, MergeBlocker{MergeBlockerWIP, "commit subject starts with WIP"})
+	}
+	if len(blockers) == 0 && !pr.MergeStatus.Stacked {
+		blockers = append(blockers, MergeBlocker{MergeBlockerStack,
+			"a pull request lower in the stack is not ready to merge"})
+	}
+	return blockers
+}
+
 const (
 	// Terminal escape codes for colors
 	colorReset = "\033[0m"
@@ -178,8 +277,7 @@ func (pr *PullRequest) String(config *config.Config) string {
 	}
 
 	prInfo := fmt.Sprintf("%3d", pr.Number)
-	prURL := fmt.Sprintf("https://%s/%s/%s/pull/%d",
-		config.Repo.GitHubHost, config.Repo.GitHubRepoOwner, config.Repo.GitHubRepoName, pr.Number)
+	prURL := pr.URL(config)
 	if config.User.ShortPRLink {
 		// OSC 8 terminal hyperlink: \033]8;;URL\033\\TEXT\033]8;;\033\\
 		prInfo = fmt.Sprintf("\033]8;;%s\033\\PR-%d\033]8;;\033\\", prURL, pr.Number)
@@ -240,9 +338,65 @@ func (pr *PullRequest) String(config *config.Config) string {
 
 // TextString returns a plain text representation of the pull request: "<url> : <title>"
 func (pr *PullRequest) TextString(config *config.Config) string {
-	prURL := fmt.Sprintf("https://%s/%s/%s/pull/%d",
-		config.Repo.GitHubHost, config.Repo.GitHubRepoOwner, config.Repo.GitHubRepoName, pr.Number)
-	return fmt.Sprintf("%s : %s", prURL, pr.Title)
+	return fmt.Sprintf("%s : %s", pr.URL(config), pr.Title)
+}
+
+// URL returns the web url of the pull request
+func (pr *PullRequest) URL(cfg *config.Config) string {
+	baseURL := hostURL(cfg.Repo.GitHubHost)
+	switch cfg.Repo.Forge {
+	case config.ForgeGitLab:
+		return fmt.Sprintf("%s/%s/%s/-/merge_requests/%d",
+			baseURL, cfg.Repo.GitHubRepoOwner, cfg.Repo.GitHubRepoName, pr.Number)
+	case config.ForgeGitea:
+		return fmt.Sprintf("%s/%s/%s/pulls/%d",
+			baseURL, cfg.Repo.GitHubRepoOwner, cfg.Repo.GitHubRepoName, pr.Number)
+	case config.ForgeBitbucket:
+		return fmt.Sprintf("%s/projects/%s/repos/%s/pull-requests/%d",
+			baseURL, cfg.Repo.GitHubRepoOwner, cfg.Repo.GitHubRepoName, pr.Number)
+	}
+	return fmt.Sprintf("%s/%s/%s/pull/%d",
+		baseURL, cfg.Repo.GitHubRepoOwner, cfg.Repo.GitHubRepoName, pr.Number)
+}
+
+// hostURL returns the base url of a forge host, the host may include
+// a scheme and a context path.
+func hostURL(host string) string {
+	if strings.Contains(host, "://") {
+		return strings.TrimSuffix(host, "/")
+	}
+	return "https://" + host
+}
+
+// MarshalText implements encoding.TextMarshaler, it is used to emit a stable
+//
+//	name for the check status in machine readable (json, yaml) output.
+func (cs CheckStatus) MarshalText() ([]byte, error) {
+	switch cs {
+	case CheckStatusPending:
+		return []byte("pending"), nil
+	case CheckStatusPass:
+		return []byte("pass"), nil
+	case CheckStatusFail:
+		return []byte("fail"), nil
+	default:
+		return []byte("unknown"), nil
+	}
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, the inverse of MarshalText
+func (cs *CheckStatus) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "pending":
+		*cs = CheckStatusPending
+	case "pass":
+		*cs = CheckStatusPass
+	case "fail":
+		*cs = CheckStatusFail
+	default:
+		*cs = CheckStatusUnknown
+	}
+	return nil
 }
 
 func (cs CheckStatus) String(config *config.Config) string {
@@ -264,3 +264,81 @@ func TestTextString(t *testing.T) {
 	}
 	assert.Equal(t, "https://github.com/testowner/testrepo/pull/7 : Fix bug in parser", pr2.TextString(cfg))
 }
+
+func TestCheckStatusText(t *testing.T) {
+	for _, cs := range []CheckStatus{CheckStatusUnknown, CheckStatusPending, CheckStatusPass, CheckStatusFail} {
+		text, err := cs.MarshalText()
+		assert.NoError(t, err)
+
+		var actual CheckStatus
+		assert.NoError(t, actual.UnmarshalText(text))
+		assert.Equal(t, cs, actual)
+	}
+
+	text, _ := CheckStatusPending.MarshalText()
+	assert.Equal(t, "pending", string(text))
+}
+
+func TestMergeBlockers(t *testing.T) {
+	cfg := &config.Config{Repo: &config.RepoConfig{RequireChecks: true, RequireApproval: true}}
+	ready := PullRequestMergeStatus{
+		ChecksPass:     CheckStatusPass,
+		ReviewApproved: true,
+		NoConflicts:    true,
+		Stacked:        true,
+	}
+
+	tests := []struct {
+		name   string
+		pr     *PullRequest
+		expect []MergeBlocker
+	}{
+		{
+			name: "Ready",
+			pr:   &PullRequest{MergeStatus: ready},
+		},
+		{
+			name: "StackOnly",
+			pr: &PullRequest{MergeStatus: PullRequestMergeStatus{
+				ChecksPass: CheckStatusPass, ReviewApproved: true, NoConflicts: true,
+			}},
+			expect: []MergeBlocker{
+				{MergeBlockerStack, "a pull request lower in the stack is not ready to merge"},
+			},
+		},
+		{
+			name: "Everything",
+			pr: &PullRequest{
+				Commit: git.Commit{WIP: true},
+				MergeStatus: PullRequestMergeStatus{
+					ChecksPass:       CheckStatusFail,
+					ChangesRequested: true,
+				},
+				Checks: []Check{
+					{Name: "build", Status: CheckStatusPass},
+					{Name: "test", Status: CheckStatusFail},
+				},
+			},
+			expect: []MergeBlocker{
+				{MergeBlockerConflicts, "pull request has merge conflicts"},
+				{MergeBlockerChecks, `required check "test" failed`},
+				{MergeBlockerApproval, "changes requested by a reviewer"},
+				{MergeBlockerWIP, "commit subject starts with WIP"},
+			},
+		},
+		{
+			name: "ChecksPendingWithoutDetail",
+			pr: &PullRequest{MergeStatus: PullRequestMergeStatus{
+				ChecksPass: CheckStatusPending, ReviewApproved: true, NoConflicts: true, Stacked: true,
+			}},
+			expect: []MergeBlocker{
+				{MergeBlockerChecks, "checks are pending"},
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expect, tc.pr.MergeBlockers(cfg))
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package github
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/ejoffe/spr/config"
+	"github.com/ejoffe/spr/git"
+)
+
+// MatchPullRequestStack returns the stack of pull requests for the local commits.
+//
+//	pullRequestMap maps commit-ids to the open spr pull requests of any forge.
+//	The stack is built from the pull request of the top most local commit
+//	following base branches down until the target branch, or any other branch
+//	which isn't a pull request branch, such as a previous target branch.
+//	The pull requests of local commits which were moved below the top one
+//	aren't on that path, they are added above it in local commit order.
+//	The list is ordered with the bottom pull request in the stack first.
+//	An error is returned when the base branches loop back into the stack.
+func MatchPullRequestStack(branchPrefix string, targetBranch string,
+	localCommitStack []git.Commit, pullRequestMap map[string]*PullRequest) ([]*PullRequest, error) {
+
+	if len(localCommitStack) == 0 || len(pullRequestMap) == 0 {
+		return []*PullRequest{}, nil
+	}
+
+	// store local commit hashes on PRs for display purposes
+	//  (the remote CommitHash is preserved for update detection in syncCommitStackToGitHub)
+	for _, c := range localCommitStack {
+		if pr, ok := pullRequestMap[c.CommitID]; ok {
+			if c.CommitHash != "" {
+				pr.LocalCommitHash = c.CommitHash
+			}
+			pr.Commit.WIP = c.WIP
+		}
+	}
+
+	var pullRequests []*PullRequest
+
+	// find top pr
+	var currpr *PullRequest
+	var found bool
+	for i := len(localCommitStack) - 1; i >= 0; i-- {
+		currpr, found = pullRequestMap[localCommitStack[i].CommitID]
+		if found {
+			break
+		}
+	}
+
+	// The list of commits from the command line actually starts at the
+	//  most recent commit. In order to reverse the list we use a
+	//  custom prepend function instead of append
+	prepend := func(l []*PullRequest, pr *PullRequest) []*PullRequest {
+		l = append(l, &PullRequest{})
+		copy(l[1:], l)
+		l[0] = pr
+		return l
+	}
+
+	// build pr stack
+	visited := map[*PullRequest]bool{}
+	for currpr != nil {
+		if visited[currpr] {
+			return nil, fmt.Errorf("unable to resolve the pull request stack : "+
+				"pull request #%d targets branch %s which is above it in the stack\n"+
+				" retarget or close the pull request and run spr update",
+				pullRequests[0].Number, pullRequests[0].ToBranch)
+		}
+		visited[currpr] = true
+		pullRequests = prepend(pullRequests, currpr)
+		if currpr.ToBranch == targetBranch {
+			break
+		}
+
+		matches := git.BranchNameRegex(branchPrefix).FindStringSubmatch(currpr.ToBranch)
+		if matches == nil {
+			break
+		}
+		nextCommitID := matches[2]
+
+		currpr = pullRequestMap[nextCommitID]
+	}
+
+	for _, c := range localCommitStack {
+		if pr, ok := pullRequestMap[c.CommitID]; ok && !visited[pr] {
+			visited[pr] = true
+			pullRequests = append(pullRequests, pr)
+		}
+	}
+	return pullRequests, nil
+}
+
+// HeadRefPrefix returns the prefix of the head branches of the pull requests
+// into the target branch, stacks are looked up by this prefix.
+func HeadRefPrefix(branchPrefix string, targetBranch string) string {
+	return branchPrefix + "/" + targetBranch + "/"
+}
+
+// SplitStacks groups pull requests into stacks by following base branches.
+//
+//	Each stack is ordered with the bottom pull request first, and the stacks
+//	are ordered by the number of their top pull request. A pull request is
+//	the top of a stack when no other pull request is based on its branch.
+func SplitStacks(pullRequests []*PullRequest) [][]*PullRequest {
+	byBranch := map[string]*PullRequest{}
+	isBase := map[string]bool{}
+	for _, pr := range pullRequests {
+		byBranch[pr.FromBranch] = pr
+		isBase[pr.ToBranch] = true
+	}
+
+	var stacks [][]*PullRequest
+	for _, top := range pullRequests {
+		if isBase[top.FromBranch] {
+			continue
+		}
+		var stack []*PullRequest
+		visited := map[*PullRequest]bool{}
+		for pr := top; pr != nil && !visited[pr]; pr = byBranch[pr.ToBranch] {
+			visited[pr] = true
+			stack = append([]*PullRequest{pr}, stack...)
+		}
+		stacks = append(stacks, stack)
+	}
+	sort.Slice(stacks, func(i, j int) bool {
+		return stacks[i][len(stacks[i])-1].Number < stacks[j][len(stacks[j])-1].Number
+	})
+	return stacks
+}
+
+// MarkStacked sets the Stacked merge status bit on every pull request
+//
+//	from the bottom of the stack up to the first one which isn't ready.
+func MarkStacked(config *config.Config, pullRequests []*PullRequest) {
+	for _, pr := range pullRequests {
+		if pr.Ready(config) {
+			pr.MergeStatus.Stacked = true
+		} else {
+			break
+		}
+	}
+}
+
+// RequiredCheckResults returns the status of each check in requiredChecks,
+//
+//	sorted by name. A required check which hasn't reported yet is pending,
+//	and when a check reports more than once a failure takes precedence.
+func RequiredCheckResults(reported []Check, requiredChecks map[string]bool) []Check {
+	statuses := make(map[string]CheckStatus, len(requiredChecks))
+	for _, check := range reported {
+		if !requiredChecks[check.Name] {
+			continue
+		}
+		if prev, seen := statuses[check.Name]; !seen || checkStatusRank(check.Status) > checkStatusRank(prev) {
+			statuses[check.Name] = check.Status
+		}
+	}
+
+	checks := make([]Check, 0, len(requiredChecks))
+	for name := range requiredChecks {
+		status, seen := statuses[name]
+		if !seen {
+			// Any required check that hasn't reported yet is pending
+			status = CheckStatusPending
+		}
+		checks = append(checks, Check{Name: name, Status: status})
+	}
+	sort.Slice(checks, func(i, j int) bool {
+		return checks[i].Name < checks[j].Name
+	})
+	return checks
+}
+
+// AggregateCheckStatus returns fail if any check failed, pending if any
+//
+//	check is pending and pass otherwise.
+func AggregateCheckStatus(checks []Check) CheckStatus {
+	status := CheckStatusPass
+	for _, check := range checks {
+		if checkStatusRank(check.Status) > checkStatusRank(status) {
+			status = check.Status
+		}
+	}
+	return status
+}
+
+func checkStatusRank(status CheckStatus) int {
+	switch status {
+	case CheckStatusPass:
+		return 0
+	case CheckStatusFail:
+		return 2
+	default:
+		return 1
+	}
+}
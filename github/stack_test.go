@@ -0,0 +1,22 @@
+package github
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitStacks(t *testing.T) {
+	a1 := &PullRequest{Number: 4, FromBranch: "spr/master/000000a1", ToBranch: "master"}
+	a2 := &PullRequest{Number: 5, FromBranch: "spr/master/000000a2", ToBranch: "spr/master/000000a1"}
+	b1 := &PullRequest{Number: 2, FromBranch: "spr/master/000000b1", ToBranch: "master"}
+	b2 := &PullRequest{Number: 7, FromBranch: "spr/master/000000b2", ToBranch: "spr/master/000000b1"}
+	c1 := &PullRequest{Number: 6, FromBranch: "spr/master/000000c1", ToBranch: "master"}
+
+	require.Equal(t, [][]*PullRequest{
+		{a1, a2},
+		{c1},
+		{b1, b2},
+	}, SplitStacks([]*PullRequest{a2, b1, c1, a1, b2}))
+	require.Empty(t, SplitStacks(nil))
+}
@@ -16,9 +16,9 @@ func (t *BasicTemplatizer) Title(info *github.GitHubInfo, commit git.Commit) str
 	return commit.Subject
 }
 
-func (t *BasicTemplatizer) Body(info *github.GitHubInfo, commit git.Commit, pr *github.PullRequest) string {
+func (t *BasicTemplatizer) Body(info *github.GitHubInfo, commit git.Commit, pr *github.PullRequest) (string, error) {
 	body := commit.Body
 	body += "\n\n"
 	body += template.ManualMergeNotice()
-	return body
+	return body, nil
 }
@@ -11,10 +11,10 @@ import (
 	"strings"
 
 	"github.com/ejoffe/spr/config"
+	"github.com/ejoffe/spr/errs"
 	"github.com/ejoffe/spr/git"
 	"github.com/ejoffe/spr/github"
 	"github.com/ejoffe/spr/github/template"
-	"github.com/rs/zerolog/log"
 )
 
 type CustomTemplatizer struct {
@@ -36,32 +36,32 @@ func (t *CustomTemplatizer) Title(info *github.GitHubInfo, commit git.Commit) st
 	return commit.Subject
 }
 
-func (t *CustomTemplatizer) Body(info *github.GitHubInfo, commit git.Commit, pr *github.PullRequest) string {
+func (t *CustomTemplatizer) Body(info *github.GitHubInfo, commit git.Commit, pr *github.PullRequest) (string, error) {
 	body := t.formatBody(commit, info.PullRequests)
 	pullRequestTemplate, err := t.readPRTemplate()
 	if err != nil {
-		log.Fatal().Err(err).Msg("failed to read PR template")
+		return "", errs.New(errs.Validation, "failed to read PR template : %w", err)
 	}
 	body, err = t.insertBodyIntoPRTemplate(body, pullRequestTemplate, pr)
 	if err != nil {
-		log.Fatal().Err(err).Msg("failed to insert body into PR template")
+		return "", errs.New(errs.Validation, "failed to insert body into PR template : %w", err)
 	}
 
 	// Open editor for user to edit the PR content only when creating a new PR (pr == nil)
 	if pr != nil {
-		return body
+		return body, nil
 	}
 
 	if !promptUserToEdit(commit) {
-		return body
+		return body, nil
 	}
 
 	body, err = EditWithEditor(body)
 	if err != nil {
-		log.Fatal().Err(err).Msg("failed to edit PR content with editor")
+		return "", fmt.Errorf("failed to edit PR content with editor : %w", err)
 	}
 
-	return body
+	return body, nil
 }
 
 // promptUserToEdit prompts the user if they want to edit the PR content in their editor
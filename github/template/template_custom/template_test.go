@@ -9,6 +9,7 @@ import (
 	"testing"
 
 	"github.com/ejoffe/spr/config"
+	"github.com/ejoffe/spr/errs"
 	"github.com/ejoffe/spr/git"
 	"github.com/ejoffe/spr/github"
 	"github.com/stretchr/testify/assert"
@@ -20,15 +21,12 @@ type mockGit struct {
 	rootDir string
 }
 
-func (m *mockGit) GitWithEditor(args string, output *string, editorCmd string) error {
-	return nil
-}
-
-func (m *mockGit) Git(args string, output *string) error {
-	return nil
+func (m *mockGit) GitWithEditor(ctx context.Context, editorCmd string, args ...string) (string, error) {
+	return "", nil
 }
 
-func (m *mockGit) MustGit(args string, output *string) {
+func (m *mockGit) Git(ctx context.Context, args ...string) (string, error) {
+	return "", nil
 }
 
 func (m *mockGit) RootDir() string {
@@ -239,6 +237,18 @@ func TestReadPRTemplateNotFound(t *testing.T) {
 	assert.Contains(t, err.Error(), "unable to read template")
 }
 
+func TestBodyTemplateNotFound(t *testing.T) {
+	repoConfig := &config.RepoConfig{
+		PRTemplatePath: "nonexistent_template.md",
+	}
+	gitcmd := &mockGit{rootDir: t.TempDir()}
+	templatizer := NewCustomTemplatizer(repoConfig, gitcmd)
+
+	_, err := templatizer.Body(&github.GitHubInfo{}, git.Commit{Subject: "Add parser"}, &github.PullRequest{})
+	assert.Error(t, err)
+	assert.True(t, errors.Is(err, errs.Validation))
+}
+
 func TestReadPRTemplateWithSubdirectory(t *testing.T) {
 	tmpDir := t.TempDir()
 	subDir := filepath.Join(tmpDir, "templates")
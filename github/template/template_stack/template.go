@@ -18,7 +18,7 @@ func (t *StackTemplatizer) Title(info *github.GitHubInfo, commit git.Commit) str
 	return commit.Subject
 }
 
-func (t *StackTemplatizer) Body(info *github.GitHubInfo, commit git.Commit, pr *github.PullRequest) string {
+func (t *StackTemplatizer) Body(info *github.GitHubInfo, commit git.Commit, pr *github.PullRequest) (string, error) {
 	body := commit.Body
 
 	// Always show stack section and notice
@@ -28,5 +28,5 @@ func (t *StackTemplatizer) Body(info *github.GitHubInfo, commit git.Commit, pr *
 	body += template.FormatStackMarkdown(commit, info.PullRequests, t.showPrTitlesInStack)
 	body += "---\n"
 	body += template.ManualMergeNotice()
-	return body
+	return body, nil
 }
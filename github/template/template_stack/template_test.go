@@ -79,7 +79,8 @@ func TestBody_EmptyStack(t *testing.T) {
 		Body:    "Commit body text",
 	}
 
-	result := templatizer.Body(info, commit, nil)
+	result, err := templatizer.Body(info, commit, nil)
+	assert.NoError(t, err)
 
 	// Should contain the commit body
 	assert.Contains(t, result, "Commit body text")
@@ -133,7 +134,8 @@ func TestBody_WithStack_NoTitles(t *testing.T) {
 	}
 
 	// Test with commit2 (middle of stack)
-	result := templatizer.Body(info, commit2, nil)
+	result, err := templatizer.Body(info, commit2, nil)
+	assert.NoError(t, err)
 
 	// Should contain the commit body
 	assert.Contains(t, result, "Second body")
@@ -210,7 +212,8 @@ func TestBody_WithStack_WithTitles(t *testing.T) {
 	}
 
 	// Test with commit2 (middle of stack)
-	result := templatizer.Body(info, commit2, nil)
+	result, err := templatizer.Body(info, commit2, nil)
+	assert.NoError(t, err)
 
 	// Should contain the commit body
 	assert.Contains(t, result, "Second body")
@@ -254,7 +257,8 @@ func TestBody_StackOrder(t *testing.T) {
 		},
 	}
 
-	result := templatizer.Body(info, commit2, nil)
+	result, err := templatizer.Body(info, commit2, nil)
+	assert.NoError(t, err)
 
 	// Stack should be in reverse order (3, 2, 1)
 	// Find the stack section
@@ -305,7 +309,8 @@ func TestBody_CurrentCommitAtStart(t *testing.T) {
 	}
 
 	// Test with commit3 (last in stack, first in reverse order)
-	result := templatizer.Body(info, commit3, nil)
+	result, err := templatizer.Body(info, commit3, nil)
+	assert.NoError(t, err)
 
 	// Should have arrow on #3
 	assert.Contains(t, result, "#3 ⬅")
@@ -343,7 +348,8 @@ func TestBody_CurrentCommitAtEnd(t *testing.T) {
 	}
 
 	// Test with commit1 (first in stack, last in reverse order)
-	result := templatizer.Body(info, commit1, nil)
+	result, err := templatizer.Body(info, commit1, nil)
+	assert.NoError(t, err)
 
 	// Should have arrow on #1
 	assert.Contains(t, result, "#1 ⬅")
@@ -368,7 +374,8 @@ func TestBody_EmptyBody(t *testing.T) {
 		},
 	}
 
-	result := templatizer.Body(info, commit, nil)
+	result, err := templatizer.Body(info, commit, nil)
+	assert.NoError(t, err)
 
 	// Should still contain stack and notice
 	assert.Contains(t, result, "#1")
@@ -391,7 +398,8 @@ func TestBody_SinglePRInStack(t *testing.T) {
 		},
 	}
 
-	result := templatizer.Body(info, commit, nil)
+	result, err := templatizer.Body(info, commit, nil)
+	assert.NoError(t, err)
 
 	// Should contain the body
 	assert.Contains(t, result, "Single body")
@@ -427,7 +435,8 @@ func TestBody_WithTitlesVsWithoutTitles(t *testing.T) {
 
 	// Test without titles
 	templatizerNoTitles := NewStackTemplatizer(false)
-	resultNoTitles := templatizerNoTitles.Body(info, commit2, nil)
+	resultNoTitles, err := templatizerNoTitles.Body(info, commit2, nil)
+	assert.NoError(t, err)
 
 	// Should NOT contain PR titles
 	assert.NotContains(t, resultNoTitles, "First PR")
@@ -438,7 +447,8 @@ func TestBody_WithTitlesVsWithoutTitles(t *testing.T) {
 
 	// Test with titles
 	templatizerWithTitles := NewStackTemplatizer(true)
-	resultWithTitles := templatizerWithTitles.Body(info, commit2, nil)
+	resultWithTitles, err := templatizerWithTitles.Body(info, commit2, nil)
+	assert.NoError(t, err)
 
 	// Should contain PR titles
 	assert.Contains(t, resultWithTitles, "First PR #1")
@@ -460,7 +470,8 @@ func TestBody_Structure(t *testing.T) {
 		},
 	}
 
-	result := templatizer.Body(info, commit, nil)
+	result, err := templatizer.Body(info, commit, nil)
+	assert.NoError(t, err)
 
 	// Verify structure: body + \n\n + stack + \n\n + notice
 	// The body should come first
@@ -513,7 +524,8 @@ func TestBody_RealWorldExample(t *testing.T) {
 	}
 
 	// Test with middle commit
-	result := templatizer.Body(info, commit2, nil)
+	result, err := templatizer.Body(info, commit2, nil)
+	assert.NoError(t, err)
 
 	// Should contain commit body
 	assert.Contains(t, result, "Created POST /login endpoint")
@@ -611,7 +623,8 @@ It even includes some **markdown** formatting.
 	templatizer := NewStackTemplatizer(false)
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
-			body := templatizer.Body(tc.info, tc.commit, nil)
+			body, err := templatizer.Body(tc.info, tc.commit, nil)
+			assert.NoError(t, err)
 			if body != tc.expected {
 				t.Fatalf("expected: '%v', actual: '%v'", tc.expected, body)
 			}
@@ -20,7 +20,7 @@ func (t *WhyWhatTemplatizer) Title(info *github.GitHubInfo, commit git.Commit) s
 	return commit.Subject
 }
 
-func (t *WhyWhatTemplatizer) Body(info *github.GitHubInfo, commit git.Commit, pr *github.PullRequest) string {
+func (t *WhyWhatTemplatizer) Body(info *github.GitHubInfo, commit git.Commit, pr *github.PullRequest) (string, error) {
 	// Split commit body by empty lines and filter out empty sections
 	sections := splitByEmptyLines(commit.Body)
 
@@ -52,13 +52,13 @@ func (t *WhyWhatTemplatizer) Body(info *github.GitHubInfo, commit git.Commit, pr
 	tmpl, err := go_template.New("why_what").Parse(whyWhatTemplate)
 	if err != nil {
 		// If template parsing fails, return the original body
-		return commit.Body
+		return commit.Body, nil
 	}
 
 	var buf bytes.Buffer
 	if err := tmpl.Execute(&buf, data); err != nil {
 		// If template execution fails, return the original body
-		return commit.Body
+		return commit.Body, nil
 	}
 
 	body := buf.String()
@@ -70,7 +70,7 @@ func (t *WhyWhatTemplatizer) Body(info *github.GitHubInfo, commit git.Commit, pr
 	body += template.FormatStackMarkdown(commit, info.PullRequests, true)
 	body += "---\n"
 	body += template.ManualMergeNotice()
-	return body
+	return body, nil
 }
 
 // splitByEmptyLines splits a string by empty lines (one or more consecutive newlines)
@@ -212,7 +212,8 @@ func TestBody(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := templatizer.Body(info, tt.commit, nil)
+			got, err := templatizer.Body(info, tt.commit, nil)
+			assert.NoError(t, err)
 
 			// Check that all required strings are present
 			for _, wantStr := range tt.contains {
@@ -320,7 +321,8 @@ func TestBodyTemplateStructure(t *testing.T) {
 		Body:    "Why section\n\nWhat changed section\n\nTest plan section",
 	}
 
-	result := templatizer.Body(info, commit, nil)
+	result, err := templatizer.Body(info, commit, nil)
+	assert.NoError(t, err)
 
 	// Verify sections appear in correct order
 	whyIndex := strings.Index(result, "Why\n===")
@@ -381,7 +383,8 @@ Manual review of the docs.`,
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := templatizer.Body(info, tt.commit, nil)
+			result, err := templatizer.Body(info, tt.commit, nil)
+			assert.NoError(t, err)
 
 			// Should always contain the required sections
 			assert.Contains(t, result, "Why\n===")
@@ -0,0 +1,496 @@
+package spr
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ejoffe/spr/git"
+	"github.com/ejoffe/spr/github"
+	"github.com/ejoffe/spr/github/githubclient/gen/genclient"
+)
+
+// maxAuditEntries is the number of operations kept in the audit log, the
+//
+//	oldest operations are dropped once it grows past maxAuditLogSize bytes,
+//	down to half that size at most, so the log isn't rewritten by every
+//	operation.
+const (
+	maxAuditEntries = 1000
+	maxAuditLogSize = 4 << 20
+)
+
+// auditLockTimeout is how long spr waits for the audit log lock held by
+//
+//	another spr, a lock older than that was left behind by a spr that died
+//	and is broken.
+const auditLockTimeout = 10 * time.Second
+
+// auditEntry is the history of a single spr operation : what it changed
+//
+//	and every git command and GitHub call it made, in order.
+type auditEntry struct {
+	Command string    `json:"command"`
+	Time    time.Time `json:"time"`
+	Branch  string    `json:"branch,omitempty"`
+	DryRun  bool      `json:"dryRun,omitempty"`
+
+	Pushed      []auditPush        `json:"pushed,omitempty"`
+	Created     []auditPullRequest `json:"created,omitempty"`
+	Updated     []auditPullRequest `json:"updated,omitempty"`
+	Closed      []auditPullRequest `json:"closed,omitempty"`
+	Restored    []auditPullRequest `json:"restored,omitempty"`
+	Merged      []auditPullRequest `json:"merged,omitempty"`
+	MergeMethod string             `json:"mergeMethod,omitempty"`
+
+	// Calls are the git commands and GitHub calls made, in the order they
+	//  completed, prefixed with "git" or "github".
+	Calls []string `json:"calls,omitempty"`
+
+	// Error is set when the operation failed before it completed
+	Error string `json:"error,omitempty"`
+}
+
+// auditPush is a commit force pushed to a pull request branch, an empty
+//
+//	CommitHash is a deleted branch.
+type auditPush struct {
+	Branch     string `json:"branch"`
+	CommitHash string `json:"commitHash,omitempty"`
+}
+
+type auditPullRequest struct {
+	Number   int    `json:"number"`
+	CommitID string `json:"commitID,omitempty"`
+	Title    string `json:"title,omitempty"`
+}
+
+func newAuditPullRequest(pr *github.PullRequest) auditPullRequest {
+	return auditPullRequest{Number: pr.Number, CommitID: pr.Commit.CommitID, Title: pr.Title}
+}
+
+// auditLog collects the entry of the running operation, the git and GitHub
+//
+//	calls are made from several goroutines during an update.
+type auditLog struct {
+	mu    sync.Mutex
+	entry *auditEntry
+}
+
+// record calls fn with the entry of the running operation, if any
+func (l *auditLog) record(fn func(entry *auditEntry)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.entry != nil {
+		fn(l.entry)
+	}
+}
+
+// startAudit starts recording an operation in the audit log. The returned
+//
+//	function writes the entry along with the error the operation returned,
+//	it must be deferred with the address of the named error result so failed
+//	operations are logged too. Operations run by another one, such as the
+//	update run after an amend, are recorded as part of it.
+func (sd *stackediff) startAudit(command string) func(err *error) {
+	sd.audit.mu.Lock()
+	defer sd.audit.mu.Unlock()
+	if sd.audit.entry != nil {
+		return func(*error) {}
+	}
+	entry := &auditEntry{Command: command, Time: time.Now(), DryRun: sd.DryRun}
+	sd.audit.entry = entry
+	return func(err *error) {
+		r := recover()
+		sd.audit.mu.Lock()
+		sd.audit.entry = nil
+		sd.audit.mu.Unlock()
+		if r != nil {
+			entry.Error = fmt.Sprint(r)
+		} else if *err != nil {
+			entry.Error = (*err).Error()
+		}
+		if entry.Branch == "" {
+			entry.Branch = sd.config.Stack
+		}
+		appendErr := sd.appendAuditEntry(entry)
+		if r != nil {
+			panic(r)
+		}
+		if *err == nil {
+			*err = appendErr
+		}
+	}
+}
+
+// auditPushed records the commits pushed to pull request branches, keyed
+//
+//	by branch name. An empty commit hash deletes the branch.
+func (sd *stackediff) auditPushed(branch string, commitHash string) {
+	sd.audit.record(func(entry *auditEntry) {
+		entry.Pushed = append(entry.Pushed, auditPush{Branch: branch, CommitHash: commitHash})
+	})
+}
+
+func (sd *stackediff) auditLogPath() string {
+	return filepath.Join(sd.gitcmd.RootDir(), ".git", "spr", "log.jsonl")
+}
+
+// readAuditLog returns the entries of the audit log, oldest first
+func (sd *stackediff) readAuditLog() ([]auditEntry, error) {
+	file, err := os.Open(sd.auditLogPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []auditEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 16*1024*1024)
+	for scanner.Scan() {
+		var entry auditEntry
+		if json.Unmarshal(scanner.Bytes(), &entry) == nil {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// appendAuditEntry adds entry at the end of the audit log, one json
+//
+//	object per line, and trims the log when it grew too long.
+func (sd *stackediff) appendAuditEntry(entry *auditEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(sd.auditLogPath()), 0755)
+	if err != nil {
+		return err
+	}
+	// the lock keeps a trim by another spr from dropping this entry
+	unlock, err := sd.lockAuditLog()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	file, err := os.OpenFile(sd.auditLogPath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(append(line, '\n'))
+	if err != nil {
+		file.Close()
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	err = file.Close()
+	if err != nil {
+		return err
+	}
+	if info.Size() <= maxAuditLogSize {
+		return nil
+	}
+	return sd.trimAuditLog()
+}
+
+// lockAuditLog takes the lock on the audit log, a lock file next to it
+//
+//	created by one spr at a time the way git locks its index. The returned
+//	func releases it.
+func (sd *stackediff) lockAuditLog() (func(), error) {
+	lockPath := sd.auditLogPath() + ".lock"
+	deadline := time.Now().Add(auditLockTimeout)
+	for {
+		file, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			file.Close()
+			return func() { os.Remove(lockPath) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		info, err := os.Stat(lockPath)
+		if err == nil && time.Since(info.ModTime()) > auditLockTimeout {
+			os.Remove(lockPath)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("audit log is locked by another spr, remove %s if none is running", lockPath)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// trimAuditLog drops the oldest entries of the audit log, keeping at most
+//
+//	maxAuditEntries of them in half of maxAuditLogSize. It is called with
+//	the audit log lock held.
+func (sd *stackediff) trimAuditLog() error {
+	data, err := os.ReadFile(sd.auditLogPath())
+	if err != nil {
+		return err
+	}
+	count := bytes.Count(data, []byte{'\n'})
+	for count > 0 && (count > maxAuditEntries || len(data) > maxAuditLogSize/2) {
+		data = data[bytes.IndexByte(data, '\n')+1:]
+		count--
+	}
+	// written to a temporary file first, a crash never leaves half a log
+	tmp := sd.auditLogPath() + ".tmp"
+	err = os.WriteFile(tmp, data, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, sd.auditLogPath())
+}
+
+// PrintLog prints the last count operations of the audit log, oldest first,
+//
+//	with what each changed. When calls is true the git commands and GitHub
+//	calls made are listed too. With a machine readable output format the
+//	entries are printed as they are stored.
+func (sd *stackediff) PrintLog(count int, calls bool) error {
+	entries, err := sd.readAuditLog()
+	if err != nil {
+		return err
+	}
+	if count > 0 && len(entries) > count {
+		entries = entries[len(entries)-count:]
+	}
+
+	if sd.OutputFormat != "" {
+		for _, entry := range entries {
+			line, err := json.Marshal(entry)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(sd.output, "%s\n", line)
+		}
+		return nil
+	}
+
+	if len(entries) == 0 {
+		fmt.Fprintf(sd.output, "no spr operations logged\n")
+		return nil
+	}
+	for _, entry := range entries {
+		fmt.Fprintf(sd.output, "%s spr %s", entry.Time.Local().Format(time.DateTime), entry.Command)
+		if entry.Branch != "" {
+			fmt.Fprintf(sd.output, " on %s", entry.Branch)
+		}
+		if entry.DryRun {
+			fmt.Fprintf(sd.output, " (dry run)")
+		}
+		fmt.Fprintf(sd.output, "\n")
+
+		for _, push := range entry.Pushed {
+			if push.CommitHash == "" {
+				fmt.Fprintf(sd.output, "  deleted %s\n", push.Branch)
+			} else {
+				fmt.Fprintf(sd.output, "  pushed %s to %s\n", shortHash(push.CommitHash), push.Branch)
+			}
+		}
+		sd.printAuditPullRequests("created", entry.Created, "")
+		sd.printAuditPullRequests("updated", entry.Updated, "")
+		sd.printAuditPullRequests("closed", entry.Closed, "")
+		sd.printAuditPullRequests("restored", entry.Restored, "")
+		sd.printAuditPullRequests("merged", entry.Merged, entry.MergeMethod)
+		if entry.Error != "" {
+			fmt.Fprintf(sd.output, "  failed: %s\n", entry.Error)
+		}
+		if calls {
+			for _, call := range entry.Calls {
+				fmt.Fprintf(sd.output, "  > %s\n", call)
+			}
+		}
+	}
+	return nil
+}
+
+func (sd *stackediff) printAuditPullRequests(action string, prs []auditPullRequest, method string) {
+	for _, pr := range prs {
+		fmt.Fprintf(sd.output, "  %s #%d", action, pr.Number)
+		if pr.Title != "" {
+			fmt.Fprintf(sd.output, " : %s", pr.Title)
+		}
+		if method != "" {
+			fmt.Fprintf(sd.output, " (%s)", strings.ToLower(method))
+		}
+		fmt.Fprintf(sd.output, "\n")
+	}
+}
+
+func shortHash(hash string) string {
+	if len(hash) > 8 {
+		return hash[:8]
+	}
+	return hash
+}
+
+// auditGit records the git commands run during an operation
+type auditGit struct {
+	git.GitInterface
+	log *auditLog
+}
+
+func (g *auditGit) call(args string, err error) {
+	g.log.record(func(entry *auditEntry) {
+		if err != nil {
+			args += " (failed: " + strings.TrimSpace(err.Error()) + ")"
+		}
+		entry.Calls = append(entry.Calls, "git "+args)
+	})
+}
+
+func (g *auditGit) GitWithEditor(ctx context.Context, editorCmd string, args ...string) (string, error) {
+	output, err := g.GitInterface.GitWithEditor(ctx, editorCmd, args...)
+	g.call(git.CommandString(args), err)
+	return output, err
+}
+
+func (g *auditGit) Git(ctx context.Context, args ...string) (string, error) {
+	output, err := g.GitInterface.Git(ctx, args...)
+	g.call(git.CommandString(args), err)
+	return output, err
+}
+
+func (g *auditGit) DeleteRemoteBranch(ctx context.Context, branch string) error {
+	err := g.GitInterface.DeleteRemoteBranch(ctx, branch)
+	g.call(fmt.Sprintf("DeleteRemoteBranch(%s)", branch), err)
+	if err == nil {
+		g.log.record(func(entry *auditEntry) {
+			entry.Pushed = append(entry.Pushed, auditPush{Branch: branch})
+		})
+	}
+	return err
+}
+
+// auditGitHub records the GitHub calls made during an operation and the
+//
+//	pull requests they changed.
+type auditGitHub struct {
+	github.GitHubInterface
+	log *auditLog
+}
+
+// call records a GitHub call, fn records what it changed and is only
+//
+//	called when the call succeeded.
+func (c *auditGitHub) call(call string, err error, fn func(entry *auditEntry)) {
+	c.log.record(func(entry *auditEntry) {
+		if err != nil {
+			call += " (failed: " + strings.TrimSpace(err.Error()) + ")"
+		}
+		entry.Calls = append(entry.Calls, "github "+call)
+		if fn != nil && err == nil {
+			fn(entry)
+		}
+	})
+}
+
+func (c *auditGitHub) GetInfo(ctx context.Context, gitcmd git.GitInterface) (*github.GitHubInfo, error) {
+	info, err := c.GitHubInterface.GetInfo(ctx, gitcmd)
+	c.call("GetInfo", err, func(entry *auditEntry) {
+		if entry.Branch == "" && info != nil {
+			entry.Branch = info.LocalBranch
+		}
+	})
+	return info, err
+}
+
+func (c *auditGitHub) GetPullRequests(ctx context.Context) ([]*github.PullRequest, error) {
+	prs, err := c.GitHubInterface.GetPullRequests(ctx)
+	c.call("GetPullRequests", err, nil)
+	return prs, err
+}
+
+func (c *auditGitHub) GetAssignableUsers(ctx context.Context) ([]github.RepoAssignee, error) {
+	users, err := c.GitHubInterface.GetAssignableUsers(ctx)
+	c.call("GetAssignableUsers", err, nil)
+	return users, err
+}
+
+func (c *auditGitHub) CreatePullRequest(ctx context.Context, gitcmd git.GitInterface, info *github.GitHubInfo,
+	commit git.Commit, prevCommit *git.Commit,
+) (*github.PullRequest, error) {
+	pr, err := c.GitHubInterface.CreatePullRequest(ctx, gitcmd, info, commit, prevCommit)
+	if err != nil {
+		c.call("CreatePullRequest "+commit.CommitID, err, nil)
+		return nil, err
+	}
+	c.call(fmt.Sprintf("CreatePullRequest %s #%d", commit.CommitID, pr.Number), nil, func(entry *auditEntry) {
+		entry.Created = append(entry.Created, newAuditPullRequest(pr))
+	})
+	return pr, nil
+}
+
+func (c *auditGitHub) UpdatePullRequest(ctx context.Context, gitcmd git.GitInterface, info *github.GitHubInfo,
+	pullRequests []*github.PullRequest, pr *github.PullRequest, commit git.Commit, prevCommit *git.Commit,
+) error {
+	err := c.GitHubInterface.UpdatePullRequest(ctx, gitcmd, info, pullRequests, pr, commit, prevCommit)
+	c.call(fmt.Sprintf("UpdatePullRequest #%d %s", pr.Number, commit.CommitID), err, func(entry *auditEntry) {
+		for _, updated := range entry.Updated {
+			if updated.Number == pr.Number {
+				return
+			}
+		}
+		entry.Updated = append(entry.Updated, auditPullRequest{Number: pr.Number, CommitID: commit.CommitID, Title: commit.Subject})
+	})
+	return err
+}
+
+func (c *auditGitHub) AddReviewers(ctx context.Context, pr *github.PullRequest, userIDs []string) error {
+	err := c.GitHubInterface.AddReviewers(ctx, pr, userIDs)
+	c.call(fmt.Sprintf("AddReviewers #%d %s", pr.Number, strings.Join(userIDs, ",")), err, nil)
+	return err
+}
+
+func (c *auditGitHub) CommentPullRequest(ctx context.Context, pr *github.PullRequest, comment string) error {
+	err := c.GitHubInterface.CommentPullRequest(ctx, pr, comment)
+	c.call(fmt.Sprintf("CommentPullRequest #%d %q", pr.Number, comment), err, nil)
+	return err
+}
+
+func (c *auditGitHub) MergePullRequest(ctx context.Context, pr *github.PullRequest,
+	mergeMethod genclient.PullRequestMergeMethod,
+) error {
+	err := c.GitHubInterface.MergePullRequest(ctx, pr, mergeMethod)
+	c.call(fmt.Sprintf("MergePullRequest #%d %s", pr.Number, mergeMethod), err, func(entry *auditEntry) {
+		entry.Merged = append(entry.Merged, newAuditPullRequest(pr))
+		entry.MergeMethod = string(mergeMethod)
+	})
+	return err
+}
+
+func (c *auditGitHub) ClosePullRequest(ctx context.Context, pr *github.PullRequest) error {
+	err := c.GitHubInterface.ClosePullRequest(ctx, pr)
+	c.call(fmt.Sprintf("ClosePullRequest #%d", pr.Number), err, func(entry *auditEntry) {
+		entry.Closed = append(entry.Closed, newAuditPullRequest(pr))
+	})
+	return err
+}
+
+func (c *auditGitHub) RestorePullRequest(ctx context.Context, pr *github.PullRequest) error {
+	err := c.GitHubInterface.RestorePullRequest(ctx, pr)
+	c.call(fmt.Sprintf("RestorePullRequest #%d", pr.Number), err, func(entry *auditEntry) {
+		entry.Restored = append(entry.Restored, newAuditPullRequest(pr))
+	})
+	return err
+}
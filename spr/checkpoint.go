@@ -0,0 +1,413 @@
+package spr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ejoffe/spr/errs"
+	"github.com/ejoffe/spr/git"
+	"github.com/ejoffe/spr/github"
+)
+
+// updateCheckpoint is the persisted state of an update being applied. The
+//
+//	planned changes are written before the first one is made, and the progress
+//	after each step, so an update which died halfway can be finished by
+//	update --continue without planning it again against a half updated stack.
+type updateCheckpoint struct {
+	Time   time.Time `json:"time"`
+	Branch string    `json:"branch"`
+
+	// Info holds the open pull requests of the stack, the ones created by
+	//  the update are added to it as they are opened.
+	Info         *github.GitHubInfo `json:"info"`
+	LocalCommits []git.Commit       `json:"localCommits"`
+	Reviewers    []string           `json:"reviewers,omitempty"`
+	Journal      *journalEntry      `json:"journal"`
+
+	Close   []*github.PullRequest `json:"close,omitempty"`
+	Reorder bool                  `json:"reorder,omitempty"`
+	Push    []git.Commit          `json:"push,omitempty"`
+	Updates []checkpointUpdate    `json:"updates,omitempty"`
+
+	// progress of the update, each step is only run once
+	Closed     int      `json:"closed"`
+	Commented  bool     `json:"commented,omitempty"`
+	Reparented bool     `json:"reparented"`
+	Pushed     bool     `json:"pushed"`
+	Updated    []string `json:"updated,omitempty"`
+
+	mu sync.Mutex
+}
+
+// checkpointUpdate is a planned pull request update, Opened is false until
+//
+//	the pull request of a new commit is created.
+type checkpointUpdate struct {
+	Opened     bool        `json:"opened"`
+	Commit     git.Commit  `json:"commit"`
+	PrevCommit *git.Commit `json:"prevCommit,omitempty"`
+}
+
+func newUpdateCheckpoint(entry *journalEntry, githubInfo *github.GitHubInfo,
+	localCommits []git.Commit, plan *updatePlan,
+) *updateCheckpoint {
+	githubInfo.PullRequests = plan.pullRequests
+	cp := &updateCheckpoint{
+		Time:         entry.Time,
+		Branch:       entry.Branch,
+		Info:         githubInfo,
+		LocalCommits: localCommits,
+		Reviewers:    plan.reviewers,
+		Journal:      entry,
+		Close:        plan.closePullRequests,
+		Reorder:      plan.reorder,
+		Push:         plan.pushCommits,
+	}
+	for _, update := range plan.updates {
+		cp.Updates = append(cp.Updates, checkpointUpdate{
+			Opened:     update.pr != nil,
+			Commit:     update.commit,
+			PrevCommit: update.prevCommit,
+		})
+	}
+	return cp
+}
+
+// pullRequest returns the pull request of the stack for the given commit
+func (cp *updateCheckpoint) pullRequest(commitID string) *github.PullRequest {
+	for _, pr := range cp.Info.PullRequests {
+		if pr.Commit.CommitID == commitID {
+			return pr
+		}
+	}
+	return nil
+}
+
+func (cp *updateCheckpoint) isUpdated(commitID string) bool {
+	for _, updated := range cp.Updated {
+		if updated == commitID {
+			return true
+		}
+	}
+	return false
+}
+
+func (sd *stackediff) checkpointPath() string {
+	return filepath.Join(sd.gitcmd.RootDir(), ".git", "spr", "update.json")
+}
+
+func (sd *stackediff) readUpdateCheckpoint() (*updateCheckpoint, error) {
+	data, err := os.ReadFile(sd.checkpointPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	cp := &updateCheckpoint{}
+	err = json.Unmarshal(data, cp)
+	if err != nil {
+		return nil, fmt.Errorf("corrupt update checkpoint %s : %w", sd.checkpointPath(), err)
+	}
+	return cp, nil
+}
+
+// saveCheckpoint writes cp, callers running in the goroutines updating
+//
+//	pull requests must hold cp.mu.
+func (sd *stackediff) saveCheckpoint(cp *updateCheckpoint) error {
+	data, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(sd.checkpointPath()), 0755)
+	if err != nil {
+		return err
+	}
+	// written to a temporary file first, a crash never leaves half a checkpoint
+	tmp := sd.checkpointPath() + ".tmp"
+	err = os.WriteFile(tmp, data, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, sd.checkpointPath())
+}
+
+// pendingUpdate returns a conflict error explaining how to finish the
+//
+//	interrupted update, if there is one.
+func (sd *stackediff) pendingUpdate() error {
+	cp, err := sd.readUpdateCheckpoint()
+	if err != nil || cp == nil {
+		return err
+	}
+	return errs.New(errs.Conflict, "the spr update of %s from %s didn't complete\n"+
+		" run spr update --continue to finish it, or spr update --abort to drop it",
+		cp.Branch, cp.Time.Local().Format(time.DateTime))
+}
+
+// ContinueUpdate finishes an update which died halfway, from its checkpoint.
+//
+//	Steps which completed are skipped and the pull requests of new commits
+//	which were opened before the checkpoint was saved are reused, so each
+//	pull request is changed once.
+func (sd *stackediff) ContinueUpdate(ctx context.Context) (err error) {
+	sd.profiletimer.Step("ContinueUpdate::Start")
+	defer sd.startAudit("update --continue")(&err)
+
+	cp, err := sd.readUpdateCheckpoint()
+	if err != nil {
+		return err
+	}
+	if cp == nil {
+		fmt.Fprintf(sd.output, "no spr update to continue\n")
+		return nil
+	}
+	fmt.Fprintf(sd.output, "continuing the spr update of %s from %s\n",
+		cp.Branch, cp.Time.Local().Format(time.DateTime))
+	result, err := sd.applyUpdate(ctx, cp, true)
+	if err != nil {
+		return err
+	}
+	return sd.printUpdateResult(result)
+}
+
+// AbortUpdate drops the checkpoint of an interrupted update, the changes
+//
+//	it made stay as they are and the next update plans from the new state.
+func (sd *stackediff) AbortUpdate() error {
+	cp, err := sd.readUpdateCheckpoint()
+	if err != nil {
+		return err
+	}
+	if cp == nil {
+		fmt.Fprintf(sd.output, "no spr update to abort\n")
+		return nil
+	}
+	err = os.Remove(sd.checkpointPath())
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(sd.output, "dropped the spr update of %s from %s\n",
+		cp.Branch, cp.Time.Local().Format(time.DateTime))
+	return nil
+}
+
+// applyUpdate makes the changes of the update in cp, recording the progress
+//
+//	in the checkpoint after each step and removing it once the update is done.
+//	When resuming, pull requests which were opened without the checkpoint
+//	being saved are looked up by their branch before creating new ones. A
+//	failed step leaves the checkpoint in place so the update can be continued.
+func (sd *stackediff) applyUpdate(ctx context.Context, cp *updateCheckpoint, resuming bool) (*UpdateResult, error) {
+	githubInfo := cp.Info
+	result := &UpdateResult{Closed: cp.Close}
+
+	// close prs for deleted commits
+	for cp.Closed < len(cp.Close) {
+		pr := cp.Close[cp.Closed]
+		// the comment is its own step, a resumed update doesn't post it twice
+		if !cp.Commented {
+			err := sd.github.CommentPullRequest(ctx, pr, "Closing pull request: commit has gone away")
+			if err != nil {
+				return nil, err
+			}
+			cp.Commented = true
+			err = sd.saveCheckpoint(cp)
+			if err != nil {
+				return nil, err
+			}
+		}
+		err := sd.github.ClosePullRequest(ctx, pr)
+		if err != nil {
+			return nil, err
+		}
+		cp.Closed++
+		cp.Commented = false
+		err = sd.saveCheckpoint(cp)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cp.Reorder && !cp.Reparented {
+		// if commits have been reordered :
+		//   first - rebase all pull requests to target branch
+		//   then - update all pull requests
+		err := sd.forEachPullRequest(len(githubInfo.PullRequests), func(i int) error {
+			pr := githubInfo.PullRequests[i]
+			return sd.github.UpdatePullRequest(ctx, sd.gitcmd, githubInfo, githubInfo.PullRequests, pr, pr.Commit, nil)
+		})
+		if err != nil {
+			return nil, err
+		}
+		cp.Reparented = true
+		err = sd.saveCheckpoint(cp)
+		if err != nil {
+			return nil, err
+		}
+		sd.profiletimer.Step("UpdatePullRequests::ReparentPullRequestsToMaster")
+	}
+
+	if !cp.Pushed {
+		err := sd.syncCommitStackToGitHub(ctx, cp.Push)
+		if err != nil {
+			return nil, err
+		}
+		cp.Pushed = true
+		err = sd.saveCheckpoint(cp)
+		if err != nil {
+			return nil, err
+		}
+	}
+	sd.profiletimer.Step("UpdatePullRequests::SyncCommitStackToGithub")
+
+	var opened map[string]*github.PullRequest
+	if resuming {
+		pullRequests, err := sd.github.GetPullRequests(ctx)
+		if err != nil {
+			return nil, err
+		}
+		opened = map[string]*github.PullRequest{}
+		for _, pr := range pullRequests {
+			opened[pr.FromBranch] = pr
+		}
+	}
+
+	var updateQueue []prUpdate
+	var assignable []github.RepoAssignee
+	created := false
+
+	// iterate through the planned updates and create missing pull_requests
+	for i := range cp.Updates {
+		update := &cp.Updates[i]
+		if !update.Opened {
+			// a pull request opened before the update died keeps its number
+			if pr, ok := opened[git.BranchNameFromCommit(sd.config, update.Commit)]; ok {
+				pr.Commit = update.Commit
+				update.Opened = true
+				githubInfo.PullRequests = append(githubInfo.PullRequests, pr)
+				cp.Journal.Created = append(cp.Journal.Created, newJournalPullRequest(pr))
+				result.Created = append(result.Created, pr)
+				created = true
+			}
+		}
+		if update.Opened {
+			pr := cp.pullRequest(update.Commit.CommitID)
+			pr.Commit = update.Commit
+			if len(cp.Reviewers) != 0 && !resuming {
+				result.Warnings = append(result.Warnings,
+					fmt.Sprintf("not updating reviewers for PR #%d", pr.Number))
+			}
+			updateQueue = append(updateQueue, prUpdate{pr: pr, commit: update.Commit, prevCommit: update.PrevCommit})
+			continue
+		}
+
+		// if pull request is not found for this commit_id it means the commit
+		//  is new and we need to create a new pull request
+		pr, err := sd.github.CreatePullRequest(ctx, sd.gitcmd, githubInfo, update.Commit, update.PrevCommit)
+		if err != nil {
+			return nil, err
+		}
+		githubInfo.PullRequests = append(githubInfo.PullRequests, pr)
+		update.Opened = true
+		cp.Journal.Created = append(cp.Journal.Created, newJournalPullRequest(pr))
+		result.Created = append(result.Created, pr)
+		err = sd.saveCheckpoint(cp)
+		if err != nil {
+			return nil, err
+		}
+		created = true
+		if len(cp.Reviewers) != 0 {
+			if assignable == nil {
+				assignable, err = sd.github.GetAssignableUsers(ctx)
+				if err != nil {
+					return nil, err
+				}
+			}
+			err = sd.addReviewers(ctx, pr, cp.Reviewers, assignable)
+			if err != nil {
+				return nil, err
+			}
+		}
+		updateQueue = append(updateQueue, prUpdate{pr: pr, commit: update.Commit, prevCommit: update.PrevCommit})
+	}
+	sd.profiletimer.Step("UpdatePullRequests::updatePullRequests")
+	if created {
+		err := sd.recordJournalEntry(cp.Journal)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Sort the PR stack by the local commit order, in case some commits were reordered
+	sortedPullRequests := sortPullRequestsByLocalCommitOrder(githubInfo.PullRequests, cp.LocalCommits)
+	err := sd.forEachPullRequest(len(updateQueue), func(i int) error {
+		pr := updateQueue[i]
+		cp.mu.Lock()
+		done := cp.isUpdated(pr.commit.CommitID)
+		cp.mu.Unlock()
+		if done {
+			return nil
+		}
+		err := sd.github.UpdatePullRequest(ctx, sd.gitcmd, githubInfo, sortedPullRequests, pr.pr, pr.commit, pr.prevCommit)
+		if err != nil {
+			return err
+		}
+		cp.mu.Lock()
+		defer cp.mu.Unlock()
+		cp.Updated = append(cp.Updated, pr.commit.CommitID)
+		return sd.saveCheckpoint(cp)
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = os.Remove(sd.checkpointPath())
+	if err != nil {
+		return nil, err
+	}
+
+	sd.profiletimer.Step("UpdatePullRequests::commitUpdateQueue")
+
+	result.Stack, err = sd.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// forEachPullRequest calls fn for each index up to n, concurrently unless
+//
+//	synchronized, and returns the errors of the calls which failed.
+func (sd *stackediff) forEachPullRequest(n int, fn func(i int) error) error {
+	var mu sync.Mutex
+	var failed []error
+	wg := new(sync.WaitGroup)
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		run := func(i int) {
+			defer wg.Done()
+			err := fn(i)
+			if err != nil {
+				mu.Lock()
+				failed = append(failed, err)
+				mu.Unlock()
+			}
+		}
+		if sd.synchronized {
+			run(i)
+		} else {
+			go run(i)
+		}
+	}
+	wg.Wait()
+	return errors.Join(failed...)
+}
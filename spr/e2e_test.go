@@ -0,0 +1,848 @@
+package spr
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ejoffe/spr/config"
+	"github.com/ejoffe/spr/errs"
+	"github.com/ejoffe/spr/git"
+	"github.com/ejoffe/spr/git/realgit"
+	"github.com/ejoffe/spr/github"
+	"github.com/ejoffe/spr/github/fakegithub"
+	"github.com/ejoffe/spr/github/githubclient"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMain runs the test binary as the sequence editor of the rebases the
+// tests start, in place of the spr binary.
+func TestMain(m *testing.M) {
+	if len(os.Args) > 1 && os.Args[1] == EditSequenceCommand {
+		err := EditSequence(os.Args[2:])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// makeE2ETestObjects returns a stackediff running real git commands in a
+// sandbox clone, against the fake GitHub server of the sandbox.
+func makeE2ETestObjects(t *testing.T) (*stackediff, *fakegithub.Sandbox, *bytes.Buffer) {
+	return makeE2ETestObjectsWithGitBackend(t, config.GitBackendCLI)
+}
+
+func makeE2ETestObjectsWithGitBackend(t *testing.T, gitBackend string) (*stackediff, *fakegithub.Sandbox, *bytes.Buffer) {
+	sb, err := fakegithub.NewSandbox(t.TempDir())
+	require.NoError(t, err)
+	t.Cleanup(sb.Close)
+
+	// realgit runs commands in the repository of the working directory
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(sb.WorkDir))
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	cfg := config.DefaultConfig()
+	cfg.Repo.GitHubRepoOwner = fakegithub.SandboxOwner
+	cfg.Repo.GitHubRepoName = fakegithub.SandboxRepo
+	cfg.Repo.GitHubHost = sb.URL
+	cfg.Repo.GitHubBranch = fakegithub.SandboxBranch
+	cfg.Repo.RequireChecks = true
+	cfg.Repo.RequireApproval = true
+	cfg.User.BranchPrefix = "spr"
+	cfg.User.GitBackend = gitBackend
+
+	client := githubclient.NewClient(cfg, sb.URL+"/api/graphql", http.DefaultClient)
+	gitcmd, err := realgit.NewGitInterface(cfg)
+	require.NoError(t, err)
+	s := NewStackedPR(cfg, client, gitcmd)
+	output := &bytes.Buffer{}
+	s.output = output
+	return s, sb, output
+}
+
+func TestE2EUpdateStatusMerge(t *testing.T) {
+	s, sb, output := makeE2ETestObjects(t)
+	ctx := context.Background()
+
+	require.NoError(t, s.UpdatePullRequests(ctx, nil, nil))
+	prs := sb.Server.PullRequests()
+	require.Len(t, prs, 3)
+	require.Equal(t, "main", prs[0].BaseRefName)
+	require.Equal(t, "spr/main/a1b2c3d0", prs[0].HeadRefName)
+	require.Equal(t, "spr/main/a1b2c3d0", prs[1].BaseRefName)
+	require.Equal(t, "spr/main/a1b2c3d1", prs[2].BaseRefName)
+	require.Equal(t, "Add printer", prs[2].Title)
+
+	// a second update leaves the pull requests as they are
+	output.Reset()
+	require.NoError(t, s.UpdatePullRequests(ctx, nil, nil))
+	require.Len(t, sb.Server.PullRequests(), 3)
+
+	// the bottom two pull requests are approved with passing checks
+	for _, number := range []int{1, 2} {
+		require.NoError(t, sb.Server.Approve(number))
+		require.NoError(t, sb.Server.SetCheck(number, "build", fakegithub.CheckSuccess))
+	}
+	require.NoError(t, sb.Server.SetCheck(3, "build", fakegithub.CheckFailure))
+
+	output.Reset()
+	require.NoError(t, s.StatusPullRequests(ctx))
+	prURL := sb.URL + "/spr-sandbox/demo/pull/"
+	require.Equal(t, ""+
+		"[❌❌✅❌] "+prURL+"3 : Add printer\n"+
+		"[✅✅✅✅] "+prURL+"2 : Add lexer\n"+
+		"[✅✅✅✅] "+prURL+"1 : Add parser\n", output.String())
+
+	output.Reset()
+	require.NoError(t, s.MergePullRequests(ctx, nil))
+	prs = sb.Server.PullRequests()
+	require.Equal(t, fakegithub.StateClosed, prs[0].State)
+	require.Equal(t, fakegithub.StateMerged, prs[1].State)
+	require.Equal(t, fakegithub.StateOpen, prs[2].State)
+	require.Len(t, prs[0].Comments, 1)
+}
+
+func TestE2EGoGitBackend(t *testing.T) {
+	s, sb, _ := makeE2ETestObjectsWithGitBackend(t, config.GitBackendGoGit)
+	ctx := context.Background()
+
+	require.NoError(t, s.UpdatePullRequests(ctx, nil, nil))
+	prs := sb.Server.PullRequests()
+	require.Len(t, prs, 3)
+	require.Equal(t, "spr/main/a1b2c3d1", prs[2].BaseRefName)
+	head := mustRevParse(t, s, "HEAD")
+	require.Equal(t, head, remoteHead(t, s, "spr/main/a1b2c3d2"))
+
+	// dropping the lexer commit force pushes the printer, undo pushes it back with a lease
+	mustGit(t, s, "rebase", "--quiet", "--onto", "HEAD~2", "HEAD~1")
+	require.NoError(t, s.UpdatePullRequests(ctx, nil, nil))
+	require.NotEqual(t, head, remoteHead(t, s, "spr/main/a1b2c3d2"))
+	require.NoError(t, s.Undo(ctx))
+	require.Equal(t, head, remoteHead(t, s, "spr/main/a1b2c3d2"))
+	require.Equal(t, fakegithub.StateOpen, sb.Server.PullRequests()[1].State)
+}
+
+func TestE2EPagination(t *testing.T) {
+	s, sb, _ := makeE2ETestObjects(t)
+	ctx := context.Background()
+	sb.Server.PageSize = 1
+
+	// a pull request opened by someone else isn't part of the stack
+	require.NoError(t, sb.Push("HEAD", "feature"))
+	_, err := sb.Server.CreatePullRequest("hubot", "main", "feature", "Add everything")
+	require.NoError(t, err)
+
+	// neither is a stack of someone else into the same target branch
+	require.NoError(t, sb.Push("HEAD~1", "spr/main/ffff0001"))
+	require.NoError(t, sb.Push("HEAD", "spr/main/ffff0002"))
+	_, err = sb.Server.CreatePullRequest("hubot", "main", "spr/main/ffff0001", "Add lexer")
+	require.NoError(t, err)
+	_, err = sb.Server.CreatePullRequest("hubot", "spr/main/ffff0001", "spr/main/ffff0002", "Add printer")
+	require.NoError(t, err)
+
+	require.NoError(t, s.UpdatePullRequests(ctx, nil, nil))
+	require.Len(t, sb.Server.PullRequests(), 6)
+
+	// only the pull requests of the stack are fetched with their commits
+	before := sb.Server.Operations()
+	info, err := s.github.GetInfo(ctx, s.gitcmd)
+	require.NoError(t, err)
+	after := sb.Server.Operations()
+	require.Equal(t, 6, after["PullRequestHeads"]-before["PullRequestHeads"])
+	require.Equal(t, 3, after["PullRequest"]-before["PullRequest"])
+	require.Len(t, info.PullRequests, 3)
+	for i, pr := range info.PullRequests {
+		require.Equal(t, i+4, pr.Number)
+		require.Len(t, pr.Commits, 1)
+	}
+	require.Equal(t, "Add printer", info.PullRequests[2].Title)
+}
+
+func TestE2ECommitPagination(t *testing.T) {
+	s, sb, _ := makeE2ETestObjects(t)
+	ctx := context.Background()
+	sb.Server.PageSize = 1
+
+	// the whole stack in a single pull request
+	require.NoError(t, sb.Push("HEAD", "spr/main/a1b2c3d2"))
+	_, err := sb.Server.CreatePullRequest(fakegithub.SandboxViewer, "main", "spr/main/a1b2c3d2", "Add printer")
+	require.NoError(t, err)
+
+	info, err := s.github.GetInfo(ctx, s.gitcmd)
+	require.NoError(t, err)
+	require.Len(t, info.PullRequests, 1)
+	commits := info.PullRequests[0].Commits
+	require.Len(t, commits, 3)
+	require.Equal(t, "Add parser", commits[0].Subject)
+	require.Equal(t, "Add printer", commits[2].Subject)
+}
+
+// openHubotStack opens the pull requests of the sandbox stack as hubot and
+// drops the commits from the local clone.
+func openHubotStack(t *testing.T, s *stackediff, sb *fakegithub.Sandbox) {
+	for i, title := range []string{"Add parser", "Add lexer", "Add printer"} {
+		head := fmt.Sprintf("spr/main/a1b2c3d%d", i)
+		base := "main"
+		if i > 0 {
+			base = fmt.Sprintf("spr/main/a1b2c3d%d", i-1)
+		}
+		require.NoError(t, sb.Push(fmt.Sprintf("HEAD~%d", 2-i), head))
+		_, err := sb.Server.CreatePullRequest("hubot", base, head, title)
+		require.NoError(t, err)
+	}
+	mustGit(t, s, "reset", "--hard", "--quiet", "origin/main")
+}
+
+func TestE2EAdopt(t *testing.T) {
+	s, sb, output := makeE2ETestObjects(t)
+	ctx := context.Background()
+
+	openHubotStack(t, s, sb)
+	require.NoError(t, s.AdoptStack(ctx, "#2", ""))
+	prURL := sb.URL + "/spr-sandbox/demo/pull/"
+	require.Equal(t, ""+
+		"adopted stack of 3 pull requests by hubot on branch stack-3\n"+
+		"  "+prURL+"3 : Add printer\n"+
+		"  "+prURL+"2 : Add lexer\n"+
+		"  "+prURL+"1 : Add parser\n", output.String())
+	require.Equal(t, "stack-3", mustGit(t, s, "rev-parse", "--abbrev-ref", "HEAD"))
+	require.Equal(t, "origin/main", mustGit(t, s, "rev-parse", "--abbrev-ref", "stack-3@{upstream}"))
+
+	// a new commit on top is added to the adopted stack
+	require.NoError(t, sb.Commit("Add formatter", "formatter.go", "package demo\n", "a1b2c3d3"))
+	require.NoError(t, s.UpdatePullRequests(ctx, nil, nil))
+	prs := sb.Server.PullRequests()
+	require.Len(t, prs, 4)
+	require.Equal(t, fakegithub.SandboxViewer, prs[3].Author)
+	require.Equal(t, "spr/main/a1b2c3d2", prs[3].BaseRefName)
+	for _, pr := range prs[:3] {
+		require.Equal(t, fakegithub.StateOpen, pr.State)
+	}
+
+	for _, pr := range prs {
+		require.NoError(t, sb.Server.Approve(pr.Number))
+		require.NoError(t, sb.Server.SetCheck(pr.Number, "build", fakegithub.CheckSuccess))
+	}
+	require.NoError(t, s.MergePullRequests(ctx, nil))
+	prs = sb.Server.PullRequests()
+	require.Equal(t, fakegithub.StateClosed, prs[0].State)
+	require.Equal(t, fakegithub.StateMerged, prs[3].State)
+
+	err := s.AdoptStack(ctx, "2", "")
+	require.EqualError(t, err, "pull request #2 is not an open spr pull request into main")
+	require.Equal(t, errs.NotFound, errs.KindOf(err))
+}
+
+func TestE2ECheckout(t *testing.T) {
+	s, sb, output := makeE2ETestObjects(t)
+	ctx := context.Background()
+	openHubotStack(t, s, sb)
+	require.NoError(t, s.CheckWritable(ctx))
+
+	require.NoError(t, s.CheckoutStack(ctx, "2", ""))
+	prURL := sb.URL + "/spr-sandbox/demo/pull/"
+	require.Equal(t, ""+
+		"checked out 2 pull requests by hubot on read-only branch pr-2\n"+
+		"  "+prURL+"2 : Add lexer\n"+
+		"  "+prURL+"1 : Add parser\n", output.String())
+	require.Equal(t, "origin/main", mustGit(t, s, "rev-parse", "--abbrev-ref", "pr-2@{upstream}"))
+
+	info, err := s.github.GetInfo(ctx, s.gitcmd)
+	require.NoError(t, err)
+	require.Equal(t, "pr-2", info.LocalBranch)
+	require.Len(t, info.PullRequests, 2)
+	require.EqualError(t, s.CheckWritable(ctx), "branch pr-2 is a read-only checkout of pull requests\n"+
+		" use spr adopt to take over the stack and update or merge it")
+
+	// updates and merges check it whichever command runs them
+	require.ErrorContains(t, s.UpdatePullRequests(ctx, nil, nil), "branch pr-2 is a read-only checkout")
+	require.ErrorContains(t, s.MergePullRequests(ctx, nil), "branch pr-2 is a read-only checkout")
+
+	// adopting the stack gives a branch which can be updated
+	output.Reset()
+	require.NoError(t, s.AdoptStack(ctx, "2", ""))
+	require.Contains(t, output.String(), "adopted stack of 3 pull requests by hubot on branch stack-3\n")
+	require.NoError(t, s.CheckWritable(ctx))
+	require.NoError(t, s.SelectStack("pr-2"))
+	require.Error(t, s.CheckWritable(ctx))
+
+	err = s.CheckoutStack(ctx, "3", "pr-2")
+	require.EqualError(t, err, "branch pr-2 already exists, pick another name with --branch")
+	require.Equal(t, errs.Conflict, errs.KindOf(err))
+
+	// a setting git can't read doesn't make the branch writable
+	mustGit(t, s, "config", "branch.stack-3.sprReadOnly", "maybe")
+	require.NoError(t, s.SelectStack("stack-3"))
+	require.ErrorContains(t, s.CheckWritable(ctx), "branch.stack-3.sprReadOnly")
+}
+
+// remoteHead returns the commit of branch on the sandbox origin, empty when
+// the branch doesn't exist.
+func remoteHead(t *testing.T, s *stackediff, branch string) string {
+	fields := strings.Fields(mustGit(t, s, "ls-remote", "origin", "refs/heads/"+branch))
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
+
+// mustRevParse returns the commit hash of rev in the sandbox clone.
+func mustRevParse(t *testing.T, s *stackediff, rev string) string {
+	hash, err := s.revParse(context.Background(), rev)
+	require.NoError(t, err)
+	return hash
+}
+
+// mustGit runs a git command in the sandbox clone and returns its output.
+func mustGit(t *testing.T, s *stackediff, args ...string) string {
+	output, err := s.gitcmd.Git(context.Background(), args...)
+	require.NoError(t, err)
+	return output
+}
+
+func TestE2EUndo(t *testing.T) {
+	s, sb, output := makeE2ETestObjects(t)
+	ctx := context.Background()
+
+	require.NoError(t, s.UpdatePullRequests(ctx, nil, nil))
+	require.Len(t, sb.Server.PullRequests(), 3)
+	head := mustRevParse(t, s, "HEAD")
+	printer := remoteHead(t, s, "spr/main/a1b2c3d2")
+	require.Equal(t, head, printer)
+
+	// drop the lexer commit : its pull request is closed and the one above retargeted
+	mustGit(t, s, "rebase", "--quiet", "--onto", "HEAD~2", "HEAD~1")
+	rebased := mustRevParse(t, s, "HEAD")
+	require.NoError(t, s.UpdatePullRequests(ctx, nil, nil))
+	prs := sb.Server.PullRequests()
+	require.Equal(t, fakegithub.StateClosed, prs[1].State)
+	require.Equal(t, "spr/main/a1b2c3d0", prs[2].BaseRefName)
+	require.NotEqual(t, printer, remoteHead(t, s, "spr/main/a1b2c3d2"))
+
+	// the local rebase wasn't made by spr and is kept
+	output.Reset()
+	require.NoError(t, s.Undo(ctx))
+	require.Contains(t, output.String(), "undid spr update on main from ")
+	prs = sb.Server.PullRequests()
+	require.Equal(t, fakegithub.StateOpen, prs[1].State)
+	require.Equal(t, "spr/main/a1b2c3d1", prs[2].BaseRefName)
+	require.Equal(t, printer, remoteHead(t, s, "spr/main/a1b2c3d2"))
+	require.Equal(t, rebased, mustRevParse(t, s, "HEAD"))
+
+	// the first update left the branch at head, before the rebase
+	err := s.Undo(ctx)
+	require.EqualError(t, err, "branch main has changed since the last spr update, it can't be undone")
+	require.Equal(t, errs.Conflict, errs.KindOf(err))
+
+	// undoing the first update closes the pull requests it opened
+	mustGit(t, s, "reset", "--hard", "--quiet", head)
+	require.NoError(t, s.Undo(ctx))
+	for _, pr := range sb.Server.PullRequests() {
+		require.Equal(t, fakegithub.StateClosed, pr.State)
+		require.Empty(t, remoteHead(t, s, pr.HeadRefName))
+	}
+
+	output.Reset()
+	require.NoError(t, s.Undo(ctx))
+	require.Equal(t, "nothing to undo\n", output.String())
+}
+
+func TestE2EUndoMerge(t *testing.T) {
+	s, sb, _ := makeE2ETestObjects(t)
+	ctx := context.Background()
+
+	require.NoError(t, s.UpdatePullRequests(ctx, nil, nil))
+	for _, pr := range sb.Server.PullRequests() {
+		require.NoError(t, sb.Server.Approve(pr.Number))
+		require.NoError(t, sb.Server.SetCheck(pr.Number, "build", fakegithub.CheckSuccess))
+	}
+	require.NoError(t, s.MergePullRequests(ctx, nil))
+
+	err := s.Undo(ctx)
+	require.EqualError(t, err, "the last spr merge merged pull request #3, a merge can't be undone")
+	require.Equal(t, errs.Validation, errs.KindOf(err))
+	require.Equal(t, fakegithub.StateMerged, sb.Server.PullRequests()[2].State)
+}
+
+func TestE2ELog(t *testing.T) {
+	s, sb, output := makeE2ETestObjects(t)
+	ctx := context.Background()
+
+	require.NoError(t, s.PrintLog(0, false))
+	require.Equal(t, "no spr operations logged\n", output.String())
+
+	require.NoError(t, s.UpdatePullRequests(ctx, nil, nil))
+	for _, pr := range sb.Server.PullRequests() {
+		require.NoError(t, sb.Server.Approve(pr.Number))
+		require.NoError(t, sb.Server.SetCheck(pr.Number, "build", fakegithub.CheckSuccess))
+	}
+	require.NoError(t, s.MergePullRequests(ctx, nil))
+
+	entries, err := s.readAuditLog()
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	update := entries[0]
+	require.Equal(t, "update", update.Command)
+	require.Equal(t, "main", update.Branch)
+	require.Len(t, update.Pushed, 3)
+	require.Equal(t, "spr/main/a1b2c3d0", update.Pushed[0].Branch)
+	require.Len(t, update.Created, 3)
+	require.Contains(t, update.Calls, "github CreatePullRequest a1b2c3d2 #3")
+	merge := entries[1]
+	require.Equal(t, []auditPullRequest{{Number: 3, CommitID: "a1b2c3d2", Title: "Add printer"}}, merge.Merged)
+	require.Equal(t, "REBASE", merge.MergeMethod)
+	require.Len(t, merge.Closed, 2)
+
+	output.Reset()
+	require.NoError(t, s.PrintLog(1, false))
+	lines := strings.Split(output.String(), "\n")
+	require.Contains(t, lines[0], " spr merge on main")
+	require.Equal(t, []string{
+		"  updated #3 : Add printer",
+		"  closed #1 : Add parser",
+		"  closed #2 : Add lexer",
+		"  merged #3 : Add printer (rebase)",
+		"",
+	}, lines[1:])
+
+	output.Reset()
+	require.NoError(t, s.PrintLog(1, true))
+	require.Contains(t, output.String(), "  > github MergePullRequest #3 REBASE\n")
+}
+
+// crashingGitHub fails right after the first pull request is created, as
+// if the connection dropped before spr got the response.
+type crashingGitHub struct {
+	github.GitHubInterface
+}
+
+func (c *crashingGitHub) CreatePullRequest(ctx context.Context, gitcmd git.GitInterface, info *github.GitHubInfo,
+	commit git.Commit, prevCommit *git.Commit,
+) (*github.PullRequest, error) {
+	_, err := c.GitHubInterface.CreatePullRequest(ctx, gitcmd, info, commit, prevCommit)
+	if err != nil {
+		return nil, err
+	}
+	return nil, errors.New("connection reset by peer")
+}
+
+func TestE2EUpdateContinue(t *testing.T) {
+	s, sb, output := makeE2ETestObjects(t)
+	ctx := context.Background()
+	s.synchronized = true
+
+	require.NoError(t, s.UpdatePullRequests(ctx, nil, nil))
+	require.NoError(t, sb.Commit("Add formatter", "formatter.go", "package demo\n", "a1b2c3d3"))
+	client := s.github
+	s.github = &crashingGitHub{GitHubInterface: client}
+	require.ErrorContains(t, s.UpdatePullRequests(ctx, nil, nil), "connection reset by peer")
+	require.Len(t, sb.Server.PullRequests(), 4)
+
+	// a new update doesn't plan against the half updated stack
+	s.github = client
+	err := s.UpdatePullRequests(ctx, nil, nil)
+	require.ErrorContains(t, err, " didn't complete\n run spr update --continue to finish it")
+	require.Equal(t, errs.Conflict, errs.KindOf(err))
+
+	output.Reset()
+	require.NoError(t, s.ContinueUpdate(ctx))
+	require.Contains(t, output.String(), "continuing the spr update of main from ")
+	prs := sb.Server.PullRequests()
+	require.Len(t, prs, 4)
+	require.Equal(t, "spr/main/a1b2c3d2", prs[3].BaseRefName)
+	cp, err := s.readUpdateCheckpoint()
+	require.NoError(t, err)
+	require.Nil(t, cp)
+
+	output.Reset()
+	require.NoError(t, s.ContinueUpdate(ctx))
+	require.Equal(t, "no spr update to continue\n", output.String())
+}
+
+// closeFailingGitHub fails to close pull requests, after spr commented on them.
+type closeFailingGitHub struct {
+	github.GitHubInterface
+}
+
+func (c *closeFailingGitHub) ClosePullRequest(ctx context.Context, pr *github.PullRequest) error {
+	return errors.New("connection reset by peer")
+}
+
+func TestE2EUpdateContinueComment(t *testing.T) {
+	s, sb, _ := makeE2ETestObjects(t)
+	ctx := context.Background()
+	s.synchronized = true
+
+	require.NoError(t, s.UpdatePullRequests(ctx, nil, nil))
+	mustGit(t, s, "rebase", "--quiet", "--onto", "HEAD~2", "HEAD~1")
+	client := s.github
+	s.github = &closeFailingGitHub{GitHubInterface: client}
+	require.ErrorContains(t, s.UpdatePullRequests(ctx, nil, nil), "connection reset by peer")
+
+	// the closing comment is posted once
+	s.github = client
+	require.NoError(t, s.ContinueUpdate(ctx))
+	prs := sb.Server.PullRequests()
+	require.Equal(t, fakegithub.StateClosed, prs[1].State)
+	require.Equal(t, []string{"Closing pull request: commit has gone away"}, prs[1].Comments)
+}
+
+func TestE2EClient(t *testing.T) {
+	s, sb, _ := makeE2ETestObjects(t)
+	ctx := context.Background()
+	client := NewClient(s.config, s.github, s.gitcmd)
+
+	result, err := client.Update(ctx, UpdateOptions{Count: 2})
+	require.NoError(t, err)
+	require.Len(t, result.Created, 2)
+	require.Empty(t, result.Closed)
+	require.Equal(t, "main", result.Stack.LocalBranch)
+	require.Equal(t, "main", result.Stack.TargetBranch)
+	require.Len(t, result.Stack.PullRequests, 2)
+
+	result, err = client.Update(ctx, UpdateOptions{})
+	require.NoError(t, err)
+	require.Len(t, result.Created, 1)
+	require.Equal(t, "Add printer", result.Created[0].Title)
+
+	stack, err := client.Status(ctx)
+	require.NoError(t, err)
+	require.Len(t, stack.PullRequests, 3)
+	require.Equal(t, "spr/main/a1b2c3d1", stack.PullRequests[2].ToBranch)
+
+	explanation, err := client.Explain(ctx, "1")
+	require.NoError(t, err)
+	require.Equal(t, 1, explanation.PullRequest.Number)
+	require.NotEmpty(t, explanation.Blockers)
+
+	for _, number := range []int{1, 2} {
+		require.NoError(t, sb.Server.Approve(number))
+		require.NoError(t, sb.Server.SetCheck(number, "build", fakegithub.CheckSuccess))
+	}
+	merged, err := client.Merge(ctx, MergeOptions{})
+	require.NoError(t, err)
+	require.Equal(t, 2, merged.Merged.Number)
+	require.True(t, merged.Merged.Merged)
+	require.Len(t, merged.Closed, 1)
+
+	_, err = client.Merge(ctx, MergeOptions{})
+	require.ErrorIs(t, err, errs.Validation)
+
+	// the operations of the client are logged like the ones of the command line
+	entries, err := s.readAuditLog()
+	require.NoError(t, err)
+	require.Len(t, entries, 4)
+	require.Equal(t, "merge", entries[2].Command)
+	require.Equal(t, "no mergeable pull requests found in the stack", entries[3].Error)
+}
+
+// subjects returns the subjects of the commits of the ui, bottom first
+func subjects(ui *stackUI) []string {
+	var subjects []string
+	for _, c := range ui.commits {
+		subjects = append(subjects, c.Subject)
+	}
+	return subjects
+}
+
+func TestE2EUI(t *testing.T) {
+	s, sb, _ := makeE2ETestObjects(t)
+	ctx := context.Background()
+	require.NoError(t, s.UpdatePullRequests(ctx, nil, nil))
+
+	ui := newStackUI(s)
+	var opened []string
+	ui.openURL = func(url string) error {
+		opened = append(opened, url)
+		return nil
+	}
+	require.NoError(t, ui.reload(ctx, true))
+	require.Equal(t, []string{"Add parser", "Add lexer", "Add printer"}, subjects(ui))
+
+	var screen bytes.Buffer
+	ui.render(&screen)
+	require.Contains(t, screen.String(), "spr ui : main -> main\r\n")
+	require.Contains(t, screen.String(), "> "+reverseVideo+shortHash(ui.commits[0].CommitHash)+" #1    Add parser  [")
+
+	// the printer is moved below the lexer, the cursor follows it
+	for _, key := range []string{keyUp, "k", "k", keyShiftDown} {
+		ui.handleKey(ctx, key)
+	}
+	require.Empty(t, ui.message)
+	require.Equal(t, 1, ui.cursor)
+	require.Equal(t, []string{"Add parser", "Add printer", "Add lexer"}, subjects(ui))
+
+	ui.handleKey(ctx, "o")
+	require.Equal(t, []string{sb.URL + "/spr-sandbox/demo/pull/3"}, opened)
+
+	ui.handleKey(ctx, "w")
+	require.Equal(t, "WIP Add printer", ui.commits[1].Subject)
+	require.True(t, ui.commits[1].WIP)
+	require.Equal(t, "a1b2c3d2", ui.commits[1].CommitID)
+	ui.handleKey(ctx, "w")
+	require.Equal(t, "Add printer", ui.commits[1].Subject)
+
+	ui.handleKey(ctx, "a")
+	require.Equal(t, "error: no staged changes, stage the changes to amend with git add", ui.message)
+
+	// the update rebases the pull requests in the new order
+	ui.handleKey(ctx, "u")
+	prs := sb.Server.PullRequests()
+	require.Equal(t, "spr/main/a1b2c3d0", prs[2].BaseRefName)
+	require.Equal(t, "spr/main/a1b2c3d2", prs[1].BaseRefName)
+
+	// the printer is squashed into the parser, its pull request is closed
+	ui.handleKey(ctx, "s")
+	require.Equal(t, 0, ui.cursor)
+	require.Equal(t, []string{"Add parser", "Add lexer"}, subjects(ui))
+	require.Equal(t, "parser.txt\nprinter.txt", mustGit(t, s, "diff", "--name-only", "HEAD~2", "HEAD~1"))
+	ui.handleKey(ctx, "u")
+	prs = sb.Server.PullRequests()
+	require.Equal(t, fakegithub.StateOpen, prs[0].State)
+	require.Equal(t, "spr/main/a1b2c3d0", prs[1].BaseRefName)
+	require.Equal(t, fakegithub.StateClosed, prs[2].State)
+	require.Len(t, ui.pullRequests, 2)
+
+	// dropping asks first
+	ui.handleKey(ctx, keyUp)
+	ui.handleKey(ctx, "d")
+	require.NotNil(t, ui.confirm)
+	ui.handleKey(ctx, "n")
+	require.Equal(t, "cancelled", ui.message)
+	require.Len(t, ui.commits, 2)
+	ui.handleKey(ctx, "d")
+	ui.handleKey(ctx, "y")
+	require.Equal(t, []string{"Add parser"}, subjects(ui))
+	require.Equal(t, 0, ui.cursor)
+
+	ui.handleKey(ctx, "q")
+	require.True(t, ui.done)
+}
+
+func TestE2EUIEdit(t *testing.T) {
+	s, _, _ := makeE2ETestObjects(t)
+	ctx := context.Background()
+
+	ui := newStackUI(s)
+	require.NoError(t, ui.reload(ctx, false))
+	ui.handleKey(ctx, keyUp)
+	ui.handleKey(ctx, "e")
+	require.True(t, ui.done)
+	require.Contains(t, ui.exitMessage, "Editing commit 2: Add lexer\n")
+	require.Equal(t, "Add lexer", mustGit(t, s, "log", "--format=%s", "-n", "1"))
+
+	require.NoError(t, s.EditCommitDone(ctx, false))
+	require.Equal(t, "Add printer", mustGit(t, s, "log", "--format=%s", "-n", "1"))
+
+	// undo resets the branch of a rewrite
+	ui = newStackUI(s)
+	require.NoError(t, ui.reload(ctx, false))
+	head := mustRevParse(t, s, "HEAD")
+	ui.handleKey(ctx, "K")
+	require.Equal(t, []string{"Add lexer", "Add parser", "Add printer"}, subjects(ui))
+	require.NoError(t, s.Undo(ctx))
+	require.Equal(t, head, mustRevParse(t, s, "HEAD"))
+}
+
+func stackSubjects(t *testing.T, s *stackediff) []string {
+	commits, err := git.GetLocalCommitStack(context.Background(), s.config, s.gitcmd)
+	require.NoError(t, err)
+	var subjects []string
+	for _, c := range commits {
+		subjects = append(subjects, c.Subject)
+	}
+	return subjects
+}
+
+func TestE2EMove(t *testing.T) {
+	s, sb, output := makeE2ETestObjects(t)
+	ctx := context.Background()
+	require.NoError(t, s.UpdatePullRequests(ctx, nil, nil))
+
+	// the printer is moved below the lexer, selected by pull request number
+	require.NoError(t, s.MoveCommit(ctx, "#3", "a1b2c3d1", false))
+	require.Contains(t, output.String(), "moved Add printer below Add lexer\n")
+	require.Equal(t, []string{"Add parser", "Add printer", "Add lexer"}, stackSubjects(t, s))
+	require.NoError(t, s.UpdatePullRequests(ctx, nil, nil))
+	prs := sb.Server.PullRequests()
+	require.Equal(t, "main", prs[0].BaseRefName)
+	require.Equal(t, "spr/main/a1b2c3d2", prs[1].BaseRefName)
+	require.Equal(t, "spr/main/a1b2c3d0", prs[2].BaseRefName)
+
+	// the parser is moved above the top commit, selected by position
+	require.NoError(t, s.MoveCommit(ctx, "1", "3", true))
+	require.Equal(t, []string{"Add printer", "Add lexer", "Add parser"}, stackSubjects(t, s))
+
+	output.Reset()
+	require.NoError(t, s.MoveCommit(ctx, "3", "2", true))
+	require.Equal(t, "Add parser is already above Add lexer\n", output.String())
+
+	err := s.MoveCommit(ctx, "2", "2", false)
+	require.Equal(t, errs.Validation, errs.KindOf(err))
+	err = s.MoveCommit(ctx, "#9", "1", false)
+	require.Equal(t, errs.NotFound, errs.KindOf(err))
+}
+
+func TestE2EReorder(t *testing.T) {
+	s, sb, output := makeE2ETestObjects(t)
+	ctx := context.Background()
+	require.NoError(t, s.UpdatePullRequests(ctx, nil, nil))
+
+	var todo string
+	edit := func(lines ...int) func(path string) error {
+		return func(path string) error {
+			content, err := os.ReadFile(path)
+			require.NoError(t, err)
+			todo = string(content)
+			picks := strings.Split(todo, "\n")
+			var edited []string
+			for _, l := range lines {
+				edited = append(edited, picks[l])
+			}
+			return os.WriteFile(path, []byte(strings.Join(edited, "\n")), 0644)
+		}
+	}
+
+	// an unchanged todo leaves the stack as it is
+	s.editFile = edit(0, 1, 2)
+	require.NoError(t, s.ReorderStack(ctx))
+	require.Contains(t, output.String(), "Stack unchanged\n")
+	require.True(t, strings.HasPrefix(todo, "pick "+mustRevParse(t, s, "HEAD~2")[:8]+" Add parser\n"))
+
+	// the printer moves to the bottom and the parser is dropped
+	s.editFile = edit(2, 1)
+	require.NoError(t, s.ReorderStack(ctx))
+	require.Equal(t, []string{"Add printer", "Add lexer"}, stackSubjects(t, s))
+	require.NoError(t, s.UpdatePullRequests(ctx, nil, nil))
+	prs := sb.Server.PullRequests()
+	require.Equal(t, fakegithub.StateClosed, prs[0].State)
+	require.Equal(t, "spr/main/a1b2c3d2", prs[1].BaseRefName)
+	require.Equal(t, "main", prs[2].BaseRefName)
+
+	s.editFile = func(path string) error {
+		return os.WriteFile(path, []byte("pick 0123abcd Add lexer\n"), 0644)
+	}
+	err := s.ReorderStack(ctx)
+	require.Equal(t, errs.Validation, errs.KindOf(err))
+	require.Equal(t, []string{"Add printer", "Add lexer"}, stackSubjects(t, s))
+
+	// the pull request of a commit dropped from the top is closed by the
+	//  next update, and undo reopens it
+	s.editFile = edit(0)
+	require.NoError(t, s.ReorderStack(ctx))
+	require.Equal(t, []string{"Add printer"}, stackSubjects(t, s))
+	require.NoError(t, s.UpdatePullRequests(ctx, nil, nil))
+	prs = sb.Server.PullRequests()
+	require.Equal(t, fakegithub.StateClosed, prs[1].State)
+	require.Equal(t, "main", prs[2].BaseRefName)
+	require.NoError(t, s.Undo(ctx))
+	require.Equal(t, fakegithub.StateOpen, sb.Server.PullRequests()[1].State)
+
+	// undoing the reorder too brings the commit back with its pull request
+	require.NoError(t, s.Undo(ctx))
+	require.Equal(t, []string{"Add printer", "Add lexer"}, stackSubjects(t, s))
+	require.NoError(t, s.UpdatePullRequests(ctx, nil, nil))
+	prs = sb.Server.PullRequests()
+	require.Equal(t, fakegithub.StateOpen, prs[1].State)
+	require.Equal(t, "spr/main/a1b2c3d2", prs[1].BaseRefName)
+}
+
+func TestE2ESplit(t *testing.T) {
+	s, sb, output := makeE2ETestObjects(t)
+	ctx := context.Background()
+	root := s.gitcmd.RootDir()
+	require.NoError(t, os.Mkdir(filepath.Join(root, "docs"), 0755))
+	require.NoError(t, os.Mkdir(filepath.Join(root, "lib"), 0755))
+	for _, file := range []string{"tools.txt", "tools_test.txt", "docs/tools.md", "lib/tools.txt"} {
+		require.NoError(t, os.WriteFile(filepath.Join(root, file), []byte(file+"\n"), 0644))
+	}
+	mustGit(t, s, "add", "--all")
+	mustGit(t, s, "commit", "--quiet", "-m", "Add tools", "-m", "commit-id:a1b2c3d3")
+	require.NoError(t, s.UpdatePullRequests(ctx, nil, nil))
+
+	// a piece which matches no file leaves the stack as it was
+	head := mustRevParse(t, s, "HEAD")
+	err := s.SplitCommit(ctx, "#4", []string{"tools.txt", "missing/*"})
+	require.Equal(t, errs.Validation, errs.KindOf(err))
+	require.False(t, s.isSplitting())
+	require.Equal(t, head, mustRevParse(t, s, "HEAD"))
+
+	// pieces given as globs split the commit in one step
+	require.NoError(t, s.SplitCommit(ctx, "#4", []string{"lib/*"}))
+	require.Contains(t, output.String(), "Split Add tools into 2 commits.\n")
+	require.Equal(t, []string{"Add parser", "Add lexer", "Add printer",
+		"Add tools (lib/*)", "Add tools"}, stackSubjects(t, s))
+
+	require.NoError(t, s.SplitCommit(ctx, "a1b2c3d3", nil))
+	require.True(t, s.isSplitting())
+	require.Contains(t, output.String(), "Splitting commit 5: Add tools\n")
+	err = s.SplitDone(ctx, false)
+	require.Equal(t, errs.Validation, errs.KindOf(err))
+	err = s.SplitCommitPiece(ctx, "Document tools", nil)
+	require.Equal(t, errs.Validation, errs.KindOf(err))
+
+	mustGit(t, s, "add", "docs/tools.md")
+	require.NoError(t, s.SplitCommitPiece(ctx, "Document tools", nil))
+	require.NoError(t, s.SplitCommitPiece(ctx, "", []string{"*_test.txt"}))
+	require.NoError(t, s.SplitDone(ctx, true))
+	require.False(t, s.isSplitting())
+	require.Equal(t, []string{"Add parser", "Add lexer", "Add printer", "Add tools (lib/*)",
+		"Document tools", "Add tools (*_test.txt)", "Add tools"}, stackSubjects(t, s))
+	require.Equal(t, "tools.txt", mustGit(t, s, "diff", "--name-only", "HEAD~1", "HEAD"))
+
+	// the split commit keeps its pull request, the pieces get new ones
+	commits, err := git.GetLocalCommitStack(ctx, s.config, s.gitcmd)
+	require.NoError(t, err)
+	require.Equal(t, "a1b2c3d3", commits[6].CommitID)
+	require.NotEqual(t, commits[3].CommitID, commits[4].CommitID)
+	prs := sb.Server.PullRequests()
+	require.Len(t, prs, 7)
+	require.Equal(t, "spr/main/"+commits[5].CommitID, prs[3].BaseRefName)
+	require.Equal(t, "Add tools (lib/*)", prs[4].Title)
+	require.Equal(t, "spr/main/a1b2c3d2", prs[4].BaseRefName)
+	require.Equal(t, "spr/main/"+commits[3].CommitID, prs[5].BaseRefName)
+	require.Equal(t, "spr/main/"+commits[4].CommitID, prs[6].BaseRefName)
+
+	// the split key of the interface starts a session, aborting it restores the stack
+	head = mustRevParse(t, s, "HEAD")
+	ui := newStackUI(s)
+	require.NoError(t, ui.reload(ctx, false))
+	ui.handleKey(ctx, "x")
+	require.True(t, ui.done)
+	require.Contains(t, ui.exitMessage, "Splitting commit 1: Add parser\n")
+	require.True(t, s.isSplitting())
+	require.NoError(t, s.SplitAbort(ctx))
+	require.False(t, s.isSplitting())
+	require.Equal(t, head, mustRevParse(t, s, "HEAD"))
+	require.Empty(t, mustGit(t, s, "status", "--porcelain"))
+
+	// a conflict with the commits above the split is resolved with git,
+	//  the split is journaled first so it can still be undone
+	require.NoError(t, s.SplitCommit(ctx, "4", nil))
+	require.NoError(t, s.SplitCommitPiece(ctx, "", []string{"lib/*"}))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "tools.txt"), []byte("conflict\n"), 0644))
+	err = s.SplitDone(ctx, false)
+	require.Equal(t, errs.Conflict, errs.KindOf(err))
+	require.False(t, s.isSplitting())
+	entries, err := s.readJournal()
+	require.NoError(t, err)
+	require.Equal(t, "split", entries[len(entries)-1].Command)
+	require.Equal(t, head, entries[len(entries)-1].HeadBefore)
+
+	require.NoError(t, os.WriteFile(filepath.Join(root, "tools.txt"), []byte("tools.txt\n"), 0644))
+	mustGit(t, s, "add", "tools.txt")
+	mustGit(t, s, "rebase", "--continue")
+	require.NoError(t, s.Undo(ctx))
+	require.Equal(t, head, mustRevParse(t, s, "HEAD"))
+}
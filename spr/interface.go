@@ -1,9 +1,129 @@
 package spr
 
-import "context"
+import (
+	"context"
+	"io"
+	"strings"
 
-type SPRInterface interface {
-	StatusPullRequests(ctx context.Context)
-	UpdatePullRequests(ctx context.Context)
-	MergePullRequests(ctx context.Context)
+	"github.com/ejoffe/spr/config"
+	"github.com/ejoffe/spr/errs"
+	"github.com/ejoffe/spr/git"
+	"github.com/ejoffe/spr/github"
+)
+
+// Client is the api to drive spr from go code. The methods return the
+//
+//	stack and the changes they made instead of printing them, the spr command
+//	renders the same results. A client operates on the stack of the checked
+//	out branch, merged into the configured target branch, until SelectStack
+//	or SelectTarget pick another one. Errors are classified with the kinds of
+//	the errs package. Methods may be added to the interface, the existing
+//	ones keep their signatures.
+type Client interface {
+	// SelectStack makes the client operate on the stack of commits on the
+	//  given local branch instead of the checked out branch.
+	SelectStack(branch string) error
+
+	// SelectTarget sets the branch the pull requests are merged into, an
+	//  empty target is the upstream branch of the selected stack.
+	SelectTarget(target string) error
+
+	// Status returns the stack and the status of its pull requests.
+	Status(ctx context.Context) (*Stack, error)
+
+	// Update pushes the commits of the stack and creates, updates and closes
+	//  pull requests to match them. The result holds the updated stack.
+	Update(ctx context.Context, opts UpdateOptions) (*UpdateResult, error)
+
+	// Merge merges the top most mergeable pull request of the stack into the
+	//  target branch and closes the pull requests below it.
+	Merge(ctx context.Context, opts MergeOptions) (*MergeResult, error)
+
+	// Explain returns what prevents the selected pull request from being
+	//  merged, selector is a pull request number or a stack position.
+	Explain(ctx context.Context, selector string) (*Explanation, error)
+}
+
+// NewClient returns a Client using the given forge client and git commands,
+//
+//	it neither prints nor reads input.
+func NewClient(cfg *config.Config, github github.GitHubInterface, gitcmd git.GitInterface) Client {
+	sd := NewStackedPR(cfg, github, gitcmd)
+	sd.output = io.Discard
+	sd.notices = io.Discard
+	sd.input = strings.NewReader("")
+	sd.editFile = func(string) error {
+		return errs.New(errs.Validation, "a client can't open an editor")
+	}
+	return sd
+}
+
+// Stack is a stack of pull requests, ordered with the bottom first. Each
+//
+//	pull request holds its commits, merge status and checks.
+type Stack struct {
+	LocalBranch  string
+	TargetBranch string
+	PullRequests []*github.PullRequest
+}
+
+// UpdateOptions are the options of Client.Update
+type UpdateOptions struct {
+	// Reviewers are requested on newly created pull requests, in addition
+	//  to the configured default reviewers
+	Reviewers []string
+
+	// Count limits the update to the given number of pull requests from the
+	//  bottom of the stack, zero updates the whole stack
+	Count uint
+}
+
+// UpdateResult is the outcome of Client.Update
+type UpdateResult struct {
+	// Stack is the stack after the update
+	Stack *Stack
+
+	// Created are the pull requests opened for new commits
+	Created []*github.PullRequest
+
+	// Closed are the pull requests closed as their commit has gone away
+	Closed []*github.PullRequest
+
+	// Warnings are problems which didn't stop the update
+	Warnings []string
+}
+
+// MergeOptions are the options of Client.Merge
+type MergeOptions struct {
+	// Count limits the merge to the given number of pull requests from the
+	//  bottom of the stack, zero merges as much of the stack as possible
+	Count uint
+}
+
+// MergeResult is the outcome of Client.Merge
+type MergeResult struct {
+	// Merged is the pull request merged into the target branch
+	Merged *github.PullRequest
+
+	// Closed are the pull requests below the merged one, their commits
+	//  were merged with it
+	Closed []*github.PullRequest
+}
+
+// Explanation tells why a pull request can't be merged
+type Explanation struct {
+	PullRequest *github.PullRequest
+
+	// Blockers is empty when the pull request is ready to merge
+	Blockers []github.MergeBlocker
+}
+
+// countLimit returns the count of the options as the limit the update and
+//
+//	merge plans take, nil for no limit.
+func countLimit(count uint) *uint {
+	if count == 0 {
+		return nil
+	}
+	return &count
 }
@@ -0,0 +1,270 @@
+package spr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ejoffe/spr/errs"
+	"github.com/ejoffe/spr/git"
+	"github.com/ejoffe/spr/github"
+)
+
+// maxJournalEntries is the number of operations kept in the journal,
+//
+//	older operations can't be undone.
+const maxJournalEntries = 20
+
+// journalEntry records the changes made by a single spr operation, with
+//
+//	the state from before the operation needed to undo them.
+type journalEntry struct {
+	Command string    `json:"command"`
+	Time    time.Time `json:"time"`
+
+	// Branch is the local branch of the stack, its head moved from
+	//  HeadBefore to HeadAfter. An empty HeadAfter is not checked on undo.
+	Branch     string `json:"branch"`
+	HeadBefore string `json:"headBefore,omitempty"`
+	HeadAfter  string `json:"headAfter,omitempty"`
+
+	// RemoteBranches are the pull request branches force pushed to the remote
+	RemoteBranches []journalBranch `json:"remoteBranches,omitempty"`
+
+	// PullRequests are the pull requests updated by the operation and Closed
+	//  the ones it closed, both as they were before the operation.
+	PullRequests []journalPullRequest `json:"pullRequests,omitempty"`
+	Closed       []journalPullRequest `json:"closed,omitempty"`
+
+	// Created are the pull requests opened by the operation
+	Created []journalPullRequest `json:"created,omitempty"`
+
+	// Merged is the pull request merged by the operation, merges can't be undone
+	Merged *journalPullRequest `json:"merged,omitempty"`
+
+	// Removed are the commit-ids of the commits a rewrite dropped or folded,
+	//  the next update closes their pull requests
+	Removed []string `json:"removed,omitempty"`
+}
+
+// journalBranch is a remote branch which pointed at Before, empty when the
+//
+//	branch didn't exist, and was force pushed to After.
+type journalBranch struct {
+	Name   string `json:"name"`
+	Before string `json:"before,omitempty"`
+	After  string `json:"after"`
+}
+
+type journalPullRequest struct {
+	ID         string `json:"id"`
+	Number     int    `json:"number"`
+	CommitID   string `json:"commitID"`
+	CommitHash string `json:"commitHash"`
+	FromBranch string `json:"fromBranch"`
+	ToBranch   string `json:"toBranch"`
+	Title      string `json:"title"`
+	Body       string `json:"body"`
+}
+
+func newJournalPullRequest(pr *github.PullRequest) journalPullRequest {
+	return journalPullRequest{
+		ID:         pr.ID,
+		Number:     pr.Number,
+		CommitID:   pr.Commit.CommitID,
+		CommitHash: pr.Commit.CommitHash,
+		FromBranch: pr.FromBranch,
+		ToBranch:   pr.ToBranch,
+		Title:      pr.Title,
+		Body:       pr.Body,
+	}
+}
+
+func (jpr journalPullRequest) pullRequest() *github.PullRequest {
+	return &github.PullRequest{
+		ID:         jpr.ID,
+		Number:     jpr.Number,
+		FromBranch: jpr.FromBranch,
+		ToBranch:   jpr.ToBranch,
+		Title:      jpr.Title,
+		Body:       jpr.Body,
+		Commit:     git.Commit{CommitID: jpr.CommitID, CommitHash: jpr.CommitHash},
+	}
+}
+
+// addPullRequest records the state of pr before the operation changes it,
+//
+//	only the first state recorded for a pull request is kept.
+func (entry *journalEntry) addPullRequest(pr *github.PullRequest) {
+	for _, recorded := range entry.PullRequests {
+		if recorded.Number == pr.Number {
+			return
+		}
+	}
+	entry.PullRequests = append(entry.PullRequests, newJournalPullRequest(pr))
+}
+
+func (sd *stackediff) journalPath() string {
+	return filepath.Join(sd.gitcmd.RootDir(), ".git", "spr", "journal.json")
+}
+
+func (sd *stackediff) readJournal() ([]journalEntry, error) {
+	data, err := os.ReadFile(sd.journalPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []journalEntry
+	err = json.Unmarshal(data, &entries)
+	if err != nil {
+		return nil, fmt.Errorf("corrupt journal %s : %w", sd.journalPath(), err)
+	}
+	return entries, nil
+}
+
+func (sd *stackediff) writeJournal(entries []journalEntry) error {
+	if len(entries) > maxJournalEntries {
+		entries = entries[len(entries)-maxJournalEntries:]
+	}
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(sd.journalPath()), 0755)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(sd.journalPath(), data, 0644)
+}
+
+// recordJournalEntry adds entry to the journal, or replaces it when it was
+//
+//	already recorded. Entries are written before the changes they describe
+//	are made and recorded again once they are complete.
+func (sd *stackediff) recordJournalEntry(entry *journalEntry) error {
+	entries, err := sd.readJournal()
+	if err != nil {
+		return err
+	}
+	if len(entries) > 0 && entries[len(entries)-1].Time.Equal(entry.Time) {
+		entries = entries[:len(entries)-1]
+	}
+	return sd.writeJournal(append(entries, *entry))
+}
+
+// revParse returns the commit hash of rev
+func (sd *stackediff) revParse(ctx context.Context, rev string) (string, error) {
+	return sd.gitcmd.Git(ctx, "rev-parse", rev)
+}
+
+// Undo reverts the last operation recorded in the journal. Pull requests
+//
+//	opened by the operation are closed, the pull request branches it force
+//	pushed are pushed back to their previous commits, or deleted when they
+//	were new, pull requests it closed are reopened and the base branch, title
+//	and body of the ones it updated are restored. Finally the local branch is
+//	reset to where it was before the operation. A merge can't be undone.
+func (sd *stackediff) Undo(ctx context.Context) (err error) {
+	sd.profiletimer.Step("Undo::Start")
+	defer sd.profiletimer.Step("Undo::End")
+	defer sd.startAudit("undo")(&err)
+
+	entries, err := sd.readJournal()
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		fmt.Fprintf(sd.output, "nothing to undo\n")
+		return nil
+	}
+	entry := entries[len(entries)-1]
+	if entry.Merged != nil {
+		return errs.New(errs.Validation, "the last spr %s merged pull request #%d, a merge can't be undone",
+			entry.Command, entry.Merged.Number)
+	}
+	if entry.HeadAfter != "" {
+		head, err := sd.revParse(ctx, "refs/heads/"+entry.Branch)
+		if err != nil || head != entry.HeadAfter {
+			return errs.New(errs.Conflict, "branch %s has changed since the last spr %s, it can't be undone",
+				entry.Branch, entry.Command)
+		}
+	}
+
+	for _, jpr := range entry.Created {
+		pr := jpr.pullRequest()
+		err = sd.github.CommentPullRequest(ctx, pr, "Closing pull request: spr undo")
+		if err != nil {
+			return err
+		}
+		err = sd.github.ClosePullRequest(ctx, pr)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(entry.RemoteBranches) > 0 {
+		// the lease fails the push when a branch was pushed again since
+		args := []string{"push", "--atomic"}
+		var refNames []string
+		for _, branch := range entry.RemoteBranches {
+			args = append(args, fmt.Sprintf("--force-with-lease=refs/heads/%s:%s", branch.Name, branch.After))
+			refNames = append(refNames, branch.Before+":refs/heads/"+branch.Name)
+		}
+		args = append(args, sd.config.Repo.GitHubRemote)
+		_, err = sd.gitcmd.Git(ctx, append(args, refNames...)...)
+		if err != nil {
+			return err
+		}
+		for _, branch := range entry.RemoteBranches {
+			sd.auditPushed(branch.Name, branch.Before)
+		}
+	}
+
+	for _, jpr := range append(entry.Closed, entry.PullRequests...) {
+		err = sd.github.RestorePullRequest(ctx, jpr.pullRequest())
+		if err != nil {
+			return err
+		}
+	}
+
+	if entry.HeadBefore != "" && entry.HeadBefore != entry.HeadAfter {
+		localBranch, err := git.GetLocalBranchName(ctx, sd.gitcmd)
+		if err != nil {
+			return err
+		}
+		if entry.Branch == localBranch {
+			_, err = sd.gitcmd.Git(ctx, "reset", "--keep", entry.HeadBefore)
+		} else {
+			_, err = sd.gitcmd.Git(ctx, "update-ref", "refs/heads/"+entry.Branch, entry.HeadBefore)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// an interrupted update which was undone isn't continued
+	cp, err := sd.readUpdateCheckpoint()
+	if err != nil {
+		return err
+	}
+	if cp != nil && cp.Time.Equal(entry.Time) {
+		err = os.Remove(sd.checkpointPath())
+		if err != nil {
+			return err
+		}
+	}
+	err = sd.writeJournal(entries[:len(entries)-1])
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(sd.output, "undid spr %s on %s from %s\n",
+		entry.Command, entry.Branch, entry.Time.Local().Format(time.DateTime))
+	return nil
+}
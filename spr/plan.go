@@ -0,0 +1,268 @@
+package spr
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ejoffe/spr/config"
+	"github.com/ejoffe/spr/git"
+	"github.com/ejoffe/spr/github"
+)
+
+// updatePlan holds all the changes 'spr update' is going to make.
+//
+//	The plan is computed up front from the local commit stack and the current
+//	state of the pull requests, without any side effects. This allows the plan
+//	to be previewed with --dry-run before anything is pushed to the remote.
+type updatePlan struct {
+	// closePullRequests are pull requests which will be closed because
+	//  their commit has gone away from the local stack
+	closePullRequests []*github.PullRequest
+
+	// pullRequests are the remaining open pull requests in the stack
+	pullRequests []*github.PullRequest
+
+	// reorder is true when commits have been reordered, in which case all
+	//  pull requests are first rebased onto the target branch
+	reorder bool
+
+	// pushCommits are the commits which are new or updated, a branch is
+	//  force pushed for each one of them
+	pushCommits []git.Commit
+
+	// updates is the list of pull request updates in stack order
+	updates []prUpdate
+
+	// reviewers are added to newly created pull requests
+	reviewers []string
+}
+
+// prUpdate is an update of a single pull request in the stack.
+//
+//	When pr is nil a new pull request is created for the commit.
+type prUpdate struct {
+	pr         *github.PullRequest
+	commit     git.Commit
+	prevCommit *git.Commit
+}
+
+// planUpdate computes the update plan of the local commits onto the pull requests
+func planUpdate(localCommits []git.Commit, pullRequests []*github.PullRequest,
+	reviewers []string, count *uint,
+) *updatePlan {
+	plan := &updatePlan{
+		reviewers: reviewers,
+	}
+
+	// close prs for deleted commits
+	localCommitMap := map[string]bool{}
+	for _, commit := range localCommits {
+		localCommitMap[commit.CommitID] = true
+	}
+	for _, pr := range pullRequests {
+		if !localCommitMap[pr.Commit.CommitID] {
+			plan.closePullRequests = append(plan.closePullRequests, pr)
+		} else {
+			plan.pullRequests = append(plan.pullRequests, pr)
+		}
+	}
+
+	plan.reorder = commitsReordered(localCommits, plan.pullRequests)
+
+	commitUpdated := func(c git.Commit) bool {
+		for _, pr := range plan.pullRequests {
+			if pr.Commit.CommitID == c.CommitID {
+				return pr.Commit.CommitHash != c.CommitHash
+			}
+		}
+		return true
+	}
+
+	for _, commit := range localCommits {
+		if commit.WIP {
+			break
+		}
+		if commitUpdated(commit) {
+			plan.pushCommits = append(plan.pushCommits, commit)
+		}
+	}
+
+	// iterate through local_commits and match pull_requests
+	var prevCommit *git.Commit
+	for commitIndex, c := range localCommits {
+		if c.WIP {
+			break
+		}
+		var prFound *github.PullRequest
+		for _, pr := range plan.pullRequests {
+			if c.CommitID == pr.Commit.CommitID {
+				prFound = pr
+				break
+			}
+		}
+		// if pull request is not found for this commit_id it means the commit
+		//  is new and a new pull request will be created
+		plan.updates = append(plan.updates, prUpdate{prFound, c, prevCommit})
+		prevCommit = &localCommits[commitIndex]
+
+		if count != nil && (commitIndex+1) == int(*count) {
+			break
+		}
+	}
+
+	return plan
+}
+
+// baseBranch returns the branch the pull request for this update is based on
+func (u prUpdate) baseBranch(cfg *config.Config) string {
+	if u.prevCommit == nil {
+		return cfg.Repo.GitHubBranch
+	}
+	return git.BranchNameFromCommit(cfg, *u.prevCommit)
+}
+
+// String returns a human readable description of the plan
+func (p *updatePlan) String(cfg *config.Config) string {
+	var b strings.Builder
+	for _, pr := range p.closePullRequests {
+		fmt.Fprintf(&b, "close     #%d : %s (commit has gone away)\n", pr.Number, pr.Title)
+	}
+	if p.reorder {
+		for _, pr := range p.pullRequests {
+			fmt.Fprintf(&b, "rebase    #%d : %s onto %s (commits reordered)\n",
+				pr.Number, pr.Title, cfg.Repo.GitHubBranch)
+		}
+	}
+	for _, c := range p.pushCommits {
+		fmt.Fprintf(&b, "push      %s : %s\n", git.BranchNameFromCommit(cfg, c), c.CommitHash)
+	}
+	for _, u := range p.updates {
+		base := u.baseBranch(cfg)
+		if u.pr == nil {
+			fmt.Fprintf(&b, "create    %s : %s -> %s\n",
+				u.commit.Subject, git.BranchNameFromCommit(cfg, u.commit), base)
+			if len(p.reviewers) != 0 {
+				fmt.Fprintf(&b, "reviewers %s : %s\n", u.commit.Subject, strings.Join(p.reviewers, ", "))
+			}
+		} else if u.pr.ToBranch != base {
+			fmt.Fprintf(&b, "rebase    #%d : %s from %s onto %s\n",
+				u.pr.Number, u.pr.Title, u.pr.ToBranch, base)
+		}
+	}
+	if b.Len() == 0 {
+		return "nothing to update\n"
+	}
+	return b.String()
+}
+
+// mergePlan holds all the changes 'spr merge' is going to make.
+type mergePlan struct {
+	// mergePullRequest is the top most mergeable pull request in the stack,
+	//  it is rebased onto the target branch and merged
+	mergePullRequest *github.PullRequest
+
+	// closePullRequests are the pull requests below the merged pull request,
+	//  their commits are merged as part of it so they are closed
+	closePullRequests []*github.PullRequest
+
+	// deleteBranches are the remote branches deleted after the merge
+	deleteBranches []string
+
+	// rejectedPullRequest is the first pull request in the stack which is
+	//  not mergeable, nil if all the pull requests (up to count) are mergeable
+	rejectedPullRequest *github.PullRequest
+
+	// rejectedReason is the reason rejectedPullRequest is not mergeable
+	rejectedReason string
+}
+
+// planMerge computes the merge plan for the given stack of pull requests
+func planMerge(cfg *config.Config, pullRequests []*github.PullRequest, count *uint) *mergePlan {
+	plan := &mergePlan{}
+
+	// Figure out top most pr in the stack that is mergeable
+	var prIndex int
+	for prIndex = 0; prIndex < len(pullRequests); prIndex++ {
+		pr := pullRequests[prIndex]
+		if !pr.Mergeable(cfg) {
+			plan.rejectedPullRequest = pr
+			plan.rejectedReason = blockerReasons(stackBlockers(cfg, pullRequests, prIndex))
+			prIndex--
+			break
+		}
+		if count != nil && (prIndex+1) == int(*count) {
+			break
+		}
+	}
+	if prIndex == len(pullRequests) {
+		prIndex--
+	}
+	if prIndex == -1 {
+		return plan
+	}
+
+	plan.mergePullRequest = pullRequests[prIndex]
+	plan.closePullRequests = pullRequests[:prIndex]
+	if cfg.User.DeleteMergedBranches {
+		plan.deleteBranches = append(plan.deleteBranches, plan.mergePullRequest.FromBranch)
+		for _, pr := range plan.closePullRequests {
+			plan.deleteBranches = append(plan.deleteBranches, pr.FromBranch)
+		}
+	}
+	return plan
+}
+
+// stackBlockers returns the merge blockers of the pull request at index in the stack.
+//
+//	The generic stack blocker is replaced with one naming the first pull
+//	request lower in the stack which is not ready to merge.
+func stackBlockers(cfg *config.Config, pullRequests []*github.PullRequest, index int) []github.MergeBlocker {
+	blockers := pullRequests[index].MergeBlockers(cfg)
+	for i, blocker := range blockers {
+		if blocker.Kind != github.MergeBlockerStack {
+			continue
+		}
+		for _, lower := range pullRequests[:index] {
+			if !lower.Ready(cfg) {
+				blockers[i].Reason = fmt.Sprintf("pull request #%d lower in the stack is not ready to merge",
+					lower.Number)
+				break
+			}
+		}
+	}
+	return blockers
+}
+
+// blockerReasons joins the reasons of the given blockers
+func blockerReasons(blockers []github.MergeBlocker) string {
+	if len(blockers) == 0 {
+		return "pull request is not mergeable"
+	}
+	reasons := make([]string, len(blockers))
+	for i, blocker := range blockers {
+		reasons[i] = blocker.Reason
+	}
+	return strings.Join(reasons, ", ")
+}
+
+// String returns a human readable description of the plan
+func (p *mergePlan) String(cfg *config.Config) string {
+	var b strings.Builder
+	if p.mergePullRequest != nil {
+		mergeMethod, _ := cfg.MergeMethod()
+		fmt.Fprintf(&b, "merge     #%d : %s (%s into %s)\n", p.mergePullRequest.Number,
+			p.mergePullRequest.Title, strings.ToLower(string(mergeMethod)), cfg.Repo.GitHubBranch)
+	}
+	for _, pr := range p.closePullRequests {
+		fmt.Fprintf(&b, "close     #%d : %s (commit merged in pull request #%d)\n",
+			pr.Number, pr.Title, p.mergePullRequest.Number)
+	}
+	for _, branch := range p.deleteBranches {
+		fmt.Fprintf(&b, "delete    %s\n", branch)
+	}
+	if p.rejectedPullRequest != nil {
+		fmt.Fprintf(&b, "stop at   #%d : %s (%s)\n",
+			p.rejectedPullRequest.Number, p.rejectedPullRequest.Title, p.rejectedReason)
+	}
+	return b.String()
+}
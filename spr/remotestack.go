@@ -0,0 +1,198 @@
+package spr
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ejoffe/spr/errs"
+	"github.com/ejoffe/spr/git"
+	"github.com/ejoffe/spr/github"
+)
+
+// readOnlyConfig is the git config variable, in the section of a local
+//
+//	branch, which marks the branch as a read-only checkout of pull requests.
+//	Deleting the branch deletes its config section along with it.
+const readOnlyConfig = "sprReadOnly"
+
+// AdoptStack creates a local branch holding the stack of pull requests the
+//
+//	given pull request belongs to, whichever user opened them. The commits
+//	are fetched from the top pull request branch so they keep the commit-ids
+//	the pull requests are matched by, and update and merge then operate on
+//	the existing pull requests. The new branch tracks the target branch and
+//	is checked out. When branch is empty it is named after the top pull request.
+func (sd *stackediff) AdoptStack(ctx context.Context, selector string, branch string) (err error) {
+	sd.profiletimer.Step("AdoptStack::Start")
+	defer sd.profiletimer.Step("AdoptStack::End")
+	defer sd.startAudit("adopt")(&err)
+
+	stack, err := sd.remoteStack(ctx, selector)
+	if err != nil {
+		return err
+	}
+	top := stack[len(stack)-1]
+	if branch == "" {
+		branch = fmt.Sprintf("stack-%d", top.Number)
+	}
+	err = sd.checkoutRemoteStack(ctx, stack, branch)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(sd.output, "adopted stack of %d pull requests by %s on branch %s\n",
+		len(stack), top.Author, branch)
+	sd.printRemoteStack(ctx, stack, branch)
+	return nil
+}
+
+// CheckoutStack creates a read-only local branch holding the given pull
+//
+//	request and the pull requests below it in its stack, to run the stack
+//	locally. The branch tracks the target branch and is checked out, update
+//	and merge refuse to run on it. When branch is empty it is named after the
+//	pull request.
+func (sd *stackediff) CheckoutStack(ctx context.Context, selector string, branch string) (err error) {
+	sd.profiletimer.Step("CheckoutStack::Start")
+	defer sd.profiletimer.Step("CheckoutStack::End")
+	defer sd.startAudit("checkout")(&err)
+
+	stack, err := sd.remoteStack(ctx, selector)
+	if err != nil {
+		return err
+	}
+	// walk down from the selected pull request, the ones above it are left out
+	number, _ := strconv.Atoi(strings.TrimPrefix(selector, "#"))
+	for i, pr := range stack {
+		if pr.Number == number {
+			stack = stack[:i+1]
+			break
+		}
+	}
+	if branch == "" {
+		branch = fmt.Sprintf("pr-%d", number)
+	}
+	err = sd.checkoutRemoteStack(ctx, stack, branch)
+	if err != nil {
+		return err
+	}
+	_, err = sd.gitcmd.Git(ctx, "config", fmt.Sprintf("branch.%s.%s", branch, readOnlyConfig), "true")
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(sd.output, "checked out %d pull requests by %s on read-only branch %s\n",
+		len(stack), stack[len(stack)-1].Author, branch)
+	sd.printRemoteStack(ctx, stack, branch)
+	return nil
+}
+
+// CheckWritable returns an error when the selected stack is on a branch
+//
+//	created by CheckoutStack, which must not update or merge pull requests.
+func (sd *stackediff) CheckWritable(ctx context.Context) error {
+	branch := sd.config.Stack
+	if branch == "" {
+		var err error
+		branch, err = git.GetLocalBranchName(ctx, sd.gitcmd)
+		if err != nil {
+			return err
+		}
+	}
+	output, err := sd.gitcmd.Git(ctx, "config", "--get", "--type=bool", fmt.Sprintf("branch.%s.%s", branch, readOnlyConfig))
+	// git config exits with 1 when the key isn't set
+	if code, ok := git.ExitCode(err); ok && code == 1 {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if output != "true" {
+		return nil
+	}
+	return errs.New(errs.Validation, "branch %s is a read-only checkout of pull requests\n"+
+		" use spr adopt to take over the stack and update or merge it", branch)
+}
+
+// remoteStack returns the open stack of pull requests into the target branch
+//
+//	which holds the selected pull request, ordered with the bottom first. The
+//	selector is a pull request number, optionally prefixed with '#'.
+func (sd *stackediff) remoteStack(ctx context.Context, selector string) ([]*github.PullRequest, error) {
+	number, err := strconv.Atoi(strings.TrimPrefix(selector, "#"))
+	if err != nil {
+		return nil, errs.New(errs.Validation, "invalid pull request %q, use a pull request number", selector)
+	}
+	pullRequests, err := sd.github.GetPullRequests(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, stack := range github.SplitStacks(pullRequests) {
+		for _, pr := range stack {
+			if pr.Number == number {
+				return stack, nil
+			}
+		}
+	}
+	return nil, errs.New(errs.NotFound, "pull request #%d is not an open spr pull request into %s",
+		number, sd.config.Repo.GitHubBranch)
+}
+
+// checkoutRemoteStack fetches the branch of the top pull request in stack
+//
+//	and checks it out as a new local branch tracking the target branch.
+func (sd *stackediff) checkoutRemoteStack(ctx context.Context, stack []*github.PullRequest, branch string) error {
+	exists, err := sd.localBranchExists(ctx, branch)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return errs.New(errs.Conflict, "branch %s already exists, pick another name with --branch", branch)
+	}
+
+	remote := sd.config.Repo.GitHubRemote
+	target := sd.config.Repo.GitHubBranch
+	top := stack[len(stack)-1].FromBranch
+	_, err = sd.gitcmd.Git(ctx, "fetch", remote,
+		fmt.Sprintf("+refs/heads/%s:refs/remotes/%s/%s", target, remote, target),
+		fmt.Sprintf("+refs/heads/%s:refs/remotes/%s/%s", top, remote, top))
+	if err != nil {
+		return err
+	}
+	_, err = sd.gitcmd.Git(ctx, "checkout", "--no-track", "-b", branch, remote+"/"+top)
+	if err != nil {
+		return fmt.Errorf("unable to check out branch %s : %w", branch, err)
+	}
+	_, err = sd.gitcmd.Git(ctx, "branch", "--set-upstream-to="+remote+"/"+target, branch)
+	return err
+}
+
+// printRemoteStack prints the pull requests of stack, top first, and warns
+//
+//	about the ones whose commit is missing from the checked out branch.
+func (sd *stackediff) printRemoteStack(ctx context.Context, stack []*github.PullRequest, branch string) {
+	for i := len(stack) - 1; i >= 0; i-- {
+		fmt.Fprintf(sd.output, "  %s\n", stack[i].TextString(sd.config))
+	}
+
+	commits, valid := git.GetBranchCommitStack(ctx, sd.config, sd.gitcmd, branch)
+	if !valid {
+		fmt.Fprintf(sd.output, "warning: the stack has commits without a commit-id, update will open new pull requests for them\n")
+		return
+	}
+	commitIDs := map[string]bool{}
+	for _, commit := range commits {
+		commitIDs[commit.CommitID] = true
+	}
+	top := stack[len(stack)-1]
+	for _, pr := range stack {
+		// a pull request without its commit on the branch is closed by the next update
+		commitID := pr.FromBranch[strings.LastIndex(pr.FromBranch, "/")+1:]
+		if !commitIDs[commitID] {
+			fmt.Fprintf(sd.output, "warning: pull request #%d is not part of the branch of #%d, check the stack before running update\n",
+				pr.Number, top.Number)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package spr
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ejoffe/spr/errs"
+	"github.com/ejoffe/spr/git"
+)
+
+// MoveCommit moves the commit matching selector right below the commit
+//
+//	matching target in the stack, or right above it when after is set.
+func (sd *stackediff) MoveCommit(ctx context.Context, selector string, target string, after bool) (err error) {
+	defer sd.startAudit("move")(&err)
+	localCommits, err := git.GetLocalCommitStack(ctx, sd.config, sd.gitcmd)
+	if err != nil {
+		return err
+	}
+	from, err := sd.selectCommit(ctx, localCommits, selector)
+	if err != nil {
+		return err
+	}
+	t, err := sd.selectCommit(ctx, localCommits, target)
+	if err != nil {
+		return err
+	}
+	if from == t {
+		return errs.New(errs.Validation, "can't move commit %s relative to itself", selector)
+	}
+
+	// the index of the target once the moved commit is taken out
+	to := t
+	if from < t {
+		to--
+	}
+	if after {
+		to++
+	}
+	where := "below"
+	if after {
+		where = "above"
+	}
+	if to == from {
+		fmt.Fprintf(sd.output, "%s is already %s %s\n", localCommits[from].Subject, where, localCommits[t].Subject)
+		return nil
+	}
+	err = sd.moveCommit(ctx, localCommits, from, to)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(sd.output, "moved %s %s %s\n", localCommits[from].Subject, where, localCommits[t].Subject)
+	return nil
+}
+
+// selectCommit returns the index of the commit matching selector in the
+//
+//	stack. A selector is a position in the stack starting at the bottom, a
+//	commit-id, a prefix of a commit hash or a pull request number after '#'.
+func (sd *stackediff) selectCommit(ctx context.Context, commits []git.Commit, selector string) (int, error) {
+	if strings.HasPrefix(selector, "#") {
+		number, err := strconv.Atoi(selector[1:])
+		if err != nil {
+			return 0, errs.New(errs.Validation, "invalid pull request number %q", selector)
+		}
+		info, err := sd.github.GetInfo(ctx, sd.gitcmd)
+		if err != nil {
+			return 0, err
+		}
+		for _, pr := range info.PullRequests {
+			if pr.Number != number {
+				continue
+			}
+			for i, c := range commits {
+				if c.CommitID == pr.Commit.CommitID {
+					return i, nil
+				}
+			}
+		}
+		return 0, errs.New(errs.NotFound, "pull request %s not found in the stack", selector)
+	}
+
+	if n, err := strconv.Atoi(selector); err == nil && n >= 1 && n <= len(commits) {
+		return n - 1, nil
+	}
+	found := -1
+	for i, c := range commits {
+		if c.CommitID == selector {
+			return i, nil
+		}
+		if len(selector) >= 4 && strings.HasPrefix(c.CommitHash, selector) {
+			if found != -1 {
+				return 0, errs.New(errs.Validation, "commit %s is ambiguous", selector)
+			}
+			found = i
+		}
+	}
+	if found == -1 {
+		return 0, errs.New(errs.NotFound, "commit %s not found in the stack", selector)
+	}
+	return found, nil
+}
+
+const reorderHelp = `
+# Reorder the stack by reordering the lines, the first line is the bottom
+# of the stack. Pull requests are rebased on the commits below them.
+#
+# Commands:
+# p, pick = keep the commit
+# f, fixup = fold the commit into the one above this line, keeping the
+#            message and pull request of that one
+# d, drop = remove the commit, its pull request is closed
+#
+# Removing a line drops its commit, removing every line leaves the stack
+# as it is.
+`
+
+// ReorderStack opens the stack in an editor, the way git rebase -i shows
+//
+//	its todo list, and rewrites the stack as it is left by the editor.
+func (sd *stackediff) ReorderStack(ctx context.Context) (err error) {
+	defer sd.startAudit("reorder")(&err)
+	localCommits, err := git.GetLocalCommitStack(ctx, sd.config, sd.gitcmd)
+	if err != nil {
+		return err
+	}
+	if len(localCommits) == 0 {
+		fmt.Fprintf(sd.output, "No commits to reorder\n")
+		return nil
+	}
+
+	var todo strings.Builder
+	for _, c := range localCommits {
+		fmt.Fprintf(&todo, "pick %s %s\n", c.CommitHash[:8], c.Subject)
+	}
+	todo.WriteString(reorderHelp)
+	todoPath := filepath.Join(sd.gitcmd.RootDir(), ".git", "SPR_REORDER")
+	err = os.WriteFile(todoPath, []byte(todo.String()), 0644)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(todoPath)
+
+	err = sd.editFile(todoPath)
+	if err != nil {
+		return err
+	}
+	edited, err := os.ReadFile(todoPath)
+	if err != nil {
+		return err
+	}
+	steps, err := parseReorderTodo(localCommits, string(edited))
+	if err != nil {
+		return err
+	}
+	if steps == nil {
+		fmt.Fprintf(sd.output, "Nothing to do, the stack is left as it is\n")
+		return nil
+	}
+	unchanged := len(steps) == len(localCommits)
+	for i := 0; unchanged && i < len(steps); i++ {
+		unchanged = steps[i].action == "pick" && steps[i].commit.CommitHash == localCommits[i].CommitHash
+	}
+	if unchanged {
+		fmt.Fprintf(sd.output, "Stack unchanged\n")
+		return nil
+	}
+	return sd.rewriteCommits(ctx, "reorder", localCommits, steps)
+}
+
+// parseReorderTodo returns the rebase steps of a reorder todo list. The
+//
+//	commits missing from the list are dropped, an empty list returns nil.
+func parseReorderTodo(commits []git.Commit, todo string) ([]rebaseStep, error) {
+	var steps []rebaseStep
+	listed := map[string]bool{}
+	picked := 0
+	for _, line := range strings.Split(todo, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) < 2 {
+			return nil, errs.New(errs.Validation, "invalid line %q, expected a command and a commit", line)
+		}
+		var action string
+		switch fields[0] {
+		case "p", "pick":
+			action = "pick"
+		case "f", "fixup":
+			action = "fixup"
+		case "d", "drop":
+			action = "drop"
+		default:
+			return nil, errs.New(errs.Validation, "unknown command %q in line %q", fields[0], line)
+		}
+		index := -1
+		for i, c := range commits {
+			if len(fields[1]) >= 4 && strings.HasPrefix(c.CommitHash, fields[1]) {
+				index = i
+				break
+			}
+		}
+		if index == -1 {
+			return nil, errs.New(errs.Validation, "commit %s is not in the stack", fields[1])
+		}
+		commit := commits[index]
+		if listed[commit.CommitHash] {
+			return nil, errs.New(errs.Validation, "commit %s is listed twice", fields[1])
+		}
+		listed[commit.CommitHash] = true
+		if action == "fixup" && picked == 0 {
+			return nil, errs.New(errs.Validation, "commit %s has no commit above it to be folded into", fields[1])
+		}
+		if action != "drop" {
+			picked++
+		}
+		steps = append(steps, rebaseStep{action: action, commit: commit})
+	}
+	if len(steps) == 0 {
+		return nil, nil
+	}
+	for _, c := range commits {
+		if !listed[c.CommitHash] {
+			steps = append(steps, rebaseStep{action: "drop", commit: c})
+		}
+	}
+	return steps, nil
+}
+
+// runEditor opens path in the editor git uses for commit messages, the
+//
+//	editor is attached to the terminal spr runs in.
+func runEditor(path string) error {
+	out, err := exec.Command("git", "var", "GIT_EDITOR").Output()
+	if err != nil {
+		return errs.New(errs.Validation, "no editor configured, set core.editor or EDITOR : %w", err)
+	}
+	editor := strings.TrimSpace(string(out))
+	cmd := exec.Command("sh", "-c", editor+` "$@"`, editor, path)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err = cmd.Run()
+	if err != nil {
+		return errs.New(errs.Validation, "editor %s failed : %w", editor, err)
+	}
+	return nil
+}
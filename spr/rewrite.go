@@ -0,0 +1,212 @@
+package spr
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ejoffe/spr/errs"
+	"github.com/ejoffe/spr/git"
+)
+
+// EditSequenceCommand is the hidden spr command git runs as the sequence
+//
+//	editor of the interactive rebases spr starts. It replaces the todo list
+//	git wrote with the one spr prepared: spr _edit-sequence <todo> <git-todo>
+const EditSequenceCommand = "_edit-sequence"
+
+// EditSequence runs the sequence editor command with the arguments which
+//
+//	follow it, the todo list prepared by spr and the one git asks to edit.
+func EditSequence(args []string) error {
+	if len(args) != 2 {
+		return errs.New(errs.Validation, "usage: spr %s <todo> <git-todo>", EditSequenceCommand)
+	}
+	todo, err := os.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(args[1], todo, 0644)
+}
+
+// rebaseStep is a line of the todo list of an interactive rebase
+type rebaseStep struct {
+	// action is pick, fixup, drop, edit or exec
+	action string
+	commit git.Commit
+
+	// command is the shell command run by an exec step
+	command string
+}
+
+func (s rebaseStep) String() string {
+	if s.action == "exec" {
+		return "exec " + s.command
+	}
+	return fmt.Sprintf("%s %s %s", s.action, s.commit.CommitHash, s.commit.Subject)
+}
+
+// pickSteps returns the steps which keep the commits as they are
+func pickSteps(commits []git.Commit) []rebaseStep {
+	steps := make([]rebaseStep, 0, len(commits))
+	for _, c := range commits {
+		steps = append(steps, rebaseStep{action: "pick", commit: c})
+	}
+	return steps
+}
+
+func (sd *stackediff) rebaseTodoPath() string {
+	return filepath.Join(sd.gitcmd.RootDir(), ".git", "spr_rebase_todo")
+}
+
+// rewriteStack rebases the stack onto the target branch following steps,
+//
+//	bottom of the stack first, instead of the todo list git would write.
+func (sd *stackediff) rewriteStack(ctx context.Context, steps []rebaseStep) error {
+	var todo strings.Builder
+	for _, step := range steps {
+		fmt.Fprintln(&todo, step)
+	}
+	todoPath := sd.rebaseTodoPath()
+	err := os.WriteFile(todoPath, []byte(todo.String()), 0644)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(todoPath)
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	editorCmd := strings.Join([]string{shellQuote(exe), EditSequenceCommand, shellQuote(todoPath)}, " ")
+	_, err = sd.gitcmd.GitWithEditor(ctx, editorCmd, "rebase", "-i", "--autostash",
+		sd.config.Repo.GitHubRemote+"/"+sd.config.Repo.GitHubBranch)
+	if errs.KindOf(err) == errs.Conflict {
+		return errs.New(errs.Conflict, "the rebase stopped on a conflict, resolve it and run "+
+			"git rebase --continue, or git rebase --abort to give up : %w", err)
+	}
+	return err
+}
+
+// shellQuote quotes s as a single word for the shell git runs editors with
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// rewriteCommits rewrites the stack following steps and records the
+//
+//	rewrite in the journal, so spr undo resets the branch to commits and
+//	the next update closes the pull requests of the commits it removed.
+func (sd *stackediff) rewriteCommits(ctx context.Context, command string,
+	commits []git.Commit, steps []rebaseStep,
+) error {
+	var removed []string
+	for _, step := range steps {
+		if (step.action == "drop" || step.action == "fixup") && step.commit.CommitID != "" {
+			removed = append(removed, step.commit.CommitID)
+		}
+	}
+	err := sd.rewriteStack(ctx, steps)
+	if err != nil {
+		return err
+	}
+	branch, err := git.GetLocalBranchName(ctx, sd.gitcmd)
+	if err != nil {
+		return err
+	}
+	head, err := sd.revParse(ctx, "HEAD")
+	if err != nil {
+		return err
+	}
+	return sd.recordJournalEntry(&journalEntry{
+		Command:    command,
+		Time:       time.Now(),
+		Branch:     branch,
+		HeadBefore: commits[len(commits)-1].CommitHash,
+		HeadAfter:  head,
+		Removed:    removed,
+	})
+}
+
+// moveCommit moves the commit at index from in the stack to index to,
+//
+//	the commits in between shift by one. Indexes start at the bottom.
+func (sd *stackediff) moveCommit(ctx context.Context, commits []git.Commit, from int, to int) (err error) {
+	defer sd.startAudit("move")(&err)
+	if from < 0 || from >= len(commits) || to < 0 || to >= len(commits) {
+		return errs.New(errs.Validation, "commit position out of range 1-%d", len(commits))
+	}
+	if from == to {
+		return nil
+	}
+	moved := make([]git.Commit, 0, len(commits))
+	for i, c := range commits {
+		if i != from {
+			moved = append(moved, c)
+		}
+	}
+	moved = append(moved[:to], append([]git.Commit{commits[from]}, moved[to:]...)...)
+	return sd.rewriteCommits(ctx, "move", commits, pickSteps(moved))
+}
+
+// squashCommit folds the commit at index into the commit below it. The
+//
+//	lower commit keeps its message and commit-id, so its pull request is
+//	updated and the one of the folded commit is closed by the next update.
+func (sd *stackediff) squashCommit(ctx context.Context, commits []git.Commit, index int) (err error) {
+	defer sd.startAudit("squash")(&err)
+	if index == 0 {
+		return errs.New(errs.Validation, "the bottom commit of the stack has no commit to squash into")
+	}
+	steps := pickSteps(commits)
+	steps[index].action = "fixup"
+	return sd.rewriteCommits(ctx, "squash", commits, steps)
+}
+
+// dropCommit removes the commit at index from the stack, its pull request
+//
+//	is closed by the next update.
+func (sd *stackediff) dropCommit(ctx context.Context, commits []git.Commit, index int) (err error) {
+	defer sd.startAudit("drop")(&err)
+	steps := pickSteps(commits)
+	steps[index].action = "drop"
+	return sd.rewriteCommits(ctx, "drop", commits, steps)
+}
+
+// wipPrefix matches the WIP marker at the start of a commit subject
+var wipPrefix = regexp.MustCompile(`^WIP:?\s*`)
+
+// toggleWIP marks the commit at index as work in progress by prefixing its
+//
+//	subject with WIP, or removes the prefix from a commit which has it.
+func (sd *stackediff) toggleWIP(ctx context.Context, commits []git.Commit, index int) (err error) {
+	defer sd.startAudit("wip")(&err)
+	commit := commits[index]
+	message, err := sd.gitcmd.Git(ctx, "log", "--format=%B", "-n", "1", commit.CommitHash)
+	if err != nil {
+		return err
+	}
+	if commit.WIP {
+		message = wipPrefix.ReplaceAllString(message, "")
+	} else {
+		message = "WIP " + message
+	}
+	messagePath := filepath.Join(sd.gitcmd.RootDir(), ".git", "spr_commit_message")
+	err = os.WriteFile(messagePath, []byte(message+"\n"), 0644)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(messagePath)
+
+	steps := pickSteps(commits[:index+1])
+	steps = append(steps, rebaseStep{
+		action:  "exec",
+		command: "git commit --amend --quiet -F " + shellQuote(messagePath),
+	})
+	steps = append(steps, pickSteps(commits[index+1:])...)
+	return sd.rewriteCommits(ctx, "wip", commits, steps)
+}
@@ -0,0 +1,320 @@
+package spr
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ejoffe/spr/errs"
+	"github.com/ejoffe/spr/git"
+	"github.com/google/uuid"
+)
+
+// splitState is the state of a split session, saved in .git/spr_split_state
+//
+//	while the rebase is stopped at the commit being split.
+type splitState struct {
+	CommitID   string
+	CommitHash string
+	Subject    string
+
+	// Branch is the branch of the stack and Head its top commit before the
+	//  split, undo resets the branch to it.
+	Branch string
+	Head   string
+
+	// Pieces is the number of new commits split off so far
+	Pieces int
+}
+
+func (sd *stackediff) splitStatePath() string {
+	return filepath.Join(sd.gitcmd.RootDir(), ".git", "spr_split_state")
+}
+
+func (sd *stackediff) isSplitting() bool {
+	_, err := os.Stat(sd.splitStatePath())
+	return err == nil
+}
+
+func (sd *stackediff) writeSplitState(state *splitState) error {
+	content := fmt.Sprintf("commit_id=%s\ncommit_hash=%s\ncommit_subject=%s\nbranch=%s\nhead=%s\npieces=%d\n",
+		state.CommitID, state.CommitHash, state.Subject, state.Branch, state.Head, state.Pieces)
+	return os.WriteFile(sd.splitStatePath(), []byte(content), 0644)
+}
+
+func (sd *stackediff) readSplitState() (*splitState, error) {
+	f, err := os.Open(sd.splitStatePath())
+	if os.IsNotExist(err) {
+		return nil, errs.New(errs.Validation, "no split session in progress, start one with 'git spr split <commit>'")
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	state := &splitState{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, _ := strings.Cut(scanner.Text(), "=")
+		switch key {
+		case "commit_id":
+			state.CommitID = value
+		case "commit_hash":
+			state.CommitHash = value
+		case "commit_subject":
+			state.Subject = value
+		case "branch":
+			state.Branch = value
+		case "head":
+			state.Head = value
+		case "pieces":
+			state.Pieces, err = strconv.Atoi(value)
+			if err != nil {
+				return nil, errs.New(errs.Validation, "invalid split state %s : %w", sd.splitStatePath(), err)
+			}
+		}
+	}
+	return state, scanner.Err()
+}
+
+// SplitCommit splits the commit matching selector into several commits.
+//
+//	Each of pieces is a space separated list of path globs, the changes to
+//	the matching files are committed as a new commit below the commit, and
+//	the changes left keep its message and pull request. Without pieces a
+//	split session is started instead, in which the changes are committed
+//	piece by piece with SplitCommitPiece and the session ends with SplitDone.
+func (sd *stackediff) SplitCommit(ctx context.Context, selector string, pieces []string) (err error) {
+	defer sd.startAudit("split")(&err)
+	localCommits, err := git.GetLocalCommitStack(ctx, sd.config, sd.gitcmd)
+	if err != nil {
+		return err
+	}
+	index, err := sd.selectCommit(ctx, localCommits, selector)
+	if err != nil {
+		return err
+	}
+	if len(pieces) == 0 {
+		return sd.splitCommit(ctx, localCommits, index)
+	}
+
+	output := sd.output
+	sd.output = &strings.Builder{}
+	err = sd.splitCommit(ctx, localCommits, index)
+	for i := 0; err == nil && i < len(pieces); i++ {
+		err = sd.SplitCommitPiece(ctx, "", strings.Fields(pieces[i]))
+	}
+	sd.output = output
+	if err != nil {
+		if sd.isSplitting() {
+			sd.SplitAbort(ctx)
+		}
+		return err
+	}
+	return sd.SplitDone(ctx, false)
+}
+
+// splitCommit starts a split session on the commit at index in the stack,
+//
+//	the rebase stops at it and its changes are left uncommitted.
+func (sd *stackediff) splitCommit(ctx context.Context, localCommits []git.Commit, index int) error {
+	if sd.isEditing() || sd.isSplitting() {
+		return errs.New(errs.Conflict, "already editing a commit\n"+
+			" finish the edit or split session in progress first")
+	}
+	branch, err := git.GetLocalBranchName(ctx, sd.gitcmd)
+	if err != nil {
+		return err
+	}
+	commit := localCommits[index]
+	err = sd.writeSplitState(&splitState{
+		CommitID:   commit.CommitID,
+		CommitHash: commit.CommitHash,
+		Subject:    commit.Subject,
+		Branch:     branch,
+		Head:       localCommits[len(localCommits)-1].CommitHash,
+	})
+	if err != nil {
+		return err
+	}
+
+	steps := pickSteps(localCommits)
+	steps[index].action = "edit"
+	err = sd.rewriteStack(ctx, steps)
+	if err == nil {
+		_, err = sd.gitcmd.Git(ctx, "reset", "--quiet", "HEAD~")
+	}
+	if err != nil {
+		os.Remove(sd.splitStatePath())
+		return fmt.Errorf("failed to start split session: %w", err)
+	}
+
+	fmt.Fprintf(sd.output, "\nSplitting commit %d: %s\n", index+1, commit.Subject)
+	fmt.Fprintf(sd.output, "Its changes are uncommitted, for each new commit stage some of them with git add -p\n")
+	fmt.Fprintf(sd.output, " and run: git spr split --commit -m <subject>, or pick files with: git spr split --commit <glob>...\n")
+	fmt.Fprintf(sd.output, "The changes left keep the commit and its pull request, run: git spr split --done\n")
+	fmt.Fprintf(sd.output, "To cancel, run: git spr split --abort\n")
+	return nil
+}
+
+// SplitCommitPiece commits a piece of the commit being split as a new
+//
+//	commit with a new commit-id. The files matching globs are staged first,
+//	without globs the changes already staged are committed. The subject
+//	defaults to the one of the commit being split.
+func (sd *stackediff) SplitCommitPiece(ctx context.Context, subject string, globs []string) (err error) {
+	defer sd.startAudit("split")(&err)
+	state, err := sd.readSplitState()
+	if err != nil {
+		return err
+	}
+
+	if len(globs) != 0 {
+		args := []string{"add", "--all", "--"}
+		for _, glob := range globs {
+			args = append(args, ":(glob)"+glob)
+		}
+		_, err = sd.gitcmd.Git(ctx, args...)
+		if err != nil {
+			return errs.New(errs.Validation, "unable to stage %s : %w", strings.Join(globs, " "), err)
+		}
+	}
+	staged, err := sd.hasStagedChanges(ctx)
+	if err != nil {
+		return err
+	}
+	if !staged {
+		return errs.New(errs.Validation, "no staged changes, stage the changes of the new commit with git add")
+	}
+
+	if subject == "" {
+		subject = state.Subject
+		if len(globs) != 0 {
+			subject += " (" + strings.Join(globs, " ") + ")"
+		} else {
+			subject += fmt.Sprintf(" (part %d)", state.Pieces+1)
+		}
+	}
+	commitID := uuid.New().String()[:8]
+	_, err = sd.gitcmd.Git(ctx, "commit", "--quiet", "-m", subject, "-m", "commit-id:"+commitID)
+	if err != nil {
+		return err
+	}
+	state.Pieces++
+	err = sd.writeSplitState(state)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(sd.output, "Committed %s with commit-id %s\n", subject, commitID)
+	return nil
+}
+
+// SplitDone commits the changes left as the commit being split, keeping its
+//
+//	message and commit-id, and continues the rebase to restore the stack.
+func (sd *stackediff) SplitDone(ctx context.Context, update bool) (err error) {
+	defer sd.startAudit("split")(&err)
+	state, err := sd.readSplitState()
+	if err != nil {
+		return err
+	}
+	if state.Pieces == 0 {
+		return errs.New(errs.Validation, "no piece has been split off yet\n"+
+			" commit one with 'git spr split --commit' or cancel with 'git spr split --abort'")
+	}
+
+	_, err = sd.gitcmd.Git(ctx, "add", "--all")
+	if err != nil {
+		return err
+	}
+	staged, err := sd.hasStagedChanges(ctx)
+	if err != nil {
+		return err
+	}
+	if !staged {
+		return errs.New(errs.Validation, "no changes are left for %s, which keeps the pull request\n"+
+			" cancel with 'git spr split --abort' to split it differently", state.Subject)
+	}
+	_, err = sd.gitcmd.Git(ctx, "commit", "--quiet", "-C", state.CommitHash)
+	if err != nil {
+		return err
+	}
+
+	entry := &journalEntry{
+		Command:    "split",
+		Time:       time.Now(),
+		Branch:     state.Branch,
+		HeadBefore: state.Head,
+	}
+	_, err = sd.gitcmd.Git(ctx, "rebase", "--continue")
+	if err != nil {
+		// the pieces are committed and a conflict above them is resolved
+		//  with git, the entry without a head after lets undo restore the
+		//  stack once the rebase is done
+		jerr := sd.recordJournalEntry(entry)
+		if jerr != nil {
+			return jerr
+		}
+		os.Remove(sd.splitStatePath())
+		return errs.New(errs.Conflict, "the rebase stopped on a conflict, resolve it and run "+
+			"git rebase --continue, or restore the stack with git rebase --abort : %w", err)
+	}
+
+	os.Remove(sd.splitStatePath())
+	entry.HeadAfter, err = sd.revParse(ctx, "HEAD")
+	if err != nil {
+		return err
+	}
+	err = sd.recordJournalEntry(entry)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(sd.output, "Split %s into %d commits.\n", state.Subject, state.Pieces+1)
+
+	if update {
+		return sd.UpdatePullRequests(ctx, nil, nil)
+	}
+	return nil
+}
+
+// hasStagedChanges returns true when changes are staged to be committed
+func (sd *stackediff) hasStagedChanges(ctx context.Context) (bool, error) {
+	// diff --quiet exits with 1 when there are staged changes
+	_, err := sd.gitcmd.Git(ctx, "diff", "--cached", "--quiet")
+	if code, ok := git.ExitCode(err); ok && code == 1 {
+		return true, nil
+	}
+	return false, err
+}
+
+// SplitAbort aborts the split session and restores the original stack.
+func (sd *stackediff) SplitAbort(ctx context.Context) error {
+	if !sd.isSplitting() {
+		fmt.Fprintf(sd.output, "No split session in progress.\n")
+		return nil
+	}
+	state, err := sd.readSplitState()
+	if err != nil {
+		return err
+	}
+
+	// the files the commit adds are untracked since it was reset, they
+	//  would stop the rebase from checking out the stack again
+	_, err = sd.gitcmd.Git(ctx, "reset", "--quiet", "--hard", state.CommitHash)
+	if err != nil {
+		return fmt.Errorf("failed to abort: %w", err)
+	}
+	_, err = sd.gitcmd.Git(ctx, "rebase", "--abort")
+	if err != nil {
+		return fmt.Errorf("failed to abort: %w", err)
+	}
+
+	os.Remove(sd.splitStatePath())
+	fmt.Fprintf(sd.output, "Split session aborted.\n")
+	return nil
+}
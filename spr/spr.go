@@ -3,36 +3,42 @@ package spr
 import (
 	"bufio"
 	"context"
-	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"os/signal"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
-	"sync"
 	"syscall"
+	"time"
 
 	"github.com/ejoffe/profiletimer"
 	"github.com/ejoffe/rake"
 	"github.com/ejoffe/spr/config"
 	"github.com/ejoffe/spr/config/config_parser"
+	"github.com/ejoffe/spr/errs"
 	"github.com/ejoffe/spr/git"
 	"github.com/ejoffe/spr/github"
 )
 
 // NewStackedPR constructs and returns a new stackediff instance.
 func NewStackedPR(config *config.Config, github github.GitHubInterface, gitcmd git.GitInterface) *stackediff {
+	audit := &auditLog{}
 	return &stackediff{
-		config:       config,
-		github:       github,
-		gitcmd:       gitcmd,
-		profiletimer: profiletimer.StartNoopTimer(),
-
-		output: os.Stdout,
-		input:  os.Stdin,
+		config:        config,
+		github:        &auditGitHub{GitHubInterface: github, log: audit},
+		gitcmd:        &auditGit{GitInterface: gitcmd, log: audit},
+		audit:         audit,
+		profiletimer:  profiletimer.StartNoopTimer(),
+		defaultTarget: config.Repo.GitHubBranch,
+
+		output:   os.Stdout,
+		notices:  os.Stderr,
+		input:    os.Stdin,
+		editFile: runEditor,
 	}
 }
 
@@ -43,20 +49,38 @@ type stackediff struct {
 	profiletimer  profiletimer.Timer
 	DetailEnabled bool
 	TextEnabled   bool
+	OutputFormat  string // When set status is printed in a machine readable format (json or yaml)
+	DryRun        bool   // When true the planned changes are printed instead of applied
+	AllStacks     bool   // When true stacks without a local branch, opened by any user, are listed too
+
+	// defaultTarget is the configured target branch, used for stacks
+	//  which don't track an upstream branch
+	defaultTarget string
+
+	// audit records the running operation in the audit log
+	audit *auditLog
 
 	output       io.Writer
+	notices      io.Writer // informs about choices spr made, kept out of output
 	input        io.Reader
 	synchronized bool // When true code is executed without goroutines. Allows test to be deterministic
+
+	// editFile opens a file in the user's editor and waits for it to close
+	editFile func(path string) error
 }
 
 // AmendCommit enables one to easily amend a commit in the middle of a stack
 //
 //	of commits. A list of commits is printed and one can be chosen to be amended.
-func (sd *stackediff) AmendCommit(ctx context.Context) {
-	localCommits := git.GetLocalCommitStack(sd.config, sd.gitcmd)
+func (sd *stackediff) AmendCommit(ctx context.Context) (err error) {
+	defer sd.startAudit("amend")(&err)
+	localCommits, err := git.GetLocalCommitStack(ctx, sd.config, sd.gitcmd)
+	if err != nil {
+		return err
+	}
 	if len(localCommits) == 0 {
 		fmt.Fprintf(sd.output, "No commits to amend\n")
-		return
+		return nil
 	}
 
 	for i := len(localCommits) - 1; i >= 0; i-- {
@@ -75,16 +99,40 @@ func (sd *stackediff) AmendCommit(ctx context.Context) {
 	line = strings.TrimSpace(line)
 	commitIndex, err := strconv.Atoi(line)
 	if err != nil || commitIndex < 1 || commitIndex > len(localCommits) {
-		fmt.Fprint(sd.output, "Invalid input\n")
-		return
+		return errs.New(errs.Validation, "invalid input %q", line)
+	}
+	return sd.amendCommit(ctx, localCommits, commitIndex-1)
+}
+
+// amendCommit folds the staged changes into the commit at index in the stack
+func (sd *stackediff) amendCommit(ctx context.Context, localCommits []git.Commit, index int) (err error) {
+	defer sd.startAudit("amend")(&err)
+	_, err = sd.gitcmd.Git(ctx, "commit", "--fixup", localCommits[index].CommitHash)
+	if err != nil {
+		return err
 	}
-	commitIndex = commitIndex - 1
-	check(err)
-	sd.gitcmd.MustGit("commit --fixup "+localCommits[commitIndex].CommitHash, nil)
 
-	rebaseCmd := fmt.Sprintf("rebase -i --autosquash --autostash %s/%s",
-		sd.config.Repo.GitHubRemote, sd.config.Repo.GitHubBranch)
-	sd.gitcmd.MustGit(rebaseCmd, nil)
+	_, err = sd.gitcmd.Git(ctx, "rebase", "-i", "--autosquash", "--autostash",
+		sd.config.Repo.GitHubRemote+"/"+sd.config.Repo.GitHubBranch)
+	if err != nil {
+		return err
+	}
+
+	branch, err := git.GetLocalBranchName(ctx, sd.gitcmd)
+	if err != nil {
+		return err
+	}
+	head, err := sd.revParse(ctx, "HEAD")
+	if err != nil {
+		return err
+	}
+	return sd.recordJournalEntry(&journalEntry{
+		Command:    "amend",
+		Time:       time.Now(),
+		Branch:     branch,
+		HeadBefore: localCommits[len(localCommits)-1].CommitHash,
+		HeadAfter:  head,
+	})
 }
 
 func (sd *stackediff) editStatePath() string {
@@ -101,17 +149,19 @@ func (sd *stackediff) isEditing() bool {
 //	The user picks a commit, and the tool starts a rebase with an edit stop
 //	at that commit. The user can then edit files and run `git spr edit --done`
 //	to amend and restore the stack.
-func (sd *stackediff) EditCommit(ctx context.Context) {
+func (sd *stackediff) EditCommit(ctx context.Context) error {
 	if sd.isEditing() {
-		fmt.Fprintf(sd.output, "Already editing a commit.\n")
-		fmt.Fprintf(sd.output, "Run 'git spr edit --done' to finish or 'git spr edit --abort' to cancel.\n")
-		return
+		return errs.New(errs.Conflict, "already editing a commit\n"+
+			" run 'git spr edit --done' to finish or 'git spr edit --abort' to cancel")
 	}
 
-	localCommits := git.GetLocalCommitStack(sd.config, sd.gitcmd)
+	localCommits, err := git.GetLocalCommitStack(ctx, sd.config, sd.gitcmd)
+	if err != nil {
+		return err
+	}
 	if len(localCommits) == 0 {
 		fmt.Fprintf(sd.output, "No commits to edit\n")
-		return
+		return nil
 	}
 
 	for i := len(localCommits) - 1; i >= 0; i-- {
@@ -130,51 +180,54 @@ func (sd *stackediff) EditCommit(ctx context.Context) {
 	line = strings.TrimSpace(line)
 	commitIndex, err := strconv.Atoi(line)
 	if err != nil || commitIndex < 1 || commitIndex > len(localCommits) {
-		fmt.Fprint(sd.output, "Invalid input\n")
-		return
+		return errs.New(errs.Validation, "invalid input %q", line)
 	}
-	commitIndex = commitIndex - 1
+	return sd.editCommit(ctx, localCommits, commitIndex-1)
+}
 
-	targetCommit := localCommits[commitIndex]
+// editCommit starts an edit session on the commit at index in the stack
+func (sd *stackediff) editCommit(ctx context.Context, localCommits []git.Commit, index int) error {
+	targetCommit := localCommits[index]
 
 	// Write state file so --done knows we're in an edit session
 	stateContent := fmt.Sprintf("commit_id=%s\ncommit_subject=%s\n", targetCommit.CommitID, targetCommit.Subject)
-	err = os.WriteFile(sd.editStatePath(), []byte(stateContent), 0644)
-	check(err)
-
-	// Use the spr binary itself as the sequence editor to rewrite 'pick' to 'edit'
-	// for the target commit. Git invokes the editor as: <editor> <todo-file>
-	exe, err := os.Executable()
-	check(err)
-	editorCmd := fmt.Sprintf("%s _edit-sequence %s", exe, targetCommit.CommitHash[:7])
+	err := os.WriteFile(sd.editStatePath(), []byte(stateContent), 0644)
+	if err != nil {
+		return err
+	}
 
-	rebaseCmd := fmt.Sprintf("rebase -i --autostash %s/%s",
-		sd.config.Repo.GitHubRemote, sd.config.Repo.GitHubBranch)
-	err = sd.gitcmd.GitWithEditor(rebaseCmd, nil, editorCmd)
+	// The rebase stops at the target commit
+	steps := pickSteps(localCommits)
+	steps[index].action = "edit"
+	err = sd.rewriteStack(ctx, steps)
 	if err != nil {
 		// Clean up state file on failure
 		os.Remove(sd.editStatePath())
-		fmt.Fprintf(sd.output, "Failed to start edit session: %s\n", err)
-		return
+		return fmt.Errorf("failed to start edit session: %w", err)
 	}
 
-	fmt.Fprintf(sd.output, "\nEditing commit %d: %s\n", commitIndex+1, targetCommit.Subject)
+	fmt.Fprintf(sd.output, "\nEditing commit %d: %s\n", index+1, targetCommit.Subject)
 	fmt.Fprintf(sd.output, "Make your changes, then run: git spr edit --done\n")
 	fmt.Fprintf(sd.output, "To cancel, run: git spr edit --abort\n")
+	return nil
 }
 
 // EditCommitDone finishes an edit session by amending the current commit
 //
 //	and continuing the rebase to restore the full stack.
-func (sd *stackediff) EditCommitDone(ctx context.Context, update bool) {
+func (sd *stackediff) EditCommitDone(ctx context.Context, update bool) (err error) {
+	defer sd.startAudit("edit")(&err)
 	if !sd.isEditing() {
 		fmt.Fprintf(sd.output, "No edit session in progress.\n")
-		return
+		return nil
 	}
 
 	// Stage modifications and deletions to tracked files only.
 	// Using -u instead of -A avoids accidentally staging untracked files.
-	sd.gitcmd.MustGit("add -u", nil)
+	_, err = sd.gitcmd.Git(ctx, "add", "-u")
+	if err != nil {
+		return err
+	}
 
 	// Check if we're resolving a rebase conflict or at the initial edit stop.
 	// Git creates .git/REBASE_HEAD when a rebase stops due to a conflict,
@@ -189,26 +242,22 @@ func (sd *stackediff) EditCommitDone(ctx context.Context, update bool) {
 		// create the proper commit from the staged conflict resolution.
 		// Do NOT amend here, as that would squash this commit's changes
 		// into the previous commit.
-		err := sd.gitcmd.Git("rebase --continue", nil)
+		_, err := sd.gitcmd.Git(ctx, "rebase", "--continue")
 		if err != nil {
-			fmt.Fprintf(sd.output, "Rebase conflict detected. Resolve conflicts and run 'git spr edit --done' again.\n")
-			return
+			return errRebaseConflict
 		}
 	} else {
 		// We're at the initial edit stop. Amend the target commit with
 		// the user's changes, then continue the rebase to replay the
 		// remaining commits on top.
-		err := sd.gitcmd.Git("commit --amend --no-edit", nil)
+		_, err := sd.gitcmd.Git(ctx, "commit", "--amend", "--no-edit")
 		if err != nil {
-			fmt.Fprintf(sd.output, "Failed to amend commit: %s\n", err)
-			fmt.Fprintf(sd.output, "Resolve any issues and try again.\n")
-			return
+			return fmt.Errorf("failed to amend commit, resolve any issues and try again: %w", err)
 		}
 
-		err = sd.gitcmd.Git("rebase --continue", nil)
+		_, err = sd.gitcmd.Git(ctx, "rebase", "--continue")
 		if err != nil {
-			fmt.Fprintf(sd.output, "Rebase conflict detected. Resolve conflicts and run 'git spr edit --done' again.\n")
-			return
+			return errRebaseConflict
 		}
 	}
 
@@ -217,30 +266,37 @@ func (sd *stackediff) EditCommitDone(ctx context.Context, update bool) {
 	fmt.Fprintf(sd.output, "Stack restored successfully.\n")
 
 	if update {
-		sd.UpdatePullRequests(ctx, nil, nil)
+		return sd.UpdatePullRequests(ctx, nil, nil)
 	}
+	return nil
 }
 
+// errRebaseConflict is returned when the rebase of an edit session stops on
+//
+//	a conflict, the session stays open until it is resolved.
+var errRebaseConflict = errs.New(errs.Conflict,
+	"rebase conflict detected, resolve conflicts and run 'git spr edit --done' again")
+
 // EditCommitAbort aborts the current edit session and restores the original stack.
-func (sd *stackediff) EditCommitAbort(ctx context.Context) {
+func (sd *stackediff) EditCommitAbort(ctx context.Context) error {
 	if !sd.isEditing() {
 		fmt.Fprintf(sd.output, "No edit session in progress.\n")
-		return
+		return nil
 	}
 
-	err := sd.gitcmd.Git("rebase --abort", nil)
+	_, err := sd.gitcmd.Git(ctx, "rebase", "--abort")
 	if err != nil {
-		fmt.Fprintf(sd.output, "Failed to abort: %s\n", err)
-		return
+		return fmt.Errorf("failed to abort: %w", err)
 	}
 
 	os.Remove(sd.editStatePath())
 	fmt.Fprintf(sd.output, "Edit session aborted.\n")
+	return nil
 }
 
 func (sd *stackediff) addReviewers(ctx context.Context,
 	pr *github.PullRequest, reviewers []string, assignable []github.RepoAssignee,
-) {
+) error {
 	userIDs := make([]string, 0, len(reviewers))
 	for _, r := range reviewers {
 		found := false
@@ -252,10 +308,10 @@ func (sd *stackediff) addReviewers(ctx context.Context,
 			}
 		}
 		if !found {
-			check(fmt.Errorf("unable to add reviewer, user %q not found", r))
+			return errs.New(errs.NotFound, "unable to add reviewer, user %q not found", r)
 		}
 	}
-	sd.github.AddReviewers(ctx, pr, userIDs)
+	return sd.github.AddReviewers(ctx, pr, userIDs)
 }
 
 func alignLocalCommits(commits []git.Commit, prs []*github.PullRequest) []git.Commit {
@@ -286,134 +342,89 @@ func alignLocalCommits(commits []git.Commit, prs []*github.PullRequest) []git.Co
 //	 pull request if a commit has been amended.
 //	In the case where commits are reordered, the corresponding pull requests
 //	 will also be reordered to match the commit stack order.
-func (sd *stackediff) UpdatePullRequests(ctx context.Context, reviewers []string, count *uint) {
-	sd.profiletimer.Step("UpdatePullRequests::Start")
-	reviewers = append(sd.config.Repo.DefaultReviewers, reviewers...)
-	githubInfo := sd.fetchAndGetGitHubInfo(ctx)
-	if githubInfo == nil {
-		return
+func (sd *stackediff) UpdatePullRequests(ctx context.Context, reviewers []string, count *uint) (err error) {
+	defer sd.startAudit("update")(&err)
+	opts := UpdateOptions{Reviewers: reviewers}
+	if count != nil {
+		opts.Count = *count
 	}
-	sd.profiletimer.Step("UpdatePullRequests::FetchAndGetGitHubInfo")
-	localCommits := alignLocalCommits(git.GetLocalCommitStack(sd.config, sd.gitcmd), githubInfo.PullRequests)
-	sd.profiletimer.Step("UpdatePullRequests::GetLocalCommitStack")
+	result, err := sd.Update(ctx, opts)
+	if err != nil || result == nil {
+		return err
+	}
+	return sd.printUpdateResult(result)
+}
 
-	// close prs for deleted commits
-	var validPullRequests []*github.PullRequest
-	localCommitMap := map[string]*git.Commit{}
-	for _, commit := range localCommits {
-		localCommitMap[commit.CommitID] = &commit
+// Update implements Client. With DryRun set the plan is printed instead
+//
+//	and the result is nil.
+func (sd *stackediff) Update(ctx context.Context, opts UpdateOptions) (result *UpdateResult, err error) {
+	sd.profiletimer.Step("UpdatePullRequests::Start")
+	defer sd.startAudit("update")(&err)
+	err = sd.pendingUpdate()
+	if err != nil {
+		return nil, err
 	}
-	for _, pr := range githubInfo.PullRequests {
-		if _, found := localCommitMap[pr.Commit.CommitID]; !found {
-			sd.github.CommentPullRequest(ctx, pr, "Closing pull request: commit has gone away")
-			sd.github.ClosePullRequest(ctx, pr)
-		} else {
-			validPullRequests = append(validPullRequests, pr)
-		}
+	err = sd.CheckWritable(ctx)
+	if err != nil {
+		return nil, err
 	}
-	githubInfo.PullRequests = validPullRequests
-
-	if commitsReordered(localCommits, githubInfo.PullRequests) {
-		wg := new(sync.WaitGroup)
-		wg.Add(len(githubInfo.PullRequests))
-
-		// if commits have been reordered :
-		//   first - rebase all pull requests to target branch
-		//   then - update all pull requests
-		for i := range githubInfo.PullRequests {
-			fn := func(i int) {
-				pr := githubInfo.PullRequests[i]
-				sd.github.UpdatePullRequest(ctx, sd.gitcmd, githubInfo, githubInfo.PullRequests, pr, pr.Commit, nil)
-				wg.Done()
-			}
-			if sd.synchronized {
-				fn(i)
-			} else {
-				go fn(i)
-			}
+	reviewers := append(sd.config.Repo.DefaultReviewers, opts.Reviewers...)
+	entry := &journalEntry{Command: "update", Time: time.Now()}
+	if !sd.DryRun {
+		// the head before the stack is rebased onto the target branch
+		entry.HeadBefore, err = sd.revParse(ctx, git.StackHead(sd.config))
+		if err != nil {
+			return nil, err
 		}
-
-		wg.Wait()
-		sd.profiletimer.Step("UpdatePullRequests::ReparentPullRequestsToMaster")
 	}
-
-	if !sd.syncCommitStackToGitHub(ctx, localCommits, githubInfo) {
-		return
+	githubInfo, err := sd.fetchAndGetGitHubInfo(ctx)
+	if err != nil {
+		return nil, err
 	}
-	sd.profiletimer.Step("UpdatePullRequests::SyncCommitStackToGithub")
-
-	type prUpdate struct {
-		pr         *github.PullRequest
-		commit     git.Commit
-		prevCommit *git.Commit
+	sd.profiletimer.Step("UpdatePullRequests::FetchAndGetGitHubInfo")
+	localCommits, err := git.GetLocalCommitStack(ctx, sd.config, sd.gitcmd)
+	if err != nil {
+		return nil, err
 	}
+	localCommits = alignLocalCommits(localCommits, githubInfo.PullRequests)
+	sd.profiletimer.Step("UpdatePullRequests::GetLocalCommitStack")
 
-	updateQueue := make([]prUpdate, 0)
-	var assignable []github.RepoAssignee
-
-	// iterate through local_commits and update pull_requests
-	var prevCommit *git.Commit
-	for commitIndex, c := range localCommits {
-		if c.WIP {
-			break
-		}
-		prFound := false
-		for _, pr := range githubInfo.PullRequests {
-			if c.CommitID == pr.Commit.CommitID {
-				prFound = true
-				updateQueue = append(updateQueue, prUpdate{pr, c, prevCommit})
-				pr.Commit = c
-				if len(reviewers) != 0 {
-					fmt.Fprintf(sd.output, "warning: not updating reviewers for PR #%d\n", pr.Number)
-				}
-				prevCommit = &localCommits[commitIndex]
-				break
-			}
-		}
-		if !prFound {
-			// if pull request is not found for this commit_id it means the commit
-			//  is new and we need to create a new pull request
-			pr := sd.github.CreatePullRequest(ctx, sd.gitcmd, githubInfo, c, prevCommit)
-			githubInfo.PullRequests = append(githubInfo.PullRequests, pr)
-			updateQueue = append(updateQueue, prUpdate{pr, c, prevCommit})
-			if len(reviewers) != 0 {
-				if assignable == nil {
-					assignable = sd.github.GetAssignableUsers(ctx)
-				}
-				sd.addReviewers(ctx, pr, reviewers, assignable)
-			}
-			prevCommit = &localCommits[commitIndex]
-		}
-
-		if count != nil && (commitIndex+1) == int(*count) {
-			break
-		}
+	removed, err := sd.removedPullRequests(ctx, githubInfo, localCommits)
+	if err != nil {
+		return nil, err
 	}
-	sd.profiletimer.Step("UpdatePullRequests::updatePullRequests")
-
-	wg := new(sync.WaitGroup)
-	wg.Add(len(updateQueue))
+	pullRequests := append(append([]*github.PullRequest{}, githubInfo.PullRequests...), removed...)
+	plan := planUpdate(localCommits, pullRequests, reviewers, countLimit(opts.Count))
+	sd.profiletimer.Step("UpdatePullRequests::PlanUpdate")
 
-	// Sort the PR stack by the local commit order, in case some commits were reordered
-	sortedPullRequests := sortPullRequestsByLocalCommitOrder(githubInfo.PullRequests, localCommits)
-	for i := range updateQueue {
-		fn := func(i int) {
-			pr := updateQueue[i]
-			sd.github.UpdatePullRequest(ctx, sd.gitcmd, githubInfo, sortedPullRequests, pr.pr, pr.commit, pr.prevCommit)
-			wg.Done()
-		}
-		if sd.synchronized {
-			fn(i)
-		} else {
-			go fn(i)
-		}
+	if sd.DryRun {
+		fmt.Fprint(sd.output, plan.String(sd.config))
+		return nil, nil
 	}
 
-	wg.Wait()
+	err = sd.journalUpdate(entry, githubInfo, localCommits, plan)
+	if err != nil {
+		return nil, err
+	}
+	sd.profiletimer.Step("UpdatePullRequests::Journal")
 
-	sd.profiletimer.Step("UpdatePullRequests::commitUpdateQueue")
+	cp := newUpdateCheckpoint(entry, githubInfo, localCommits, plan)
+	err = sd.saveCheckpoint(cp)
+	if err != nil {
+		return nil, err
+	}
+	return sd.applyUpdate(ctx, cp, false)
+}
 
-	sd.StatusPullRequests(ctx)
+// printUpdateResult prints the warnings of an update followed by the
+//
+//	status of the updated stack.
+func (sd *stackediff) printUpdateResult(result *UpdateResult) error {
+	for _, warning := range result.Warnings {
+		fmt.Fprintf(sd.output, "warning: %s\n", warning)
+	}
+	return sd.printStack(result.Stack)
 }
 
 // MergePullRequests will go through all the current pull requests
@@ -434,144 +445,516 @@ func (sd *stackediff) UpdatePullRequests(ctx context.Context, reviewers []string
 //	pull request. This one merge in effect merges all the commits in the stack.
 //	We than close all the pull requests which are below the merged request, as
 //	their commits have already been merged.
-func (sd *stackediff) MergePullRequests(ctx context.Context, count *uint) {
-	sd.profiletimer.Step("MergePullRequests::Start")
-	githubInfo := sd.github.GetInfo(ctx, sd.gitcmd)
+func (sd *stackediff) MergePullRequests(ctx context.Context, count *uint) (err error) {
+	defer sd.startAudit("merge")(&err)
+	if sd.DryRun {
+		_, plan, err := sd.planMerge(ctx, count)
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(sd.output, plan.String(sd.config))
+		if plan.mergePullRequest == nil {
+			return errNothingToMerge
+		}
+		return nil
+	}
+
+	opts := MergeOptions{}
+	if count != nil {
+		opts.Count = *count
+	}
+	result, err := sd.Merge(ctx, opts)
+	if err != nil {
+		return err
+	}
+	for _, pr := range result.Closed {
+		fmt.Fprintf(sd.output, "%s\n", pr.String(sd.config))
+	}
+	fmt.Fprintf(sd.output, "%s\n", result.Merged.String(sd.config))
+	return nil
+}
+
+var errNothingToMerge = errs.New(errs.Validation, "no mergeable pull requests found in the stack")
+
+// planMerge fetches the stack and plans its merge, making sure the stack
+//
+//	isn't a read-only checkout and the merge check passed on the local
+//	commits when one is configured.
+func (sd *stackediff) planMerge(ctx context.Context, count *uint) (*github.GitHubInfo, *mergePlan, error) {
+	err := sd.CheckWritable(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	githubInfo, err := sd.github.GetInfo(ctx, sd.gitcmd)
+	if err != nil {
+		return nil, nil, err
+	}
 	sd.profiletimer.Step("MergePullRequests::getGitHubInfo")
 
 	// MergeCheck
 	if sd.config.Repo.MergeCheck != "" {
-		localCommits := git.GetLocalCommitStack(sd.config, sd.gitcmd)
+		localCommits, err := git.GetLocalCommitStack(ctx, sd.config, sd.gitcmd)
+		if err != nil {
+			return nil, nil, err
+		}
 		if len(localCommits) > 0 {
 			lastCommit := localCommits[len(localCommits)-1]
 			checkedCommit, found := sd.config.State.MergeCheckCommit[githubInfo.Key()]
 
-			if !found {
-				check(errors.New("need to run merge check 'spr check' before merging"))
-			} else if checkedCommit != "SKIP" && lastCommit.CommitHash != checkedCommit {
-				check(errors.New("need to run merge check 'spr check' before merging"))
+			if !found || (checkedCommit != "SKIP" && lastCommit.CommitHash != checkedCommit) {
+				return nil, nil, errs.New(errs.Validation, "need to run merge check 'spr check' before merging")
 			}
 		}
 	}
 
-	// Figure out top most pr in the stack that is mergeable
-	var prIndex int
-	for prIndex = 0; prIndex < len(githubInfo.PullRequests); prIndex++ {
-		pr := githubInfo.PullRequests[prIndex]
-		if !pr.Mergeable(sd.config) {
-			prIndex--
-			break
-		}
-		if count != nil && (prIndex+1) == int(*count) {
-			break
-		}
-	}
-	if prIndex == len(githubInfo.PullRequests) {
-		prIndex--
+	return githubInfo, planMerge(sd.config, githubInfo.PullRequests, count), nil
+}
+
+// Merge implements Client
+func (sd *stackediff) Merge(ctx context.Context, opts MergeOptions) (result *MergeResult, err error) {
+	sd.profiletimer.Step("MergePullRequests::Start")
+	defer sd.startAudit("merge")(&err)
+	githubInfo, plan, err := sd.planMerge(ctx, countLimit(opts.Count))
+	if err != nil {
+		return nil, err
 	}
-	if prIndex == -1 {
-		check(errors.New("no mergeable pull requests found in the stack"))
-		return
+	if plan.mergePullRequest == nil {
+		return nil, errNothingToMerge
 	}
-	prToMerge := githubInfo.PullRequests[prIndex]
+	prToMerge := plan.mergePullRequest
 
 	// Update the base of the merging pr to target branch
-	sd.github.UpdatePullRequest(ctx, sd.gitcmd, githubInfo, githubInfo.PullRequests, prToMerge, prToMerge.Commit, nil)
+	err = sd.github.UpdatePullRequest(ctx, sd.gitcmd, githubInfo, githubInfo.PullRequests, prToMerge, prToMerge.Commit, nil)
+	if err != nil {
+		return nil, err
+	}
 	sd.profiletimer.Step("MergePullRequests::update pr base")
 
 	// Merge pull request
 	mergeMethod, err := sd.config.MergeMethod()
-	check(err)
-	sd.github.MergePullRequest(ctx, prToMerge, mergeMethod)
+	if err != nil {
+		return nil, errs.Wrap(errs.Validation, err)
+	}
+	err = sd.github.MergePullRequest(ctx, prToMerge, mergeMethod)
+	if err != nil {
+		return nil, err
+	}
+	merged := newJournalPullRequest(prToMerge)
+	entry := &journalEntry{
+		Command: "merge",
+		Time:    time.Now(),
+		Branch:  githubInfo.LocalBranch,
+		Merged:  &merged,
+	}
+	for _, pr := range plan.closePullRequests {
+		entry.Closed = append(entry.Closed, newJournalPullRequest(pr))
+	}
+	err = sd.recordJournalEntry(entry)
+	if err != nil {
+		return nil, err
+	}
 	if sd.config.User.DeleteMergedBranches {
-		sd.gitcmd.DeleteRemoteBranch(ctx, prToMerge.FromBranch)
+		err = sd.gitcmd.DeleteRemoteBranch(ctx, prToMerge.FromBranch)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	// Close all the pull requests in the stack below the merged pr
 	//  Before closing add a review comment with the pr that merged the commit.
-	for i := 0; i < prIndex; i++ {
-		pr := githubInfo.PullRequests[i]
+	for _, pr := range plan.closePullRequests {
 		comment := fmt.Sprintf(
-			"✓ Commit merged in pull request [#%d](https://%s/%s/%s/pull/%d)",
-			prToMerge.Number, sd.config.Repo.GitHubHost, sd.config.Repo.GitHubRepoOwner, sd.config.Repo.GitHubRepoName, prToMerge.Number)
-		sd.github.CommentPullRequest(ctx, pr, comment)
-		sd.github.ClosePullRequest(ctx, pr)
+			"✓ Commit merged in pull request [#%d](%s)",
+			prToMerge.Number, prToMerge.URL(sd.config))
+		err = sd.github.CommentPullRequest(ctx, pr, comment)
+		if err != nil {
+			return nil, err
+		}
+		err = sd.github.ClosePullRequest(ctx, pr)
+		if err != nil {
+			return nil, err
+		}
 		if sd.config.User.DeleteMergedBranches {
-			sd.gitcmd.DeleteRemoteBranch(ctx, pr.FromBranch)
+			err = sd.gitcmd.DeleteRemoteBranch(ctx, pr.FromBranch)
+			if err != nil {
+				return nil, err
+			}
 		}
 	}
 	sd.profiletimer.Step("MergePullRequests::close prs")
 
-	for i := 0; i <= prIndex; i++ {
-		pr := githubInfo.PullRequests[i]
+	for _, pr := range plan.closePullRequests {
 		pr.Merged = true
-		fmt.Fprintf(sd.output, "%s\n", pr.String(sd.config))
 	}
+	prToMerge.Merged = true
 
 	sd.profiletimer.Step("MergePullRequests::End")
+	return &MergeResult{Merged: prToMerge, Closed: plan.closePullRequests}, nil
 }
 
 // StatusPullRequests fetches all the users pull requests from github and
 //
 //	prints out the status of each. It does not make any updates locally or
 //	remotely on github.
-func (sd *stackediff) StatusPullRequests(ctx context.Context) {
+func (sd *stackediff) StatusPullRequests(ctx context.Context) error {
+	stack, err := sd.Status(ctx)
+	if err != nil {
+		return err
+	}
+	return sd.printStack(stack)
+}
+
+// Status implements Client
+func (sd *stackediff) Status(ctx context.Context) (*Stack, error) {
 	sd.profiletimer.Step("StatusPullRequests::Start")
-	githubInfo := sd.github.GetInfo(ctx, sd.gitcmd)
+	defer sd.profiletimer.Step("StatusPullRequests::End")
+	githubInfo, err := sd.github.GetInfo(ctx, sd.gitcmd)
+	if err != nil {
+		return nil, err
+	}
+	return &Stack{
+		LocalBranch:  githubInfo.LocalBranch,
+		TargetBranch: sd.config.Repo.GitHubBranch,
+		PullRequests: githubInfo.PullRequests,
+	}, nil
+}
 
-	if sd.TextEnabled {
-		for i := len(githubInfo.PullRequests) - 1; i >= 0; i-- {
-			pr := githubInfo.PullRequests[i]
+// printStack prints the pull requests of the stack top first, or the whole
+//
+//	stack in the selected machine readable format.
+func (sd *stackediff) printStack(stack *Stack) error {
+	if sd.OutputFormat != "" {
+		return writeStackStatus(sd.output, sd.OutputFormat, newStackStatus(sd.config, stack))
+	} else if sd.TextEnabled {
+		for i := len(stack.PullRequests) - 1; i >= 0; i-- {
+			pr := stack.PullRequests[i]
 			fmt.Fprintf(sd.output, "%s\n", pr.TextString(sd.config))
 		}
-	} else if len(githubInfo.PullRequests) == 0 {
+	} else if len(stack.PullRequests) == 0 {
 		fmt.Fprintf(sd.output, "pull request stack is empty\n")
 	} else {
 		if sd.DetailEnabled {
 			fmt.Fprint(sd.output, header(sd.config))
 		}
-		for i := len(githubInfo.PullRequests) - 1; i >= 0; i-- {
-			pr := githubInfo.PullRequests[i]
+		for i := len(stack.PullRequests) - 1; i >= 0; i-- {
+			pr := stack.PullRequests[i]
 			fmt.Fprintf(sd.output, "%s\n", pr.String(sd.config))
 		}
 	}
-	sd.profiletimer.Step("StatusPullRequests::End")
+	return nil
+}
+
+// SelectStack makes spr operate on the stack of commits on the given local
+//
+//	branch instead of the checked out branch. Selecting the checked out
+//	branch is the same as not selecting a stack.
+func (sd *stackediff) SelectStack(branch string) error {
+	// selecting a stack only reads refs, it isn't worth cancelling
+	ctx := context.Background()
+	exists, err := sd.localBranchExists(ctx, branch)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return errs.New(errs.NotFound, "stack %s not found: no such local branch", branch)
+	}
+	localBranch, err := git.GetLocalBranchName(ctx, sd.gitcmd)
+	if err != nil {
+		return err
+	}
+	if branch == localBranch {
+		sd.config.Stack = ""
+	} else {
+		sd.config.Stack = branch
+	}
+	return nil
+}
+
+// SelectTarget sets the branch the pull requests of the selected stack are
+//
+//	merged into. When target is empty it is inferred from the upstream branch
+//	tracked by the stack's local branch, without an upstream the configured
+//	githubBranch is used.
+func (sd *stackediff) SelectTarget(target string) error {
+	if target == "" {
+		var err error
+		target, err = sd.inferTarget(context.Background(), sd.config.Stack)
+		if err != nil {
+			return err
+		}
+		if target != sd.defaultTarget {
+			fmt.Fprintf(sd.notices, "targeting %s, the upstream branch of the stack\n", target)
+		}
+	}
+	sd.config.Repo.GitHubBranch = target
+	return errs.Wrap(errs.Validation, config_parser.CheckConfig(sd.config))
+}
+
+// localBranchExists returns whether the local branch exists, the exit code
+//
+//	tells a missing branch apart from git failing.
+func (sd *stackediff) localBranchExists(ctx context.Context, branch string) (bool, error) {
+	_, err := sd.gitcmd.Git(ctx, "rev-parse", "--verify", "--quiet", "refs/heads/"+branch)
+	if code, ok := git.ExitCode(err); ok && code == 1 {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// inferTarget returns the target branch of the stack on the given local branch,
+//
+//	an empty branch is the checked out branch.
+func (sd *stackediff) inferTarget(ctx context.Context, branch string) (string, error) {
+	if branch == "" {
+		var err error
+		branch, err = git.GetLocalBranchName(ctx, sd.gitcmd)
+		if err != nil {
+			return "", err
+		}
+	}
+	upstream := git.GetUpstreamBranch(ctx, sd.config, sd.gitcmd, branch)
+	if upstream == "" || git.BranchNameRegex(sd.config.User.BranchPrefix).MatchString(upstream) {
+		return sd.defaultTarget, nil
+	}
+	// git push -u makes a branch track a remote branch of its own name,
+	//  which isn't a target unless it's configured as one
+	if upstream == branch && upstream != sd.defaultTarget &&
+		!slices.Contains(sd.config.Repo.TargetBranches, upstream) {
+		return sd.defaultTarget, nil
+	}
+	return upstream, nil
+}
+
+// ListStacks prints every local branch which holds a stack of spr commits
+//
+//	together with the pull requests of each stack and their merge status.
+//	The checked out stack is marked with a '*'. With AllStacks set the open
+//	spr pull requests into the target branch which don't belong to a local
+//	stack are listed as well, grouped by stack along with their author.
+func (sd *stackediff) ListStacks(ctx context.Context) error {
+	sd.profiletimer.Step("ListStacks::Start")
+	defer sd.profiletimer.Step("ListStacks::End")
+
+	currentBranch, err := git.GetLocalBranchName(ctx, sd.gitcmd)
+	if err != nil {
+		return err
+	}
+	localBranches, err := git.GetLocalBranches(ctx, sd.gitcmd)
+	if err != nil {
+		return err
+	}
+	selectedStack := sd.config.Stack
+	selectedTarget := sd.config.Repo.GitHubBranch
+	defer func() {
+		sd.config.Stack = selectedStack
+		sd.config.Repo.GitHubBranch = selectedTarget
+	}()
+
+	branchRegex := git.BranchNameRegex(sd.config.User.BranchPrefix)
+	found := false
+	listed := map[int]bool{}
+	for _, branch := range localBranches {
+		if branchRegex.MatchString(branch) {
+			continue
+		}
+		sd.config.Repo.GitHubBranch, err = sd.inferTarget(ctx, branch)
+		if err != nil {
+			return err
+		}
+		commits, valid := git.GetBranchCommitStack(ctx, sd.config, sd.gitcmd, branch)
+		if !valid || len(commits) == 0 {
+			continue
+		}
+		found = true
+
+		marker := " "
+		sd.config.Stack = branch
+		if branch == currentBranch {
+			marker = "*"
+			sd.config.Stack = ""
+		}
+		info, err := sd.github.GetInfo(ctx, sd.gitcmd)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(sd.output, "%s %s -> %s : %d commits, %d pull requests\n",
+			marker, branch, sd.config.Repo.GitHubBranch, len(commits), len(info.PullRequests))
+		for i := len(info.PullRequests) - 1; i >= 0; i-- {
+			fmt.Fprintf(sd.output, "    %s\n", info.PullRequests[i].String(sd.config))
+			listed[info.PullRequests[i].Number] = true
+		}
+	}
+
+	if sd.AllStacks {
+		sd.config.Stack = selectedStack
+		sd.config.Repo.GitHubBranch = selectedTarget
+		pullRequests, err := sd.github.GetPullRequests(ctx)
+		if err != nil {
+			return err
+		}
+		for _, stack := range github.SplitStacks(pullRequests) {
+			top := stack[len(stack)-1]
+			if listed[top.Number] {
+				continue
+			}
+			found = true
+			fmt.Fprintf(sd.output, "  %s -> %s : %d pull requests by %s\n",
+				top.FromBranch, selectedTarget, len(stack), top.Author)
+			for i := len(stack) - 1; i >= 0; i-- {
+				fmt.Fprintf(sd.output, "    %s\n", stack[i].TextString(sd.config))
+			}
+		}
+	}
+	if !found {
+		fmt.Fprintf(sd.output, "no stacks found\n")
+	}
+	return nil
+}
+
+// ExplainPullRequest prints every condition which prevents a pull request
+//
+//	in the stack from being merged. The pull request is selected either by
+//	its number, optionally prefixed with '#', or by its position in the stack
+//	counting from 1 at the bottom.
+func (sd *stackediff) ExplainPullRequest(ctx context.Context, selector string) error {
+	explanation, err := sd.Explain(ctx, selector)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(sd.output, "%s\n", explanation.PullRequest.String(sd.config))
+	if len(explanation.Blockers) == 0 {
+		fmt.Fprintf(sd.output, "  pull request is ready to merge\n")
+		return nil
+	}
+	for _, blocker := range explanation.Blockers {
+		fmt.Fprintf(sd.output, "  %-10s : %s\n", blocker.Kind, blocker.Reason)
+	}
+	return nil
+}
+
+// Explain implements Client
+func (sd *stackediff) Explain(ctx context.Context, selector string) (*Explanation, error) {
+	sd.profiletimer.Step("ExplainPullRequest::Start")
+	defer sd.profiletimer.Step("ExplainPullRequest::End")
+
+	githubInfo, err := sd.github.GetInfo(ctx, sd.gitcmd)
+	if err != nil {
+		return nil, err
+	}
+	index, err := selectPullRequest(githubInfo.PullRequests, selector)
+	if err != nil {
+		return nil, err
+	}
+
+	blockers := stackBlockers(sd.config, githubInfo.PullRequests, index)
+	blocker, stale, err := sd.mergeCheckBlocker(ctx, githubInfo)
+	if err != nil {
+		return nil, err
+	}
+	if stale {
+		blockers = append(blockers, blocker)
+	}
+	return &Explanation{PullRequest: githubInfo.PullRequests[index], Blockers: blockers}, nil
+}
+
+// selectPullRequest returns the index of the pull request matching selector.
+//
+//	A selector starting with '#' only matches pull request numbers, otherwise
+//	pull request numbers are matched first and then positions in the stack.
+func selectPullRequest(pullRequests []*github.PullRequest, selector string) (int, error) {
+	byNumber := strings.HasPrefix(selector, "#")
+	n, err := strconv.Atoi(strings.TrimPrefix(selector, "#"))
+	if err != nil {
+		return 0, errs.New(errs.Validation, "invalid pull request %q, use a pull request number or stack position", selector)
+	}
+	for i, pr := range pullRequests {
+		if pr.Number == n {
+			return i, nil
+		}
+	}
+	if !byNumber && n >= 1 && n <= len(pullRequests) {
+		return n - 1, nil
+	}
+	return 0, errs.New(errs.NotFound, "pull request %s not found in the stack", selector)
+}
+
+// mergeCheckBlocker returns a blocker when a merge check is configured and
+//
+//	has not passed on the current top commit of the stack.
+func (sd *stackediff) mergeCheckBlocker(ctx context.Context, githubInfo *github.GitHubInfo) (github.MergeBlocker, bool, error) {
+	if sd.config.Repo.MergeCheck == "" {
+		return github.MergeBlocker{}, false, nil
+	}
+	localCommits, err := git.GetLocalCommitStack(ctx, sd.config, sd.gitcmd)
+	if err != nil || len(localCommits) == 0 {
+		return github.MergeBlocker{}, false, err
+	}
+	lastCommit := localCommits[len(localCommits)-1]
+	checkedCommit, found := sd.config.State.MergeCheckCommit[githubInfo.Key()]
+	if !found || checkedCommit == "" {
+		return github.MergeBlocker{
+			Kind:   github.MergeBlockerMergeCheck,
+			Reason: "merge check has not passed, run 'spr check'",
+		}, true, nil
+	}
+	if checkedCommit != "SKIP" && lastCommit.CommitHash != checkedCommit {
+		return github.MergeBlocker{
+			Kind:   github.MergeBlockerMergeCheck,
+			Reason: "merge check ran on an older commit, run 'spr check'",
+		}, true, nil
+	}
+	return github.MergeBlocker{}, false, nil
 }
 
 // SyncStack synchronizes your local stack with remote's
-func (sd *stackediff) SyncStack(ctx context.Context) {
+func (sd *stackediff) SyncStack(ctx context.Context) (err error) {
 	sd.profiletimer.Step("SyncStack::Start")
 	defer sd.profiletimer.Step("SyncStack::End")
+	defer sd.startAudit("sync")(&err)
 
-	githubInfo := sd.github.GetInfo(ctx, sd.gitcmd)
+	githubInfo, err := sd.github.GetInfo(ctx, sd.gitcmd)
+	if err != nil {
+		return err
+	}
 
 	if len(githubInfo.PullRequests) == 0 {
 		fmt.Fprintf(sd.output, "pull request stack is empty\n")
-		return
+		return nil
 	}
 
 	lastPR := githubInfo.PullRequests[len(githubInfo.PullRequests)-1]
-	syncCommand := fmt.Sprintf("cherry-pick ..%s", lastPR.Commit.CommitHash)
-	err := sd.gitcmd.Git(syncCommand, nil)
-	check(err)
+	_, err = sd.gitcmd.Git(ctx, "cherry-pick", ".."+lastPR.Commit.CommitHash)
+	return err
 }
 
-func (sd *stackediff) RunMergeCheck(ctx context.Context) {
+func (sd *stackediff) RunMergeCheck(ctx context.Context) error {
 	sd.profiletimer.Step("RunMergeCheck::Start")
 	defer sd.profiletimer.Step("RunMergeCheck::End")
 
 	if sd.config.Repo.MergeCheck == "" {
 		fmt.Println("use MergeCheck to configure a pre merge check command to run")
-		return
+		return nil
 	}
 
-	localCommits := git.GetLocalCommitStack(sd.config, sd.gitcmd)
+	localCommits, err := git.GetLocalCommitStack(ctx, sd.config, sd.gitcmd)
+	if err != nil {
+		return err
+	}
 	if len(localCommits) == 0 {
 		fmt.Println("no local commits - nothing to check")
-		return
+		return nil
 	}
 
-	githubInfo := sd.github.GetInfo(ctx, sd.gitcmd)
+	githubInfo, err := sd.github.GetInfo(ctx, sd.gitcmd)
+	if err != nil {
+		return err
+	}
+	statePath, err := config_parser.InternalConfigFilePath()
+	if err != nil {
+		return err
+	}
 
 	sigch := make(chan os.Signal, 1)
 	signal.Notify(sigch, os.Interrupt, syscall.SIGTERM)
@@ -588,14 +971,16 @@ func (sd *stackediff) RunMergeCheck(ctx context.Context) {
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
-	err := cmd.Start()
-	check(err)
+	err = cmd.Start()
+	if err != nil {
+		return errs.Wrap(errs.Validation, fmt.Errorf("unable to run merge check : %w", err))
+	}
 
 	go func() {
 		_, ok := <-sigch
 		if ok {
-			err := cmd.Process.Signal(syscall.SIGKILL)
-			check(err)
+			// the process may have exited already
+			cmd.Process.Signal(syscall.SIGKILL)
 		}
 	}()
 
@@ -603,16 +988,17 @@ func (sd *stackediff) RunMergeCheck(ctx context.Context) {
 	if err != nil {
 		sd.config.State.MergeCheckCommit[githubInfo.Key()] = ""
 		rake.LoadSources(sd.config.State,
-			rake.YamlFileWriter(config_parser.InternalConfigFilePath()))
+			rake.YamlFileWriter(statePath))
 		fmt.Printf("MergeCheck FAILED: %s\n", err)
-		return
+		return nil
 	}
 
 	lastCommit := localCommits[len(localCommits)-1]
 	sd.config.State.MergeCheckCommit[githubInfo.Key()] = lastCommit.CommitHash
 	rake.LoadSources(sd.config.State,
-		rake.YamlFileWriter(config_parser.InternalConfigFilePath()))
+		rake.YamlFileWriter(statePath))
 	fmt.Println("MergeCheck PASSED")
+	return nil
 }
 
 // ProfilingEnable enables stopwatch profiling
@@ -621,9 +1007,8 @@ func (sd *stackediff) ProfilingEnable() {
 }
 
 // ProfilingSummary prints profiling info to stdout
-func (sd *stackediff) ProfilingSummary() {
-	err := sd.profiletimer.ShowResults()
-	check(err)
+func (sd *stackediff) ProfilingSummary() error {
+	return sd.profiletimer.ShowResults()
 }
 
 func commitsReordered(localCommits []git.Commit, pullRequests []*github.PullRequest) bool {
@@ -650,66 +1035,164 @@ func sortPullRequestsByLocalCommitOrder(pullRequests []*github.PullRequest, loca
 	return sortedPullRequests
 }
 
-func (sd *stackediff) fetchAndGetGitHubInfo(ctx context.Context) *github.GitHubInfo {
-	if sd.config.Repo.ForceFetchTags {
-		sd.gitcmd.MustGit("fetch --tags --force", nil)
-	} else {
-		sd.gitcmd.MustGit("fetch", nil)
+// removedPullRequests returns the open pull requests of the commits which
+//
+//	rewrites of the stack removed since its last update. The pull requests
+//	of the stack are matched from its top commit down, so the ones of the
+//	commits removed from the top of the stack have to be looked up.
+func (sd *stackediff) removedPullRequests(ctx context.Context, githubInfo *github.GitHubInfo,
+	localCommits []git.Commit,
+) ([]*github.PullRequest, error) {
+	branch := sd.config.Stack
+	if branch == "" {
+		branch = githubInfo.LocalBranch
 	}
-	rebaseCommand := fmt.Sprintf("rebase %s/%s --autostash",
-		sd.config.Repo.GitHubRemote, sd.config.Repo.GitHubBranch)
-	err := sd.gitcmd.Git(rebaseCommand, nil)
+	entries, err := sd.readJournal()
 	if err != nil {
-		return nil
+		return nil, err
 	}
-	info := sd.github.GetInfo(ctx, sd.gitcmd)
-	if git.BranchNameRegex(sd.config.User.BranchPrefix).FindString(info.LocalBranch) != "" {
-		fmt.Printf("error: don't run spr in a remote pr branch\n")
-		fmt.Printf(" this could lead to weird duplicate pull requests getting created\n")
-		fmt.Printf(" in general there is no need to checkout remote branches used for prs\n")
-		fmt.Printf(" instead use local branches and run spr update to sync your commit stack\n")
-		fmt.Printf("  with your pull requests on github\n")
-		fmt.Printf("branch name: %s\n", info.LocalBranch)
-		return nil
+	// rewrites recorded after the last update of the branch
+	removed := map[string]bool{}
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].Branch != branch {
+			continue
+		}
+		if entries[i].Command == "update" {
+			break
+		}
+		for _, commitID := range entries[i].Removed {
+			removed[commitID] = true
+		}
+	}
+	for _, c := range localCommits {
+		delete(removed, c.CommitID)
+	}
+	for _, pr := range githubInfo.PullRequests {
+		delete(removed, pr.Commit.CommitID)
+	}
+	if len(removed) == 0 {
+		return nil, nil
 	}
 
-	return info
+	pullRequests, err := sd.github.GetPullRequests(ctx)
+	if err != nil {
+		return nil, err
+	}
+	branches := map[string]string{}
+	for commitID := range removed {
+		branches[git.BranchNameFromCommit(sd.config, git.Commit{CommitID: commitID})] = commitID
+	}
+	var prs []*github.PullRequest
+	for _, pr := range pullRequests {
+		if commitID, ok := branches[pr.FromBranch]; ok {
+			pr.Commit.CommitID = commitID
+			prs = append(prs, pr)
+		}
+	}
+	return prs, nil
 }
 
-// syncCommitStackToGitHub gets all the local commits in the given branch
+// journalUpdate records the planned update in the journal before any of it
 //
-//	which are new (on top of remote branch) and creates a corresponding
-//	branch on github for each commit.
-func (sd *stackediff) syncCommitStackToGitHub(ctx context.Context,
-	commits []git.Commit, info *github.GitHubInfo,
-) bool {
-	var output string
-	sd.gitcmd.MustGit("status --porcelain --untracked-files=no", &output)
-	if output != "" {
-		err := sd.gitcmd.Git("stash", nil)
-		if err != nil {
-			return false
+//	is applied. Updates which change nothing aren't recorded.
+func (sd *stackediff) journalUpdate(entry *journalEntry, githubInfo *github.GitHubInfo,
+	localCommits []git.Commit, plan *updatePlan,
+) error {
+	entry.Branch = sd.config.Stack
+	if entry.Branch == "" {
+		entry.Branch = githubInfo.LocalBranch
+	}
+	if len(localCommits) > 0 {
+		entry.HeadAfter = localCommits[len(localCommits)-1].CommitHash
+	}
+	for _, pr := range plan.closePullRequests {
+		entry.Closed = append(entry.Closed, newJournalPullRequest(pr))
+	}
+	if plan.reorder {
+		for _, pr := range plan.pullRequests {
+			entry.addPullRequest(pr)
 		}
-		defer sd.gitcmd.MustGit("stash pop", nil)
 	}
-
-	commitUpdated := func(c git.Commit, info *github.GitHubInfo) bool {
-		for _, pr := range info.PullRequests {
-			if pr.Commit.CommitID == c.CommitID {
-				return pr.Commit.CommitHash != c.CommitHash
+	for _, update := range plan.updates {
+		if update.pr != nil {
+			entry.addPullRequest(update.pr)
+		}
+	}
+	for _, commit := range plan.pushCommits {
+		branch := journalBranch{
+			Name:  git.BranchNameFromCommit(sd.config, commit),
+			After: commit.CommitHash,
+		}
+		for _, pr := range plan.pullRequests {
+			if pr.Commit.CommitID == commit.CommitID {
+				branch.Before = pr.Commit.CommitHash
 			}
 		}
-		return true
+		entry.RemoteBranches = append(entry.RemoteBranches, branch)
 	}
 
-	var updatedCommits []git.Commit
-	for _, commit := range commits {
-		if commit.WIP {
-			break
+	headMoved := entry.HeadAfter != "" && entry.HeadAfter != entry.HeadBefore
+	if headMoved || len(entry.RemoteBranches) > 0 || len(entry.Closed) > 0 || plan.reorder {
+		return sd.recordJournalEntry(entry)
+	}
+	return nil
+}
+
+func (sd *stackediff) fetchAndGetGitHubInfo(ctx context.Context) (*github.GitHubInfo, error) {
+	fetchCommand := []string{"fetch"}
+	if sd.config.Repo.ForceFetchTags {
+		fetchCommand = append(fetchCommand, "--tags", "--force")
+	}
+	_, err := sd.gitcmd.Git(ctx, fetchCommand...)
+	if err != nil {
+		return nil, err
+	}
+	// a stack which is not checked out can't be rebased without checking it
+	//  out, and a dry run leaves the local branch as it is
+	if sd.config.Stack == "" && !sd.DryRun {
+		_, err := sd.gitcmd.Git(ctx, "rebase",
+			sd.config.Repo.GitHubRemote+"/"+sd.config.Repo.GitHubBranch, "--autostash")
+		if err != nil {
+			return nil, err
 		}
-		if commitUpdated(commit, info) {
-			updatedCommits = append(updatedCommits, commit)
+	}
+	info, err := sd.github.GetInfo(ctx, sd.gitcmd)
+	if err != nil {
+		return nil, err
+	}
+	if git.BranchNameRegex(sd.config.User.BranchPrefix).FindString(info.LocalBranch) != "" {
+		return nil, errs.New(errs.Validation, "don't run spr in a remote pr branch\n"+
+			" this could lead to weird duplicate pull requests getting created\n"+
+			" in general there is no need to checkout remote branches used for prs\n"+
+			" instead use local branches and run spr update to sync your commit stack\n"+
+			"  with your pull requests on github\n"+
+			"branch name: %s", info.LocalBranch)
+	}
+
+	return info, nil
+}
+
+// syncCommitStackToGitHub force pushes a branch to github for each of the
+//
+//	given commits, these are the commits which are new or have been updated.
+func (sd *stackediff) syncCommitStackToGitHub(ctx context.Context,
+	updatedCommits []git.Commit,
+) (err error) {
+	output, err := sd.gitcmd.Git(ctx, "status", "--porcelain", "--untracked-files=no")
+	if err != nil {
+		return err
+	}
+	if output != "" {
+		_, err = sd.gitcmd.Git(ctx, "stash")
+		if err != nil {
+			return err
 		}
+		defer func() {
+			_, popErr := sd.gitcmd.Git(ctx, "stash", "pop")
+			if err == nil {
+				err = popErr
+			}
+		}()
 	}
 
 	var refNames []string
@@ -722,27 +1205,24 @@ func (sd *stackediff) syncCommitStackToGitHub(ctx context.Context,
 	if len(updatedCommits) > 0 {
 		if sd.config.Repo.BranchPushIndividually {
 			for _, refName := range refNames {
-				pushCommand := fmt.Sprintf("push --force %s %s", sd.config.Repo.GitHubRemote, refName)
-				sd.gitcmd.MustGit(pushCommand, nil)
+				_, err = sd.gitcmd.Git(ctx, "push", "--force", sd.config.Repo.GitHubRemote, refName)
+				if err != nil {
+					return err
+				}
 			}
 		} else {
-			pushCommand := fmt.Sprintf("push --force --atomic %s ", sd.config.Repo.GitHubRemote)
-			pushCommand += strings.Join(refNames, " ")
-			sd.gitcmd.MustGit(pushCommand, nil)
+			pushCommand := []string{"push", "--force", "--atomic", sd.config.Repo.GitHubRemote}
+			_, err = sd.gitcmd.Git(ctx, append(pushCommand, refNames...)...)
+			if err != nil {
+				return err
+			}
 		}
-	}
-	sd.profiletimer.Step("SyncCommitStack::PushBranches")
-	return true
-}
-
-func check(err error) {
-	if err != nil {
-		if os.Getenv("SPR_DEBUG") == "1" {
-			panic(err)
+		for _, commit := range updatedCommits {
+			sd.auditPushed(git.BranchNameFromCommit(sd.config, commit), commit.CommitHash)
 		}
-		fmt.Printf("error: %s\n", err)
-		os.Exit(1)
 	}
+	sd.profiletimer.Step("SyncCommitStack::PushBranches")
+	return nil
 }
 
 func header(config *config.Config) string {
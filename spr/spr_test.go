@@ -1,15 +1,20 @@
 package spr
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/ejoffe/spr/config"
+	"github.com/ejoffe/spr/errs"
 	"github.com/ejoffe/spr/git"
 	"github.com/ejoffe/spr/git/mockgit"
 	"github.com/ejoffe/spr/github"
@@ -26,9 +31,11 @@ func makeTestObjects(t *testing.T, synchronized bool) (
 	cfg.Repo.RequireApproval = true
 	cfg.Repo.GitHubRemote = "origin"
 	cfg.Repo.GitHubBranch = "master"
+	cfg.Repo.Forge = config.ForgeGitHub
 	cfg.Repo.MergeMethod = "rebase"
 	cfg.User.BranchPrefix = "spr"
 	gitmock = mockgit.NewMockGit(t)
+	gitmock.SetRootDir(t.TempDir())
 	githubmock = mockclient.NewMockClient(t)
 	githubmock.Info = &github.GitHubInfo{
 		UserName:     "TestSPR",
@@ -38,6 +45,7 @@ func makeTestObjects(t *testing.T, synchronized bool) (
 	s = NewStackedPR(cfg, githubmock, gitmock)
 	output = &bytes.Buffer{}
 	s.output = output
+	s.notices = io.Discard
 	input = &bytes.Buffer{}
 	s.input = input
 	s.synchronized = synchronized
@@ -87,6 +95,8 @@ func testSPRBasicFlowFourCommitsQueue(t *testing.T, sync bool) {
 
 		// 'git spr update' :: UpdatePullRequest :: commits=[c1]
 		githubmock.ExpectGetInfo()
+		gitmock.ExpectWritable("")
+		gitmock.ExpectRevParse("HEAD", "h0")
 		gitmock.ExpectFetch()
 		gitmock.ExpectLogAndRespond([]*git.Commit{&c1})
 		gitmock.ExpectPushCommits([]*git.Commit{&c1})
@@ -104,6 +114,8 @@ func testSPRBasicFlowFourCommitsQueue(t *testing.T, sync bool) {
 
 		// 'git spr update' :: UpdatePullRequest :: commits=[c1, c2]
 		githubmock.ExpectGetInfo()
+		gitmock.ExpectWritable("")
+		gitmock.ExpectRevParse("HEAD", "h0")
 		gitmock.ExpectFetch()
 		gitmock.ExpectLogAndRespond([]*git.Commit{&c2, &c1})
 		gitmock.ExpectPushCommits([]*git.Commit{&c2})
@@ -125,6 +137,8 @@ func testSPRBasicFlowFourCommitsQueue(t *testing.T, sync bool) {
 
 		// 'git spr update' :: UpdatePullRequest :: commits=[c1, c2, c3, c4]
 		githubmock.ExpectGetInfo()
+		gitmock.ExpectWritable("")
+		gitmock.ExpectRevParse("HEAD", "h0")
 		gitmock.ExpectFetch()
 		gitmock.ExpectLogAndRespond([]*git.Commit{&c4, &c3, &c2, &c1})
 		gitmock.ExpectPushCommits([]*git.Commit{&c3, &c4})
@@ -159,6 +173,7 @@ func testSPRBasicFlowFourCommitsQueue(t *testing.T, sync bool) {
 		output.Reset()
 
 		// 'git spr merge' :: MergePullRequest :: commits=[a1, a2]
+		gitmock.ExpectWritable("")
 		githubmock.ExpectGetInfo()
 		githubmock.ExpectUpdatePullRequest(c2, nil)
 		githubmock.ExpectMergePullRequest(c2, genclient.PullRequestMergeMethod_REBASE)
@@ -183,6 +198,8 @@ func testSPRBasicFlowFourCommitsQueue(t *testing.T, sync bool) {
 		githubmock.ExpectUpdatePullRequest(c4, &c3)
 		githubmock.ExpectGetInfo()
 
+		gitmock.ExpectWritable("")
+		gitmock.ExpectRevParse("HEAD", "h0")
 		gitmock.ExpectFetch()
 		gitmock.ExpectLogAndRespond([]*git.Commit{&c4, &c3, &c2, &c1})
 		gitmock.ExpectStatus()
@@ -203,6 +220,7 @@ func testSPRBasicFlowFourCommitsQueue(t *testing.T, sync bool) {
 		output.Reset()
 
 		// 'git spr merge' :: MergePullRequest :: commits=[a2, a3, a4]
+		gitmock.ExpectWritable("")
 		githubmock.ExpectGetInfo()
 		githubmock.ExpectUpdatePullRequest(c4, nil)
 		githubmock.ExpectMergePullRequest(c4, genclient.PullRequestMergeMethod_REBASE)
@@ -268,6 +286,8 @@ func testSPRBasicFlowFourCommits(t *testing.T, sync bool) {
 
 		// 'git spr update' :: UpdatePullRequest :: commits=[c1]
 		githubmock.ExpectGetInfo()
+		gitmock.ExpectWritable("")
+		gitmock.ExpectRevParse("HEAD", "h0")
 		gitmock.ExpectFetch()
 		gitmock.ExpectLogAndRespond([]*git.Commit{&c1})
 		gitmock.ExpectPushCommits([]*git.Commit{&c1})
@@ -285,6 +305,8 @@ func testSPRBasicFlowFourCommits(t *testing.T, sync bool) {
 
 		// 'git spr update' :: UpdatePullRequest :: commits=[c1, c2]
 		githubmock.ExpectGetInfo()
+		gitmock.ExpectWritable("")
+		gitmock.ExpectRevParse("HEAD", "h0")
 		gitmock.ExpectFetch()
 		gitmock.ExpectLogAndRespond([]*git.Commit{&c2, &c1})
 		gitmock.ExpectPushCommits([]*git.Commit{&c2})
@@ -306,6 +328,8 @@ func testSPRBasicFlowFourCommits(t *testing.T, sync bool) {
 
 		// 'git spr update' :: UpdatePullRequest :: commits=[c1, c2, c3, c4]
 		githubmock.ExpectGetInfo()
+		gitmock.ExpectWritable("")
+		gitmock.ExpectRevParse("HEAD", "h0")
 		gitmock.ExpectFetch()
 		gitmock.ExpectLogAndRespond([]*git.Commit{&c4, &c3, &c2, &c1})
 		gitmock.ExpectPushCommits([]*git.Commit{&c3, &c4})
@@ -340,6 +364,7 @@ func testSPRBasicFlowFourCommits(t *testing.T, sync bool) {
 		output.Reset()
 
 		// 'git spr merge' :: MergePullRequest :: commits=[a1, a2, a3, a4]
+		gitmock.ExpectWritable("")
 		githubmock.ExpectGetInfo()
 		githubmock.ExpectUpdatePullRequest(c4, nil)
 		githubmock.ExpectMergePullRequest(c4, genclient.PullRequestMergeMethod_REBASE)
@@ -387,6 +412,8 @@ func testSPRBasicFlowDeleteBranch(t *testing.T, sync bool) {
 
 		// 'git spr update' :: UpdatePullRequest :: commits=[c1]
 		githubmock.ExpectGetInfo()
+		gitmock.ExpectWritable("")
+		gitmock.ExpectRevParse("HEAD", "h0")
 		gitmock.ExpectFetch()
 		gitmock.ExpectLogAndRespond([]*git.Commit{&c1})
 		gitmock.ExpectPushCommits([]*git.Commit{&c1})
@@ -404,6 +431,8 @@ func testSPRBasicFlowDeleteBranch(t *testing.T, sync bool) {
 
 		// 'git spr update' :: UpdatePullRequest :: commits=[c1, c2]
 		githubmock.ExpectGetInfo()
+		gitmock.ExpectWritable("")
+		gitmock.ExpectRevParse("HEAD", "h0")
 		gitmock.ExpectFetch()
 		gitmock.ExpectLogAndRespond([]*git.Commit{&c2, &c1})
 		gitmock.ExpectPushCommits([]*git.Commit{&c2})
@@ -424,6 +453,7 @@ func testSPRBasicFlowDeleteBranch(t *testing.T, sync bool) {
 		output.Reset()
 
 		// 'git spr merge' :: MergePullRequest :: commits=[a1, a2]
+		gitmock.ExpectWritable("")
 		githubmock.ExpectGetInfo()
 		githubmock.ExpectUpdatePullRequest(c2, nil)
 		githubmock.ExpectMergePullRequest(c2, genclient.PullRequestMergeMethod_REBASE)
@@ -475,6 +505,8 @@ func testSPRMergeCount(t *testing.T, sync bool) {
 
 		// 'git spr update' :: UpdatePullRequest :: commits=[c1, c2, c3, c4]
 		githubmock.ExpectGetInfo()
+		gitmock.ExpectWritable("")
+		gitmock.ExpectRevParse("HEAD", "h0")
 		gitmock.ExpectFetch()
 		gitmock.ExpectLogAndRespond([]*git.Commit{&c4, &c3, &c2, &c1})
 		gitmock.ExpectPushCommits([]*git.Commit{&c1, &c2, &c3, &c4})
@@ -507,6 +539,7 @@ func testSPRMergeCount(t *testing.T, sync bool) {
 		output.Reset()
 
 		// 'git spr merge --count 2' :: MergePullRequest :: commits=[a1, a2, a3, a4]
+		gitmock.ExpectWritable("")
 		githubmock.ExpectGetInfo()
 		githubmock.ExpectUpdatePullRequest(c2, nil)
 		githubmock.ExpectMergePullRequest(c2, genclient.PullRequestMergeMethod_REBASE)
@@ -555,6 +588,8 @@ func testSPRAmendCommit(t *testing.T, sync bool) {
 
 		// 'git spr update' :: UpdatePullRequest :: commits=[c1, c2]
 		githubmock.ExpectGetInfo()
+		gitmock.ExpectWritable("")
+		gitmock.ExpectRevParse("HEAD", "h0")
 		gitmock.ExpectFetch()
 		gitmock.ExpectLogAndRespond([]*git.Commit{&c2, &c1})
 		gitmock.ExpectPushCommits([]*git.Commit{&c1, &c2})
@@ -576,6 +611,8 @@ func testSPRAmendCommit(t *testing.T, sync bool) {
 		c2.CommitHash = "c201000000000000000000000000000000000000"
 		// 'git spr update' :: UpdatePullRequest :: commits=[c1, c2]
 		githubmock.ExpectGetInfo()
+		gitmock.ExpectWritable("")
+		gitmock.ExpectRevParse("HEAD", "h0")
 		gitmock.ExpectFetch()
 		gitmock.ExpectLogAndRespond([]*git.Commit{&c2, &c1})
 		gitmock.ExpectPushCommits([]*git.Commit{&c2})
@@ -596,6 +633,8 @@ func testSPRAmendCommit(t *testing.T, sync bool) {
 		c2.CommitHash = "c202000000000000000000000000000000000000"
 		// 'git spr update' :: UpdatePullRequest :: commits=[c1, c2]
 		githubmock.ExpectGetInfo()
+		gitmock.ExpectWritable("")
+		gitmock.ExpectRevParse("HEAD", "h0")
 		gitmock.ExpectFetch()
 		gitmock.ExpectLogAndRespond([]*git.Commit{&c2, &c1})
 		gitmock.ExpectPushCommits([]*git.Commit{&c1, &c2})
@@ -612,6 +651,7 @@ func testSPRAmendCommit(t *testing.T, sync bool) {
 		output.Reset()
 
 		// 'git spr merge' :: MergePullRequest :: commits=[a1, a2]
+		gitmock.ExpectWritable("")
 		githubmock.ExpectGetInfo()
 		githubmock.ExpectUpdatePullRequest(c2, nil)
 		githubmock.ExpectMergePullRequest(c2, genclient.PullRequestMergeMethod_REBASE)
@@ -675,6 +715,8 @@ func testSPRReorderCommit(t *testing.T, sync bool) {
 
 		// 'git spr update' :: UpdatePullRequest :: commits=[c1, c2, c3, c4]
 		githubmock.ExpectGetInfo()
+		gitmock.ExpectWritable("")
+		gitmock.ExpectRevParse("HEAD", "h0")
 		gitmock.ExpectFetch()
 		gitmock.ExpectLogAndRespond([]*git.Commit{&c4, &c3, &c2, &c1})
 		gitmock.ExpectPushCommits([]*git.Commit{&c1, &c2, &c3, &c4})
@@ -700,6 +742,8 @@ func testSPRReorderCommit(t *testing.T, sync bool) {
 
 		// 'git spr update' :: UpdatePullRequest :: commits=[c2, c4, c1, c3]
 		githubmock.ExpectGetInfo()
+		gitmock.ExpectWritable("")
+		gitmock.ExpectRevParse("HEAD", "h0")
 		gitmock.ExpectFetch()
 		gitmock.ExpectLogAndRespond([]*git.Commit{&c3, &c1, &c4, &c2})
 		githubmock.ExpectUpdatePullRequest(c1, nil)
@@ -731,6 +775,8 @@ func testSPRReorderCommit(t *testing.T, sync bool) {
 
 		// 'git spr update' :: UpdatePullRequest :: commits=[c5, c1, c2, c3, c4]
 		githubmock.ExpectGetInfo()
+		gitmock.ExpectWritable("")
+		gitmock.ExpectRevParse("HEAD", "h0")
 		gitmock.ExpectFetch()
 		gitmock.ExpectLogAndRespond([]*git.Commit{&c1, &c2, &c3, &c4, &c5})
 		githubmock.ExpectUpdatePullRequest(c1, nil)
@@ -809,6 +855,8 @@ func testSPRDeleteCommit(t *testing.T, sync bool) {
 
 		// 'git spr update' :: UpdatePullRequest :: commits=[c1, c2, c3, c4]
 		githubmock.ExpectGetInfo()
+		gitmock.ExpectWritable("")
+		gitmock.ExpectRevParse("HEAD", "h0")
 		gitmock.ExpectFetch()
 		gitmock.ExpectLogAndRespond([]*git.Commit{&c4, &c3, &c2, &c1})
 		gitmock.ExpectPushCommits([]*git.Commit{&c1, &c2, &c3, &c4})
@@ -835,6 +883,8 @@ func testSPRDeleteCommit(t *testing.T, sync bool) {
 
 		// 'git spr update' :: UpdatePullRequest :: commits=[c2, c4, c1, c3]
 		githubmock.ExpectGetInfo()
+		gitmock.ExpectWritable("")
+		gitmock.ExpectRevParse("HEAD", "h0")
 		gitmock.ExpectFetch()
 		gitmock.ExpectLogAndRespond([]*git.Commit{&c4, &c1})
 		githubmock.ExpectCommentPullRequest(c2)
@@ -899,6 +949,8 @@ func testAmendOneCommit(t *testing.T, sync bool) {
 		}
 		gitmock.ExpectLogAndRespond([]*git.Commit{&c1})
 		gitmock.ExpectFixup(c1.CommitHash)
+		gitmock.ExpectLocalBranch("* master")
+		gitmock.ExpectRevParse("HEAD", "c1a")
 		input.WriteString("1")
 		s.AmendCommit(ctx)
 		assert.Equal(" 1 : 00000001 : test commit 1\nCommit to amend (1): ", output.String())
@@ -928,6 +980,8 @@ func testAmendTwoCommits(t *testing.T, sync bool) {
 		}
 		gitmock.ExpectLogAndRespond([]*git.Commit{&c1, &c2})
 		gitmock.ExpectFixup(c2.CommitHash)
+		gitmock.ExpectLocalBranch("* master")
+		gitmock.ExpectRevParse("HEAD", "c2a")
 		input.WriteString("1")
 		s.AmendCommit(ctx)
 		assert.Equal(" 2 : 00000001 : test commit 1\n 1 : 00000002 : test commit 2\nCommit to amend (1-2): ", output.String())
@@ -953,22 +1007,25 @@ func testAmendInvalidInput(t *testing.T, sync bool) {
 
 		gitmock.ExpectLogAndRespond([]*git.Commit{&c1})
 		input.WriteString("a")
-		s.AmendCommit(ctx)
-		assert.Equal(" 1 : 00000001 : test commit 1\nCommit to amend (1): Invalid input\n", output.String())
+		err := s.AmendCommit(ctx)
+		assert.Equal(errs.Validation, errs.KindOf(err))
+		assert.Equal(" 1 : 00000001 : test commit 1\nCommit to amend (1): ", output.String())
 		gitmock.ExpectationsMet()
 		output.Reset()
 
 		gitmock.ExpectLogAndRespond([]*git.Commit{&c1})
 		input.WriteString("0")
-		s.AmendCommit(ctx)
-		assert.Equal(" 1 : 00000001 : test commit 1\nCommit to amend (1): Invalid input\n", output.String())
+		err = s.AmendCommit(ctx)
+		assert.Equal(errs.Validation, errs.KindOf(err))
+		assert.Equal(" 1 : 00000001 : test commit 1\nCommit to amend (1): ", output.String())
 		gitmock.ExpectationsMet()
 		output.Reset()
 
 		gitmock.ExpectLogAndRespond([]*git.Commit{&c1})
 		input.WriteString("2")
-		s.AmendCommit(ctx)
-		assert.Equal(" 1 : 00000001 : test commit 1\nCommit to amend (1): Invalid input\n", output.String())
+		err = s.AmendCommit(ctx)
+		assert.Equal(errs.Validation, errs.KindOf(err))
+		assert.Equal(" 1 : 00000001 : test commit 1\nCommit to amend (1): ", output.String())
 		gitmock.ExpectationsMet()
 		output.Reset()
 	})
@@ -994,6 +1051,8 @@ func TestSPRFetchOverridesNoFetchConfig(t *testing.T) {
 
 	// With NoFetch=false, fetch should run
 	githubmock.ExpectGetInfo()
+	gitmock.ExpectWritable("")
+	gitmock.ExpectRevParse("HEAD", "h0")
 	gitmock.ExpectFetch()
 	gitmock.ExpectLogAndRespond([]*git.Commit{&c1})
 	gitmock.ExpectPushCommits([]*git.Commit{&c1})
@@ -1070,7 +1129,7 @@ func TestEditCommitSelectCommit(t *testing.T) {
 }
 
 func TestEditCommitAlreadyEditing(t *testing.T) {
-	s, _, _, output, tmpDir := setupEditTest(t)
+	s, _, _, _, tmpDir := setupEditTest(t)
 	ctx := context.Background()
 
 	// Create the state file to simulate an active edit session
@@ -1078,12 +1137,13 @@ func TestEditCommitAlreadyEditing(t *testing.T) {
 	err := os.WriteFile(stateFile, []byte("commit_id=00000001\n"), 0644)
 	require.NoError(t, err)
 
-	s.EditCommit(ctx)
-	require.Contains(t, output.String(), "Already editing a commit")
+	err = s.EditCommit(ctx)
+	require.ErrorContains(t, err, "already editing a commit")
+	require.Equal(t, errs.Conflict, errs.KindOf(err))
 }
 
 func TestEditCommitInvalidInput(t *testing.T) {
-	s, gitmock, input, output, _ := setupEditTest(t)
+	s, gitmock, input, _, _ := setupEditTest(t)
 	ctx := context.Background()
 
 	c1 := git.Commit{
@@ -1094,8 +1154,8 @@ func TestEditCommitInvalidInput(t *testing.T) {
 
 	gitmock.ExpectLogAndRespond([]*git.Commit{&c1})
 	input.WriteString("abc\n")
-	s.EditCommit(ctx)
-	require.Contains(t, output.String(), "Invalid input")
+	err := s.EditCommit(ctx)
+	require.EqualError(t, err, `invalid input "abc"`)
 	gitmock.ExpectationsMet()
 }
 
@@ -1132,7 +1192,7 @@ func TestEditCommitDoneHappyPath(t *testing.T) {
 }
 
 func TestEditCommitDoneWithConflict(t *testing.T) {
-	s, gitmock, _, output, tmpDir := setupEditTest(t)
+	s, gitmock, _, _, tmpDir := setupEditTest(t)
 	ctx := context.Background()
 
 	// Create state file to simulate active edit session
@@ -1143,9 +1203,8 @@ func TestEditCommitDoneWithConflict(t *testing.T) {
 	// No REBASE_HEAD — initial edit stop, but rebase --continue will conflict
 	gitmock.ExpectEditDoneAmendWithConflict()
 
-	s.EditCommitDone(ctx, false)
-
-	require.Contains(t, output.String(), "Rebase conflict detected")
+	err = s.EditCommitDone(ctx, false)
+	require.ErrorIs(t, err, errRebaseConflict)
 
 	// State file should still exist (session not complete)
 	_, err = os.Stat(stateFile)
@@ -1203,8 +1262,8 @@ func TestEditCommitDoneConflictThenResolution(t *testing.T) {
 	// No REBASE_HEAD — at the initial edit stop
 	gitmock.ExpectEditDoneAmendWithConflict()
 
-	s.EditCommitDone(ctx, false)
-	require.Contains(t, output.String(), "Rebase conflict detected")
+	err = s.EditCommitDone(ctx, false)
+	require.ErrorIs(t, err, errRebaseConflict)
 	gitmock.ExpectationsMet()
 	output.Reset()
 
@@ -1297,3 +1356,599 @@ func TestStatusPullRequestsTextMode(t *testing.T) {
 	assert.Equal("https://github.com/testowner/testrepo/pull/1 : first PR", lines[1])
 	githubmock.ExpectationsMet()
 }
+
+func TestStatusPullRequestsOutputFormat(t *testing.T) {
+	s, _, githubmock, _, output := makeTestObjects(t, true)
+	assert := require.New(t)
+	ctx := context.Background()
+
+	s.config.Repo.GitHubHost = "github.com"
+	s.config.Repo.GitHubRepoOwner = "testowner"
+	s.config.Repo.GitHubRepoName = "testrepo"
+
+	// Empty stack is an empty list, not a message
+	s.OutputFormat = OutputFormatJSON
+	githubmock.ExpectGetInfo()
+	s.StatusPullRequests(ctx)
+	var status StackStatus
+	assert.NoError(json.Unmarshal(output.Bytes(), &status))
+	assert.Equal(StatusSchemaVersion, status.SchemaVersion)
+	assert.Equal("master", status.LocalBranch)
+	assert.Empty(status.PullRequests)
+	githubmock.ExpectationsMet()
+	output.Reset()
+
+	c1 := git.Commit{CommitID: "00000001", CommitHash: "c100000000000000000000000000000000000000", Subject: "first PR"}
+	c2 := git.Commit{CommitID: "00000002", CommitHash: "c200000000000000000000000000000000000000", Subject: "second PR"}
+	githubmock.Info.PullRequests = []*github.PullRequest{
+		{
+			Number:     1,
+			Title:      "first PR",
+			FromBranch: "spr/master/00000001",
+			ToBranch:   "master",
+			Commit:     c1,
+			Commits:    []git.Commit{c1},
+			MergeStatus: github.PullRequestMergeStatus{
+				ChecksPass:     github.CheckStatusPass,
+				ReviewApproved: true,
+				NoConflicts:    true,
+				Stacked:        true,
+			},
+		},
+		{
+			Number:          2,
+			Title:           "second PR",
+			FromBranch:      "spr/master/00000002",
+			ToBranch:        "spr/master/00000001",
+			Commit:          c2,
+			Commits:         []git.Commit{c1, c2},
+			LocalCommitHash: "d200000000000000000000000000000000000000",
+			InQueue:         true,
+			MergeStatus: github.PullRequestMergeStatus{
+				ChecksPass: github.CheckStatusPending,
+			},
+		},
+	}
+
+	githubmock.ExpectGetInfo()
+	s.StatusPullRequests(ctx)
+	status = StackStatus{}
+	assert.NoError(json.Unmarshal(output.Bytes(), &status))
+	assert.Len(status.PullRequests, 2)
+	// PRs are listed bottom of the stack first
+	assert.Equal(1, status.PullRequests[0].Number)
+	assert.Equal("https://github.com/testowner/testrepo/pull/1", status.PullRequests[0].URL)
+	assert.True(status.PullRequests[0].Mergeable)
+	assert.Empty(status.PullRequests[0].Warnings)
+	assert.Equal(2, status.PullRequests[1].Number)
+	assert.Equal("spr/master/00000001", status.PullRequests[1].ToBranch)
+	assert.Equal("00000002", status.PullRequests[1].CommitID)
+	assert.Equal("d200000000000000000000000000000000000000", status.PullRequests[1].LocalCommitHash)
+	assert.True(status.PullRequests[1].InQueue)
+	assert.False(status.PullRequests[1].Mergeable)
+	assert.Len(status.PullRequests[1].Commits, 2)
+	assert.Equal([]string{"pull request contains 2 commits"}, status.PullRequests[1].Warnings)
+	assert.Contains(output.String(), `"checksPass": "pending"`)
+	githubmock.ExpectationsMet()
+	output.Reset()
+
+	s.OutputFormat = OutputFormatYAML
+	githubmock.ExpectGetInfo()
+	s.StatusPullRequests(ctx)
+	assert.True(strings.HasPrefix(output.String(), "schemaVersion: 1\n"))
+	assert.Contains(output.String(), "    checksPass: pass\n")
+	assert.Contains(output.String(), "url: https://github.com/testowner/testrepo/pull/2\n")
+	githubmock.ExpectationsMet()
+}
+
+func TestSPRUpdateDryRun(t *testing.T) {
+	s, gitmock, githubmock, _, output := makeTestObjects(t, true)
+	assert := require.New(t)
+	ctx := context.Background()
+	s.DryRun = true
+
+	c1 := git.Commit{
+		CommitID:   "00000001",
+		CommitHash: "c100000000000000000000000000000000000000",
+		Subject:    "test commit 1",
+	}
+	c2 := git.Commit{
+		CommitID:   "00000002",
+		CommitHash: "c200000000000000000000000000000000000000",
+		Subject:    "test commit 2",
+	}
+	c3 := git.Commit{
+		CommitID:   "00000003",
+		CommitHash: "c300000000000000000000000000000000000000",
+		Subject:    "test commit 3",
+	}
+
+	// nothing to do on an empty stack
+	gitmock.ExpectWritable("")
+	githubmock.ExpectGetInfo()
+	gitmock.ExpectFetchOnly()
+	gitmock.ExpectLogAndRespond([]*git.Commit{})
+	s.UpdatePullRequests(ctx, nil, nil)
+	assert.Equal("nothing to update\n", output.String())
+	gitmock.ExpectationsMet()
+	githubmock.ExpectationsMet()
+	output.Reset()
+
+	// new stack : all branches are pushed and all pull requests are created
+	gitmock.ExpectWritable("")
+	githubmock.ExpectGetInfo()
+	gitmock.ExpectFetchOnly()
+	gitmock.ExpectLogAndRespond([]*git.Commit{&c2, &c1})
+	s.UpdatePullRequests(ctx, []string{mockclient.NobodyLogin}, nil)
+	assert.Equal(strings.Join([]string{
+		"push      spr/master/00000001 : c100000000000000000000000000000000000000",
+		"push      spr/master/00000002 : c200000000000000000000000000000000000000",
+		"create    test commit 1 : spr/master/00000001 -> master",
+		"reviewers test commit 1 : nobody",
+		"create    test commit 2 : spr/master/00000002 -> spr/master/00000001",
+		"reviewers test commit 2 : nobody",
+		"",
+	}, "\n"), output.String())
+	gitmock.ExpectationsMet()
+	githubmock.ExpectationsMet()
+	output.Reset()
+
+	// c1 amended, c2 deleted, c3 added on top of c1
+	githubmock.Info.PullRequests = []*github.PullRequest{
+		{Number: 1, Title: "test commit 1", Commit: c1, ToBranch: "master"},
+		{Number: 2, Title: "test commit 2", Commit: c2, ToBranch: "spr/master/00000001"},
+	}
+	c1.CommitHash = "c101000000000000000000000000000000000000"
+	gitmock.ExpectWritable("")
+	githubmock.ExpectGetInfo()
+	gitmock.ExpectFetchOnly()
+	gitmock.ExpectLogAndRespond([]*git.Commit{&c3, &c1})
+	s.UpdatePullRequests(ctx, nil, nil)
+	assert.Equal(strings.Join([]string{
+		"close     #2 : test commit 2 (commit has gone away)",
+		"push      spr/master/00000001 : c101000000000000000000000000000000000000",
+		"push      spr/master/00000003 : c300000000000000000000000000000000000000",
+		"create    test commit 3 : spr/master/00000003 -> spr/master/00000001",
+		"",
+	}, "\n"), output.String())
+	gitmock.ExpectationsMet()
+	githubmock.ExpectationsMet()
+	output.Reset()
+
+	// c1 and c2 reordered
+	githubmock.Info.PullRequests = []*github.PullRequest{
+		{Number: 1, Title: "test commit 1", Commit: c1, ToBranch: "master"},
+		{Number: 2, Title: "test commit 2", Commit: c2, ToBranch: "spr/master/00000001"},
+	}
+	gitmock.ExpectWritable("")
+	githubmock.ExpectGetInfo()
+	gitmock.ExpectFetchOnly()
+	gitmock.ExpectLogAndRespond([]*git.Commit{&c1, &c2})
+	s.UpdatePullRequests(ctx, nil, nil)
+	assert.Equal(strings.Join([]string{
+		"rebase    #1 : test commit 1 onto master (commits reordered)",
+		"rebase    #2 : test commit 2 onto master (commits reordered)",
+		"rebase    #2 : test commit 2 from spr/master/00000001 onto master",
+		"rebase    #1 : test commit 1 from master onto spr/master/00000002",
+		"",
+	}, "\n"), output.String())
+	gitmock.ExpectationsMet()
+	githubmock.ExpectationsMet()
+}
+
+func TestSPRMergeDryRun(t *testing.T) {
+	s, gitmock, githubmock, _, output := makeTestObjects(t, true)
+	assert := require.New(t)
+	ctx := context.Background()
+	s.DryRun = true
+	s.config.User.DeleteMergedBranches = true
+
+	ready := github.PullRequestMergeStatus{
+		ChecksPass:     github.CheckStatusPass,
+		ReviewApproved: true,
+		NoConflicts:    true,
+		Stacked:        true,
+	}
+	githubmock.Info.PullRequests = []*github.PullRequest{
+		{Number: 1, Title: "test commit 1", FromBranch: "spr/master/00000001", MergeStatus: ready},
+		{Number: 2, Title: "test commit 2", FromBranch: "spr/master/00000002", MergeStatus: ready},
+		{Number: 3, Title: "test commit 3", FromBranch: "spr/master/00000003", MergeStatus: github.PullRequestMergeStatus{
+			ChecksPass:  github.CheckStatusPass,
+			NoConflicts: true,
+			Stacked:     true,
+		}},
+	}
+
+	gitmock.ExpectWritable("")
+	githubmock.ExpectGetInfo()
+	s.MergePullRequests(ctx, nil)
+	assert.Equal(strings.Join([]string{
+		"merge     #2 : test commit 2 (rebase into master)",
+		"close     #1 : test commit 1 (commit merged in pull request #2)",
+		"delete    spr/master/00000002",
+		"delete    spr/master/00000001",
+		"stop at   #3 : test commit 3 (pull request is not approved)",
+		"",
+	}, "\n"), output.String())
+	assert.False(githubmock.Info.PullRequests[0].Merged)
+	gitmock.ExpectationsMet()
+	githubmock.ExpectationsMet()
+}
+
+func TestSPRExplainPullRequest(t *testing.T) {
+	s, gitmock, githubmock, _, output := makeTestObjects(t, true)
+	assert := require.New(t)
+	ctx := context.Background()
+	s.config.Repo.RequiredChecks = []string{"build", "lint"}
+
+	githubmock.Info.PullRequests = []*github.PullRequest{
+		{Number: 7, Title: "test commit 1", MergeStatus: github.PullRequestMergeStatus{
+			ChecksPass:       github.CheckStatusFail,
+			ChangesRequested: true,
+			NoConflicts:      false,
+			Stacked:          false,
+		}, Checks: []github.Check{
+			{Name: "build", Status: github.CheckStatusFail},
+			{Name: "lint", Status: github.CheckStatusPending},
+		}},
+		{Number: 8, Title: "test commit 2", MergeStatus: github.PullRequestMergeStatus{
+			ChecksPass:     github.CheckStatusPass,
+			ReviewApproved: true,
+			NoConflicts:    true,
+			Stacked:        false,
+		}},
+	}
+
+	githubmock.ExpectGetInfo()
+	s.ExplainPullRequest(ctx, "#7")
+	lines := strings.Split(output.String(), "\n")
+	assert.Equal([]string{
+		"  conflicts  : pull request has merge conflicts",
+		`  checks     : required check "build" failed`,
+		`  checks     : required check "lint" is pending`,
+		"  approval   : changes requested by a reviewer",
+		"",
+	}, lines[1:])
+	output.Reset()
+
+	// position 2 from the bottom of the stack
+	githubmock.ExpectGetInfo()
+	s.ExplainPullRequest(ctx, "2")
+	lines = strings.Split(output.String(), "\n")
+	assert.Equal([]string{
+		"  stack      : pull request #7 lower in the stack is not ready to merge",
+		"",
+	}, lines[1:])
+
+	gitmock.ExpectationsMet()
+	githubmock.ExpectationsMet()
+}
+
+func TestSelectPullRequest(t *testing.T) {
+	prs := []*github.PullRequest{{Number: 2}, {Number: 10}, {Number: 11}}
+	tests := []struct {
+		selector string
+		index    int
+		err      bool
+	}{
+		{selector: "10", index: 1},
+		{selector: "#11", index: 2},
+		{selector: "2", index: 0},
+		{selector: "3", index: 2},
+		{selector: "#3", err: true},
+		{selector: "4", err: true},
+		{selector: "abc", err: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.selector, func(t *testing.T) {
+			index, err := selectPullRequest(prs, tc.selector)
+			if tc.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.index, index)
+		})
+	}
+}
+
+func TestSPRStackSelection(t *testing.T) {
+	s, gitmock, githubmock, _, output := makeTestObjects(t, true)
+	assert := require.New(t)
+	ctx := context.Background()
+
+	c1 := git.Commit{
+		CommitID:   "00000001",
+		CommitHash: "c100000000000000000000000000000000000000",
+		Subject:    "test commit 1",
+	}
+
+	// selecting the checked out branch is the same as no selection
+	gitmock.ExpectVerifyBranch("master")
+	gitmock.ExpectLocalBranch("* master")
+	assert.NoError(s.SelectStack("master"))
+	assert.Equal("", s.config.Stack)
+
+	gitmock.ExpectVerifyBranch("feature")
+	gitmock.ExpectLocalBranch("* master")
+	assert.NoError(s.SelectStack("feature"))
+	assert.Equal("feature", s.config.Stack)
+
+	// a stack which is not checked out is updated without rebasing
+	gitmock.ExpectWritable("feature")
+	gitmock.ExpectRevParse("feature", "h0")
+	gitmock.ExpectFetchOnly()
+	githubmock.ExpectGetInfo()
+	gitmock.ExpectBranchLogAndRespond("feature", []*git.Commit{&c1})
+	gitmock.ExpectPushCommits([]*git.Commit{&c1})
+	githubmock.ExpectCreatePullRequest(c1, nil)
+	githubmock.ExpectGetAssignableUsers()
+	githubmock.ExpectAddReviewers([]string{mockclient.NobodyUserID})
+	githubmock.ExpectUpdatePullRequest(c1, nil)
+	githubmock.ExpectGetInfo()
+	s.UpdatePullRequests(ctx, []string{mockclient.NobodyLogin}, nil)
+	assert.Contains(output.String(), "test commit 1")
+
+	gitmock.ExpectationsMet()
+	githubmock.ExpectationsMet()
+}
+
+func TestSPRListStacks(t *testing.T) {
+	s, gitmock, githubmock, _, output := makeTestObjects(t, true)
+	assert := require.New(t)
+	ctx := context.Background()
+
+	c1 := git.Commit{
+		CommitID:   "00000001",
+		CommitHash: "c100000000000000000000000000000000000000",
+		Subject:    "test commit 1",
+	}
+	c2 := git.Commit{
+		CommitID:   "00000002",
+		CommitHash: "c200000000000000000000000000000000000000",
+		Subject:    "test commit 2",
+	}
+	githubmock.Info.PullRequests = []*github.PullRequest{
+		{Number: 1, Title: "test commit 1", Commit: c1},
+	}
+
+	gitmock.ExpectLocalBranch("* feature-a")
+	gitmock.ExpectLocalBranches("feature-a", "feature-b", "master", "empty", "spr/master/00000001")
+	gitmock.ExpectUpstream("feature-a", "origin/master")
+	gitmock.ExpectBranchLogAndRespond("feature-a", []*git.Commit{&c1})
+	githubmock.ExpectGetInfo()
+	gitmock.ExpectUpstream("feature-b", "origin/release/2026.10")
+	gitmock.ExpectTargetLogAndRespond("release/2026.10", "feature-b", []*git.Commit{&c1, &c2})
+	githubmock.ExpectGetInfo()
+	gitmock.ExpectUpstream("master", "origin/master")
+	gitmock.ExpectBranchLogAndRespond("master", nil)
+	gitmock.ExpectUpstream("empty", "")
+	gitmock.ExpectBranchLogAndRespond("empty", nil)
+	s.ListStacks(ctx)
+
+	lines := strings.Split(output.String(), "\n")
+	assert.Equal("* feature-a -> master : 1 commits, 1 pull requests", lines[0])
+	assert.Equal("  feature-b -> release/2026.10 : 2 commits, 1 pull requests", lines[2])
+	assert.Len(lines, 5)
+	assert.Equal("", s.config.Stack)
+	assert.Equal("master", s.config.Repo.GitHubBranch)
+
+	gitmock.ExpectationsMet()
+	githubmock.ExpectationsMet()
+}
+
+func TestSPRListAllStacks(t *testing.T) {
+	s, gitmock, githubmock, _, output := makeTestObjects(t, true)
+	assert := require.New(t)
+	ctx := context.Background()
+	s.AllStacks = true
+	s.config.Repo.GitHubHost = "github.com"
+	s.config.Repo.GitHubRepoOwner = "ejoffe"
+	s.config.Repo.GitHubRepoName = "spr"
+
+	c1 := git.Commit{
+		CommitID:   "00000001",
+		CommitHash: "c100000000000000000000000000000000000000",
+		Subject:    "test commit 1",
+	}
+	githubmock.Info.PullRequests = []*github.PullRequest{
+		{Number: 1, Title: "test commit 1", Commit: c1},
+	}
+	githubmock.PullRequests = []*github.PullRequest{
+		{Number: 1, Title: "test commit 1", Author: mockclient.NobodyLogin,
+			FromBranch: "spr/master/00000001", ToBranch: "master"},
+		{Number: 2, Title: "their commit 1", Author: "hubot",
+			FromBranch: "spr/master/000000a1", ToBranch: "master"},
+		{Number: 3, Title: "their commit 2", Author: "hubot",
+			FromBranch: "spr/master/000000a2", ToBranch: "spr/master/000000a1"},
+	}
+
+	gitmock.ExpectLocalBranch("* feature-a")
+	gitmock.ExpectLocalBranches("feature-a")
+	gitmock.ExpectUpstream("feature-a", "origin/master")
+	gitmock.ExpectBranchLogAndRespond("feature-a", []*git.Commit{&c1})
+	githubmock.ExpectGetInfo()
+	githubmock.ExpectGetPullRequests()
+	s.ListStacks(ctx)
+
+	assert.Equal(strings.Join([]string{
+		"* feature-a -> master : 1 commits, 1 pull requests",
+		"    [?xxx]   1 : test commit 1",
+		"  spr/master/000000a2 -> master : 2 pull requests by hubot",
+		"    https://github.com/ejoffe/spr/pull/3 : their commit 2",
+		"    https://github.com/ejoffe/spr/pull/2 : their commit 1",
+		"",
+	}, "\n"), output.String())
+
+	gitmock.ExpectationsMet()
+	githubmock.ExpectationsMet()
+}
+
+func TestSPRSelectTarget(t *testing.T) {
+	s, gitmock, githubmock, _, output := makeTestObjects(t, true)
+	assert := require.New(t)
+	ctx := context.Background()
+
+	c1 := git.Commit{
+		CommitID:   "00000001",
+		CommitHash: "c100000000000000000000000000000000000000",
+		Subject:    "test commit 1",
+	}
+
+	// no upstream : use the configured target branch
+	gitmock.ExpectLocalBranch("* feature")
+	gitmock.ExpectUpstream("feature", "")
+	assert.NoError(s.SelectTarget(""))
+	assert.Equal("master", s.config.Repo.GitHubBranch)
+
+	// upstream on another remote : use the configured target branch
+	gitmock.ExpectLocalBranch("* feature")
+	gitmock.ExpectUpstream("feature", "fork/develop")
+	assert.NoError(s.SelectTarget(""))
+	assert.Equal("master", s.config.Repo.GitHubBranch)
+
+	var notices bytes.Buffer
+	s.notices = &notices
+	gitmock.ExpectLocalBranch("* feature")
+	gitmock.ExpectUpstream("feature", "origin/team/payments")
+	assert.NoError(s.SelectTarget(""))
+	assert.Equal("team/payments", s.config.Repo.GitHubBranch)
+	assert.Equal("targeting team/payments, the upstream branch of the stack\n", notices.String())
+
+	// a branch pushed with git push -u tracks a branch of its own name
+	notices.Reset()
+	gitmock.ExpectLocalBranch("* feature")
+	gitmock.ExpectUpstream("feature", "origin/feature")
+	assert.NoError(s.SelectTarget(""))
+	assert.Equal("master", s.config.Repo.GitHubBranch)
+	assert.Empty(notices.String())
+
+	// unless that branch is a configured integration branch
+	s.config.Repo.TargetBranches = []string{"develop"}
+	gitmock.ExpectLocalBranch("* develop")
+	gitmock.ExpectUpstream("develop", "origin/develop")
+	assert.NoError(s.SelectTarget(""))
+	assert.Equal("develop", s.config.Repo.GitHubBranch)
+
+	assert.NoError(s.SelectTarget("release/2026.10"))
+	assert.Equal("release/2026.10", s.config.Repo.GitHubBranch)
+
+	// pull request branches embed the target branch including its slashes
+	s.DryRun = true
+	gitmock.ExpectWritable("")
+	gitmock.ExpectFetchOnly()
+	githubmock.ExpectGetInfo()
+	gitmock.ExpectTargetLogAndRespond("release/2026.10", "HEAD", []*git.Commit{&c1})
+	s.UpdatePullRequests(ctx, nil, nil)
+	assert.Equal(strings.Join([]string{
+		"push      spr/release/2026.10/00000001 : c100000000000000000000000000000000000000",
+		"create    test commit 1 : spr/release/2026.10/00000001 -> release/2026.10",
+		"",
+	}, "\n"), output.String())
+
+	gitmock.ExpectationsMet()
+	githubmock.ExpectationsMet()
+}
+
+func TestReadKey(t *testing.T) {
+	keys := bufio.NewReader(strings.NewReader("k\033[A\033[1;2B\033OB\003\033"))
+	for _, expected := range []string{"k", keyUp, keyShiftDown, keyDown, keyCtrlC, keyEscape} {
+		key, err := readKey(keys)
+		require.NoError(t, err)
+		require.Equal(t, expected, key)
+	}
+	_, err := readKey(keys)
+	require.Error(t, err)
+}
+
+func TestParseReorderTodo(t *testing.T) {
+	commits := []git.Commit{
+		{CommitID: "00000001", CommitHash: "c100000000000000000000000000000000000000", Subject: "test commit 1"},
+		{CommitID: "00000002", CommitHash: "c200000000000000000000000000000000000000", Subject: "test commit 2"},
+		{CommitID: "00000003", CommitHash: "c300000000000000000000000000000000000000", Subject: "test commit 3"},
+	}
+	steps, err := parseReorderTodo(commits, "pick c3000000 test commit 3\n\n# comment\nf c1000000 test commit 1\n")
+	require.NoError(t, err)
+	require.Equal(t, []rebaseStep{
+		{action: "pick", commit: commits[2]},
+		{action: "fixup", commit: commits[0]},
+		{action: "drop", commit: commits[1]},
+	}, steps)
+
+	steps, err = parseReorderTodo(commits, "# pick c1000000 test commit 1\n")
+	require.NoError(t, err)
+	require.Nil(t, steps)
+
+	for _, todo := range []string{
+		"squash c1000000 test commit 1",
+		"pick c4000000 test commit 4",
+		"pick c1000000\npick c1000000",
+		"drop c1000000\nfixup c2000000",
+		"pick",
+	} {
+		_, err = parseReorderTodo(commits, todo)
+		require.Equal(t, errs.Validation, errs.KindOf(err), todo)
+	}
+}
+
+func TestAuditLogTrim(t *testing.T) {
+	s, _, _, _, _ := makeTestObjects(t, true)
+	writeLog := func(count int, size int) {
+		var data []byte
+		for i := 0; i < count; i++ {
+			line, err := json.Marshal(&auditEntry{Command: fmt.Sprintf("update %d", i), Calls: []string{strings.Repeat("x", size)}})
+			require.NoError(t, err)
+			data = append(append(data, line...), '\n')
+		}
+		require.NoError(t, os.MkdirAll(filepath.Dir(s.auditLogPath()), 0755))
+		require.NoError(t, os.WriteFile(s.auditLogPath(), data, 0644))
+	}
+
+	// the log is left alone until it passes maxAuditLogSize
+	writeLog(maxAuditEntries+100, 10)
+	require.NoError(t, s.appendAuditEntry(&auditEntry{Command: "merge"}))
+	entries, err := s.readAuditLog()
+	require.NoError(t, err)
+	require.Len(t, entries, maxAuditEntries+101)
+
+	// once it does the oldest entries past maxAuditEntries are dropped
+	writeLog(2800, 1500)
+	require.NoError(t, s.appendAuditEntry(&auditEntry{Command: "merge"}))
+	entries, err = s.readAuditLog()
+	require.NoError(t, err)
+	require.Len(t, entries, maxAuditEntries)
+	require.Equal(t, "update 1801", entries[0].Command)
+	require.Equal(t, "merge", entries[len(entries)-1].Command)
+
+	// and larger ones until it fits in half of maxAuditLogSize
+	writeLog(100, maxAuditLogSize/50)
+	require.NoError(t, s.appendAuditEntry(&auditEntry{Command: "merge"}))
+	info, err := os.Stat(s.auditLogPath())
+	require.NoError(t, err)
+	require.LessOrEqual(t, info.Size(), int64(maxAuditLogSize/2))
+	entries, err = s.readAuditLog()
+	require.NoError(t, err)
+	require.Less(t, len(entries), 100)
+	require.Equal(t, "merge", entries[len(entries)-1].Command)
+	for _, suffix := range []string{".tmp", ".lock"} {
+		_, err = os.Stat(s.auditLogPath() + suffix)
+		require.True(t, os.IsNotExist(err), suffix)
+	}
+}
+
+func TestAuditLogStaleLock(t *testing.T) {
+	s, _, _, _, _ := makeTestObjects(t, true)
+	lockPath := s.auditLogPath() + ".lock"
+	require.NoError(t, os.MkdirAll(filepath.Dir(lockPath), 0755))
+	require.NoError(t, os.WriteFile(lockPath, nil, 0644))
+	stale := time.Now().Add(-2 * auditLockTimeout)
+	require.NoError(t, os.Chtimes(lockPath, stale, stale))
+
+	// a lock left behind by a spr that died doesn't block the log
+	require.NoError(t, s.appendAuditEntry(&auditEntry{Command: "update"}))
+	entries, err := s.readAuditLog()
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	_, err = os.Stat(lockPath)
+	require.True(t, os.IsNotExist(err))
+}
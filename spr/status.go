@@ -0,0 +1,140 @@
+package spr
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/ejoffe/spr/config"
+	"github.com/ejoffe/spr/github"
+	"github.com/ejoffe/spr/pretty"
+	"gopkg.in/yaml.v3"
+)
+
+// StatusSchemaVersion is the version of the machine readable status output.
+//
+//	It is incremented whenever a field is removed or changes its meaning,
+//	new fields can be added without changing the version.
+const StatusSchemaVersion = 1
+
+const (
+	// OutputFormatJSON emits the stack status as json
+	OutputFormatJSON = "json"
+
+	// OutputFormatYAML emits the stack status as yaml
+	OutputFormatYAML = "yaml"
+)
+
+// StackStatus is the machine readable status of a stack of pull requests.
+//
+//	Pull requests are ordered with the bottom of the stack first.
+type StackStatus struct {
+	SchemaVersion int                 `json:"schemaVersion" yaml:"schemaVersion"`
+	LocalBranch   string              `json:"localBranch" yaml:"localBranch"`
+	TargetBranch  string              `json:"targetBranch" yaml:"targetBranch"`
+	PullRequests  []PullRequestStatus `json:"pullRequests" yaml:"pullRequests"`
+}
+
+// PullRequestStatus is the machine readable status of a single pull request
+type PullRequestStatus struct {
+	Number          int          `json:"number" yaml:"number"`
+	URL             string       `json:"url" yaml:"url"`
+	Title           string       `json:"title" yaml:"title"`
+	FromBranch      string       `json:"fromBranch" yaml:"fromBranch"`
+	ToBranch        string       `json:"toBranch" yaml:"toBranch"`
+	CommitID        string       `json:"commitID" yaml:"commitID"`
+	CommitHash      string       `json:"commitHash" yaml:"commitHash"`
+	LocalCommitHash string       `json:"localCommitHash" yaml:"localCommitHash"`
+	MergeStatus     MergeStatus  `json:"mergeStatus" yaml:"mergeStatus"`
+	Mergeable       bool         `json:"mergeable" yaml:"mergeable"`
+	InQueue         bool         `json:"inQueue" yaml:"inQueue"`
+	Merged          bool         `json:"merged" yaml:"merged"`
+	Commits         []CommitInfo `json:"commits" yaml:"commits"`
+	Warnings        []string     `json:"warnings" yaml:"warnings"`
+}
+
+// MergeStatus mirrors the merge status bits of a pull request
+type MergeStatus struct {
+	ChecksPass       github.CheckStatus `json:"checksPass" yaml:"checksPass"`
+	ReviewApproved   bool               `json:"reviewApproved" yaml:"reviewApproved"`
+	ChangesRequested bool               `json:"changesRequested" yaml:"changesRequested"`
+	NoConflicts      bool               `json:"noConflicts" yaml:"noConflicts"`
+	Stacked          bool               `json:"stacked" yaml:"stacked"`
+}
+
+// CommitInfo is a commit which is part of a pull request
+type CommitInfo struct {
+	CommitID   string `json:"commitID" yaml:"commitID"`
+	CommitHash string `json:"commitHash" yaml:"commitHash"`
+	Subject    string `json:"subject" yaml:"subject"`
+}
+
+func newStackStatus(cfg *config.Config, stack *Stack) *StackStatus {
+	status := &StackStatus{
+		SchemaVersion: StatusSchemaVersion,
+		LocalBranch:   stack.LocalBranch,
+		TargetBranch:  stack.TargetBranch,
+		PullRequests:  []PullRequestStatus{},
+	}
+	for _, pr := range stack.PullRequests {
+		status.PullRequests = append(status.PullRequests, newPullRequestStatus(cfg, pr))
+	}
+	return status
+}
+
+func newPullRequestStatus(cfg *config.Config, pr *github.PullRequest) PullRequestStatus {
+	status := PullRequestStatus{
+		Number:          pr.Number,
+		URL:             pr.URL(cfg),
+		Title:           pr.Title,
+		FromBranch:      pr.FromBranch,
+		ToBranch:        pr.ToBranch,
+		CommitID:        pr.Commit.CommitID,
+		CommitHash:      pr.Commit.CommitHash,
+		LocalCommitHash: pr.LocalCommitHash,
+		MergeStatus: MergeStatus{
+			ChecksPass:       pr.MergeStatus.ChecksPass,
+			ReviewApproved:   pr.MergeStatus.ReviewApproved,
+			ChangesRequested: pr.MergeStatus.ChangesRequested,
+			NoConflicts:      pr.MergeStatus.NoConflicts,
+			Stacked:          pr.MergeStatus.Stacked,
+		},
+		Mergeable: pr.Mergeable(cfg),
+		InQueue:   pr.InQueue,
+		Merged:    pr.Merged,
+		Commits:   []CommitInfo{},
+		Warnings:  []string{},
+	}
+	for _, c := range pr.Commits {
+		status.Commits = append(status.Commits, CommitInfo{
+			CommitID:   c.CommitID,
+			CommitHash: c.CommitHash,
+			Subject:    c.Subject,
+		})
+	}
+	if len(pr.Commits) > 1 {
+		status.Warnings = append(status.Warnings,
+			fmt.Sprintf("pull request contains %d commits", len(pr.Commits)))
+	}
+	return status
+}
+
+// writeStackStatus writes the stack status in the given machine readable format
+func writeStackStatus(writer io.Writer, format string, status *StackStatus) error {
+	switch format {
+	case OutputFormatJSON:
+		pretty.PrettyWriter(status, writer)
+		_, err := fmt.Fprintln(writer)
+		return err
+	case OutputFormatYAML:
+		encoder := yaml.NewEncoder(writer)
+		encoder.SetIndent(2)
+		err := encoder.Encode(status)
+		if err != nil {
+			return err
+		}
+		return encoder.Close()
+	default:
+		return fmt.Errorf("unknown output format %q, choose from %q or %q",
+			format, OutputFormatJSON, OutputFormatYAML)
+	}
+}
@@ -0,0 +1,441 @@
+package spr
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/ejoffe/spr/errs"
+	"github.com/ejoffe/spr/git"
+	"github.com/ejoffe/spr/github"
+	"golang.org/x/term"
+)
+
+const (
+	// Terminal escape codes of the full screen interface
+	enterAltScreen = "\033[?1049h\033[?25l"
+	exitAltScreen  = "\033[?25h\033[?1049l"
+	clearScreen    = "\033[H\033[2J"
+	reverseVideo   = "\033[7m"
+	resetVideo     = "\033[0m"
+
+	// Names of the keys read as escape sequences or control characters
+	keyUp        = "up"
+	keyDown      = "down"
+	keyShiftUp   = "shift-up"
+	keyShiftDown = "shift-down"
+	keyEscape    = "esc"
+	keyCtrlC     = "ctrl-c"
+)
+
+const uiHelp = "" +
+	"↑/↓ select  shift+↑/↓ move  s squash  x split  d drop  w wip\n" +
+	"a amend  e edit  o open  u update  m merge  r refresh  q quit"
+
+// stackUI is the state of the full screen interface of spr ui
+type stackUI struct {
+	sd *stackediff
+
+	// commits are the local commits of the stack, bottom first, and
+	//  pullRequests their pull requests by commit-id
+	commits      []git.Commit
+	pullRequests map[string]*github.PullRequest
+	branch       string
+
+	// cursor is the index of the selected commit
+	cursor int
+
+	// message is the output or error of the last operation
+	message string
+
+	// confirm is an operation run once the prompt is answered with y
+	confirm       func(ctx context.Context) error
+	confirmPrompt string
+
+	// done ends the interface, exitMessage is printed once the screen is closed
+	done        bool
+	exitMessage string
+
+	openURL func(url string) error
+}
+
+func newStackUI(sd *stackediff) *stackUI {
+	return &stackUI{
+		sd:           sd,
+		pullRequests: map[string]*github.PullRequest{},
+		openURL:      openBrowser,
+	}
+}
+
+// RunUI runs a full screen interface to the stack of the checked out branch.
+//
+//	A commit is selected with the arrow keys and reordered, squashed, split,
+//	dropped, marked work in progress, amended or edited with a key press,
+//	using the same operations as the commands. The stack can be updated and
+//	merged and the pull request of a commit opened in the browser.
+func (sd *stackediff) RunUI(ctx context.Context) error {
+	stdin, ok := sd.input.(*os.File)
+	if !ok || !term.IsTerminal(int(stdin.Fd())) {
+		return errs.New(errs.Validation, "spr ui needs an interactive terminal")
+	}
+	ui := newStackUI(sd)
+	err := ui.reload(ctx, true)
+	if err != nil {
+		return err
+	}
+
+	state, err := term.MakeRaw(int(stdin.Fd()))
+	if err != nil {
+		return err
+	}
+	screen := sd.output
+	fmt.Fprint(screen, enterAltScreen)
+	defer func() {
+		fmt.Fprint(screen, exitAltScreen)
+		term.Restore(int(stdin.Fd()), state)
+		fmt.Fprint(screen, ui.exitMessage)
+	}()
+
+	keys := bufio.NewReader(stdin)
+	for !ui.done {
+		ui.render(screen)
+		key, err := readKey(keys)
+		if err != nil {
+			return err
+		}
+		ui.handleKey(ctx, key)
+	}
+	return nil
+}
+
+// readKey reads a key press, arrow keys are read as their escape sequence
+func readKey(r *bufio.Reader) (string, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	switch b {
+	case 3:
+		return keyCtrlC, nil
+	case '\033':
+	default:
+		return string(b), nil
+	}
+	// the bytes of a sequence arrive together, an escape on its own was typed
+	if r.Buffered() == 0 {
+		return keyEscape, nil
+	}
+	seq := make([]byte, 0, 8)
+	for r.Buffered() > 0 {
+		b, err := r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		seq = append(seq, b)
+		// the sequence ends with a letter or tilde after its [ or O
+		if len(seq) > 1 && (b >= 'A' && b <= 'Z' || b == '~') {
+			break
+		}
+	}
+	switch string(seq) {
+	case "[A", "OA":
+		return keyUp, nil
+	case "[B", "OB":
+		return keyDown, nil
+	case "[1;2A":
+		return keyShiftUp, nil
+	case "[1;2B":
+		return keyShiftDown, nil
+	}
+	return keyEscape, nil
+}
+
+// reload reads the local commits of the stack, and their pull requests
+//
+//	when pullRequests is set. Local rewrites don't change the pull requests.
+func (ui *stackUI) reload(ctx context.Context, pullRequests bool) error {
+	commits, err := git.GetLocalCommitStack(ctx, ui.sd.config, ui.sd.gitcmd)
+	if err != nil {
+		return err
+	}
+	ui.commits = commits
+	if pullRequests {
+		info, err := ui.sd.github.GetInfo(ctx, ui.sd.gitcmd)
+		if err != nil {
+			return err
+		}
+		ui.branch = info.LocalBranch
+		ui.pullRequests = map[string]*github.PullRequest{}
+		for _, pr := range info.PullRequests {
+			ui.pullRequests[pr.Commit.CommitID] = pr
+		}
+	}
+	if ui.cursor >= len(ui.commits) {
+		ui.cursor = len(ui.commits) - 1
+	}
+	if ui.cursor < 0 {
+		ui.cursor = 0
+	}
+	return nil
+}
+
+func (ui *stackUI) render(w io.Writer) {
+	cfg := ui.sd.config
+	var b strings.Builder
+	b.WriteString(clearScreen)
+	fmt.Fprintf(&b, "spr ui : %s -> %s\n\n", ui.branch, cfg.Repo.GitHubBranch)
+	if len(ui.commits) == 0 {
+		b.WriteString("  no commits on the stack\n")
+	}
+	for i := len(ui.commits) - 1; i >= 0; i-- {
+		if i == ui.cursor {
+			fmt.Fprintf(&b, "> %s%s%s\n", reverseVideo, ui.commitLine(i), resetVideo)
+		} else {
+			fmt.Fprintf(&b, "  %s\n", ui.commitLine(i))
+		}
+	}
+	fmt.Fprintf(&b, "\n%s\n", uiHelp)
+	if ui.message != "" {
+		fmt.Fprintf(&b, "\n%s\n", ui.message)
+	}
+	if ui.confirm != nil {
+		fmt.Fprintf(&b, "\n%s (y/n) ", ui.confirmPrompt)
+	}
+	// the terminal doesn't return the carriage at a new line in raw mode
+	fmt.Fprint(w, strings.ReplaceAll(b.String(), "\n", "\r\n"))
+}
+
+// commitLine is the line of the commit at index: its hash, pull request
+//
+//	number, subject and the merge status bits of its pull request.
+func (ui *stackUI) commitLine(index int) string {
+	c := ui.commits[index]
+	pr := ui.pullRequests[c.CommitID]
+	if pr == nil {
+		return fmt.Sprintf("%s %-5s %s", shortHash(c.CommitHash), "-", c.Subject)
+	}
+	return fmt.Sprintf("%s %-5s %s  %s", shortHash(c.CommitHash),
+		fmt.Sprintf("#%d", pr.Number), c.Subject, pr.StatusString(ui.sd.config))
+}
+
+func (ui *stackUI) handleKey(ctx context.Context, key string) {
+	if ui.confirm != nil {
+		confirm := ui.confirm
+		ui.confirm = nil
+		if key == "y" {
+			ui.run(func() error { return confirm(ctx) })
+		} else {
+			ui.message = "cancelled"
+		}
+		return
+	}
+
+	switch key {
+	case "q", keyEscape, keyCtrlC:
+		ui.done = true
+	case "k", keyUp:
+		if ui.cursor < len(ui.commits)-1 {
+			ui.cursor++
+		}
+	case "j", keyDown:
+		if ui.cursor > 0 {
+			ui.cursor--
+		}
+	case "K", keyShiftUp:
+		ui.move(ctx, ui.cursor+1)
+	case "J", keyShiftDown:
+		ui.move(ctx, ui.cursor-1)
+	case "s":
+		ui.rewrite(ctx, func(commits []git.Commit, index int) error {
+			err := ui.sd.squashCommit(ctx, commits, index)
+			if err == nil {
+				ui.cursor--
+			}
+			return err
+		})
+	case "x":
+		ui.split(ctx)
+	case "d":
+		if c, ok := ui.selected(); ok {
+			ui.confirmPrompt = fmt.Sprintf("drop commit %q?", c.Subject)
+			ui.confirm = func(ctx context.Context) error {
+				err := ui.sd.dropCommit(ctx, ui.commits, ui.cursor)
+				if err != nil {
+					return err
+				}
+				return ui.reload(ctx, false)
+			}
+		}
+	case "w":
+		ui.rewrite(ctx, func(commits []git.Commit, index int) error {
+			return ui.sd.toggleWIP(ctx, commits, index)
+		})
+	case "a":
+		ui.amend(ctx)
+	case "e":
+		ui.edit(ctx)
+	case "o":
+		ui.open()
+	case "u":
+		ui.run(func() error {
+			err := ui.sd.UpdatePullRequests(ctx, nil, nil)
+			if err != nil {
+				return err
+			}
+			return ui.reload(ctx, true)
+		})
+	case "m":
+		ui.confirmPrompt = "merge the stack?"
+		ui.confirm = func(ctx context.Context) error {
+			err := ui.sd.MergePullRequests(ctx, nil)
+			if err != nil {
+				return err
+			}
+			return ui.reload(ctx, true)
+		}
+	case "r":
+		ui.run(func() error { return ui.reload(ctx, true) })
+	}
+}
+
+// selected returns the commit under the cursor, false when the stack is empty
+func (ui *stackUI) selected() (git.Commit, bool) {
+	if len(ui.commits) == 0 {
+		return git.Commit{}, false
+	}
+	return ui.commits[ui.cursor], true
+}
+
+// run runs an operation with its output captured as the message
+func (ui *stackUI) run(fn func() error) {
+	screen := ui.sd.output
+	var output bytes.Buffer
+	ui.sd.output = &output
+	err := fn()
+	ui.sd.output = screen
+
+	ui.message = strings.TrimSpace(output.String())
+	if err != nil {
+		if ui.message != "" {
+			ui.message += "\n"
+		}
+		ui.message += "error: " + err.Error()
+	}
+}
+
+// rewrite runs an operation rewriting the selected commit of the stack and
+//
+//	reads the rewritten commits.
+func (ui *stackUI) rewrite(ctx context.Context, fn func(commits []git.Commit, index int) error) {
+	if _, ok := ui.selected(); !ok {
+		return
+	}
+	ui.run(func() error {
+		err := fn(ui.commits, ui.cursor)
+		if err != nil {
+			return err
+		}
+		return ui.reload(ctx, false)
+	})
+}
+
+// move moves the selected commit to index, the cursor follows it
+func (ui *stackUI) move(ctx context.Context, index int) {
+	if index < 0 || index >= len(ui.commits) {
+		return
+	}
+	ui.rewrite(ctx, func(commits []git.Commit, from int) error {
+		err := ui.sd.moveCommit(ctx, commits, from, index)
+		if err == nil {
+			ui.cursor = index
+		}
+		return err
+	})
+}
+
+// amend folds the staged changes into the selected commit
+func (ui *stackUI) amend(ctx context.Context) {
+	ui.rewrite(ctx, func(commits []git.Commit, index int) error {
+		staged, err := ui.sd.hasStagedChanges(ctx)
+		if err != nil {
+			return err
+		}
+		if !staged {
+			return errs.New(errs.Validation, "no staged changes, stage the changes to amend with git add")
+		}
+		return ui.sd.amendCommit(ctx, commits, index)
+	})
+}
+
+// edit starts an edit session on the selected commit and closes the
+//
+//	interface, the changes are made outside of it.
+func (ui *stackUI) edit(ctx context.Context) {
+	if _, ok := ui.selected(); !ok {
+		return
+	}
+	if ui.sd.isEditing() || ui.sd.isSplitting() {
+		ui.message = "error: already editing a commit, finish with git spr edit --done or git spr split --done"
+		return
+	}
+	ui.run(func() error {
+		return ui.sd.editCommit(ctx, ui.commits, ui.cursor)
+	})
+	if ui.sd.isEditing() {
+		ui.done = true
+		ui.exitMessage = ui.message + "\n"
+	}
+}
+
+// split starts a split session on the selected commit and closes the
+//
+//	interface, the commit is split with git spr split in the terminal.
+func (ui *stackUI) split(ctx context.Context) {
+	if _, ok := ui.selected(); !ok {
+		return
+	}
+	ui.run(func() error {
+		return ui.sd.splitCommit(ctx, ui.commits, ui.cursor)
+	})
+	if ui.sd.isSplitting() {
+		ui.done = true
+		ui.exitMessage = ui.message + "\n"
+	}
+}
+
+// open opens the pull request of the selected commit in the browser
+func (ui *stackUI) open() {
+	c, ok := ui.selected()
+	if !ok {
+		return
+	}
+	pr := ui.pullRequests[c.CommitID]
+	if pr == nil {
+		ui.message = "the commit has no pull request yet, run update to create it"
+		return
+	}
+	err := ui.openURL(pr.URL(ui.sd.config))
+	if err != nil {
+		ui.message = "error: " + err.Error()
+	}
+}
+
+// openBrowser opens url with the default browser of the platform
+func openBrowser(url string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+	return cmd.Start()
+}